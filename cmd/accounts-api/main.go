@@ -11,9 +11,15 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/tribal/bank-api/internal/audit"
+	"github.com/tribal/bank-api/internal/auth"
 	"github.com/tribal/bank-api/internal/handlers"
+	"github.com/tribal/bank-api/internal/importer"
+	"github.com/tribal/bank-api/internal/middleware"
+	"github.com/tribal/bank-api/internal/migrate"
 	"github.com/tribal/bank-api/internal/repository"
 	"github.com/tribal/bank-api/internal/service"
+	"github.com/tribal/bank-api/internal/tier"
 	"github.com/tribal/bank-api/pkg/telemetry"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
@@ -26,6 +32,39 @@ const (
 func main() {
 	ctx := context.Background()
 
+	// Get database path from environment or use default
+	dbPath := os.Getenv("DB_PATH")
+	if dbPath == "" {
+		dbPath = "./data/bank.db"
+	}
+
+	// `accounts-api migrate up|down|status` manages the schema and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate.Command(ctx, os.Args[2:], os.Getenv("DATABASE_URL"), dbPath, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "migrate: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// `accounts-api audit verify` checks the audit hash chain and exits
+	if len(os.Args) > 1 && os.Args[1] == "audit" {
+		if err := audit.Command(ctx, os.Args[2:], os.Getenv("DATABASE_URL"), dbPath, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "audit: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// `accounts-api apikey create|list|revoke` manages API keys and exits
+	if len(os.Args) > 1 && os.Args[1] == "apikey" {
+		if err := auth.Command(ctx, os.Args[2:], os.Getenv("DATABASE_URL"), dbPath, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "apikey: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Setup Loki logger
 	lokiURL := os.Getenv("LOKI_ENDPOINT")
 	logger := telemetry.NewLokiLogger(lokiURL, serviceName)
@@ -42,22 +81,92 @@ func main() {
 		}()
 	}
 
-	// Get database path from environment or use default
-	dbPath := os.Getenv("DB_PATH")
-	if dbPath == "" {
-		dbPath = "./data/bank.db"
-	}
-
-	// Initialize repository
-	repo, err := repository.NewRepository(dbPath)
+	// Initialize repository: PostgreSQL when DATABASE_URL is set, SQLite otherwise
+	repo, err := repository.Open(os.Getenv("DATABASE_URL"), dbPath)
 	if err != nil {
 		logger.Fatal("Failed to initialize repository: %v", err)
 	}
+	defer repo.Close()
+	logger.Info("Using %s repository", repo.Dialect())
+
+	// Accounts are opened in one of the tiers of ACCOUNT_TIERS_FILE, or of
+	// the default catalog when it is not set
+	tiers := tier.DefaultCatalog
+	if tiersFile := os.Getenv("ACCOUNT_TIERS_FILE"); tiersFile != "" {
+		if tiers, err = tier.LoadFile(tiersFile); err != nil {
+			logger.Fatal("Failed to load account tiers: %v", err)
+		}
+	}
+	logger.Info("Account tiers %v, default %s", tiers.Names(), tiers.Default())
 
 	// Initialize services and handlers
-	accountService := service.NewAccountService(repo)
+	accountService := service.NewAccountService(repo, tiers)
 	accountHandler := handlers.NewAccountHandler(accountService)
+	customerHandler := handlers.NewCustomerHandler(service.NewCustomerService(repo))
+	ledgerService := service.NewLedgerService(repo)
+	ledgerHandler := handlers.NewLedgerHandler(ledgerService)
 	transactionHandler := handlers.NewTransactionHandler(serviceName)
+	auditHandler := handlers.NewAuditHandler(service.NewAuditService(repo))
+
+	// `accounts-api import accounts FILE [--dry-run]` opens the accounts of a
+	// CSV file through the account service and exits
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		if err := importer.Command(auth.System(ctx, "import"), os.Args[2:], accountService, nil, os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "import: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Check the double-entry invariants before serving traffic
+	if report, err := ledgerService.Verify(auth.System(ctx, "ledger-verify")); err != nil {
+		logger.Error("Failed to verify ledger: %v", err)
+	} else if !report.Balanced {
+		logger.Error("Ledger is out of balance: %d unbalanced entries, %d balance mismatches",
+			len(report.UnbalancedEntries), len(report.BalanceMismatches))
+	}
+
+	// Idempotency keys let clients safely retry POST requests
+	idempotencyTTL := middleware.DefaultIdempotencyTTL
+	if v := os.Getenv("IDEMPOTENCY_TTL"); v != "" {
+		if idempotencyTTL, err = time.ParseDuration(v); err != nil {
+			logger.Fatal("Invalid IDEMPOTENCY_TTL: %v", err)
+		}
+	}
+	if purged, err := repo.PurgeExpiredIdempotencyKeys(ctx, time.Now()); err != nil {
+		logger.Error("Failed to purge expired idempotency keys: %v", err)
+	} else if purged > 0 {
+		logger.Info("Purged %d expired idempotency keys", purged)
+	}
+	idempotency := middleware.Idempotency(repo, idempotencyTTL)
+
+	// Roles map to permissions with the RBAC policy of AUTH_POLICY_FILE, or
+	// the default policy when it is not set
+	policy := auth.DefaultPolicy
+	if policyFile := os.Getenv("AUTH_POLICY_FILE"); policyFile != "" {
+		if policy, err = auth.LoadPolicy(policyFile); err != nil {
+			logger.Fatal("Failed to load RBAC policy: %v", err)
+		}
+	}
+	logger.Info("RBAC policy defines roles %v", policy.Roles())
+
+	// Every API route requires a JWT bearer token or an API key
+	authenticator, err := auth.NewAuthenticator(repo, auth.JWTConfigFromEnv(), policy)
+	if err != nil {
+		logger.Fatal("Failed to configure authentication: %v", err)
+	}
+	authenticate := middleware.Authenticate(authenticator)
+	authorize := middleware.Authorize
+
+	// RATE_LIMITS throttles each client per route; nothing is throttled
+	// when it is not set
+	rateLimits, err := middleware.ParseRateLimits(os.Getenv("RATE_LIMITS"))
+	if err != nil {
+		logger.Fatal("Invalid RATE_LIMITS: %v", err)
+	}
+	rateLimiter := middleware.NewRateLimiter(rateLimits)
+	rateLimit := middleware.RateLimiting(rateLimiter)
+	failedAuthLimit := middleware.FailedAuthRateLimiting(rateLimiter)
 
 	// Setup Gin router
 	router := gin.Default()
@@ -71,6 +180,9 @@ func main() {
 	// Add OpenTelemetry middleware
 	router.Use(otelgin.Middleware(serviceName))
 
+	// Attribute state changes to the actor and request for the audit log
+	router.Use(middleware.RequestContext())
+
 	// Metrics endpoint for Prometheus
 	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
@@ -79,12 +191,45 @@ func main() {
 	router.GET("/ready", transactionHandler.HealthCheck)
 
 	// API routes
-	api := router.Group("/api")
+	// Failed authentications are throttled by IP address before credentials
+	// are checked, everything else by principal once they are
+	api := router.Group("/api", failedAuthLimit, authenticate, rateLimit)
+	{
+		api.GET("/accounts", authorize(auth.PermAccountsRead), accountHandler.ListAccounts)
+		api.GET("/accounts/:id", authorize(auth.PermAccountsRead), accountHandler.GetAccount)
+		api.POST("/accounts", authorize(auth.PermAccountsCreate), idempotency, accountHandler.CreateAccount)
+		api.POST("/imports/accounts", authorize(auth.PermAccountsCreate), accountHandler.ImportAccounts)
+		api.GET("/accounts/:id/transactions", authorize(auth.PermAccountsRead), accountHandler.GetAccountTransactions)
+		api.GET("/accounts/:id/statement", authorize(auth.PermAccountsRead), accountHandler.GetAccountStatement)
+		api.POST("/accounts/:id/deposits", authorize(auth.PermAccountsDeposit), idempotency, accountHandler.Deposit)
+		api.POST("/accounts/:id/withdrawals", authorize(auth.PermAccountsWithdraw), idempotency, accountHandler.Withdraw)
+		api.POST("/accounts/:id/freeze", authorize(auth.PermAccountsFreeze), accountHandler.FreezeAccount)
+		api.POST("/accounts/:id/unfreeze", authorize(auth.PermAccountsFreeze), accountHandler.UnfreezeAccount)
+		api.POST("/accounts/:id/close", authorize(auth.PermAccountsClose), accountHandler.CloseAccount)
+		api.POST("/accounts/:id/reopen", authorize(auth.PermAccountsClose), accountHandler.ReopenAccount)
+		api.PUT("/accounts/:id/overdraft", authorize(auth.PermAccountsOverdraft), accountHandler.SetOverdraft)
+		api.POST("/accounts/:id/owners", authorize(auth.PermAccountsOwners), accountHandler.AddAccountOwner)
+		api.DELETE("/accounts/:id/owners/:customer_id", authorize(auth.PermAccountsOwners), accountHandler.RemoveAccountOwner)
+		api.GET("/customers", authorize(auth.PermCustomersRead), customerHandler.ListCustomers)
+		api.POST("/customers", authorize(auth.PermCustomersWrite), idempotency, customerHandler.CreateCustomer)
+		api.GET("/customers/:id", authorize(auth.PermCustomersRead), customerHandler.GetCustomer)
+		api.PUT("/customers/:id", authorize(auth.PermCustomersWrite), customerHandler.UpdateCustomer)
+		api.DELETE("/customers/:id", authorize(auth.PermCustomersWrite), customerHandler.DeleteCustomer)
+		api.GET("/customers/:id/accounts", authorize(auth.PermCustomersRead), customerHandler.ListCustomerAccounts)
+		api.GET("/ledger/verify", authorize(auth.PermLedgerVerify), ledgerHandler.VerifyLedger)
+		api.GET("/audit", authorize(auth.PermAuditRead), auditHandler.ListAuditEntries)
+	}
+
+	// Internal routes used by transfers-api, which resolves and mutates
+	// accounts through this service instead of its own database. They are
+	// only open to callers holding the service role.
+	internal := router.Group("/internal", authenticate, middleware.RequireRole(auth.RoleService))
 	{
-		api.GET("/accounts", accountHandler.ListAccounts)
-		api.GET("/accounts/:id", accountHandler.GetAccount)
-		api.POST("/accounts", accountHandler.CreateAccount)
-		api.GET("/accounts/:id/transactions", accountHandler.GetAccountTransactions)
+		internal.GET("/accounts/:id", accountHandler.GetAccount)
+		internal.GET("/account-numbers/:number", accountHandler.GetAccountByNumber)
+		internal.POST("/accounts/:id/entries", accountHandler.PostEntry)
+		internal.POST("/accounts/:id/holds", accountHandler.PlaceHold)
+		internal.POST("/accounts/:id/holds/:key/release", accountHandler.ReleaseHold)
 	}
 
 	// Get port from environment or use default
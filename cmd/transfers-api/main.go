@@ -11,9 +11,17 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/tribal/bank-api/internal/accountsclient"
+	"github.com/tribal/bank-api/internal/audit"
+	"github.com/tribal/bank-api/internal/auth"
+	"github.com/tribal/bank-api/internal/fx"
 	"github.com/tribal/bank-api/internal/handlers"
+	"github.com/tribal/bank-api/internal/importer"
+	"github.com/tribal/bank-api/internal/middleware"
+	"github.com/tribal/bank-api/internal/migrate"
 	"github.com/tribal/bank-api/internal/repository"
 	"github.com/tribal/bank-api/internal/service"
+	"github.com/tribal/bank-api/internal/tier"
 	"github.com/tribal/bank-api/pkg/telemetry"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
@@ -26,6 +34,39 @@ const (
 func main() {
 	ctx := context.Background()
 
+	// Get database path from environment or use default
+	dbPath := os.Getenv("DB_PATH")
+	if dbPath == "" {
+		dbPath = "./data/bank.db"
+	}
+
+	// `transfers-api migrate up|down|status` manages the schema and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate.Command(ctx, os.Args[2:], os.Getenv("DATABASE_URL"), dbPath, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "migrate: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// `transfers-api audit verify` checks the audit hash chain and exits
+	if len(os.Args) > 1 && os.Args[1] == "audit" {
+		if err := audit.Command(ctx, os.Args[2:], os.Getenv("DATABASE_URL"), dbPath, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "audit: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// `transfers-api apikey create|list|revoke` manages API keys and exits
+	if len(os.Args) > 1 && os.Args[1] == "apikey" {
+		if err := auth.Command(ctx, os.Args[2:], os.Getenv("DATABASE_URL"), dbPath, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "apikey: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Setup Loki logger
 	lokiURL := os.Getenv("LOKI_ENDPOINT")
 	logger := telemetry.NewLokiLogger(lokiURL, serviceName)
@@ -42,22 +83,151 @@ func main() {
 		}()
 	}
 
-	// Get database path from environment or use default
-	dbPath := os.Getenv("DB_PATH")
-	if dbPath == "" {
-		dbPath = "./data/bank.db"
-	}
-
-	// Initialize repository
-	repo, err := repository.NewRepository(dbPath)
+	// Initialize repository: PostgreSQL when DATABASE_URL is set, SQLite otherwise
+	repo, err := repository.Open(os.Getenv("DATABASE_URL"), dbPath)
 	if err != nil {
 		logger.Fatal("Failed to initialize repository: %v", err)
 	}
+	defer repo.Close()
+	logger.Info("Using %s repository", repo.Dialect())
+
+	// Cross-currency transfers are converted with the rates file when
+	// configured and rejected otherwise
+	var rates fx.RateProvider
+	if ratesFile := os.Getenv("FX_RATES_FILE"); ratesFile != "" {
+		provider, err := fx.LoadFile(ratesFile)
+		if err != nil {
+			logger.Fatal("Failed to load FX rates: %v", err)
+		}
+		rates = provider
+	}
 
 	// Initialize services and handlers
-	transferService := service.NewTransferService(repo)
+	// Accounts live in accounts-api; transfers-api reads and mutates them
+	// through its internal API so both services share one ledger
+	accountsURL := os.Getenv("ACCOUNTS_API_URL")
+	if accountsURL == "" {
+		accountsURL = "http://localhost:8080"
+	}
+	// ACCOUNTS_API_KEY must be a key registered in accounts-api with the
+	// service role
+	accounts := accountsclient.New(accountsURL, os.Getenv("ACCOUNTS_API_KEY"))
+
+	// The transfer saga runs inline on each request; the relay resumes steps
+	// that failed transiently or were interrupted
+	saga := service.NewTransferSaga(repo, accounts)
+	relayInterval := 5 * time.Second
+	if v := os.Getenv("OUTBOX_POLL_INTERVAL"); v != "" {
+		if relayInterval, err = time.ParseDuration(v); err != nil {
+			logger.Fatal("Invalid OUTBOX_POLL_INTERVAL: %v", err)
+		}
+	}
+
+	// Velocity limits cap the transfers each account sends per hour and the
+	// amount it sends per day; both are unlimited when unset
+	limits, err := service.ParseVelocityLimits(os.Getenv("TRANSFER_MAX_PER_HOUR"), os.Getenv("TRANSFER_MAX_DAILY_AMOUNT"))
+	if err != nil {
+		logger.Fatal("Invalid transfer velocity limits: %v", err)
+	}
+
+	// Outgoing transfers are bounded by the limits of the source account's
+	// tier, read from ACCOUNT_TIERS_FILE or the default catalog; it must match
+	// the catalog of accounts-api
+	tiers := tier.DefaultCatalog
+	if tiersFile := os.Getenv("ACCOUNT_TIERS_FILE"); tiersFile != "" {
+		if tiers, err = tier.LoadFile(tiersFile); err != nil {
+			logger.Fatal("Failed to load account tiers: %v", err)
+		}
+	}
+	logger.Info("Account tiers %v, default %s", tiers.Names(), tiers.Default())
+
+	// Authorized transfers release their hold if not captured within
+	// HOLD_TTL. Every replica expires them; each transfer is locked first.
+	holdTTL := service.DefaultHoldTTL
+	if v := os.Getenv("HOLD_TTL"); v != "" {
+		if holdTTL, err = time.ParseDuration(v); err != nil {
+			logger.Fatal("Invalid HOLD_TTL: %v", err)
+		}
+	}
+
+	transferService := service.NewTransferService(repo, accounts, rates, saga, limits, tiers, holdTTL)
 	transferHandler := handlers.NewTransferHandler(transferService)
+
+	// `transfers-api import transfers FILE [--dry-run]` executes the transfers
+	// of a CSV file through the transfer service and exits, leaving steps
+	// that could not run to the relay of the running replicas
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		if err := importer.Command(auth.System(ctx, "import"), os.Args[2:], nil, transferService, os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "import: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Background jobs run without a caller, so each carries a system
+	// principal of its own
+	relayCtx, stopRelay := context.WithCancel(ctx)
+	defer stopRelay()
+	go saga.Start(auth.System(relayCtx, "outbox-relay"), relayInterval)
+	go transferService.StartHoldExpiry(auth.System(relayCtx, "hold-expiry"), relayInterval)
+
+	// Every replica runs the scheduler; schedules are leased before they run,
+	// so each run happens on one replica only
+	scheduler := service.NewTransferScheduler(repo, transferService)
+	schedulerInterval := 10 * time.Second
+	if v := os.Getenv("SCHEDULER_POLL_INTERVAL"); v != "" {
+		if schedulerInterval, err = time.ParseDuration(v); err != nil {
+			logger.Fatal("Invalid SCHEDULER_POLL_INTERVAL: %v", err)
+		}
+	}
+	schedulerCtx, stopScheduler := context.WithCancel(ctx)
+	defer stopScheduler()
+	go scheduler.Start(auth.System(schedulerCtx, "transfer-scheduler"), schedulerInterval, logger)
+
 	transactionHandler := handlers.NewTransactionHandler(serviceName)
+	auditHandler := handlers.NewAuditHandler(service.NewAuditService(repo))
+
+	// Idempotency keys let clients safely retry POST requests
+	idempotencyTTL := middleware.DefaultIdempotencyTTL
+	if v := os.Getenv("IDEMPOTENCY_TTL"); v != "" {
+		if idempotencyTTL, err = time.ParseDuration(v); err != nil {
+			logger.Fatal("Invalid IDEMPOTENCY_TTL: %v", err)
+		}
+	}
+	if purged, err := repo.PurgeExpiredIdempotencyKeys(ctx, time.Now()); err != nil {
+		logger.Error("Failed to purge expired idempotency keys: %v", err)
+	} else if purged > 0 {
+		logger.Info("Purged %d expired idempotency keys", purged)
+	}
+	idempotency := middleware.Idempotency(repo, idempotencyTTL)
+
+	// Roles map to permissions with the RBAC policy of AUTH_POLICY_FILE, or
+	// the default policy when it is not set
+	policy := auth.DefaultPolicy
+	if policyFile := os.Getenv("AUTH_POLICY_FILE"); policyFile != "" {
+		if policy, err = auth.LoadPolicy(policyFile); err != nil {
+			logger.Fatal("Failed to load RBAC policy: %v", err)
+		}
+	}
+	logger.Info("RBAC policy defines roles %v", policy.Roles())
+
+	// Every API route requires a JWT bearer token or an API key
+	authenticator, err := auth.NewAuthenticator(repo, auth.JWTConfigFromEnv(), policy)
+	if err != nil {
+		logger.Fatal("Failed to configure authentication: %v", err)
+	}
+	authenticate := middleware.Authenticate(authenticator)
+	authorize := middleware.Authorize
+
+	// RATE_LIMITS throttles each client per route; nothing is throttled
+	// when it is not set
+	rateLimits, err := middleware.ParseRateLimits(os.Getenv("RATE_LIMITS"))
+	if err != nil {
+		logger.Fatal("Invalid RATE_LIMITS: %v", err)
+	}
+	rateLimiter := middleware.NewRateLimiter(rateLimits)
+	rateLimit := middleware.RateLimiting(rateLimiter)
+	failedAuthLimit := middleware.FailedAuthRateLimiting(rateLimiter)
 
 	// Setup Gin router
 	router := gin.Default()
@@ -71,6 +241,9 @@ func main() {
 	// Add OpenTelemetry middleware
 	router.Use(otelgin.Middleware(serviceName))
 
+	// Attribute state changes to the actor and request for the audit log
+	router.Use(middleware.RequestContext())
+
 	// Metrics endpoint for Prometheus
 	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
@@ -79,10 +252,27 @@ func main() {
 	router.GET("/ready", transactionHandler.HealthCheck)
 
 	// API routes
-	api := router.Group("/api")
+	// Failed authentications are throttled by IP address before credentials
+	// are checked, everything else by principal once they are
+	api := router.Group("/api", failedAuthLimit, authenticate, rateLimit)
 	{
-		api.POST("/transfers", transferHandler.CreateTransfer)
-		api.GET("/transfers/:id", transferHandler.GetTransfer)
+		api.GET("/transfers", authorize(auth.PermTransfersRead), transferHandler.ListTransfers)
+		api.POST("/transfers", authorize(auth.PermTransfersCreate), idempotency, transferHandler.CreateTransfer)
+		api.GET("/transfers/:id", authorize(auth.PermTransfersRead), transferHandler.GetTransfer)
+		api.GET("/accounts/:id/limits", authorize(auth.PermAccountsRead), transferHandler.GetAccountLimits)
+		api.GET("/schedules", authorize(auth.PermTransfersSchedule), transferHandler.ListSchedules)
+		api.POST("/schedules", authorize(auth.PermTransfersSchedule), idempotency, transferHandler.CreateSchedule)
+		api.GET("/schedules/:id", authorize(auth.PermTransfersSchedule), transferHandler.GetSchedule)
+		api.POST("/schedules/:id/pause", authorize(auth.PermTransfersSchedule), transferHandler.PauseSchedule)
+		api.POST("/schedules/:id/resume", authorize(auth.PermTransfersSchedule), transferHandler.ResumeSchedule)
+		api.POST("/schedules/:id/cancel", authorize(auth.PermTransfersSchedule), transferHandler.CancelSchedule)
+		api.POST("/transfers/:id/reversal", authorize(auth.PermTransfersReverse), idempotency, transferHandler.ReverseTransfer)
+		api.POST("/transfers/:id/capture", authorize(auth.PermTransfersCreate), idempotency, transferHandler.CaptureTransfer)
+		api.POST("/transfers/:id/void", authorize(auth.PermTransfersCreate), idempotency, transferHandler.VoidTransfer)
+		api.POST("/transfer-batches", authorize(auth.PermTransfersCreate), idempotency, transferHandler.CreateBatch)
+		api.POST("/imports/transfers", authorize(auth.PermTransfersCreate), transferHandler.ImportTransfers)
+		api.GET("/transfer-batches/:id", authorize(auth.PermTransfersRead), transferHandler.GetBatch)
+		api.GET("/audit", authorize(auth.PermAuditRead), auditHandler.ListAuditEntries)
 	}
 
 	// Get port from environment or use default
@@ -0,0 +1,177 @@
+package accountsclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/tribal/bank-api/internal/audit"
+	"github.com/tribal/bank-api/internal/models"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("accounts-client")
+
+// ErrUnavailable wraps the errors of requests that got no response from
+// accounts-api, such as refused connections and timeouts
+var ErrUnavailable = errors.New("accounts-api request failed")
+
+// Client talks to the internal API of accounts-api, which owns all accounts.
+// The trace context of each call is propagated with the global W3C propagator
+// so spans on both services join the same trace.
+type Client struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+// New creates a client for the accounts-api reachable at baseURL that
+// authenticates with apiKey, a key holding the service role
+func New(baseURL, apiKey string) *Client {
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		apiKey:     apiKey,
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// APIError is a non-2xx response from accounts-api. It unwraps to the
+// matching models error when the response carries a known error code.
+type APIError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("accounts-api: %s (status %d)", e.Message, e.StatusCode)
+}
+
+func (e *APIError) Unwrap() error {
+	return models.ErrorFromCode(e.Code)
+}
+
+func (c *Client) GetAccount(ctx context.Context, id uint) (*models.Account, error) {
+	var account models.Account
+	if err := c.do(ctx, "GetAccount", http.MethodGet, fmt.Sprintf("/internal/accounts/%d", id), nil, &account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (c *Client) GetAccountByNumber(ctx context.Context, accountNumber string) (*models.Account, error) {
+	var account models.Account
+	path := "/internal/account-numbers/" + url.PathEscape(accountNumber)
+	if err := c.do(ctx, "GetAccountByNumber", http.MethodGet, path, nil, &account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (c *Client) PostEntry(ctx context.Context, accountID uint, entry models.AccountEntry) (*models.Account, error) {
+	var account models.Account
+	path := fmt.Sprintf("/internal/accounts/%d/entries", accountID)
+	if err := c.do(ctx, "PostEntry", http.MethodPost, path, entry, &account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (c *Client) PlaceHold(ctx context.Context, accountID uint, hold models.AccountHoldRequest) (*models.Account, error) {
+	var account models.Account
+	path := fmt.Sprintf("/internal/accounts/%d/holds", accountID)
+	if err := c.do(ctx, "PlaceHold", http.MethodPost, path, hold, &account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (c *Client) ReleaseHold(ctx context.Context, accountID uint, key string) (*models.Account, error) {
+	var account models.Account
+	path := fmt.Sprintf("/internal/accounts/%d/holds/%s/release", accountID, url.PathEscape(key))
+	if err := c.do(ctx, "ReleaseHold", http.MethodPost, path, nil, &account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (c *Client) do(ctx context.Context, operation, method, path string, body, out interface{}) error {
+	ctx, span := tracer.Start(ctx, "AccountsClient."+operation, trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("http.request.method", method),
+		attribute.String("url.full", c.baseURL+path),
+	)
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	// Propagate the W3C trace context and the audit actor to accounts-api
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	audit.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+
+	if resp.StatusCode >= 300 {
+		apiErr := &APIError{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+		var payload struct {
+			Error string `json:"error"`
+			Code  string `json:"code"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&payload); err == nil {
+			apiErr.Code = payload.Code
+			if payload.Error != "" {
+				apiErr.Message = payload.Error
+			}
+		}
+		span.RecordError(apiErr)
+		span.SetStatus(codes.Error, apiErr.Message)
+		return apiErr
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode accounts-api response: %w", err)
+	}
+	return nil
+}
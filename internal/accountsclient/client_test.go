@@ -0,0 +1,154 @@
+package accountsclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tribal/bank-api/internal/audit"
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/pkg/money"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// newTestClient returns a client for a test server that answers every
+// request with handler
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return New(server.URL+"/", "svc-key")
+}
+
+// respond writes body as JSON with the given status
+func respond(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func TestClientMapsErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    interface{}
+		want    error
+		message string
+	}{
+		{"not found", http.StatusNotFound, map[string]string{"error": "account not found", "code": "account_not_found"}, models.ErrAccountNotFound, "account not found"},
+		{"insufficient balance", http.StatusConflict, map[string]string{"error": "insufficient balance", "code": "insufficient_balance"}, models.ErrInsufficientBalance, "insufficient balance"},
+		{"frozen", http.StatusConflict, map[string]string{"error": "account is frozen: ACC-1", "code": "account_frozen"}, models.ErrAccountFrozen, "account is frozen: ACC-1"},
+		{"currency mismatch", http.StatusUnprocessableEntity, map[string]string{"error": "currency does not match account currency", "code": "currency_mismatch"}, models.ErrCurrencyMismatch, "currency does not match account currency"},
+		// Without a known code the error is not a domain error, so the saga
+		// retries it
+		{"concurrent update", http.StatusConflict, map[string]string{"error": "account was modified concurrently"}, nil, "account was modified concurrently"},
+		{"unknown code", http.StatusBadRequest, map[string]string{"error": "bad", "code": "something_new"}, nil, "bad"},
+		{"not json", http.StatusBadGateway, "<html>", nil, "Bad Gateway"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if s, ok := tt.body.(string); ok {
+					w.WriteHeader(tt.status)
+					w.Write([]byte(s))
+					return
+				}
+				respond(w, tt.status, tt.body)
+			})
+
+			_, err := client.PostEntry(context.Background(), 1, models.AccountEntry{Type: models.TransactionTypeTransfer, Amount: money.New(-100, "USD"), Reference: "TRF-1"})
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("got %v, want an APIError", err)
+			}
+			if apiErr.StatusCode != tt.status || apiErr.Message != tt.message {
+				t.Errorf("got status %d and message %q, want %d and %q", apiErr.StatusCode, apiErr.Message, tt.status, tt.message)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want it to match %v", err, tt.want)
+			}
+			if tt.want == nil && models.ErrorCode(err) != "" {
+				t.Errorf("got domain error %q, want none", models.ErrorCode(err))
+			}
+		})
+	}
+}
+
+func TestClientSendsRequest(t *testing.T) {
+	var got *http.Request
+	var entry models.AccountEntry
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		json.NewDecoder(r.Body).Decode(&entry)
+		respond(w, http.StatusOK, models.Account{ID: 7, AccountNumber: "ACC-7", Balance: money.New(900, "USD")})
+	})
+
+	ctx := audit.WithMetadata(context.Background(), audit.Metadata{Actor: "teller-1", RequestID: "req-1"})
+	account, err := client.PostEntry(ctx, 7, models.AccountEntry{Type: models.TransactionTypeTransfer, Amount: money.New(-100, "USD"), Reference: "TRF-1"})
+	if err != nil {
+		t.Fatalf("post entry: %v", err)
+	}
+	if account.ID != 7 || account.Balance != money.New(900, "USD") {
+		t.Errorf("account: got %d with %s, want 7 with 9.00", account.ID, account.Balance)
+	}
+
+	if got.Method != http.MethodPost || got.URL.Path != "/internal/accounts/7/entries" {
+		t.Errorf("request: got %s %s, want POST /internal/accounts/7/entries", got.Method, got.URL.Path)
+	}
+	if actor, request := got.Header.Get(audit.ActorHeader), got.Header.Get(audit.RequestIDHeader); actor != "teller-1" || request != "req-1" {
+		t.Errorf("audit headers: got actor %q and request %q, want teller-1 and req-1", actor, request)
+	}
+	if auth := got.Header.Get("Authorization"); auth != "Bearer svc-key" {
+		t.Errorf("Authorization: got %q, want the API key as a bearer token", auth)
+	}
+	if entry.Reference != "TRF-1" || entry.Amount != money.New(-100, "USD") {
+		t.Errorf("entry: got reference %q and amount %s, want TRF-1 and -1.00", entry.Reference, entry.Amount)
+	}
+}
+
+func TestClientEscapesPath(t *testing.T) {
+	var path string
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.EscapedPath()
+		respond(w, http.StatusOK, models.Account{})
+	})
+
+	if _, err := client.GetAccountByNumber(context.Background(), "ACC/1 2"); err != nil {
+		t.Fatalf("get account by number: %v", err)
+	}
+	if want := "/internal/account-numbers/ACC%2F1%202"; path != want {
+		t.Errorf("path: got %s, want %s", path, want)
+	}
+}
+
+func TestClientPropagatesTraceContext(t *testing.T) {
+	previous := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(previous) })
+
+	var traceparent string
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		respond(w, http.StatusOK, models.Account{})
+	})
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	parent := trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled})
+	ctx := trace.ContextWithSpanContext(context.Background(), parent)
+
+	if _, err := client.GetAccount(ctx, 1); err != nil {
+		t.Fatalf("get account: %v", err)
+	}
+
+	// The client span is not recorded without a tracer provider, so the
+	// request carries the caller's span
+	if want := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"; traceparent != want {
+		t.Errorf("traceparent: got %q, want %q", traceparent, want)
+	}
+}
@@ -0,0 +1,43 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/tribal/bank-api/internal/repository"
+)
+
+// ErrChainBroken is returned by Command when verification finds tampering
+var ErrChainBroken = errors.New("audit chain is broken")
+
+const usage = `usage: audit <command>
+
+commands:
+  verify   check the hash chain of the audit log`
+
+// Command runs `audit verify` against the database selected like
+// repository.Open and writes a report to out
+func Command(ctx context.Context, args []string, databaseURL, sqlitePath string, out io.Writer) error {
+	if len(args) != 1 || args[0] != "verify" {
+		return fmt.Errorf("expected a single command\n%s", usage)
+	}
+
+	repo, err := repository.OpenQuiet(databaseURL, sqlitePath)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	report, err := Verify(ctx, repo)
+	if err != nil {
+		return err
+	}
+	if !report.Valid {
+		fmt.Fprintf(out, "entry %d: %s\n", report.FirstInvalid, report.Problem)
+		return fmt.Errorf("%w after %d valid entries", ErrChainBroken, report.Entries)
+	}
+	fmt.Fprintf(out, "verified %d entries, chain is intact\n", report.Entries)
+	return nil
+}
@@ -0,0 +1,64 @@
+// Package audit carries the actor and request ID of a state change through
+// the context, and verifies the hash chain of the audit log
+package audit
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/propagation"
+)
+
+const (
+	// ActorHeader names who performs a request. transfers-api forwards it to
+	// accounts-api so both services attribute a transfer to the same actor.
+	ActorHeader     = "X-Actor"
+	RequestIDHeader = "X-Request-ID"
+
+	// SystemActor performs changes that no request triggered, such as outbox
+	// retries
+	SystemActor    = "system"
+	AnonymousActor = "anonymous"
+)
+
+// Metadata identifies who caused a change and in which request
+type Metadata struct {
+	Actor     string
+	RequestID string
+}
+
+type metadataKey struct{}
+
+// WithMetadata returns a copy of ctx carrying md
+func WithMetadata(ctx context.Context, md Metadata) context.Context {
+	return context.WithValue(ctx, metadataKey{}, md)
+}
+
+// FromContext returns the metadata stored in ctx. Without any, the change is
+// attributed to SystemActor.
+func FromContext(ctx context.Context) Metadata {
+	md, _ := ctx.Value(metadataKey{}).(Metadata)
+	if md.Actor == "" {
+		md.Actor = SystemActor
+	}
+	return md
+}
+
+// Inject writes the metadata of ctx to carrier, so it survives a call to
+// another service or a trip through the outbox
+func Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	md := FromContext(ctx)
+	carrier.Set(ActorHeader, md.Actor)
+	if md.RequestID != "" {
+		carrier.Set(RequestIDHeader, md.RequestID)
+	}
+}
+
+// Extract returns a copy of ctx carrying the metadata found in carrier. ctx
+// is returned unchanged when carrier names no actor.
+func Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	actor := carrier.Get(ActorHeader)
+	if actor == "" {
+		return ctx
+	}
+	return WithMetadata(ctx, Metadata{Actor: actor, RequestID: carrier.Get(RequestIDHeader)})
+}
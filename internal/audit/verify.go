@@ -0,0 +1,66 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/internal/repository"
+)
+
+// Lister reads audit entries
+type Lister interface {
+	ListAuditEntries(ctx context.Context, opts repository.ListOptions) ([]models.AuditEntry, string, error)
+}
+
+// Verify walks the audit log in sequence order and checks that sequences
+// have no gaps, that every entry points to the hash of its predecessor and
+// that its own hash matches its content. It stops at the first entry that
+// fails and reports it.
+func Verify(ctx context.Context, store Lister) (*models.AuditReport, error) {
+	report := &models.AuditReport{Valid: true, CheckedAt: time.Now()}
+
+	var prev *models.AuditEntry
+	opts := repository.ListOptions{Sort: "sequence", Limit: repository.MaxPageLimit}
+	for {
+		entries, next, err := store.ListAuditEntries(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read audit entries: %w", err)
+		}
+		for i := range entries {
+			entry := &entries[i]
+			if problem := check(prev, entry); problem != "" {
+				report.Valid = false
+				report.FirstInvalid = entry.Sequence
+				report.Problem = problem
+				return report, nil
+			}
+			report.Entries++
+			prev = entry
+		}
+		if next == "" {
+			return report, nil
+		}
+		opts.Cursor = next
+	}
+}
+
+func check(prev, entry *models.AuditEntry) string {
+	var wantSequence uint = 1
+	var wantPrevHash string
+	if prev != nil {
+		wantSequence = prev.Sequence + 1
+		wantPrevHash = prev.Hash
+	}
+
+	switch {
+	case entry.Sequence != wantSequence:
+		return fmt.Sprintf("expected sequence %d, found %d: entries are missing", wantSequence, entry.Sequence)
+	case entry.PrevHash != wantPrevHash:
+		return "previous hash does not match the preceding entry"
+	case entry.Hash != entry.ComputeHash():
+		return "hash does not match the entry's content"
+	}
+	return ""
+}
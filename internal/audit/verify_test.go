@@ -0,0 +1,84 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/internal/repository"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "audit.db")
+
+	migrator, err := repository.OpenMigrator("", path)
+	if err != nil {
+		t.Fatalf("open migrator: %v", err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+	migrator.Close()
+
+	repo, err := repository.OpenQuiet("", path)
+	if err != nil {
+		t.Fatalf("open repository: %v", err)
+	}
+	defer repo.Close()
+
+	for i := 1; i <= 5; i++ {
+		entry := &models.AuditEntry{
+			Action:     models.AuditAccountCreated,
+			EntityType: models.AuditEntityAccount,
+			EntityID:   uint(i),
+			Actor:      "alice",
+			After:      `{"balance":"0.00"}`,
+		}
+		if err := repo.AppendAuditEntry(ctx, entry); err != nil {
+			t.Fatalf("append audit entry: %v", err)
+		}
+	}
+
+	report, err := Verify(ctx, repo)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if !report.Valid || report.Entries != 5 {
+		t.Fatalf("intact chain: got valid=%v entries=%d", report.Valid, report.Entries)
+	}
+
+	// Bypass the append-only trigger the way someone with direct database
+	// access could, and rewrite history
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.Exec("DROP TRIGGER audit_entries_no_update").Error; err != nil {
+		t.Fatalf("drop trigger: %v", err)
+	}
+	if err := db.Exec("UPDATE audit_entries SET actor = 'mallory' WHERE sequence = 3").Error; err != nil {
+		t.Fatalf("tamper: %v", err)
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+
+	report, err = Verify(ctx, repo)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if report.Valid || report.FirstInvalid != 3 || report.Entries != 2 {
+		t.Fatalf("tampered chain: got valid=%v first_invalid=%d entries=%d", report.Valid, report.FirstInvalid, report.Entries)
+	}
+
+	var out bytes.Buffer
+	if err := Command(ctx, []string{"verify"}, "", path, &out); !errors.Is(err, ErrChainBroken) {
+		t.Fatalf("command: got %v, want ErrChainBroken", err)
+	}
+}
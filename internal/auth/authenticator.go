@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/internal/repository"
+)
+
+var (
+	// ErrUnauthenticated means the request carried no credentials
+	ErrUnauthenticated = errors.New("authentication required")
+	// ErrInvalidToken means the bearer token is malformed, expired or not
+	// signed by a trusted key
+	ErrInvalidToken = errors.New("invalid bearer token")
+	// ErrInvalidAPIKey means the API key is unknown, revoked or expired
+	ErrInvalidAPIKey = errors.New("invalid API key")
+	// ErrForbidden means the principal lacks a role the route requires
+	ErrForbidden = errors.New("insufficient permissions")
+)
+
+var errorCodes = map[error]string{
+	ErrUnauthenticated: "unauthenticated",
+	ErrInvalidToken:    "invalid_token",
+	ErrInvalidAPIKey:   "invalid_api_key",
+	ErrForbidden:       "forbidden",
+}
+
+// ErrorCode returns the wire code of an authentication error, or "" if err
+// is not one
+func ErrorCode(err error) string {
+	for target, code := range errorCodes {
+		if errors.Is(err, target) {
+			return code
+		}
+	}
+	return ""
+}
+
+// APIKeyStore looks up the stored API keys
+type APIKeyStore interface {
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error)
+}
+
+// Authenticator resolves the principal of a request from a JWT bearer token
+// or an API key
+type Authenticator struct {
+	keys   APIKeyStore
+	jwt    *jwtVerifier
+	policy *Policy
+	now    func() time.Time
+}
+
+// NewAuthenticator creates an authenticator checking API keys against keys
+// and, when cfg has keys configured, bearer JWTs. The permissions of each
+// principal are resolved with policy.
+func NewAuthenticator(keys APIKeyStore, cfg JWTConfig, policy *Policy) (*Authenticator, error) {
+	a := &Authenticator{keys: keys, policy: policy, now: time.Now}
+	if cfg.Enabled() {
+		v, err := newJWTVerifier(cfg)
+		if err != nil {
+			return nil, err
+		}
+		a.jwt = v
+	}
+	return a, nil
+}
+
+// Authenticate returns the principal of r. API keys are read from the
+// X-API-Key header or a bearer token starting with "bk_"; any other bearer
+// token is verified as a JWT.
+func (a *Authenticator) Authenticate(ctx context.Context, r *http.Request) (*Principal, error) {
+	p, err := a.authenticate(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	p.Permissions = a.policy.Permissions(p.Roles)
+	return p, nil
+}
+
+func (a *Authenticator) authenticate(ctx context.Context, r *http.Request) (*Principal, error) {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return a.authenticateAPIKey(ctx, key)
+	}
+
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return nil, ErrUnauthenticated
+	}
+	scheme, token, ok := strings.Cut(header, " ")
+	token = strings.TrimSpace(token)
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return nil, ErrInvalidToken
+	}
+	if _, isKey := ParseAPIKey(token); isKey {
+		return a.authenticateAPIKey(ctx, token)
+	}
+	if a.jwt == nil {
+		return nil, ErrInvalidToken
+	}
+
+	p, err := a.jwt.verify(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	return p, nil
+}
+
+func (a *Authenticator) authenticateAPIKey(ctx context.Context, key string) (*Principal, error) {
+	prefix, ok := ParseAPIKey(key)
+	if !ok {
+		return nil, ErrInvalidAPIKey
+	}
+	stored, err := a.keys.GetAPIKeyByPrefix(ctx, prefix)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !matchAPIKey(key, stored.Hash) || !stored.Active(a.now()) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	p := &Principal{
+		Subject: stored.Subject,
+		Roles:   stored.RoleList(),
+		Method:  MethodAPIKey,
+	}
+	if stored.CustomerID != nil {
+		p.CustomerID = *stored.CustomerID
+	}
+	return p, nil
+}
@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/internal/repository"
+)
+
+type keyStore map[string]*models.APIKey
+
+func (s keyStore) GetAPIKeyByPrefix(_ context.Context, prefix string) (*models.APIKey, error) {
+	if key, ok := s[prefix]; ok {
+		return key, nil
+	}
+	return nil, repository.ErrNotFound
+}
+
+func request(header, value string) *http.Request {
+	r, _ := http.NewRequest(http.MethodGet, "/api/accounts", nil)
+	if header != "" {
+		r.Header.Set(header, value)
+	}
+	return r
+}
+
+func claims(subject string, ttl time.Duration) Claims {
+	now := time.Now()
+	return Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   subject,
+			Issuer:    "bank-idp",
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+		CustomerID: 7,
+		Roles:      []string{"customer"},
+	}
+}
+
+func TestAuthenticateJWT(t *testing.T) {
+	ctx := context.Background()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	jwks, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": "k1",
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+	}}})
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, jwks, 0o600); err != nil {
+		t.Fatalf("write JWKS: %v", err)
+	}
+
+	a, err := NewAuthenticator(keyStore{}, JWTConfig{HS256Secret: "secret", JWKSFile: path, Issuer: "bank-idp"}, DefaultPolicy)
+	if err != nil {
+		t.Fatalf("new authenticator: %v", err)
+	}
+
+	hs, _ := SignHS256("secret", claims("alice", time.Hour))
+	rsToken := jwt.NewWithClaims(jwt.SigningMethodRS256, claims("bob", time.Hour))
+	rsToken.Header["kid"] = "k1"
+	rs, _ := rsToken.SignedString(rsaKey)
+	expired, _ := SignHS256("secret", claims("alice", -time.Hour))
+	forged, _ := SignHS256("other", claims("alice", time.Hour))
+	wrongIssuer := claims("alice", time.Hour)
+	wrongIssuer.Issuer = "elsewhere"
+	otherIssuer, _ := SignHS256("secret", wrongIssuer)
+
+	for _, tt := range []struct {
+		name    string
+		token   string
+		subject string
+		err     error
+	}{
+		{"HS256", hs, "alice", nil},
+		{"RS256", rs, "bob", nil},
+		{"Expired", expired, "", ErrInvalidToken},
+		{"WrongSecret", forged, "", ErrInvalidToken},
+		{"WrongIssuer", otherIssuer, "", ErrInvalidToken},
+		{"Garbage", "not-a-token", "", ErrInvalidToken},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := a.Authenticate(ctx, request("Authorization", "Bearer "+tt.token))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if tt.err == nil && (p.Subject != tt.subject || p.CustomerID != 7 || !p.HasRole("customer") || p.Method != MethodJWT ||
+				p.Permissions[PermAccountsRead] != ScopeOwn) {
+				t.Fatalf("got principal %+v", p)
+			}
+		})
+	}
+
+	if _, err := a.Authenticate(ctx, request("", "")); !errors.Is(err, ErrUnauthenticated) {
+		t.Fatalf("no credentials: got %v, want ErrUnauthenticated", err)
+	}
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	ctx := context.Background()
+	key, prefix, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	revokedKey, revokedPrefix, _ := GenerateAPIKey()
+	revokedAt := time.Now()
+	store := keyStore{
+		prefix:        {Prefix: prefix, Hash: HashAPIKey(key), Subject: "transfers-api", Roles: "service"},
+		revokedPrefix: {Prefix: revokedPrefix, Hash: HashAPIKey(revokedKey), Subject: "old", RevokedAt: &revokedAt},
+	}
+	a, err := NewAuthenticator(store, JWTConfig{}, DefaultPolicy)
+	if err != nil {
+		t.Fatalf("new authenticator: %v", err)
+	}
+
+	for _, r := range []*http.Request{request(APIKeyHeader, key), request("Authorization", "Bearer "+key)} {
+		p, err := a.Authenticate(ctx, r)
+		if err != nil {
+			t.Fatalf("authenticate: %v", err)
+		}
+		if p.Subject != "transfers-api" || !p.HasRole(RoleService) || p.Method != MethodAPIKey {
+			t.Fatalf("got principal %+v", p)
+		}
+	}
+
+	for name, value := range map[string]string{
+		"Revoked":   revokedKey,
+		"WrongKey":  "bk_" + prefix + "_00",
+		"Unknown":   "bk_ffffffff_00",
+		"Malformed": "nope",
+	} {
+		if _, err := a.Authenticate(ctx, request(APIKeyHeader, value)); !errors.Is(err, ErrInvalidAPIKey) {
+			t.Fatalf("%s: got %v, want ErrInvalidAPIKey", name, err)
+		}
+	}
+
+	// Without JWT keys configured bearer tokens other than API keys fail
+	if _, err := a.Authenticate(ctx, request("Authorization", "Bearer eyJ.x.y")); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("JWT without keys: got %v, want ErrInvalidToken", err)
+	}
+}
@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/internal/repository"
+)
+
+const usage = `usage: apikey <command>
+
+commands:
+  create --name NAME --subject SUBJECT [--roles R1,R2] [--customer ID]
+         [--expires DURATION] [--key-file PATH]
+             create a key and print it; --key-file registers the key stored
+             in PATH instead of generating one and does nothing if it is
+             already registered
+  list       list keys without their secrets
+  revoke PREFIX
+             revoke the key with the given prefix`
+
+// Command runs `apikey create|list|revoke` against the database selected
+// like repository.Open and writes a report to out
+func Command(ctx context.Context, args []string, databaseURL, sqlitePath string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing command\n%s", usage)
+	}
+	switch args[0] {
+	case "create", "list", "revoke":
+	default:
+		return fmt.Errorf("unknown command %q\n%s", args[0], usage)
+	}
+
+	repo, err := repository.OpenQuiet(databaseURL, sqlitePath)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	switch args[0] {
+	case "create":
+		return createKey(ctx, repo, args[1:], out)
+	case "list":
+		if len(args) > 1 {
+			return fmt.Errorf("list takes no arguments\n%s", usage)
+		}
+		return listKeys(ctx, repo, out)
+	default:
+		if len(args) != 2 {
+			return fmt.Errorf("revoke takes a key prefix\n%s", usage)
+		}
+		if err := repo.RevokeAPIKey(ctx, args[1], time.Now()); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return fmt.Errorf("no active key with prefix %q", args[1])
+			}
+			return err
+		}
+		fmt.Fprintf(out, "revoked %s\n", args[1])
+		return nil
+	}
+}
+
+func createKey(ctx context.Context, repo repository.Repository, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("apikey create", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	name := flags.String("name", "", "")
+	subject := flags.String("subject", "", "")
+	roles := flags.String("roles", "", "")
+	customerID := flags.Uint("customer", 0, "")
+	expires := flags.Duration("expires", 0, "")
+	keyFile := flags.String("key-file", "", "")
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("%v\n%s", err, usage)
+	}
+	if *name == "" || *subject == "" || flags.NArg() > 0 {
+		return fmt.Errorf("create needs --name and --subject\n%s", usage)
+	}
+
+	var key, prefix string
+	if *keyFile != "" {
+		// The key is read from a file, such as a mounted secret, so that it
+		// never shows up in the command line of the process
+		data, err := os.ReadFile(*keyFile)
+		if err != nil {
+			return fmt.Errorf("read --key-file: %w", err)
+		}
+		key = strings.TrimSpace(string(data))
+		var ok bool
+		if prefix, ok = ParseAPIKey(key); !ok {
+			return fmt.Errorf("%s must hold a key of the form bk_<prefix>_<secret>", *keyFile)
+		}
+		existing, err := repo.GetAPIKeyByPrefix(ctx, prefix)
+		if err == nil {
+			if !matchAPIKey(key, existing.Hash) {
+				return fmt.Errorf("another key with prefix %q is already registered", prefix)
+			}
+			fmt.Fprintf(out, "key %s is already registered\n", prefix)
+			return nil
+		}
+		if !errors.Is(err, repository.ErrNotFound) {
+			return err
+		}
+	} else {
+		var err error
+		if key, prefix, err = GenerateAPIKey(); err != nil {
+			return err
+		}
+	}
+
+	record := &models.APIKey{
+		Name:    *name,
+		Prefix:  prefix,
+		Hash:    HashAPIKey(key),
+		Subject: *subject,
+		Roles:   *roles,
+	}
+	if *customerID != 0 {
+		id := *customerID
+		record.CustomerID = &id
+	}
+	if *expires > 0 {
+		at := time.Now().Add(*expires)
+		record.ExpiresAt = &at
+	}
+	if err := repo.CreateAPIKey(ctx, record); err != nil {
+		return err
+	}
+
+	if *keyFile != "" {
+		fmt.Fprintf(out, "registered key %s\n", prefix)
+		return nil
+	}
+	fmt.Fprintf(out, "created key %s; it is shown only once:\n%s\n", prefix, key)
+	return nil
+}
+
+func listKeys(ctx context.Context, repo repository.Repository, out io.Writer) error {
+	keys, err := repo.ListAPIKeys(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PREFIX\tNAME\tSUBJECT\tROLES\tSTATUS\tCREATED AT")
+	for _, key := range keys {
+		status := "active"
+		switch {
+		case key.RevokedAt != nil:
+			status = "revoked"
+		case !key.Active(now):
+			status = "expired"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", key.Prefix, key.Name, key.Subject,
+			strings.Join(key.RoleList(), ","), status, key.CreatedAt.Format(time.RFC3339))
+	}
+	return w.Flush()
+}
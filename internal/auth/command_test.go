@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tribal/bank-api/internal/repository"
+)
+
+func TestCreateKeyFromFile(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "keys.db")
+	migrator, err := repository.OpenMigrator("", dbPath)
+	if err != nil {
+		t.Fatalf("open migrator: %v", err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	migrator.Close()
+
+	key, prefix, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	// Mounted secrets and files written by editors may end in a newline
+	keyFile := filepath.Join(dir, "service-api-key")
+	if err := os.WriteFile(keyFile, []byte(key+"\n"), 0o600); err != nil {
+		t.Fatalf("write key file: %v", err)
+	}
+
+	create := func() string {
+		t.Helper()
+		var out bytes.Buffer
+		args := []string{"create", "--name", "transfers-api", "--subject", "transfers-api", "--roles", "service", "--key-file", keyFile}
+		if err := Command(ctx, args, "", dbPath, &out); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		return out.String()
+	}
+	if out := create(); strings.Contains(out, key) || !strings.Contains(out, "registered key "+prefix) {
+		t.Fatalf("first create: got %q, want the key registered without printing it", out)
+	}
+	if out := create(); !strings.Contains(out, "already registered") {
+		t.Fatalf("second create: got %q, want the key already registered", out)
+	}
+
+	repo, err := repository.OpenQuiet("", dbPath)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer repo.Close()
+	stored, err := repo.GetAPIKeyByPrefix(ctx, prefix)
+	if err != nil {
+		t.Fatalf("get key: %v", err)
+	}
+	if !matchAPIKey(key, stored.Hash) {
+		t.Fatalf("stored hash does not match the key in the file")
+	}
+
+	if err := os.WriteFile(keyFile, []byte("not-a-key"), 0o600); err != nil {
+		t.Fatalf("write key file: %v", err)
+	}
+	args := []string{"create", "--name", "bad", "--subject", "bad", "--key-file", keyFile}
+	if err := Command(ctx, args, "", dbPath, &bytes.Buffer{}); err == nil || strings.Contains(err.Error(), "not-a-key") {
+		t.Fatalf("malformed key file: got %v, want an error that does not echo the file", err)
+	}
+}
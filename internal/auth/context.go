@@ -0,0 +1,60 @@
+// Package auth identifies the caller of a request
+package auth
+
+import (
+	"context"
+	"slices"
+)
+
+// Authentication methods. MethodSystem marks the principal of work the
+// system starts itself rather than a caller.
+const (
+	MethodJWT    = "jwt"
+	MethodAPIKey = "api_key"
+	MethodSystem = "system"
+)
+
+// RoleService is held by other services of the system, such as transfers-api
+// calling the internal routes of accounts-api
+const RoleService = "service"
+
+// Principal is the authenticated caller of a request. CustomerID is set when
+// the caller acts on behalf of a customer; permissions granted for own
+// resources only then reach that customer's accounts. Permissions are
+// resolved from Roles by the policy when the principal authenticates.
+type Principal struct {
+	Subject     string
+	CustomerID  uint
+	Roles       []string
+	Method      string
+	Permissions map[Permission]Scope
+}
+
+// HasRole reports whether the principal holds role
+func (p *Principal) HasRole(role string) bool {
+	return slices.Contains(p.Roles, role)
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying p
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// System returns a copy of ctx carrying the principal of a component that
+// runs without a caller, such as the saga relay, the scheduler or a CLI
+// command. It holds every permission on every resource.
+func System(ctx context.Context, subject string) context.Context {
+	p := &Principal{Subject: subject, Method: MethodSystem, Permissions: make(map[Permission]Scope, len(knownPermissions))}
+	for perm := range knownPermissions {
+		p.Permissions[perm] = ScopeAll
+	}
+	return WithPrincipal(ctx, p)
+}
+
+// FromContext returns the principal stored in ctx, if any
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Permission allows an operation on a resource
+type Permission string
+
+// Permissions checked by the API routes and service methods
+const (
+	PermAccountsRead      Permission = "accounts:read"
+	PermAccountsCreate    Permission = "accounts:create"
+	PermAccountsDeposit   Permission = "accounts:deposit"
+	PermAccountsWithdraw  Permission = "accounts:withdraw"
+	PermAccountsFreeze    Permission = "accounts:freeze"
+	PermAccountsClose     Permission = "accounts:close"
+	PermAccountsOwners    Permission = "accounts:owners"
+	PermAccountsOverdraft Permission = "accounts:overdraft"
+	PermCustomersRead     Permission = "customers:read"
+	PermCustomersWrite    Permission = "customers:write"
+	PermTransfersRead     Permission = "transfers:read"
+	PermTransfersCreate   Permission = "transfers:create"
+	PermTransfersReverse  Permission = "transfers:reverse"
+	PermTransfersSchedule Permission = "transfers:schedule"
+	PermLedgerVerify      Permission = "ledger:verify"
+	PermAuditRead         Permission = "audit:read"
+)
+
+// ownScoped lists the permissions that can be granted for the caller's own
+// resources only, by appending ":own"
+var ownScoped = map[Permission]bool{
+	PermAccountsRead:      true,
+	PermCustomersRead:     true,
+	PermTransfersRead:     true,
+	PermTransfersCreate:   true,
+	PermTransfersSchedule: true,
+}
+
+var knownPermissions = map[Permission]bool{
+	PermAccountsRead: true, PermAccountsCreate: true, PermAccountsDeposit: true,
+	PermAccountsWithdraw: true, PermAccountsFreeze: true, PermAccountsClose: true,
+	PermAccountsOwners: true, PermAccountsOverdraft: true, PermCustomersRead: true,
+	PermCustomersWrite: true, PermTransfersRead: true, PermTransfersCreate: true,
+	PermTransfersReverse: true, PermTransfersSchedule: true, PermLedgerVerify: true,
+	PermAuditRead: true,
+}
+
+// Scope is how far a permission reaches
+type Scope int
+
+const (
+	// ScopeNone denies the permission
+	ScopeNone Scope = iota
+	// ScopeOwn grants it on the resources of the principal's customer
+	ScopeOwn
+	// ScopeAll grants it on every resource
+	ScopeAll
+)
+
+// Policy maps roles to the permissions they grant. In a policy file each
+// role lists permissions such as "accounts:read", "accounts:read:own" for
+// the caller's own accounts only, or "*" for all of them:
+//
+//	{"roles": {"auditor": ["accounts:read", "audit:read"]}}
+type Policy struct {
+	roles map[string]map[Permission]Scope
+}
+
+// DefaultPolicy is used when no policy file is configured. It matches
+// config/rbac-policy.json.
+var DefaultPolicy = mustPolicy(map[string][]string{
+	"admin": {"*"},
+	"teller": {
+		"accounts:read", "accounts:create", "accounts:deposit", "accounts:withdraw",
+		"accounts:freeze", "accounts:owners", "customers:read", "customers:write",
+		"transfers:read", "transfers:create", "transfers:schedule",
+	},
+	"customer": {
+		"accounts:read:own", "customers:read:own", "transfers:read:own", "transfers:create:own",
+		"transfers:schedule:own",
+	},
+	"auditor": {
+		"accounts:read", "customers:read", "transfers:read", "ledger:verify", "audit:read",
+	},
+	// transfers-api resolves accounts through the internal routes of
+	// accounts-api, which are otherwise reserved to this role
+	RoleService: {"accounts:read"},
+})
+
+// NewPolicy builds a policy from the permissions granted to each role
+func NewPolicy(roles map[string][]string) (*Policy, error) {
+	p := &Policy{roles: make(map[string]map[Permission]Scope, len(roles))}
+	for role, grants := range roles {
+		perms := make(map[Permission]Scope, len(grants))
+		for _, grant := range grants {
+			if grant == "*" {
+				for perm := range knownPermissions {
+					perms[perm] = ScopeAll
+				}
+				continue
+			}
+			perm, scope := Permission(grant), ScopeAll
+			if base, ok := strings.CutSuffix(grant, ":own"); ok {
+				perm, scope = Permission(base), ScopeOwn
+				if !ownScoped[perm] {
+					return nil, fmt.Errorf("role %q: %s cannot be limited to own resources", role, base)
+				}
+			}
+			if !knownPermissions[perm] {
+				return nil, fmt.Errorf("role %q: unknown permission %q", role, grant)
+			}
+			perms[perm] = max(perms[perm], scope)
+		}
+		p.roles[role] = perms
+	}
+	return p, nil
+}
+
+func mustPolicy(roles map[string][]string) *Policy {
+	p, err := NewPolicy(roles)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// LoadPolicy reads a policy file
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+	var file struct {
+		Roles map[string][]string `json:"roles"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse policy file: %w", err)
+	}
+	if len(file.Roles) == 0 {
+		return nil, fmt.Errorf("policy file %s defines no roles", path)
+	}
+	return NewPolicy(file.Roles)
+}
+
+// Roles returns the roles the policy defines, sorted
+func (p *Policy) Roles() []string {
+	roles := make([]string, 0, len(p.roles))
+	for role := range p.roles {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+// Permissions returns the widest scope each permission is granted with to
+// any of roles. Roles the policy does not define grant nothing.
+func (p *Policy) Permissions(roles []string) map[Permission]Scope {
+	perms := make(map[Permission]Scope)
+	for _, role := range roles {
+		for perm, scope := range p.roles[role] {
+			perms[perm] = max(perms[perm], scope)
+		}
+	}
+	return perms
+}
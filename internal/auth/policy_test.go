@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/tribal/bank-api/internal/models"
+)
+
+func TestDefaultPolicyMatchesPolicyFile(t *testing.T) {
+	file, err := LoadPolicy("../../config/rbac-policy.json")
+	if err != nil {
+		t.Fatalf("load policy: %v", err)
+	}
+	if !reflect.DeepEqual(file.roles, DefaultPolicy.roles) {
+		t.Fatalf("config/rbac-policy.json and DefaultPolicy differ:\nfile:    %v\ndefault: %v", file.roles, DefaultPolicy.roles)
+	}
+}
+
+func TestNewPolicyRejectsUnknownPermissions(t *testing.T) {
+	for _, grant := range []string{"accounts:delete", "audit:read:own", ""} {
+		if _, err := NewPolicy(map[string][]string{"role": {grant}}); err == nil {
+			t.Fatalf("grant %q was accepted", grant)
+		}
+	}
+}
+
+func TestAuthorizeScopes(t *testing.T) {
+	alice := &models.Account{Owners: []models.Customer{{ID: 1}}}
+	bob := &models.Account{Owners: []models.Customer{{ID: 2}}}
+	principal := func(customerID uint, roles ...string) context.Context {
+		p := &Principal{Subject: "test", CustomerID: customerID, Roles: roles}
+		p.Permissions = DefaultPolicy.Permissions(p.Roles)
+		return WithPrincipal(context.Background(), p)
+	}
+
+	customer := principal(1, "customer")
+	if err := AuthorizeAccount(customer, PermTransfersCreate, alice); err != nil {
+		t.Fatalf("customer sending from own account: %v", err)
+	}
+	if err := AuthorizeAccount(customer, PermTransfersCreate, bob); !errors.Is(err, models.ErrNotAccountOwner) {
+		t.Fatalf("customer sending from another account: got %v, want ErrNotAccountOwner", err)
+	}
+	if err := Authorize(customer, PermTransfersReverse); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("customer reversing: got %v, want ErrForbidden", err)
+	}
+	if id, err := CustomerScope(customer, PermAccountsRead); err != nil || id != 1 {
+		t.Fatalf("customer account scope: %d, %v", id, err)
+	}
+	if err := AuthorizeAnyAccount(customer, PermTransfersRead, bob, alice); err != nil {
+		t.Fatalf("customer reading a transfer into own account: %v", err)
+	}
+	if err := AuthorizeAnyAccount(customer, PermTransfersRead, bob, nil); !errors.Is(err, models.ErrNotAccountOwner) {
+		t.Fatalf("customer reading a transfer between other accounts: got %v, want ErrNotAccountOwner", err)
+	}
+	if _, err := CustomerScope(principal(0, "customer"), PermAccountsRead); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("own scope without customer: got %v, want ErrForbidden", err)
+	}
+
+	teller := principal(0, "teller")
+	if err := AuthorizeAccount(teller, PermAccountsRead, bob); err != nil {
+		t.Fatalf("teller reading any account: %v", err)
+	}
+	if err := Authorize(teller, PermAccountsClose); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("teller closing: got %v, want ErrForbidden", err)
+	}
+	if err := Authorize(principal(0, "auditor", "teller"), PermAuditRead); err != nil {
+		t.Fatalf("roles combine: %v", err)
+	}
+	if err := Authorize(context.Background(), PermAccountsRead); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("call without principal: got %v, want ErrForbidden", err)
+	}
+	if err := Authorize(System(context.Background(), "relay"), PermAccountsClose); err != nil {
+		t.Fatalf("system call: %v", err)
+	}
+}
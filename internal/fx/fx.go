@@ -0,0 +1,152 @@
+package fx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/tribal/bank-api/pkg/money"
+)
+
+// rateDecimals is the precision rates are rounded to before being applied, so
+// the rate recorded on a transfer is exactly the one used for the conversion.
+const rateDecimals = 10
+
+var (
+	ErrUnsupportedPair = errors.New("no exchange rate for currency pair")
+	ErrInvalidRate     = errors.New("invalid exchange rate")
+)
+
+// Rate is an exchange rate: one unit of From buys Value units of To
+type Rate struct {
+	From  money.Currency
+	To    money.Currency
+	Value *big.Rat
+}
+
+// String returns the rate as a fixed-point decimal
+func (r Rate) String() string {
+	return r.Value.FloatString(rateDecimals)
+}
+
+// RateProvider resolves exchange rates between currencies
+type RateProvider interface {
+	Rate(ctx context.Context, from, to money.Currency) (Rate, error)
+}
+
+// Convert applies the rate to an amount in rate.From, returning the amount in
+// rate.To rounded half-to-even to the target currency's minor units.
+func Convert(amount money.Money, rate Rate) (money.Money, error) {
+	if amount.Currency != rate.From {
+		return money.Money{}, fmt.Errorf("%w: amount in %s, rate from %s", money.ErrCurrencyMismatch, amount.Currency, rate.From)
+	}
+
+	// minor_to = minor_from * rate * 10^(exp_to - exp_from)
+	v := new(big.Rat).SetInt64(amount.Minor)
+	v.Mul(v, rate.Value)
+	shift := rate.To.Exponent() - rate.From.Exponent()
+	pow := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(shift))), nil))
+	if shift >= 0 {
+		v.Mul(v, pow)
+	} else {
+		v.Quo(v, pow)
+	}
+
+	minor := roundHalfEven(v)
+	if !minor.IsInt64() {
+		return money.Money{}, money.ErrOverflow
+	}
+	return money.New(minor.Int64(), rate.To), nil
+}
+
+func roundHalfEven(v *big.Rat) *big.Int {
+	q, r := new(big.Int).QuoRem(v.Num(), v.Denom(), new(big.Int))
+	// Compare 2*|r| with the denominator to decide the direction
+	twice := new(big.Int).Mul(new(big.Int).Abs(r), big.NewInt(2))
+	switch twice.Cmp(v.Denom()) {
+	case 1:
+		return q.Add(q, big.NewInt(int64(v.Sign())))
+	case 0:
+		if q.Bit(0) == 1 {
+			return q.Add(q, big.NewInt(int64(v.Sign())))
+		}
+	}
+	return q
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// StaticProvider serves rates from a fixed table quoted against a base
+// currency. Cross rates are derived through the base, so it works offline.
+type StaticProvider struct {
+	base  money.Currency
+	rates map[money.Currency]*big.Rat
+}
+
+// NewStaticProvider builds a provider from decimal rates, where rates[c] is
+// the number of units of c that one unit of base buys.
+func NewStaticProvider(base money.Currency, rates map[money.Currency]string) (*StaticProvider, error) {
+	p := &StaticProvider{
+		base:  base,
+		rates: map[money.Currency]*big.Rat{base: big.NewRat(1, 1)},
+	}
+	for currency, value := range rates {
+		r, ok := new(big.Rat).SetString(value)
+		if !ok || r.Sign() <= 0 {
+			return nil, fmt.Errorf("%w: %s=%q", ErrInvalidRate, currency, value)
+		}
+		p.rates[currency] = r
+	}
+	return p, nil
+}
+
+type rateFile struct {
+	Base  money.Currency            `json:"base"`
+	Rates map[money.Currency]string `json:"rates"`
+}
+
+// LoadFile reads a JSON rate table such as
+//
+//	{"base": "USD", "rates": {"EUR": "0.92", "GBP": "0.79"}}
+func LoadFile(path string) (*StaticProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rates file: %w", err)
+	}
+
+	var f rateFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse rates file: %w", err)
+	}
+	if f.Base == "" {
+		f.Base = money.DefaultCurrency
+	}
+
+	return NewStaticProvider(f.Base, f.Rates)
+}
+
+// Rate returns the rate from one currency to another via the base currency
+func (p *StaticProvider) Rate(ctx context.Context, from, to money.Currency) (Rate, error) {
+	fromRate, ok := p.rates[from]
+	if !ok {
+		return Rate{}, fmt.Errorf("%w: %s/%s", ErrUnsupportedPair, from, to)
+	}
+	toRate, ok := p.rates[to]
+	if !ok {
+		return Rate{}, fmt.Errorf("%w: %s/%s", ErrUnsupportedPair, from, to)
+	}
+
+	value := new(big.Rat).Quo(toRate, fromRate)
+	// Round to the published precision so the recorded rate is the applied one
+	value, _ = new(big.Rat).SetString(value.FloatString(rateDecimals))
+
+	return Rate{From: from, To: to, Value: value}, nil
+}
@@ -0,0 +1,126 @@
+package fx
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tribal/bank-api/pkg/money"
+)
+
+func rate(from, to money.Currency, value string) Rate {
+	r, ok := new(big.Rat).SetString(value)
+	if !ok {
+		panic("invalid rate " + value)
+	}
+	return Rate{From: from, To: to, Value: r}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount money.Money
+		rate   Rate
+		want   money.Money
+	}{
+		{"exact", money.New(10000, "USD"), rate("USD", "EUR", "0.92"), money.New(9200, "EUR")},
+		{"tie rounds down to even", money.New(125, "KWD"), rate("KWD", "USD", "1"), money.New(12, "USD")},
+		{"tie rounds up to even", money.New(135, "KWD"), rate("KWD", "USD", "1"), money.New(14, "USD")},
+		{"negative tie", money.New(-125, "KWD"), rate("KWD", "USD", "1"), money.New(-12, "USD")},
+		{"negative tie up", money.New(-135, "KWD"), rate("KWD", "USD", "1"), money.New(-14, "USD")},
+		{"above half", money.New(1, "USD"), rate("USD", "EUR", "0.51"), money.New(1, "EUR")},
+		{"below half", money.New(1, "USD"), rate("USD", "EUR", "0.49"), money.New(0, "EUR")},
+		{"tie through rate", money.New(1, "USD"), rate("USD", "EUR", "0.5"), money.New(0, "EUR")},
+		{"to zero decimals", money.New(101, "USD"), rate("USD", "JPY", "150.5"), money.New(152, "JPY")},
+		{"to zero decimals tie", money.New(100, "USD"), rate("USD", "JPY", "2.5"), money.New(2, "JPY")},
+		{"to zero decimals tie up", money.New(100, "USD"), rate("USD", "JPY", "3.5"), money.New(4, "JPY")},
+		{"from zero decimals", money.New(1000, "JPY"), rate("JPY", "USD", "0.0066445183"), money.New(664, "USD")},
+		{"to three decimals", money.New(100, "USD"), rate("USD", "KWD", "0.3075"), money.New(308, "KWD")},
+		{"three to zero decimals", money.New(1500, "KWD"), rate("KWD", "JPY", "487.5"), money.New(731, "JPY")},
+		{"zero", money.New(0, "USD"), rate("USD", "EUR", "0.92"), money.New(0, "EUR")},
+	}
+	for _, tt := range tests {
+		got, err := Convert(tt.amount, tt.rate)
+		if err != nil || got != tt.want {
+			t.Errorf("%s: %s %s at %s: got %s %s, %v, want %s %s",
+				tt.name, tt.amount, tt.amount.Currency, tt.rate, got, got.Currency, err, tt.want, tt.want.Currency)
+		}
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+	if _, err := Convert(money.New(100, "GBP"), rate("USD", "EUR", "0.92")); !errors.Is(err, money.ErrCurrencyMismatch) {
+		t.Errorf("amount in another currency: got %v, want ErrCurrencyMismatch", err)
+	}
+	if _, err := Convert(money.New(math.MaxInt64, "USD"), rate("USD", "JPY", "150")); !errors.Is(err, money.ErrOverflow) {
+		t.Errorf("overflow: got %v, want ErrOverflow", err)
+	}
+}
+
+func TestStaticProvider(t *testing.T) {
+	p, err := NewStaticProvider("USD", map[money.Currency]string{"EUR": "0.92", "GBP": "0.79", "JPY": "150"})
+	if err != nil {
+		t.Fatalf("new provider: %v", err)
+	}
+
+	tests := []struct {
+		from, to money.Currency
+		want     string
+	}{
+		{"USD", "EUR", "0.9200000000"},
+		{"USD", "USD", "1.0000000000"},
+		// Inverse rates are 1/rate rounded to the published precision
+		{"EUR", "USD", "1.0869565217"},
+		{"JPY", "USD", "0.0066666667"},
+		// Cross rates go through the base
+		{"EUR", "GBP", "0.8586956522"},
+		{"GBP", "EUR", "1.1645569620"},
+		{"EUR", "JPY", "163.0434782609"},
+	}
+	for _, tt := range tests {
+		r, err := p.Rate(context.Background(), tt.from, tt.to)
+		if err != nil || r.String() != tt.want || r.From != tt.from || r.To != tt.to {
+			t.Errorf("%s/%s: got %s, %v, want %s", tt.from, tt.to, r, err, tt.want)
+		}
+	}
+
+	// The recorded rate is the applied one: converting with it is exact
+	r, _ := p.Rate(context.Background(), "EUR", "USD")
+	if got, _ := Convert(money.New(10000000000, "EUR"), r); got != money.New(10869565217, "USD") {
+		t.Errorf("convert with inverse rate: got %s", got)
+	}
+
+	for _, pair := range [][2]money.Currency{{"USD", "CHF"}, {"CHF", "USD"}, {"CHF", "SEK"}} {
+		if _, err := p.Rate(context.Background(), pair[0], pair[1]); !errors.Is(err, ErrUnsupportedPair) {
+			t.Errorf("%s/%s: got %v, want ErrUnsupportedPair", pair[0], pair[1], err)
+		}
+	}
+}
+
+func TestNewStaticProviderRejectsInvalidRates(t *testing.T) {
+	for _, value := range []string{"0", "-1.2", "abc", ""} {
+		if _, err := NewStaticProvider("USD", map[money.Currency]string{"EUR": value}); !errors.Is(err, ErrInvalidRate) {
+			t.Errorf("rate %q: got %v, want ErrInvalidRate", value, err)
+		}
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.json")
+	if err := os.WriteFile(path, []byte(`{"rates": {"EUR": "0.92"}}`), 0o644); err != nil {
+		t.Fatalf("write rates: %v", err)
+	}
+
+	p, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	// The base defaults to the default currency
+	if r, err := p.Rate(context.Background(), money.DefaultCurrency, "EUR"); err != nil || r.String() != "0.9200000000" {
+		t.Fatalf("rate from default base: got %s, %v", r, err)
+	}
+}
@@ -1,12 +1,17 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/tribal/bank-api/internal/accountsclient"
+	"github.com/tribal/bank-api/internal/auth"
 	"github.com/tribal/bank-api/internal/models"
 	"github.com/tribal/bank-api/internal/service"
+	"github.com/tribal/bank-api/pkg/money"
 )
 
 type AccountHandler struct {
@@ -20,17 +25,32 @@ func NewAccountHandler(accountService *service.AccountService) *AccountHandler {
 }
 
 // ListAccounts godoc
-// @Summary List all accounts
-// @Description Get a list of all bank accounts
+// @Summary List accounts
+// @Description Get a page of bank accounts
 // @Tags accounts
 // @Accept json
 // @Produce json
-// @Success 200 {array} models.Account
+// @Param limit query int false "Page size (default 50, max 200)"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param sort query string false "id, created_at, account_number or balance; prefix with - for descending"
+// @Param from query string false "Created at or after (RFC 3339 or date)"
+// @Param to query string false "Created before (RFC 3339 or date)"
+// @Param currency query string false "Currency"
+// @Param min_amount query string false "Minimum balance"
+// @Param max_amount query string false "Maximum balance"
+// @Param status query string false "active, frozen or closed"
+// @Success 200 {object} models.Page[models.Account]
 // @Router /api/accounts [get]
 func (h *AccountHandler) ListAccounts(c *gin.Context) {
-	accounts, err := h.accountService.ListAccounts(c.Request.Context())
+	var q models.ListQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	accounts, err := h.accountService.ListAccounts(c.Request.Context(), q)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
 
@@ -56,7 +76,7 @@ func (h *AccountHandler) GetAccount(c *gin.Context) {
 
 	account, err := h.accountService.GetAccount(c.Request.Context(), uint(id))
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "account not found"})
+		writeError(c, err)
 		return
 	}
 
@@ -81,7 +101,7 @@ func (h *AccountHandler) CreateAccount(c *gin.Context) {
 
 	account, err := h.accountService.CreateAccount(c.Request.Context(), req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
 
@@ -90,12 +110,21 @@ func (h *AccountHandler) CreateAccount(c *gin.Context) {
 
 // GetAccountTransactions godoc
 // @Summary Get account transactions
-// @Description Get all transactions for a specific account
+// @Description Get a page of transactions for a specific account
 // @Tags accounts
 // @Accept json
 // @Produce json
 // @Param id path int true "Account ID"
-// @Success 200 {array} models.Transaction
+// @Param limit query int false "Page size (default 50, max 200)"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param sort query string false "created_at (default -created_at), amount or id; prefix with - for descending"
+// @Param from query string false "Created at or after (RFC 3339 or date)"
+// @Param to query string false "Created before (RFC 3339 or date)"
+// @Param type query string false "Transaction type"
+// @Param reference query string false "Reference"
+// @Param min_amount query string false "Minimum absolute amount"
+// @Param max_amount query string false "Maximum absolute amount"
+// @Success 200 {object} models.Page[models.Transaction]
 // @Router /api/accounts/{id}/transactions [get]
 func (h *AccountHandler) GetAccountTransactions(c *gin.Context) {
 	idParam := c.Param("id")
@@ -105,11 +134,408 @@ func (h *AccountHandler) GetAccountTransactions(c *gin.Context) {
 		return
 	}
 
-	transactions, err := h.accountService.GetAccountTransactions(c.Request.Context(), uint(id))
+	var q models.ListQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	transactions, err := h.accountService.GetAccountTransactions(c.Request.Context(), uint(id), q)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, transactions)
 }
+
+// Deposit godoc
+// @Summary Deposit money
+// @Description Add money to an account
+// @Tags accounts
+// @Accept json
+// @Produce json
+// @Param id path int true "Account ID"
+// @Param deposit body models.CashTransactionRequest true "Deposit data"
+// @Success 201 {object} models.Transaction
+// @Router /api/accounts/{id}/deposits [post]
+func (h *AccountHandler) Deposit(c *gin.Context) {
+	h.cashTransaction(c, h.accountService.Deposit)
+}
+
+// Withdraw godoc
+// @Summary Withdraw money
+// @Description Take money out of an account
+// @Tags accounts
+// @Accept json
+// @Produce json
+// @Param id path int true "Account ID"
+// @Param withdrawal body models.CashTransactionRequest true "Withdrawal data"
+// @Success 201 {object} models.Transaction
+// @Router /api/accounts/{id}/withdrawals [post]
+func (h *AccountHandler) Withdraw(c *gin.Context) {
+	h.cashTransaction(c, h.accountService.Withdraw)
+}
+
+func (h *AccountHandler) cashTransaction(c *gin.Context, apply func(context.Context, uint, models.CashTransactionRequest) (*models.Transaction, error)) {
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid account id"})
+		return
+	}
+
+	var req models.CashTransactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	transaction, err := apply(c.Request.Context(), uint(id), req)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, transaction)
+}
+
+// FreezeAccount godoc
+// @Summary Freeze an account
+// @Description Block all incoming and outgoing movements of an active account
+// @Tags accounts
+// @Accept json
+// @Produce json
+// @Param id path int true "Account ID"
+// @Param request body models.AccountStatusRequest true "Reason code"
+// @Success 200 {object} models.Account
+// @Router /api/accounts/{id}/freeze [post]
+func (h *AccountHandler) FreezeAccount(c *gin.Context) {
+	h.changeStatus(c, models.AccountActionFreeze)
+}
+
+// UnfreezeAccount godoc
+// @Summary Unfreeze an account
+// @Description Return a frozen account to active
+// @Tags accounts
+// @Accept json
+// @Produce json
+// @Param id path int true "Account ID"
+// @Param request body models.AccountStatusRequest true "Reason code"
+// @Success 200 {object} models.Account
+// @Router /api/accounts/{id}/unfreeze [post]
+func (h *AccountHandler) UnfreezeAccount(c *gin.Context) {
+	h.changeStatus(c, models.AccountActionUnfreeze)
+}
+
+// CloseAccount godoc
+// @Summary Close an account
+// @Description Close an active or frozen account. The balance must be zero.
+// @Tags accounts
+// @Accept json
+// @Produce json
+// @Param id path int true "Account ID"
+// @Param request body models.AccountStatusRequest true "Reason code"
+// @Success 200 {object} models.Account
+// @Router /api/accounts/{id}/close [post]
+func (h *AccountHandler) CloseAccount(c *gin.Context) {
+	h.changeStatus(c, models.AccountActionClose)
+}
+
+// ReopenAccount godoc
+// @Summary Reopen an account
+// @Description Return a closed account to active
+// @Tags accounts
+// @Accept json
+// @Produce json
+// @Param id path int true "Account ID"
+// @Param request body models.AccountStatusRequest true "Reason code"
+// @Success 200 {object} models.Account
+// @Router /api/accounts/{id}/reopen [post]
+func (h *AccountHandler) ReopenAccount(c *gin.Context) {
+	h.changeStatus(c, models.AccountActionReopen)
+}
+
+func (h *AccountHandler) changeStatus(c *gin.Context, action models.AccountAction) {
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid account id"})
+		return
+	}
+
+	var req models.AccountStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	account, err := h.accountService.ChangeStatus(c.Request.Context(), uint(id), action, req)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
+}
+
+// SetOverdraft godoc
+// @Summary Set the overdraft limit of an account
+// @Description Let the account be debited down to minus the limit. Zero removes the overdraft; the limit cannot go below the overdraft drawn.
+// @Tags accounts
+// @Accept json
+// @Produce json
+// @Param id path int true "Account ID"
+// @Param request body models.OverdraftRequest true "Overdraft limit"
+// @Success 200 {object} models.Account
+// @Router /api/accounts/{id}/overdraft [put]
+func (h *AccountHandler) SetOverdraft(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid account id"})
+		return
+	}
+
+	var req models.OverdraftRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	account, err := h.accountService.SetOverdraft(c.Request.Context(), uint(id), req)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
+}
+
+// AddAccountOwner godoc
+// @Summary Add an account owner
+// @Description Make a customer an owner of the account. Accounts with several owners are joint accounts.
+// @Tags accounts
+// @Accept json
+// @Produce json
+// @Param id path int true "Account ID"
+// @Param owner body models.AccountOwnerRequest true "Customer to add"
+// @Success 200 {object} models.Account
+// @Router /api/accounts/{id}/owners [post]
+func (h *AccountHandler) AddAccountOwner(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid account id"})
+		return
+	}
+
+	var req models.AccountOwnerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	account, err := h.accountService.AddOwner(c.Request.Context(), uint(id), req)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
+}
+
+// RemoveAccountOwner godoc
+// @Summary Remove an account owner
+// @Description Stop a customer from owning the account. The last owner cannot be removed.
+// @Tags accounts
+// @Produce json
+// @Param id path int true "Account ID"
+// @Param customer_id path int true "Customer ID"
+// @Success 200 {object} models.Account
+// @Router /api/accounts/{id}/owners/{customer_id} [delete]
+func (h *AccountHandler) RemoveAccountOwner(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid account id"})
+		return
+	}
+	customerID, err := strconv.ParseUint(c.Param("customer_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid customer id"})
+		return
+	}
+
+	account, err := h.accountService.RemoveOwner(c.Request.Context(), uint(id), uint(customerID))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
+}
+
+// GetAccountByNumber godoc
+// @Summary Get account by number (internal)
+// @Description Resolve an account by its account number. Used by transfers-api.
+// @Tags internal
+// @Produce json
+// @Param number path string true "Account number"
+// @Success 200 {object} models.Account
+// @Router /internal/account-numbers/{number} [get]
+func (h *AccountHandler) GetAccountByNumber(c *gin.Context) {
+	account, err := h.accountService.GetAccountByNumber(c.Request.Context(), c.Param("number"))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
+}
+
+// PostEntry godoc
+// @Summary Post a balance entry (internal)
+// @Description Atomically apply a signed amount to an account and record the transaction. Used by transfers-api.
+// @Tags internal
+// @Accept json
+// @Produce json
+// @Param id path int true "Account ID"
+// @Param entry body models.AccountEntry true "Entry data"
+// @Success 200 {object} models.Account
+// @Router /internal/accounts/{id}/entries [post]
+func (h *AccountHandler) PostEntry(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid account id"})
+		return
+	}
+
+	var entry models.AccountEntry
+	if err := c.ShouldBindJSON(&entry); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	account, err := h.accountService.PostEntry(c.Request.Context(), uint(id), entry)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
+}
+
+// PlaceHold godoc
+// @Summary Place a hold on an account (internal)
+// @Description Reserve part of the available balance of an account without moving money. Used by transfers-api to authorize transfers.
+// @Tags internal
+// @Accept json
+// @Produce json
+// @Param id path int true "Account ID"
+// @Param hold body models.AccountHoldRequest true "Hold data"
+// @Success 200 {object} models.Account
+// @Router /internal/accounts/{id}/holds [post]
+func (h *AccountHandler) PlaceHold(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid account id"})
+		return
+	}
+
+	var req models.AccountHoldRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	account, err := h.accountService.PlaceHold(c.Request.Context(), uint(id), req)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
+}
+
+// ReleaseHold godoc
+// @Summary Release a hold (internal)
+// @Description Give the amount of an active hold back to the available balance of the account. Used by transfers-api to void and expire transfers.
+// @Tags internal
+// @Produce json
+// @Param id path int true "Account ID"
+// @Param key path string true "Hold key"
+// @Success 200 {object} models.Account
+// @Router /internal/accounts/{id}/holds/{key}/release [post]
+func (h *AccountHandler) ReleaseHold(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid account id"})
+		return
+	}
+
+	account, err := h.accountService.ReleaseHold(c.Request.Context(), uint(id), c.Param("key"))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
+}
+
+// writeError maps domain errors to HTTP statuses and includes their wire code
+// so other services can tell them apart
+func writeError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, models.ErrAccountNotFound), errors.Is(err, models.ErrTransferNotFound),
+		errors.Is(err, models.ErrCustomerNotFound), errors.Is(err, models.ErrOwnerNotFound),
+		errors.Is(err, models.ErrScheduleNotFound), errors.Is(err, models.ErrHoldNotFound),
+		errors.Is(err, models.ErrBatchNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, models.ErrNotAccountOwner), errors.Is(err, auth.ErrForbidden):
+		status = http.StatusForbidden
+	case errors.Is(err, models.ErrInsufficientBalance), errors.Is(err, models.ErrConcurrentUpdate),
+		errors.Is(err, models.ErrTransferNotReversible), errors.Is(err, models.ErrReversalExceedsAmount),
+		errors.Is(err, models.ErrReversalFailed), errors.Is(err, models.ErrTransferFailed),
+		errors.Is(err, models.ErrAccountFrozen),
+		errors.Is(err, models.ErrAccountClosed), errors.Is(err, models.ErrInvalidStatusTransition),
+		errors.Is(err, models.ErrBalanceNotZero), errors.Is(err, models.ErrCustomerExists),
+		errors.Is(err, models.ErrAccountExists),
+		errors.Is(err, models.ErrCustomerHasAccounts), errors.Is(err, models.ErrOwnerExists),
+		errors.Is(err, models.ErrLastOwner), errors.Is(err, models.ErrOverdraftInUse),
+		errors.Is(err, models.ErrInvalidScheduleTransition), errors.Is(err, models.ErrTransferNotAuthorized),
+		errors.Is(err, models.ErrHoldExpired), errors.Is(err, models.ErrHoldNotActive):
+		status = http.StatusConflict
+	case errors.Is(err, models.ErrTransferRateExceeded):
+		status = http.StatusTooManyRequests
+	case errors.Is(err, models.ErrCurrencyMismatch), errors.Is(err, models.ErrDailyAmountExceeded),
+		errors.Is(err, models.ErrTransferAmountRange), errors.Is(err, models.ErrTierLimitExceeded):
+		status = http.StatusUnprocessableEntity
+	case errors.Is(err, money.ErrInvalidAmount), errors.Is(err, money.ErrTooManyDecimals),
+		errors.Is(err, money.ErrInvalidCurrency), errors.Is(err, money.ErrOverflow),
+		errors.Is(err, models.ErrInvalidListQuery), errors.Is(err, models.ErrInvalidStatusReason),
+		errors.Is(err, models.ErrUnknownTier), errors.Is(err, models.ErrInvalidSchedule),
+		errors.Is(err, models.ErrInvalidBatch), errors.Is(err, models.ErrInvalidImport),
+		errors.Is(err, models.ErrInvalidStatement), errors.Is(err, models.ErrOccurredInFuture),
+		errors.Is(err, models.ErrSameAccount):
+		status = http.StatusBadRequest
+	// accounts-api could not be reached or failed; the request may succeed
+	// if retried, so the response must not be stored as its outcome
+	case errors.Is(err, accountsclient.ErrUnavailable):
+		status = http.StatusServiceUnavailable
+	case errors.As(err, new(*accountsclient.APIError)):
+		status = http.StatusBadGateway
+	}
+
+	body := gin.H{"error": err.Error()}
+	if code := models.ErrorCode(err); code != "" {
+		body["code"] = code
+	} else if code := auth.ErrorCode(err); code != "" {
+		body["code"] = code
+	}
+	c.JSON(status, body)
+}
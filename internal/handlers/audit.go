@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/internal/service"
+)
+
+type AuditHandler struct {
+	auditService *service.AuditService
+}
+
+func NewAuditHandler(auditService *service.AuditService) *AuditHandler {
+	return &AuditHandler{
+		auditService: auditService,
+	}
+}
+
+// ListAuditEntries godoc
+// @Summary List audit entries
+// @Description List the audit log of this service, newest first by default
+// @Tags audit
+// @Produce json
+// @Param limit query int false "Page size (default 50, max 200)"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param sort query string false "sequence or created_at; prefix with - for descending"
+// @Param from query string false "Created at or after (RFC 3339 or date)"
+// @Param to query string false "Created before (RFC 3339 or date)"
+// @Param action query string false "Action, e.g. account.created"
+// @Param entity_type query string false "account, transfer or reversal"
+// @Param entity_id query int false "Entity ID"
+// @Param actor query string false "Actor"
+// @Success 200 {object} models.Page[models.AuditEntry]
+// @Router /api/audit [get]
+func (h *AuditHandler) ListAuditEntries(c *gin.Context) {
+	var q models.ListQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	entries, err := h.auditService.ListEntries(c.Request.Context(), q)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
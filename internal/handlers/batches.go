@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tribal/bank-api/internal/models"
+)
+
+// CreateBatch godoc
+// @Summary Submit a batch of transfers
+// @Description Run up to 500 transfers in one request. Compensating batches hold every transfer, capture them only once all are held and reverse the captures made if a later one fails; this is best-effort compensation, not a transaction, and a batch whose capture or reversal cannot be confirmed ends in needs_attention with its money possibly moved. Best-effort batches run each transfer on its own and report the outcome of each.
+// @Tags batches
+// @Accept json
+// @Produce json
+// @Param batch body models.CreateTransferBatchRequest true "Batch data"
+// @Success 201 {object} models.TransferBatch
+// @Success 202 {object} models.TransferBatch
+// @Router /api/transfer-batches [post]
+func (h *TransferHandler) CreateBatch(c *gin.Context) {
+	var req models.CreateTransferBatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	batch, err := h.transferService.CreateBatch(c.Request.Context(), req)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	// Transfers still pending will be completed asynchronously
+	if batch.Status == models.TransferBatchStatusProcessing {
+		c.JSON(http.StatusAccepted, batch)
+		return
+	}
+
+	c.JSON(http.StatusCreated, batch)
+}
+
+// GetBatch godoc
+// @Summary Get transfer batch by ID
+// @Description Get a transfer batch with its summary and the outcome of each transfer
+// @Tags batches
+// @Produce json
+// @Param id path int true "Batch ID"
+// @Success 200 {object} models.TransferBatch
+// @Router /api/transfer-batches/{id} [get]
+func (h *TransferHandler) GetBatch(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid batch id"})
+		return
+	}
+
+	batch, err := h.transferService.GetBatch(c.Request.Context(), uint(id))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, batch)
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/internal/service"
+)
+
+type CustomerHandler struct {
+	customerService *service.CustomerService
+}
+
+func NewCustomerHandler(customerService *service.CustomerService) *CustomerHandler {
+	return &CustomerHandler{
+		customerService: customerService,
+	}
+}
+
+// ListCustomers godoc
+// @Summary List customers
+// @Description Get a page of customers
+// @Tags customers
+// @Produce json
+// @Param limit query int false "Page size (default 50, max 200)"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param sort query string false "id, created_at or name; prefix with - for descending"
+// @Param from query string false "Created at or after (RFC 3339 or date)"
+// @Param to query string false "Created before (RFC 3339 or date)"
+// @Success 200 {object} models.Page[models.Customer]
+// @Router /api/customers [get]
+func (h *CustomerHandler) ListCustomers(c *gin.Context) {
+	var q models.ListQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	customers, err := h.customerService.ListCustomers(c.Request.Context(), q)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, customers)
+}
+
+// GetCustomer godoc
+// @Summary Get customer by ID
+// @Description Get a customer by ID
+// @Tags customers
+// @Produce json
+// @Param id path int true "Customer ID"
+// @Success 200 {object} models.Customer
+// @Router /api/customers/{id} [get]
+func (h *CustomerHandler) GetCustomer(c *gin.Context) {
+	id, ok := customerID(c)
+	if !ok {
+		return
+	}
+
+	customer, err := h.customerService.GetCustomer(c.Request.Context(), id)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, customer)
+}
+
+// CreateCustomer godoc
+// @Summary Create a customer
+// @Description Create a customer. Email and external ID must be unique.
+// @Tags customers
+// @Accept json
+// @Produce json
+// @Param customer body models.CustomerRequest true "Customer data"
+// @Success 201 {object} models.Customer
+// @Router /api/customers [post]
+func (h *CustomerHandler) CreateCustomer(c *gin.Context) {
+	var req models.CustomerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	customer, err := h.customerService.CreateCustomer(c.Request.Context(), req)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, customer)
+}
+
+// UpdateCustomer godoc
+// @Summary Update a customer
+// @Description Replace the name, email and external ID of a customer
+// @Tags customers
+// @Accept json
+// @Produce json
+// @Param id path int true "Customer ID"
+// @Param customer body models.CustomerRequest true "Customer data"
+// @Success 200 {object} models.Customer
+// @Router /api/customers/{id} [put]
+func (h *CustomerHandler) UpdateCustomer(c *gin.Context) {
+	id, ok := customerID(c)
+	if !ok {
+		return
+	}
+
+	var req models.CustomerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	customer, err := h.customerService.UpdateCustomer(c.Request.Context(), id, req)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, customer)
+}
+
+// DeleteCustomer godoc
+// @Summary Delete a customer
+// @Description Delete a customer that owns no open accounts
+// @Tags customers
+// @Param id path int true "Customer ID"
+// @Success 204
+// @Router /api/customers/{id} [delete]
+func (h *CustomerHandler) DeleteCustomer(c *gin.Context) {
+	id, ok := customerID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.customerService.DeleteCustomer(c.Request.Context(), id); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListCustomerAccounts godoc
+// @Summary List a customer's accounts
+// @Description Get a page of the accounts a customer owns, alone or jointly
+// @Tags customers
+// @Produce json
+// @Param id path int true "Customer ID"
+// @Param limit query int false "Page size (default 50, max 200)"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param sort query string false "id, created_at, account_number or balance; prefix with - for descending"
+// @Param status query string false "active, frozen or closed"
+// @Param currency query string false "Currency"
+// @Success 200 {object} models.Page[models.Account]
+// @Router /api/customers/{id}/accounts [get]
+func (h *CustomerHandler) ListCustomerAccounts(c *gin.Context) {
+	id, ok := customerID(c)
+	if !ok {
+		return
+	}
+
+	var q models.ListQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	accounts, err := h.customerService.ListCustomerAccounts(c.Request.Context(), id, q)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, accounts)
+}
+
+// customerID parses the :id path parameter, answering 400 if it is invalid
+func customerID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid customer id"})
+		return 0, false
+	}
+	return uint(id), true
+}
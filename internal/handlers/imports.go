@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tribal/bank-api/internal/importer"
+	"github.com/tribal/bank-api/internal/models"
+)
+
+// ImportAccounts godoc
+// @Summary Import accounts from CSV
+// @Description Open an account per row of a CSV file with the columns account_number, currency, tier, initial_balance and owner_ids (separated by semicolons). The file is read as it is uploaded; rows that fail are reported by line and do not stop the import.
+// @Tags imports
+// @Accept text/csv
+// @Produce json
+// @Param dry_run query bool false "Validate the rows without importing them"
+// @Success 200 {object} models.ImportReport
+// @Router /api/imports/accounts [post]
+func (h *AccountHandler) ImportAccounts(c *gin.Context) {
+	var q models.ImportQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := importer.Accounts(c.Request.Context(), c.Request.Body, h.accountService, q.DryRun)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// ImportTransfers godoc
+// @Summary Import transfers from CSV
+// @Description Record a historical transfer per row of a CSV file with the columns from_account_number, to_account_number, amount, occurred_at and description, in order. The transfers are booked dated occurred_at without moving balances or counting towards limits. The file is read as it is uploaded; rows that fail are reported by line and do not stop the import.
+// @Tags imports
+// @Accept text/csv
+// @Produce json
+// @Param dry_run query bool false "Validate the rows without recording them"
+// @Success 200 {object} models.ImportReport
+// @Router /api/imports/transfers [post]
+func (h *TransferHandler) ImportTransfers(c *gin.Context) {
+	var q models.ImportQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := importer.Transfers(c.Request.Context(), c.Request.Body, h.transferService, q.DryRun)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
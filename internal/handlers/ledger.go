@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tribal/bank-api/internal/service"
+)
+
+type LedgerHandler struct {
+	ledgerService *service.LedgerService
+}
+
+func NewLedgerHandler(ledgerService *service.LedgerService) *LedgerHandler {
+	return &LedgerHandler{
+		ledgerService: ledgerService,
+	}
+}
+
+// VerifyLedger godoc
+// @Summary Verify the ledger
+// @Description Check that every journal entry balances and that account balances match their postings
+// @Tags ledger
+// @Produce json
+// @Success 200 {object} models.LedgerReport
+// @Router /api/ledger/verify [get]
+func (h *LedgerHandler) VerifyLedger(c *gin.Context) {
+	report, err := h.ledgerService.Verify(c.Request.Context())
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tribal/bank-api/internal/models"
+)
+
+// CreateSchedule godoc
+// @Summary Schedule a transfer
+// @Description Schedule a future-dated transfer, or one that recurs daily, weekly or monthly
+// @Tags schedules
+// @Accept json
+// @Produce json
+// @Param schedule body models.CreateScheduleRequest true "Schedule data"
+// @Success 201 {object} models.TransferSchedule
+// @Router /api/schedules [post]
+func (h *TransferHandler) CreateSchedule(c *gin.Context) {
+	var req models.CreateScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	schedule, err := h.transferService.CreateSchedule(c.Request.Context(), req)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, schedule)
+}
+
+// ListSchedules godoc
+// @Summary List transfer schedules
+// @Description Get a page of transfer schedules
+// @Tags schedules
+// @Accept json
+// @Produce json
+// @Param limit query int false "Page size (default 50, max 200)"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param sort query string false "created_at (default -created_at), next_run_at or id; prefix with - for descending"
+// @Param from query string false "Created at or after (RFC 3339 or date)"
+// @Param to query string false "Created before (RFC 3339 or date)"
+// @Param status query string false "Schedule status"
+// @Param account_number query string false "Source account, required for callers limited to their own accounts"
+// @Success 200 {object} models.Page[models.TransferSchedule]
+// @Router /api/schedules [get]
+func (h *TransferHandler) ListSchedules(c *gin.Context) {
+	var q models.ListQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	schedules, err := h.transferService.ListSchedules(c.Request.Context(), q)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, schedules)
+}
+
+// GetSchedule godoc
+// @Summary Get transfer schedule by ID
+// @Description Get a single transfer schedule and the outcome of its last run
+// @Tags schedules
+// @Accept json
+// @Produce json
+// @Param id path int true "Schedule ID"
+// @Success 200 {object} models.TransferSchedule
+// @Router /api/schedules/{id} [get]
+func (h *TransferHandler) GetSchedule(c *gin.Context) {
+	h.scheduleAction(c, h.transferService.GetSchedule)
+}
+
+// PauseSchedule godoc
+// @Summary Pause a transfer schedule
+// @Description Stop an active schedule from running until it is resumed
+// @Tags schedules
+// @Produce json
+// @Param id path int true "Schedule ID"
+// @Success 200 {object} models.TransferSchedule
+// @Router /api/schedules/{id}/pause [post]
+func (h *TransferHandler) PauseSchedule(c *gin.Context) {
+	h.scheduleAction(c, h.transferService.PauseSchedule)
+}
+
+// ResumeSchedule godoc
+// @Summary Resume a transfer schedule
+// @Description Reactivate a paused schedule
+// @Tags schedules
+// @Produce json
+// @Param id path int true "Schedule ID"
+// @Success 200 {object} models.TransferSchedule
+// @Router /api/schedules/{id}/resume [post]
+func (h *TransferHandler) ResumeSchedule(c *gin.Context) {
+	h.scheduleAction(c, h.transferService.ResumeSchedule)
+}
+
+// CancelSchedule godoc
+// @Summary Cancel a transfer schedule
+// @Description End an active or paused schedule for good
+// @Tags schedules
+// @Produce json
+// @Param id path int true "Schedule ID"
+// @Success 200 {object} models.TransferSchedule
+// @Router /api/schedules/{id}/cancel [post]
+func (h *TransferHandler) CancelSchedule(c *gin.Context) {
+	h.scheduleAction(c, h.transferService.CancelSchedule)
+}
+
+// scheduleAction runs a service method on the schedule of the :id parameter
+// and responds with the schedule
+func (h *TransferHandler) scheduleAction(c *gin.Context, action func(context.Context, uint) (*models.TransferSchedule, error)) {
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid schedule id"})
+		return
+	}
+
+	schedule, err := action(c.Request.Context(), uint(id))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, schedule)
+}
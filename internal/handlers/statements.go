@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/internal/statement"
+)
+
+// GetAccountStatement godoc
+// @Summary Export an account statement
+// @Description Download the opening and closing balances of an account and its transactions in a period as CSV, plain text, OFX or ISO 20022 camt.053. The transactions are streamed as they are read, so periods of any length can be exported. Imported history is listed as memo lines that the balances do not include, and left out of OFX.
+// @Tags accounts
+// @Produce text/csv
+// @Produce text/plain
+// @Produce application/x-ofx
+// @Produce application/xml
+// @Param id path int true "Account ID"
+// @Param from query string false "Start of the period, inclusive (RFC 3339 or date; default the first day of the month of to)"
+// @Param to query string false "End of the period, exclusive (RFC 3339 or date; default now)"
+// @Param format query string false "csv (default), txt, ofx or camt053"
+// @Success 200 {file} file
+// @Router /api/accounts/{id}/statement [get]
+func (h *AccountHandler) GetAccountStatement(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid account id"})
+		return
+	}
+
+	var q models.StatementQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	stmt, err := h.accountService.GetStatement(ctx, uint(id), q)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	// Once the file has started the status is sent; an error can only cut
+	// it short, so it is logged
+	started := false
+	err = h.accountService.ReadStatement(ctx, stmt, func(each func(fn func(*models.Transaction) error) error) error {
+		c.Header("Content-Type", statement.ContentType(stmt.Format))
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, statement.Filename(stmt)))
+		c.Status(http.StatusOK)
+		started = true
+		return statement.Write(ctx, c.Writer, stmt, each)
+	})
+	if err != nil && !started {
+		writeError(c, err)
+	} else if err != nil {
+		_ = c.Error(err)
+	}
+}
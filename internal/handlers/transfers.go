@@ -27,6 +27,7 @@ func NewTransferHandler(transferService *service.TransferService) *TransferHandl
 // @Produce json
 // @Param transfer body models.CreateTransferRequest true "Transfer data"
 // @Success 201 {object} models.Transfer
+// @Success 202 {object} models.Transfer
 // @Router /api/transfers [post]
 func (h *TransferHandler) CreateTransfer(c *gin.Context) {
 	var req models.CreateTransferRequest
@@ -37,13 +38,153 @@ func (h *TransferHandler) CreateTransfer(c *gin.Context) {
 
 	transfer, err := h.transferService.CreateTransfer(c.Request.Context(), req)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		writeError(c, err)
+		return
+	}
+
+	// Transfers still pending will be completed asynchronously
+	if transfer.Status == models.TransferStatusPending {
+		c.JSON(http.StatusAccepted, transfer)
 		return
 	}
 
 	c.JSON(http.StatusCreated, transfer)
 }
 
+// ReverseTransfer godoc
+// @Summary Reverse a transfer
+// @Description Refund all or part of a completed transfer to the source account
+// @Tags transfers
+// @Accept json
+// @Produce json
+// @Param id path int true "Transfer ID"
+// @Param reversal body models.CreateReversalRequest false "Reversal data"
+// @Success 201 {object} models.TransferReversal
+// @Success 202 {object} models.TransferReversal
+// @Router /api/transfers/{id}/reversal [post]
+func (h *TransferHandler) ReverseTransfer(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid transfer id"})
+		return
+	}
+
+	// An empty body reverses the whole remaining amount
+	var req models.CreateReversalRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	reversal, err := h.transferService.ReverseTransfer(c.Request.Context(), uint(id), req)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	// Reversals still pending will be completed asynchronously
+	if reversal.Status == models.ReversalStatusPending {
+		c.JSON(http.StatusAccepted, reversal)
+		return
+	}
+
+	c.JSON(http.StatusCreated, reversal)
+}
+
+// CaptureTransfer godoc
+// @Summary Capture an authorized transfer
+// @Description Debit the amount held by an authorized transfer and credit the destination
+// @Tags transfers
+// @Produce json
+// @Param id path int true "Transfer ID"
+// @Success 200 {object} models.Transfer
+// @Success 202 {object} models.Transfer
+// @Router /api/transfers/{id}/capture [post]
+func (h *TransferHandler) CaptureTransfer(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid transfer id"})
+		return
+	}
+
+	transfer, err := h.transferService.CaptureTransfer(c.Request.Context(), uint(id))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	// Captures still pending will be completed asynchronously
+	if transfer.Status == models.TransferStatusPending {
+		c.JSON(http.StatusAccepted, transfer)
+		return
+	}
+
+	c.JSON(http.StatusOK, transfer)
+}
+
+// VoidTransfer godoc
+// @Summary Void an authorized transfer
+// @Description Cancel an authorized transfer and release the amount it holds on the source account
+// @Tags transfers
+// @Produce json
+// @Param id path int true "Transfer ID"
+// @Success 200 {object} models.Transfer
+// @Router /api/transfers/{id}/void [post]
+func (h *TransferHandler) VoidTransfer(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid transfer id"})
+		return
+	}
+
+	transfer, err := h.transferService.VoidTransfer(c.Request.Context(), uint(id))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, transfer)
+}
+
+// ListTransfers godoc
+// @Summary List transfers
+// @Description Get a page of transfers
+// @Tags transfers
+// @Accept json
+// @Produce json
+// @Param limit query int false "Page size (default 50, max 200)"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param sort query string false "created_at (default -created_at), amount or id; prefix with - for descending"
+// @Param from query string false "Created at or after (RFC 3339 or date)"
+// @Param to query string false "Created before (RFC 3339 or date)"
+// @Param type query string false "Transfer status"
+// @Param account_number query string false "Source or destination account"
+// @Param currency query string false "Currency of the debited amount"
+// @Param min_amount query string false "Minimum debited amount"
+// @Param max_amount query string false "Maximum debited amount"
+// @Success 200 {object} models.Page[models.Transfer]
+// @Router /api/transfers [get]
+func (h *TransferHandler) ListTransfers(c *gin.Context) {
+	var q models.ListQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	transfers, err := h.transferService.ListTransfers(c.Request.Context(), q)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, transfers)
+}
+
 // GetTransfer godoc
 // @Summary Get transfer by ID
 // @Description Get a single transfer by its ID
@@ -63,9 +204,34 @@ func (h *TransferHandler) GetTransfer(c *gin.Context) {
 
 	transfer, err := h.transferService.GetTransfer(c.Request.Context(), uint(id))
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "transfer not found"})
+		writeError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, transfer)
 }
+
+// GetAccountLimits godoc
+// @Summary Get the transfer limits of an account
+// @Description Per-transaction limits of the account's tier and what is left of its daily and monthly ones
+// @Tags transfers
+// @Produce json
+// @Param id path int true "Account ID"
+// @Success 200 {object} models.AccountLimits
+// @Router /api/accounts/{id}/limits [get]
+func (h *TransferHandler) GetAccountLimits(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.ParseUint(idParam, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid account id"})
+		return
+	}
+
+	limits, err := h.transferService.GetAccountLimits(c.Request.Context(), uint(id))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, limits)
+}
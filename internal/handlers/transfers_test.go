@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tribal/bank-api/internal/accountsclient"
+	"github.com/tribal/bank-api/internal/auth"
+	"github.com/tribal/bank-api/internal/middleware"
+	"github.com/tribal/bank-api/internal/repository"
+	"github.com/tribal/bank-api/internal/service"
+	"github.com/tribal/bank-api/internal/tier"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+const testSubject = "handler-test"
+
+// newTransferRouter serves the transfer routes to a system principal behind
+// the idempotency middleware, with accounts-api reachable at accountsURL
+func newTransferRouter(t *testing.T, accountsURL string) (*gin.Engine, repository.Repository) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "transfers.db")
+	migrator, err := repository.OpenMigrator("", path)
+	if err != nil {
+		t.Fatalf("open migrator: %v", err)
+	}
+	defer migrator.Close()
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+	repo, err := repository.OpenQuiet("", path)
+	if err != nil {
+		t.Fatalf("open repository: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	accounts := accountsclient.New(accountsURL, "")
+	saga := service.NewTransferSaga(repo, accounts)
+	transfers := service.NewTransferService(repo, accounts, nil, saga, service.VelocityLimits{}, tier.DefaultCatalog, service.DefaultHoldTTL)
+	handler := NewTransferHandler(transfers)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Request = c.Request.WithContext(auth.System(c.Request.Context(), testSubject))
+	})
+	router.POST("/api/transfers", middleware.Idempotency(repo, 0), handler.CreateTransfer)
+	router.GET("/api/transfers/:id", handler.GetTransfer)
+	return router, repo
+}
+
+func postTransfer(router *gin.Engine, key string) *httptest.ResponseRecorder {
+	body := `{"from_account_number":"ACC001","to_account_number":"ACC002","amount":"10.00"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/transfers", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(middleware.IdempotencyKeyHeader, key)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestCreateTransferAccountsAPIFailure(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"error":"database is locked"}`))
+	}))
+	defer failing.Close()
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	cases := []struct {
+		name string
+		url  string
+		want int
+	}{
+		{"accounts-api error", failing.URL, http.StatusBadGateway},
+		{"accounts-api unreachable", unreachable.URL, http.StatusServiceUnavailable},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			router, repo := newTransferRouter(t, tc.url)
+
+			w := postTransfer(router, "retry-me")
+			if w.Code != tc.want {
+				t.Fatalf("status: got %d (%s), want %d", w.Code, w.Body.String(), tc.want)
+			}
+
+			// The key is released so the client can retry the transfer
+			_, err := repo.GetIdempotencyKey(context.Background(), testSubject+" POST /api/transfers", "retry-me")
+			if !errors.Is(err, repository.ErrNotFound) {
+				t.Fatalf("idempotency key: got %v, want it released", err)
+			}
+			w = postTransfer(router, "retry-me")
+			if w.Code != tc.want || w.Header().Get(middleware.IdempotentReplayedHeader) != "" {
+				t.Fatalf("retry: got %d replayed=%q, want %d run again", w.Code, w.Header().Get(middleware.IdempotentReplayedHeader), tc.want)
+			}
+		})
+	}
+}
+
+func TestCreateTransferRejectionIsStored(t *testing.T) {
+	accountsAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":"account not found","code":"account_not_found"}`))
+	}))
+	defer accountsAPI.Close()
+	router, _ := newTransferRouter(t, accountsAPI.URL)
+
+	if w := postTransfer(router, "unknown-account"); w.Code != http.StatusNotFound {
+		t.Fatalf("status: got %d (%s), want 404", w.Code, w.Body.String())
+	}
+	w := postTransfer(router, "unknown-account")
+	if w.Code != http.StatusNotFound || w.Header().Get(middleware.IdempotentReplayedHeader) != "true" {
+		t.Fatalf("retry: got %d replayed=%q, want the 404 replayed", w.Code, w.Header().Get(middleware.IdempotentReplayedHeader))
+	}
+}
+
+func TestGetTransferNotFound(t *testing.T) {
+	router, _ := newTransferRouter(t, "http://127.0.0.1:0")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/transfers/42", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status: got %d (%s), want 404", w.Code, w.Body.String())
+	}
+	var body struct {
+		Code string `json:"code"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Code != "transfer_not_found" {
+		t.Fatalf("body: got %s, want code transfer_not_found", w.Body.String())
+	}
+}
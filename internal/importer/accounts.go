@@ -0,0 +1,74 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/pkg/money"
+)
+
+// AccountService creates and validates accounts; service.AccountService
+// satisfies it
+type AccountService interface {
+	CreateAccount(ctx context.Context, req models.CreateAccountRequest) (*models.Account, error)
+	ValidateAccount(ctx context.Context, req models.CreateAccountRequest) error
+}
+
+var accountColumns = []column{
+	{name: "account_number", required: true},
+	{name: "currency"},
+	{name: "tier"},
+	{name: "initial_balance"},
+	{name: "owner_ids"},
+}
+
+// Accounts opens an account for each row of r, with the columns of
+// models.CreateAccountRequest; owner_ids are separated by semicolons. Initial
+// balances are deposited like those of accounts opened through the API. A
+// dry run only validates the rows, including that no two of them open the
+// same account.
+func Accounts(ctx context.Context, r io.Reader, accounts AccountService, dryRun bool) (*models.ImportReport, error) {
+	seen := make(map[string]int)
+	return run(ctx, r, models.ImportAccounts, dryRun, accountColumns, func(ctx context.Context, row row) error {
+		owners, err := parseOwnerIDs(row.get("owner_ids"))
+		if err != nil {
+			return err
+		}
+		req := models.CreateAccountRequest{
+			AccountNumber:  row.get("account_number"),
+			Currency:       row.get("currency"),
+			Tier:           row.get("tier"),
+			InitialBalance: money.Decimal(row.get("initial_balance")),
+			OwnerIDs:       owners,
+		}
+
+		if !dryRun {
+			_, err := accounts.CreateAccount(ctx, req)
+			return err
+		}
+		if line, ok := seen[req.AccountNumber]; ok {
+			return fmt.Errorf("%w: %s is opened on line %d too", models.ErrAccountExists, req.AccountNumber, line)
+		}
+		seen[req.AccountNumber] = row.line
+		return accounts.ValidateAccount(ctx, req)
+	})
+}
+
+func parseOwnerIDs(s string) ([]uint, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var ids []uint
+	for _, field := range strings.Split(s, ";") {
+		id, err := strconv.ParseUint(strings.TrimSpace(field), 10, 32)
+		if err != nil || id == 0 {
+			return nil, fmt.Errorf("%w: invalid owner id %q", models.ErrInvalidImport, field)
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
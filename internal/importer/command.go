@@ -0,0 +1,97 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/tribal/bank-api/internal/audit"
+	"github.com/tribal/bank-api/internal/models"
+)
+
+const usage = `usage: import <accounts|transfers> FILE [--dry-run] [--actor NAME]
+
+  accounts   open an account per row (accounts-api)
+  transfers  record a historical transfer per row (transfers-api)
+
+FILE is a CSV file with a header row, or - for standard input. --dry-run
+validates the rows without importing them; --actor names who the audit log
+attributes the import to (default "import").`
+
+// Command runs `import accounts|transfers FILE` through the given services and
+// writes a report to out. A service is nil when the binary does not own what
+// it imports. It returns an error when any row failed.
+func Command(ctx context.Context, args []string, accounts AccountService, transfers TransferService, stdin io.Reader, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing what to import\n%s", usage)
+	}
+	kind := args[0]
+	switch {
+	case kind == models.ImportAccounts && accounts == nil:
+		return errors.New("accounts are imported with accounts-api")
+	case kind == models.ImportTransfers && transfers == nil:
+		return errors.New("transfers are imported with transfers-api")
+	case kind != models.ImportAccounts && kind != models.ImportTransfers:
+		return fmt.Errorf("unknown import %q\n%s", kind, usage)
+	}
+
+	// Flags may come before or after the file
+	flags := flag.NewFlagSet("import "+kind, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	dryRun := flags.Bool("dry-run", false, "")
+	actor := flags.String("actor", "import", "")
+	if err := flags.Parse(args[1:]); err != nil {
+		return fmt.Errorf("%v\n%s", err, usage)
+	}
+	path := flags.Arg(0)
+	if err := flags.Parse(flags.Args()[min(1, flags.NArg()):]); err != nil {
+		return fmt.Errorf("%v\n%s", err, usage)
+	}
+	if path == "" || flags.NArg() > 0 {
+		return fmt.Errorf("import %s takes a single file\n%s", kind, usage)
+	}
+
+	in := stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		in = file
+	}
+
+	ctx = audit.WithMetadata(ctx, audit.Metadata{Actor: *actor, RequestID: "import:" + filepath.Base(path)})
+
+	var report *models.ImportReport
+	var err error
+	if kind == models.ImportAccounts {
+		report, err = Accounts(ctx, in, accounts, *dryRun)
+	} else {
+		report, err = Transfers(ctx, in, transfers, *dryRun)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, e := range report.Errors {
+		if e.Code != "" {
+			fmt.Fprintf(out, "line %d: %s (%s)\n", e.Line, e.Error, e.Code)
+		} else {
+			fmt.Fprintf(out, "line %d: %s\n", e.Line, e.Error)
+		}
+	}
+	verb := "imported"
+	if report.DryRun {
+		verb = "valid"
+	}
+	fmt.Fprintf(out, "%s: %d rows, %d %s, %d failed\n", kind, report.Rows, report.Imported, verb, report.Failed)
+	if report.Failed > 0 {
+		return fmt.Errorf("%d of %d rows failed", report.Failed, report.Rows)
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+// Package importer loads accounts and transfers from CSV files through the
+// same services the API uses, so imported rows are validated, audited and
+// counted in the metrics like any other.
+package importer
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/tribal/bank-api/internal/auth"
+	"github.com/tribal/bank-api/internal/models"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("importer")
+
+// column is a column of an import file. Required columns must be in the
+// header and have a value on every row.
+type column struct {
+	name     string
+	required bool
+}
+
+// row is a record of an import file, read by column name
+type row struct {
+	line    int
+	fields  []string
+	columns map[string]int
+}
+
+// get returns the trimmed value of a column, or "" if the file lacks it
+func (r row) get(name string) string {
+	i, ok := r.columns[name]
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(r.fields[i])
+}
+
+// run reads r as CSV with a header row naming the columns, in any order, and
+// passes each record to fn as soon as it is read, so files of any size are
+// imported in constant memory. Records that cannot be parsed or that fn
+// rejects are reported with their line and do not stop the import.
+func run(ctx context.Context, r io.Reader, kind string, dryRun bool, columns []column, fn func(ctx context.Context, row row) error) (*models.ImportReport, error) {
+	ctx, span := tracer.Start(ctx, "importer.run")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("import.kind", kind),
+		attribute.Bool("import.dry_run", dryRun),
+	)
+
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		err = fmt.Errorf("%w: the file is empty", models.ErrInvalidImport)
+	} else if err != nil {
+		err = fmt.Errorf("%w: header: %v", models.ErrInvalidImport, err)
+	}
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	index, err := headerIndex(header, columns)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	reader.FieldsPerRecord = len(header)
+
+	report := &models.ImportReport{Kind: kind, DryRun: dryRun, Errors: []models.ImportError{}}
+	for {
+		if err := ctx.Err(); err != nil {
+			span.RecordError(err)
+			return nil, fmt.Errorf("import stopped after %d rows: %w", report.Rows, err)
+		}
+
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var parseErr *csv.ParseError
+		if err != nil && !errors.As(err, &parseErr) {
+			span.RecordError(err)
+			return nil, fmt.Errorf("failed to read the file after %d rows: %w", report.Rows, err)
+		}
+
+		report.Rows++
+		line := 0
+		if parseErr != nil {
+			line = parseErr.StartLine
+			err = fmt.Errorf("%w: %v", models.ErrInvalidImport, parseErr.Err)
+		} else {
+			line, _ = reader.FieldPos(0)
+			err = importRow(ctx, kind, row{line: line, fields: record, columns: index}, columns, fn)
+		}
+
+		if err != nil {
+			report.Failed++
+			report.Errors = append(report.Errors, models.ImportError{Line: line, Error: err.Error(), Code: errorCode(err)})
+			continue
+		}
+		report.Imported++
+	}
+
+	span.SetAttributes(
+		attribute.Int("import.rows", report.Rows),
+		attribute.Int("import.failed", report.Failed),
+	)
+
+	return report, nil
+}
+
+// importRow checks the required values of a row and passes it to fn. Each row
+// gets a trace of its own, linked to the span of the import, so large files
+// do not end up in a single trace.
+func importRow(ctx context.Context, kind string, r row, columns []column, fn func(ctx context.Context, row row) error) error {
+	ctx, span := tracer.Start(ctx, "importer.row",
+		trace.WithNewRoot(),
+		trace.WithLinks(trace.LinkFromContext(ctx)),
+		trace.WithAttributes(
+			attribute.String("import.kind", kind),
+			attribute.Int("import.line", r.line),
+		),
+	)
+	defer span.End()
+
+	for _, col := range columns {
+		if col.required && r.get(col.name) == "" {
+			err := fmt.Errorf("%w: %s is empty", models.ErrInvalidImport, col.name)
+			span.RecordError(err)
+			return err
+		}
+	}
+	if err := fn(ctx, r); err != nil {
+		span.RecordError(err)
+		return err
+	}
+	return nil
+}
+
+// headerIndex maps the column names of a header to their position. Names are
+// matched without regard to case; unknown and repeated columns are rejected.
+func headerIndex(header []string, columns []column) (map[string]int, error) {
+	known := make(map[string]bool, len(columns))
+	for _, col := range columns {
+		known[col.name] = true
+	}
+
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		if i == 0 {
+			// Spreadsheets often start the file with a byte order mark
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !known[name] {
+			return nil, fmt.Errorf("%w: unknown column %q", models.ErrInvalidImport, name)
+		}
+		if _, ok := index[name]; ok {
+			return nil, fmt.Errorf("%w: column %q appears twice", models.ErrInvalidImport, name)
+		}
+		index[name] = i
+	}
+	for _, col := range columns {
+		if _, ok := index[col.name]; col.required && !ok {
+			return nil, fmt.Errorf("%w: missing column %q", models.ErrInvalidImport, col.name)
+		}
+	}
+	return index, nil
+}
+
+// errorCode returns the wire code of a domain or authorization error
+func errorCode(err error) string {
+	if code := models.ErrorCode(err); code != "" {
+		return code
+	}
+	return auth.ErrorCode(err)
+}
@@ -0,0 +1,167 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/pkg/money"
+)
+
+// fakeAccounts records the requests it gets and rejects negative balances
+// and taken account numbers like the account service
+type fakeAccounts struct {
+	created   []models.CreateAccountRequest
+	validated []models.CreateAccountRequest
+	taken     map[string]bool
+}
+
+func (f *fakeAccounts) check(req models.CreateAccountRequest) error {
+	if strings.HasPrefix(string(req.InitialBalance), "-") {
+		return fmt.Errorf("%w: initial balance cannot be negative", money.ErrInvalidAmount)
+	}
+	if f.taken[req.AccountNumber] {
+		return fmt.Errorf("%w: %s", models.ErrAccountExists, req.AccountNumber)
+	}
+	return nil
+}
+
+func (f *fakeAccounts) CreateAccount(ctx context.Context, req models.CreateAccountRequest) (*models.Account, error) {
+	if err := f.check(req); err != nil {
+		return nil, err
+	}
+	f.created = append(f.created, req)
+	return &models.Account{AccountNumber: req.AccountNumber}, nil
+}
+
+func (f *fakeAccounts) ValidateAccount(ctx context.Context, req models.CreateAccountRequest) error {
+	f.validated = append(f.validated, req)
+	return f.check(req)
+}
+
+type fakeTransfers struct {
+	created []models.HistoricalTransferRequest
+}
+
+func (f *fakeTransfers) RecordHistoricalTransfer(ctx context.Context, req models.HistoricalTransferRequest) (*models.Transfer, error) {
+	if req.FromAccountNumber == req.ToAccountNumber {
+		return nil, errors.New("cannot transfer to the same account")
+	}
+	f.created = append(f.created, req)
+	return &models.Transfer{}, nil
+}
+
+func (f *fakeTransfers) ValidateHistoricalTransfer(ctx context.Context, req models.HistoricalTransferRequest) error {
+	return errors.New("unexpected dry run")
+}
+
+func TestAccounts(t *testing.T) {
+	file := "\ufeffAccount_Number, currency,initial_balance,owner_ids\n" +
+		"ACC-1,USD,100.00,1;2\n" +
+		"ACC-2,EUR,-5,\n" +
+		"\n" +
+		",USD,1,\n" +
+		"ACC-3,USD\n" +
+		"ACC-4,USD,0,x\n" +
+		"ACC-5,,,\n"
+
+	accounts := &fakeAccounts{}
+	report, err := Accounts(context.Background(), strings.NewReader(file), accounts, false)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+
+	if report.Rows != 6 || report.Imported != 2 || report.Failed != 4 || report.DryRun {
+		t.Fatalf("got %d rows, %d imported, %d failed", report.Rows, report.Imported, report.Failed)
+	}
+	wantLines := []int{3, 5, 6, 7}
+	wantCodes := []string{"", "invalid_import", "invalid_import", "invalid_import"}
+	for i, e := range report.Errors {
+		if e.Line != wantLines[i] || e.Code != wantCodes[i] {
+			t.Errorf("error %d: got line %d (%s), want line %d (%s): %s", i, e.Line, e.Code, wantLines[i], wantCodes[i], e.Error)
+		}
+	}
+	if len(report.Errors) != len(wantLines) {
+		t.Fatalf("got %d errors, want %d: %+v", len(report.Errors), len(wantLines), report.Errors)
+	}
+
+	want := []models.CreateAccountRequest{
+		{AccountNumber: "ACC-1", Currency: "USD", InitialBalance: "100.00", OwnerIDs: []uint{1, 2}},
+		{AccountNumber: "ACC-5"},
+	}
+	if !reflect.DeepEqual(accounts.created, want) {
+		t.Fatalf("created %+v, want %+v", accounts.created, want)
+	}
+}
+
+func TestAccountsDryRun(t *testing.T) {
+	file := "account_number,initial_balance\nACC-1,10\nACC-2,20\nACC-1,30\nACC-9,0\n"
+
+	accounts := &fakeAccounts{taken: map[string]bool{"ACC-9": true}}
+	report, err := Accounts(context.Background(), strings.NewReader(file), accounts, true)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+
+	if len(accounts.created) != 0 {
+		t.Fatalf("dry run created %d accounts", len(accounts.created))
+	}
+	if report.Imported != 2 || report.Failed != 2 || !report.DryRun {
+		t.Fatalf("got %d valid, %d failed", report.Imported, report.Failed)
+	}
+	// The second ACC-1 repeats line 2 and ACC-9 is already taken
+	for i, line := range []int{4, 5} {
+		if e := report.Errors[i]; e.Line != line || e.Code != "account_exists" {
+			t.Errorf("error %d: got line %d (%s), want line %d (account_exists)", i, e.Line, e.Code, line)
+		}
+	}
+}
+
+func TestTransfers(t *testing.T) {
+	file := "from_account_number,to_account_number,amount,occurred_at,description\n" +
+		"ACC-1,ACC-2,10.00,2024-03-01,Rent\n" +
+		"ACC-1,ACC-1,5.00,2024-03-02,\n" +
+		"ACC-2,ACC-3,2.50,2024-03-05T13:30:00Z,\"Split, with comma\"\n" +
+		"ACC-2,ACC-3,1.00,yesterday,\n"
+
+	transfers := &fakeTransfers{}
+	report, err := Transfers(context.Background(), strings.NewReader(file), transfers, false)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+
+	if report.Imported != 2 || report.Failed != 2 || report.Errors[0].Line != 3 {
+		t.Fatalf("got report %+v", report)
+	}
+	if e := report.Errors[1]; e.Line != 5 || e.Code != "invalid_import" {
+		t.Fatalf("error 1: got line %d (%s), want line 5 (invalid_import)", e.Line, e.Code)
+	}
+	want := []models.HistoricalTransferRequest{
+		{FromAccountNumber: "ACC-1", ToAccountNumber: "ACC-2", Amount: "10.00", Description: "Rent",
+			OccurredAt: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{FromAccountNumber: "ACC-2", ToAccountNumber: "ACC-3", Amount: "2.50", Description: "Split, with comma",
+			OccurredAt: time.Date(2024, 3, 5, 13, 30, 0, 0, time.UTC)},
+	}
+	if !reflect.DeepEqual(transfers.created, want) {
+		t.Fatalf("created %+v, want %+v", transfers.created, want)
+	}
+}
+
+func TestInvalidHeader(t *testing.T) {
+	for _, file := range []string{
+		"",
+		"from_account_number,to_account_number\n",
+		"from_account_number,to_account_number,amount,memo\n",
+		"from_account_number,to_account_number,amount,amount\n",
+	} {
+		_, err := Transfers(context.Background(), strings.NewReader(file), &fakeTransfers{}, false)
+		if !errors.Is(err, models.ErrInvalidImport) {
+			t.Errorf("%q: got %v, want ErrInvalidImport", file, err)
+		}
+	}
+}
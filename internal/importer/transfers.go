@@ -0,0 +1,65 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/pkg/money"
+)
+
+// TransferService records and validates historical transfers;
+// service.TransferService satisfies it
+type TransferService interface {
+	RecordHistoricalTransfer(ctx context.Context, req models.HistoricalTransferRequest) (*models.Transfer, error)
+	ValidateHistoricalTransfer(ctx context.Context, req models.HistoricalTransferRequest) error
+}
+
+var transferColumns = []column{
+	{name: "from_account_number", required: true},
+	{name: "to_account_number", required: true},
+	{name: "amount", required: true},
+	{name: "occurred_at", required: true},
+	{name: "description"},
+}
+
+// Transfers records a historical transfer for each row of r, in order, with
+// the columns of models.HistoricalTransferRequest; occurred_at is an RFC 3339
+// time or a date, read as midnight UTC. The transfers took place in another
+// system and the balances of the accounts already include them, so they are
+// booked dated occurred_at without moving money or counting towards any
+// limit. The file is not deduplicated: importing it twice records the
+// history twice.
+func Transfers(ctx context.Context, r io.Reader, transfers TransferService, dryRun bool) (*models.ImportReport, error) {
+	return run(ctx, r, models.ImportTransfers, dryRun, transferColumns, func(ctx context.Context, row row) error {
+		occurredAt, err := parseOccurredAt(row.get("occurred_at"))
+		if err != nil {
+			return err
+		}
+		req := models.HistoricalTransferRequest{
+			FromAccountNumber: row.get("from_account_number"),
+			ToAccountNumber:   row.get("to_account_number"),
+			Amount:            money.Decimal(row.get("amount")),
+			Description:       row.get("description"),
+			OccurredAt:        occurredAt,
+		}
+
+		if dryRun {
+			return transfers.ValidateHistoricalTransfer(ctx, req)
+		}
+		_, err = transfers.RecordHistoricalTransfer(ctx, req)
+		return err
+	})
+}
+
+func parseOccurredAt(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%w: invalid occurred_at %q, want an RFC 3339 time or a date", models.ErrInvalidImport, s)
+}
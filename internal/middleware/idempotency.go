@@ -0,0 +1,245 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tribal/bank-api/internal/auth"
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/internal/repository"
+)
+
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	DefaultIdempotencyTTL    = 24 * time.Hour
+	maxIdempotencyKeyLength  = 255
+
+	// idempotencyLease is how long a request holds its key without renewing
+	// it. A running request renews it every third of the lease, so only a
+	// request that died leaves its key held, and for one lease at most.
+	idempotencyLease = 5 * time.Minute
+)
+
+// IdempotencyStore persists idempotency records
+type IdempotencyStore interface {
+	CreateIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) error
+	GetIdempotencyKey(ctx context.Context, scope, key string) (*models.IdempotencyKey, error)
+	CompleteIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) error
+	ExtendIdempotencyLease(ctx context.Context, id uint, until time.Time) error
+	DeleteIdempotencyKey(ctx context.Context, id uint) error
+}
+
+// Idempotency returns a middleware that makes a route safe to retry. The first
+// request carrying an Idempotency-Key header is executed and its response
+// stored; later requests with the same key and payload get the stored
+// response replayed. Reusing a key with a different payload returns 422 and
+// retrying while the first request is still running returns 409, however long
+// it runs. A request that dies without answering frees its key once its lease
+// runs out. Keys expire after ttl. Requests without the header are passed
+// through untouched.
+func Idempotency(store IdempotencyStore, ttl time.Duration) gin.HandlerFunc {
+	return idempotency(store, ttl, idempotencyLease)
+}
+
+// idempotency is Idempotency with the lease given
+func idempotency(store IdempotencyStore, ttl, lease time.Duration) gin.HandlerFunc {
+	if ttl <= 0 {
+		ttl = DefaultIdempotencyTTL
+	}
+
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key header is too long"})
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "failed to read request body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		// Keys are scoped to the caller so two clients cannot replay each
+		// other's responses
+		ctx := c.Request.Context()
+		scope := c.Request.Method + " " + c.Request.URL.Path
+		if principal, ok := auth.FromContext(ctx); ok {
+			scope = principal.Subject + " " + scope
+		}
+		now := time.Now()
+		lockedUntil := now.Add(lease)
+		record := &models.IdempotencyKey{
+			Key:         key,
+			Scope:       scope,
+			RequestHash: fingerprint(c.Request.Method, c.Request.URL.Path, body),
+			LockedUntil: &lockedUntil,
+			ExpiresAt:   now.Add(ttl),
+		}
+
+		existing, err := reserve(ctx, store, record)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to store idempotency key"})
+			return
+		}
+
+		if existing != nil {
+			switch {
+			case existing.RequestHash != record.RequestHash:
+				c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used with a different request payload"})
+			case existing.StatusCode == 0:
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "a request with this Idempotency-Key is still being processed"})
+			default:
+				c.Header(IdempotentReplayedHeader, "true")
+				c.Data(existing.StatusCode, existing.ContentType, existing.ResponseBody)
+				c.Abort()
+			}
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+
+		stopRenewing := renewLease(ctx, store, record.ID, lease)
+
+		// Release the key if the handler panics so it does not stay in progress
+		defer func() {
+			if r := recover(); r != nil {
+				stopRenewing()
+				_ = store.DeleteIdempotencyKey(context.WithoutCancel(ctx), record.ID)
+				panic(r)
+			}
+		}()
+
+		c.Next()
+		stopRenewing()
+
+		// Server errors are not stored so the client can retry with the same key
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError {
+			_ = store.DeleteIdempotencyKey(context.WithoutCancel(ctx), record.ID)
+			return
+		}
+
+		record.StatusCode = status
+		record.ContentType = recorder.Header().Get("Content-Type")
+		record.ResponseBody = recorder.body.Bytes()
+		if err := store.CompleteIdempotencyKey(context.WithoutCancel(ctx), record); err != nil {
+			_ = c.Error(err)
+		}
+	}
+}
+
+// reserve inserts the record, or returns the live record already holding the
+// key. Expired records, and in-progress records whose lease has run out, are
+// removed and the insert retried once.
+func reserve(ctx context.Context, store IdempotencyStore, record *models.IdempotencyKey) (*models.IdempotencyKey, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		err := store.CreateIdempotencyKey(ctx, record)
+		if err == nil {
+			return nil, nil
+		}
+		if !errors.Is(err, repository.ErrDuplicateKey) {
+			return nil, err
+		}
+
+		existing, err := store.GetIdempotencyKey(ctx, record.Scope, record.Key)
+		if err != nil {
+			return nil, err
+		}
+		if !reclaimable(existing, time.Now()) {
+			return existing, nil
+		}
+		if err := store.DeleteIdempotencyKey(ctx, existing.ID); err != nil {
+			return nil, err
+		}
+		record.ID = 0
+	}
+	return nil, errors.New("idempotency key is contended")
+}
+
+// renewLease extends the lease of the key with the given id every third of
+// the lease until the returned function is called, so a slow handler keeps
+// its key. A renewal that fails is retried at the next tick; the lease only
+// runs out if renewals fail for a whole lease.
+func renewLease(ctx context.Context, store IdempotencyStore, id uint, lease time.Duration) func() {
+	ctx = context.WithoutCancel(ctx)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				_ = store.ExtendIdempotencyLease(ctx, id, now.Add(lease))
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// reclaimable reports whether a stored record no longer holds its key: it has
+// expired, or its request never answered and the lease is over. Records from
+// before leases were recorded have none and are reclaimable while in progress.
+func reclaimable(record *models.IdempotencyKey, now time.Time) bool {
+	if !now.Before(record.ExpiresAt) {
+		return true
+	}
+	return record.StatusCode == 0 && (record.LockedUntil == nil || !now.Before(*record.LockedUntil))
+}
+
+// fingerprint hashes the request, compacting JSON bodies so insignificant
+// whitespace does not count as a different payload
+func fingerprint(method, path string, body []byte) string {
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, body); err == nil {
+		body = compact.Bytes()
+	}
+
+	h := sha256.New()
+	h.Write([]byte(method))
+	h.Write([]byte{'\n'})
+	h.Write([]byte(path))
+	h.Write([]byte{'\n'})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// responseRecorder copies the response body while writing it to the client
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,324 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tribal/bank-api/internal/auth"
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/internal/repository"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// memoryIdempotencyStore keeps idempotency records in memory with the
+// unique (scope, key) constraint of the table
+type memoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[uint]*models.IdempotencyKey
+	nextID  uint
+}
+
+func newMemoryIdempotencyStore() *memoryIdempotencyStore {
+	return &memoryIdempotencyStore{records: map[uint]*models.IdempotencyKey{}}
+}
+
+func (s *memoryIdempotencyStore) CreateIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.records {
+		if r.Scope == key.Scope && r.Key == key.Key {
+			return repository.ErrDuplicateKey
+		}
+	}
+	s.nextID++
+	key.ID = s.nextID
+	stored := *key
+	s.records[key.ID] = &stored
+	return nil
+}
+
+func (s *memoryIdempotencyStore) GetIdempotencyKey(ctx context.Context, scope, key string) (*models.IdempotencyKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.records {
+		if r.Scope == scope && r.Key == key {
+			found := *r
+			return &found, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (s *memoryIdempotencyStore) CompleteIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := *key
+	s.records[key.ID] = &stored
+	return nil
+}
+
+func (s *memoryIdempotencyStore) ExtendIdempotencyLease(ctx context.Context, id uint, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.records[id]
+	if !ok || r.StatusCode != 0 {
+		return repository.ErrNotFound
+	}
+	r.LockedUntil = &until
+	return nil
+}
+
+func (s *memoryIdempotencyStore) DeleteIdempotencyKey(ctx context.Context, id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, id)
+	return nil
+}
+
+// expireAll moves the expiry of every record to the past
+func (s *memoryIdempotencyStore) expireAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.records {
+		r.ExpiresAt = time.Now().Add(-time.Second)
+	}
+}
+
+// abandon marks every record as left in progress by a request that died
+// before answering and whose lease has run out
+func (s *memoryIdempotencyStore) abandon() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lapsed := time.Now().Add(-time.Second)
+	for _, r := range s.records {
+		r.StatusCode = 0
+		r.ContentType = ""
+		r.ResponseBody = nil
+		r.LockedUntil = &lapsed
+	}
+}
+
+// idempotencyRouter serves POST /transfers behind the middleware. The handler
+// counts its calls and answers with the status in the "status" query
+// parameter, or 201. The X-Subject header, if set, authenticates the request
+// as that subject.
+func idempotencyRouter(store IdempotencyStore, handler gin.HandlerFunc) (*gin.Engine, *int) {
+	calls := 0
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if subject := c.GetHeader("X-Subject"); subject != "" {
+			c.Request = c.Request.WithContext(auth.WithPrincipal(c.Request.Context(), &auth.Principal{Subject: subject}))
+		}
+	})
+	router.POST("/transfers", Idempotency(store, time.Hour), func(c *gin.Context) {
+		calls++
+		if handler != nil {
+			handler(c)
+			return
+		}
+		status := http.StatusCreated
+		if c.Query("status") == "500" {
+			status = http.StatusInternalServerError
+		}
+		c.JSON(status, gin.H{"call": calls})
+	})
+	return router, &calls
+}
+
+func post(router http.Handler, target, key, subject, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	if subject != "" {
+		req.Header.Set("X-Subject", subject)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotencyReplaysResponse(t *testing.T) {
+	router, calls := idempotencyRouter(newMemoryIdempotencyStore(), nil)
+
+	first := post(router, "/transfers", "k1", "", `{"amount": "10.00"}`)
+	// Whitespace does not make a different payload
+	second := post(router, "/transfers", "k1", "", `{"amount":"10.00"}`)
+
+	if *calls != 1 {
+		t.Fatalf("handler ran %d times, want 1", *calls)
+	}
+	if second.Code != http.StatusCreated || second.Body.String() != first.Body.String() {
+		t.Fatalf("replay: got %d %s, want %d %s", second.Code, second.Body, first.Code, first.Body)
+	}
+	if second.Header().Get(IdempotentReplayedHeader) != "true" || first.Header().Get(IdempotentReplayedHeader) != "" {
+		t.Fatalf("%s header: first %q, replay %q", IdempotentReplayedHeader, first.Header().Get(IdempotentReplayedHeader), second.Header().Get(IdempotentReplayedHeader))
+	}
+	if ct := second.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Fatalf("replayed content type %q", ct)
+	}
+
+	// Requests without a key are never deduplicated
+	post(router, "/transfers", "", "", `{"amount": "10.00"}`)
+	post(router, "/transfers", "", "", `{"amount": "10.00"}`)
+	if *calls != 3 {
+		t.Fatalf("handler ran %d times, want 3", *calls)
+	}
+}
+
+func TestIdempotencyRejectsDifferentPayload(t *testing.T) {
+	router, calls := idempotencyRouter(newMemoryIdempotencyStore(), nil)
+
+	post(router, "/transfers", "k1", "", `{"amount": "10.00"}`)
+	w := post(router, "/transfers", "k1", "", `{"amount": "99.00"}`)
+
+	if w.Code != http.StatusUnprocessableEntity || *calls != 1 {
+		t.Fatalf("got %d after %d calls, want 422 after 1", w.Code, *calls)
+	}
+}
+
+func TestIdempotencyConflictWhileInFlight(t *testing.T) {
+	store := newMemoryIdempotencyStore()
+	var retry *httptest.ResponseRecorder
+	var router *gin.Engine
+	// The handler retries the request before it answers, as a client would
+	// after a timeout
+	router, _ = idempotencyRouter(store, func(c *gin.Context) {
+		retry = post(router, "/transfers", "k1", "", `{"amount": "10.00"}`)
+		c.JSON(http.StatusCreated, gin.H{})
+	})
+
+	first := post(router, "/transfers", "k1", "", `{"amount": "10.00"}`)
+	if retry == nil || retry.Code != http.StatusConflict {
+		t.Fatalf("retry while in flight: got %v, want 409", retry)
+	}
+	if first.Code != http.StatusCreated {
+		t.Fatalf("first request: got %d, want 201", first.Code)
+	}
+}
+
+func TestIdempotencyReleasesKeyAfterServerError(t *testing.T) {
+	store := newMemoryIdempotencyStore()
+	router, calls := idempotencyRouter(store, nil)
+
+	if w := post(router, "/transfers?status=500", "k1", "", `{}`); w.Code != http.StatusInternalServerError {
+		t.Fatalf("first request: got %d, want 500", w.Code)
+	}
+	if len(store.records) != 0 {
+		t.Fatalf("%d records kept after a server error, want 0", len(store.records))
+	}
+
+	w := post(router, "/transfers?status=500", "k1", "", `{}`)
+	if w.Code != http.StatusInternalServerError || *calls != 2 {
+		t.Fatalf("retry: got %d after %d calls, want the handler to run again", w.Code, *calls)
+	}
+}
+
+func TestIdempotencyKeyExpires(t *testing.T) {
+	store := newMemoryIdempotencyStore()
+	router, calls := idempotencyRouter(store, nil)
+
+	post(router, "/transfers", "k1", "", `{"amount": "10.00"}`)
+	store.expireAll()
+
+	// An expired key can be reused, even with another payload
+	w := post(router, "/transfers", "k1", "", `{"amount": "20.00"}`)
+	if w.Code != http.StatusCreated || w.Header().Get(IdempotentReplayedHeader) != "" || *calls != 2 {
+		t.Fatalf("after expiry: got %d (replayed %q) after %d calls, want a new execution",
+			w.Code, w.Header().Get(IdempotentReplayedHeader), *calls)
+	}
+	if len(store.records) != 1 {
+		t.Fatalf("%d records after reuse, want the expired one replaced", len(store.records))
+	}
+}
+
+func TestIdempotencyReclaimsAbandonedKey(t *testing.T) {
+	store := newMemoryIdempotencyStore()
+	router, calls := idempotencyRouter(store, nil)
+
+	post(router, "/transfers", "k1", "", `{"amount": "10.00"}`)
+	store.abandon()
+
+	// The first request died before storing its response; once its lease is
+	// over the retry runs instead of getting 409 until the key expires
+	w := post(router, "/transfers", "k1", "", `{"amount": "10.00"}`)
+	if w.Code != http.StatusCreated || w.Header().Get(IdempotentReplayedHeader) != "" || *calls != 2 {
+		t.Fatalf("retry after the lease: got %d (replayed %q) after %d calls, want a new execution",
+			w.Code, w.Header().Get(IdempotentReplayedHeader), *calls)
+	}
+
+	w = post(router, "/transfers", "k1", "", `{"amount": "10.00"}`)
+	if w.Code != http.StatusCreated || w.Header().Get(IdempotentReplayedHeader) != "true" || *calls != 2 {
+		t.Fatalf("next retry: got %d (replayed %q) after %d calls, want the reclaimed response replayed",
+			w.Code, w.Header().Get(IdempotentReplayedHeader), *calls)
+	}
+}
+
+func TestIdempotencyScopedByPrincipal(t *testing.T) {
+	router, calls := idempotencyRouter(newMemoryIdempotencyStore(), nil)
+
+	alice := post(router, "/transfers", "k1", "alice", `{"amount": "10.00"}`)
+	bob := post(router, "/transfers", "k1", "bob", `{"amount": "10.00"}`)
+
+	if *calls != 2 || bob.Header().Get(IdempotentReplayedHeader) != "" {
+		t.Fatalf("the same key from two principals ran %d times (replayed %q), want 2 executions",
+			*calls, bob.Header().Get(IdempotentReplayedHeader))
+	}
+	if alice.Body.String() == bob.Body.String() {
+		t.Fatal("bob got alice's response")
+	}
+
+	// Each principal still gets their own response replayed
+	again := post(router, "/transfers", "k1", "alice", `{"amount": "10.00"}`)
+	if again.Body.String() != alice.Body.String() || *calls != 2 {
+		t.Fatalf("alice's replay: got %s after %d calls", again.Body, *calls)
+	}
+}
+
+func TestIdempotencyKeepsKeyOfRunningRequest(t *testing.T) {
+	store := newMemoryIdempotencyStore()
+	const lease = 30 * time.Millisecond
+	started, release := make(chan struct{}), make(chan struct{})
+	var calls atomic.Int32
+	router := gin.New()
+	router.POST("/transfers", idempotency(store, time.Hour, lease), func(c *gin.Context) {
+		if calls.Add(1) == 1 {
+			close(started)
+			<-release
+		}
+		c.JSON(http.StatusCreated, gin.H{})
+	})
+
+	first := make(chan *httptest.ResponseRecorder)
+	go func() { first <- post(router, "/transfers", "k1", "", `{"amount": "10.00"}`) }()
+	<-started
+
+	// The first request outlives several leases; it renews its own, so a
+	// retry must not reclaim the key and run the request a second time
+	time.Sleep(4 * lease)
+	w := post(router, "/transfers", "k1", "", `{"amount": "10.00"}`)
+	if w.Code != http.StatusConflict || calls.Load() != 1 {
+		t.Fatalf("retry while running: got %d after %d calls, want 409 after 1", w.Code, calls.Load())
+	}
+
+	close(release)
+	if w := <-first; w.Code != http.StatusCreated {
+		t.Fatalf("first request: got %d, want 201", w.Code)
+	}
+	w = post(router, "/transfers", "k1", "", `{"amount": "10.00"}`)
+	if w.Header().Get(IdempotentReplayedHeader) != "true" || calls.Load() != 1 {
+		t.Fatalf("retry after the first request: got %d (replayed %q) after %d calls, want its response replayed",
+			w.Code, w.Header().Get(IdempotentReplayedHeader), calls.Load())
+	}
+}
@@ -0,0 +1,305 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tribal/bank-api/internal/auth"
+	"github.com/tribal/bank-api/pkg/telemetry"
+)
+
+// Rate limit response headers, following the IETF RateLimit header fields draft
+const (
+	RateLimitLimitHeader     = "RateLimit-Limit"
+	RateLimitRemainingHeader = "RateLimit-Remaining"
+	RateLimitResetHeader     = "RateLimit-Reset"
+	RateLimitPolicyHeader    = "RateLimit-Policy"
+
+	// DefaultRateLimitRoute is the RateLimits entry that applies to routes
+	// without one of their own
+	DefaultRateLimitRoute = "*"
+
+	rateLimitSweepInterval = time.Minute
+)
+
+// RateLimit allows Requests per Period to each client. It is enforced as a
+// token bucket that holds up to Requests tokens and refills continuously, so
+// clients can burst up to the whole allowance.
+type RateLimit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// ParseRateLimit reads a limit written as "<requests>/<period>", where the
+// period is s, m, h or a duration such as 30s
+func ParseRateLimit(s string) (RateLimit, error) {
+	requests, period, ok := strings.Cut(strings.TrimSpace(s), "/")
+	if !ok {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q, want <requests>/<period>", s)
+	}
+	n, err := strconv.Atoi(requests)
+	if err != nil || n < 1 {
+		return RateLimit{}, fmt.Errorf("invalid number of requests in rate limit %q", s)
+	}
+
+	limit := RateLimit{Requests: n}
+	switch period {
+	case "s":
+		limit.Period = time.Second
+	case "m":
+		limit.Period = time.Minute
+	case "h":
+		limit.Period = time.Hour
+	default:
+		limit.Period, err = time.ParseDuration(period)
+		if err != nil || limit.Period <= 0 {
+			return RateLimit{}, fmt.Errorf("invalid period in rate limit %q", s)
+		}
+	}
+	return limit, nil
+}
+
+func (l RateLimit) String() string {
+	switch l.Period {
+	case time.Second:
+		return fmt.Sprintf("%d/s", l.Requests)
+	case time.Minute:
+		return fmt.Sprintf("%d/m", l.Requests)
+	case time.Hour:
+		return fmt.Sprintf("%d/h", l.Requests)
+	}
+	return fmt.Sprintf("%d/%s", l.Requests, l.Period)
+}
+
+// rate returns the tokens the bucket regains per second
+func (l RateLimit) rate() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+// RateLimits maps routes, written "METHOD /path" with the router's path
+// patterns, to their limit. The "*" entry applies to every other route; the
+// routes it covers share one allowance per client.
+type RateLimits map[string]RateLimit
+
+// ParseRateLimits reads a comma-separated list of route limits such as
+// "POST /api/transfers=120/m,*=600/m". An empty string sets no limits.
+func ParseRateLimits(s string) (RateLimits, error) {
+	limits := RateLimits{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		route, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid rate limit entry %q, want ROUTE=LIMIT", item)
+		}
+		route = strings.Join(strings.Fields(route), " ")
+		if route != DefaultRateLimitRoute {
+			method, path, ok := strings.Cut(route, " ")
+			if !ok || method != strings.ToUpper(method) || !strings.HasPrefix(path, "/") {
+				return nil, fmt.Errorf("invalid rate limit route %q, want \"METHOD /path\" or \"*\"", route)
+			}
+		}
+		if _, dup := limits[route]; dup {
+			return nil, fmt.Errorf("duplicate rate limit for %q", route)
+		}
+		limit, err := ParseRateLimit(value)
+		if err != nil {
+			return nil, err
+		}
+		limits[route] = limit
+	}
+	return limits, nil
+}
+
+// RateLimiter keeps a token bucket per client and route in memory. Each
+// replica enforces its limits on its own.
+type RateLimiter struct {
+	limits RateLimits
+	now    func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	limit   RateLimit
+	tokens  float64
+	updated time.Time
+}
+
+func NewRateLimiter(limits RateLimits) *RateLimiter {
+	return &RateLimiter{
+		limits:  limits,
+		now:     time.Now,
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// rateLimitDecision is the outcome of taking a token from a bucket
+type rateLimitDecision struct {
+	allowed    bool
+	remaining  int
+	reset      time.Duration // until the bucket is full again
+	retryAfter time.Duration // until the next token, when not allowed
+}
+
+// take removes a token from the bucket of key, creating it full if needed
+func (l *RateLimiter) take(key string, limit RateLimit) rateLimitDecision {
+	return l.check(key, limit, true)
+}
+
+// peek tells whether the bucket of key has a token left without taking it
+func (l *RateLimiter) peek(key string, limit RateLimit) rateLimitDecision {
+	return l.check(key, limit, false)
+}
+
+func (l *RateLimiter) check(key string, limit RateLimit, consume bool) rateLimitDecision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok || b.limit != limit {
+		b = &tokenBucket{limit: limit, tokens: float64(limit.Requests), updated: now}
+		l.buckets[key] = b
+	}
+	b.refill(now)
+
+	var d rateLimitDecision
+	if b.tokens >= 1 {
+		if consume {
+			b.tokens--
+		}
+		d.allowed = true
+	} else {
+		d.retryAfter = secondsDuration((1 - b.tokens) / limit.rate())
+	}
+	d.remaining = int(b.tokens)
+	d.reset = secondsDuration((float64(limit.Requests) - b.tokens) / limit.rate())
+	return d
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	elapsed := now.Sub(b.updated).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	b.tokens = math.Min(float64(b.limit.Requests), b.tokens+elapsed*b.limit.rate())
+	b.updated = now
+}
+
+// sweep drops the buckets that have refilled completely, which are the same
+// as the new bucket the client would get, so idle clients do not pile up
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.limit.Requests) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func secondsDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// ceilSeconds renders a duration as whole seconds, rounded up as header
+// values must not promise a reset earlier than the real one
+func ceilSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
+
+// routeLimit returns the limit for the route a request matched and the key
+// of its allowance, or false when the route is not limited
+func (l *RateLimiter) routeLimit(c *gin.Context) (string, RateLimit, bool) {
+	route := c.Request.Method + " " + c.FullPath()
+	if limit, ok := l.limits[route]; ok {
+		return route, limit, true
+	}
+	limit, ok := l.limits[DefaultRateLimitRoute]
+	return DefaultRateLimitRoute, limit, ok
+}
+
+// RateLimiting returns a middleware that throttles each client with the
+// limiter's limit for the matched route. It runs after Authenticate and
+// tells clients apart by their principal, so every API key or token subject
+// has its own allowance. Responses carry the RateLimit-* headers; requests
+// over the limit get 429 with Retry-After. Routes without a limit, and every
+// route when there are no limits, pass.
+func RateLimiting(l *RateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route, limit, ok := l.routeLimit(c)
+		principal, authenticated := auth.FromContext(c.Request.Context())
+		if !ok || !authenticated {
+			c.Next()
+			return
+		}
+
+		d := l.take(route+" "+principal.Method+":"+principal.Subject, limit)
+		setRateLimitHeaders(c, limit, d)
+		if !d.allowed {
+			abortRateLimited(c, limit, d)
+			return
+		}
+		c.Next()
+	}
+}
+
+// FailedAuthRateLimiting returns a middleware that throttles, by IP address,
+// requests that fail to authenticate, so guessing credentials is limited
+// like any other use of the API. It runs before Authenticate: each 401 takes
+// a token from the address's bucket for the route, and once the bucket is
+// empty every request from the address gets 429 until it refills, without
+// its credentials being checked.
+func FailedAuthRateLimiting(l *RateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route, limit, ok := l.routeLimit(c)
+		if !ok {
+			c.Next()
+			return
+		}
+
+		key := route + " ip:" + c.ClientIP()
+		if d := l.peek(key, limit); !d.allowed {
+			setRateLimitHeaders(c, limit, d)
+			abortRateLimited(c, limit, d)
+			return
+		}
+		c.Next()
+
+		if c.Writer.Status() == http.StatusUnauthorized {
+			l.take(key, limit)
+		}
+	}
+}
+
+func setRateLimitHeaders(c *gin.Context, limit RateLimit, d rateLimitDecision) {
+	c.Header(RateLimitLimitHeader, strconv.Itoa(limit.Requests))
+	c.Header(RateLimitRemainingHeader, strconv.Itoa(d.remaining))
+	c.Header(RateLimitResetHeader, ceilSeconds(d.reset))
+	c.Header(RateLimitPolicyHeader, fmt.Sprintf("%d;w=%s", limit.Requests, ceilSeconds(limit.Period)))
+}
+
+func abortRateLimited(c *gin.Context, limit RateLimit, d rateLimitDecision) {
+	telemetry.RecordRateLimited(c.Request.Method, c.FullPath())
+	c.Header("Retry-After", ceilSeconds(d.retryAfter))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+		"error": fmt.Sprintf("rate limit of %s exceeded", limit),
+		"code":  "rate_limited",
+	})
+}
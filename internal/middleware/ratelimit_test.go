@@ -0,0 +1,222 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tribal/bank-api/internal/auth"
+)
+
+// rateLimitClock is a settable clock for the limiter
+type rateLimitClock struct {
+	now time.Time
+}
+
+func (c *rateLimitClock) Now() time.Time {
+	return c.now
+}
+
+func (c *rateLimitClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestRateLimiter(limits RateLimits) (*RateLimiter, *rateLimitClock) {
+	clock := &rateLimitClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	l := NewRateLimiter(limits)
+	l.now = clock.Now
+	return l, clock
+}
+
+// rateLimitRouter serves GET /accounts and POST /transfers behind both
+// rate-limiting middlewares, as the mains register them. Requests without an
+// X-Subject header fail to authenticate with 401.
+func rateLimitRouter(l *RateLimiter) *gin.Engine {
+	router := gin.New()
+	authenticate := func(c *gin.Context) {
+		subject := c.GetHeader("X-Subject")
+		if subject == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"code": "unauthenticated"})
+			return
+		}
+		principal := &auth.Principal{Subject: subject, Method: "api_key"}
+		c.Request = c.Request.WithContext(auth.WithPrincipal(c.Request.Context(), principal))
+	}
+	api := router.Group("/", FailedAuthRateLimiting(l), authenticate, RateLimiting(l))
+	api.GET("/accounts", func(c *gin.Context) { c.Status(http.StatusOK) })
+	api.POST("/transfers", func(c *gin.Context) { c.Status(http.StatusCreated) })
+	return router
+}
+
+func request(router http.Handler, method, target, subject, ip string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	req.RemoteAddr = ip + ":1234"
+	if subject != "" {
+		req.Header.Set("X-Subject", subject)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestParseRateLimits(t *testing.T) {
+	limits, err := ParseRateLimits(" POST  /api/transfers=120/m, *=10/s,GET /api/accounts=5/30s")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	want := RateLimits{
+		"POST /api/transfers": {Requests: 120, Period: time.Minute},
+		"*":                   {Requests: 10, Period: time.Second},
+		"GET /api/accounts":   {Requests: 5, Period: 30 * time.Second},
+	}
+	if len(limits) != len(want) {
+		t.Fatalf("got %v, want %v", limits, want)
+	}
+	for route, limit := range want {
+		if limits[route] != limit {
+			t.Errorf("%s: got %v, want %v", route, limits[route], limit)
+		}
+	}
+
+	for _, invalid := range []string{"*=0/m", "*=10", "*=10/d", "post /x=1/s", "GET x=1/s", "*=1/s,*=2/s", "*"} {
+		if _, err := ParseRateLimits(invalid); err == nil {
+			t.Errorf("%q was accepted", invalid)
+		}
+	}
+}
+
+func TestRateLimiterRefills(t *testing.T) {
+	l, clock := newTestRateLimiter(nil)
+	limit := RateLimit{Requests: 2, Period: time.Minute}
+
+	for i := range 2 {
+		if d := l.take("k", limit); !d.allowed {
+			t.Fatalf("request %d within the burst was refused", i+1)
+		}
+	}
+	d := l.take("k", limit)
+	if d.allowed {
+		t.Fatal("request over the burst was allowed")
+	}
+	if d.retryAfter != 30*time.Second {
+		t.Fatalf("retry after: got %v, want 30s", d.retryAfter)
+	}
+
+	// A token comes back every 30 seconds, and no more than the burst
+	clock.Advance(29 * time.Second)
+	if l.take("k", limit).allowed {
+		t.Fatal("request before the next token was allowed")
+	}
+	clock.Advance(time.Second)
+	if !l.take("k", limit).allowed {
+		t.Fatal("request after a token refilled was refused")
+	}
+	clock.Advance(time.Hour)
+	if d := l.take("k", limit); !d.allowed || d.remaining != 1 {
+		t.Fatalf("after an idle hour: allowed %v, remaining %d, want a full bucket", d.allowed, d.remaining)
+	}
+}
+
+func TestRateLimitingHeaders(t *testing.T) {
+	l, clock := newTestRateLimiter(RateLimits{"POST /transfers": {Requests: 2, Period: time.Minute}})
+	router := rateLimitRouter(l)
+
+	first := request(router, http.MethodPost, "/transfers", "alice", "10.0.0.1")
+	second := request(router, http.MethodPost, "/transfers", "alice", "10.0.0.1")
+	third := request(router, http.MethodPost, "/transfers", "alice", "10.0.0.1")
+
+	tests := []struct {
+		name       string
+		w          *httptest.ResponseRecorder
+		status     int
+		remaining  string
+		reset      string
+		retryAfter string
+	}{
+		{"first", first, http.StatusCreated, "1", "30", ""},
+		{"second", second, http.StatusCreated, "0", "60", ""},
+		{"third", third, http.StatusTooManyRequests, "0", "60", "30"},
+	}
+	for _, tt := range tests {
+		h := tt.w.Header()
+		if tt.w.Code != tt.status {
+			t.Errorf("%s: got status %d, want %d", tt.name, tt.w.Code, tt.status)
+		}
+		if h.Get(RateLimitLimitHeader) != "2" || h.Get(RateLimitPolicyHeader) != "2;w=60" {
+			t.Errorf("%s: got limit %q and policy %q, want 2 and 2;w=60", tt.name, h.Get(RateLimitLimitHeader), h.Get(RateLimitPolicyHeader))
+		}
+		if h.Get(RateLimitRemainingHeader) != tt.remaining || h.Get(RateLimitResetHeader) != tt.reset {
+			t.Errorf("%s: got remaining %q and reset %q, want %s and %s", tt.name,
+				h.Get(RateLimitRemainingHeader), h.Get(RateLimitResetHeader), tt.remaining, tt.reset)
+		}
+		if h.Get("Retry-After") != tt.retryAfter {
+			t.Errorf("%s: got Retry-After %q, want %q", tt.name, h.Get("Retry-After"), tt.retryAfter)
+		}
+	}
+
+	// Other principals and unlimited routes are unaffected, even from the
+	// same address
+	if w := request(router, http.MethodPost, "/transfers", "bob", "10.0.0.1"); w.Code != http.StatusCreated {
+		t.Fatalf("another principal: got %d, want 201", w.Code)
+	}
+	if w := request(router, http.MethodGet, "/accounts", "alice", "10.0.0.1"); w.Code != http.StatusOK || w.Header().Get(RateLimitLimitHeader) != "" {
+		t.Fatalf("unlimited route: got %d with limit %q, want 200 without headers", w.Code, w.Header().Get(RateLimitLimitHeader))
+	}
+
+	clock.Advance(30 * time.Second)
+	if w := request(router, http.MethodPost, "/transfers", "alice", "10.0.0.1"); w.Code != http.StatusCreated {
+		t.Fatalf("after Retry-After: got %d, want 201", w.Code)
+	}
+}
+
+func TestFailedAuthRateLimiting(t *testing.T) {
+	l, clock := newTestRateLimiter(RateLimits{DefaultRateLimitRoute: {Requests: 3, Period: time.Minute}})
+	router := rateLimitRouter(l)
+
+	for i := range 3 {
+		if w := request(router, http.MethodGet, "/accounts", "", "10.0.0.1"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("failed attempt %d: got %d, want 401", i+1, w.Code)
+		}
+	}
+
+	// The address is locked out, whatever credentials it sends next
+	w := request(router, http.MethodGet, "/accounts", "", "10.0.0.1")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "20" {
+		t.Fatalf("after 3 failures: got %d with Retry-After %q, want 429 and 20", w.Code, w.Header().Get("Retry-After"))
+	}
+	if w := request(router, http.MethodGet, "/accounts", "alice", "10.0.0.1"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("valid credentials from a locked out address: got %d, want 429", w.Code)
+	}
+	if w := request(router, http.MethodGet, "/accounts", "alice", "10.0.0.2"); w.Code != http.StatusOK {
+		t.Fatalf("another address: got %d, want 200", w.Code)
+	}
+
+	// Authenticated requests do not use up the address's allowance
+	clock.Advance(20 * time.Second)
+	for i := range 3 {
+		if w := request(router, http.MethodGet, "/accounts", "alice", "10.0.0.1"); w.Code != http.StatusOK {
+			t.Fatalf("authenticated request %d: got %d, want 200", i+1, w.Code)
+		}
+	}
+}
+
+func TestRateLimiterSweepsIdleBuckets(t *testing.T) {
+	l, clock := newTestRateLimiter(nil)
+	limit := RateLimit{Requests: 10, Period: time.Minute}
+
+	l.take("idle", limit)
+	l.take("busy", limit)
+	clock.Advance(rateLimitSweepInterval)
+	for range 10 {
+		l.take("busy", limit)
+	}
+
+	if _, ok := l.buckets["idle"]; ok {
+		t.Fatal("a bucket that refilled was not swept")
+	}
+	if _, ok := l.buckets["busy"]; !ok {
+		t.Fatal("a bucket in use was swept")
+	}
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tribal/bank-api/internal/audit"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+const maxRequestIDLength = 128
+
+// RequestContext returns a middleware that stores the actor and request ID of
+// the request in its context, where the audit log picks them up. The actor is
+// read from the X-Actor header and defaults to "anonymous". The request ID is
+// read from X-Request-ID, generated when missing, and echoed in the response.
+func RequestContext() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		md := audit.FromContext(audit.Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header)))
+		if c.GetHeader(audit.ActorHeader) == "" {
+			md.Actor = audit.AnonymousActor
+		}
+		md.RequestID = c.GetHeader(audit.RequestIDHeader)
+		if md.RequestID == "" || len(md.RequestID) > maxRequestIDLength {
+			md.RequestID = newRequestID()
+		}
+
+		c.Header(audit.RequestIDHeader, md.RequestID)
+		c.Request = c.Request.WithContext(audit.WithMetadata(c.Request.Context(), md))
+		c.Next()
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,109 @@
+// Package migrate implements the `migrate` subcommand shared by the service
+// binaries
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tribal/bank-api/internal/repository"
+)
+
+const usage = `usage: migrate <command>
+
+commands:
+  up         apply every pending migration
+  down [N]   roll back the last N applied migrations (default 1)
+  status     list migrations and whether they are applied`
+
+// Command runs `migrate up|down [N]|status` against the database selected
+// like repository.Open and writes a report to out
+func Command(ctx context.Context, args []string, databaseURL, sqlitePath string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing command\n%s", usage)
+	}
+
+	steps := 1
+	switch args[0] {
+	case "up", "status":
+		if len(args) > 1 {
+			return fmt.Errorf("%s takes no arguments\n%s", args[0], usage)
+		}
+	case "down":
+		if len(args) > 2 {
+			return fmt.Errorf("down takes at most one argument\n%s", usage)
+		}
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+			steps = n
+		}
+	default:
+		return fmt.Errorf("unknown command %q\n%s", args[0], usage)
+	}
+
+	migrator, err := repository.OpenMigrator(databaseURL, sqlitePath)
+	if err != nil {
+		return err
+	}
+	defer migrator.Close()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			fmt.Fprintf(out, "applied %03d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Fprintln(out, "schema is up to date")
+		}
+	case "down":
+		rolledBack, err := migrator.Down(ctx, steps)
+		for _, m := range rolledBack {
+			fmt.Fprintf(out, "rolled back %03d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(rolledBack) == 0 {
+			fmt.Fprintln(out, "no migrations to roll back")
+		}
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		return writeStatus(out, statuses)
+	}
+	return nil
+}
+
+func writeStatus(out io.Writer, statuses []repository.MigrationStatus) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+	for _, s := range statuses {
+		name := s.Name
+		if name == "" {
+			name = "(unknown)"
+		}
+		state, appliedAt := "pending", ""
+		if s.Applied {
+			state = "applied"
+			appliedAt = s.AppliedAt.Format(time.RFC3339)
+		}
+		if s.Modified {
+			state = "modified"
+		}
+		fmt.Fprintf(w, "%03d\t%s\t%s\t%s\n", s.Version, name, state, appliedAt)
+	}
+	return w.Flush()
+}
@@ -1,21 +1,205 @@
 package models
 
 import (
+	"encoding/json"
+	"fmt"
 	"time"
 
+	"github.com/tribal/bank-api/pkg/money"
 	"gorm.io/gorm"
 )
 
+// AccountStatus is the lifecycle state of an account
+type AccountStatus string
+
+const (
+	AccountStatusActive AccountStatus = "active"
+	// Frozen accounts can neither send nor receive money until unfrozen
+	AccountStatusFrozen AccountStatus = "frozen"
+	// Closed accounts have a zero balance and accept no movements until
+	// reopened
+	AccountStatusClosed AccountStatus = "closed"
+)
+
+// AccountAction moves an account from one status to another
+type AccountAction string
+
+const (
+	AccountActionFreeze   AccountAction = "freeze"
+	AccountActionUnfreeze AccountAction = "unfreeze"
+	AccountActionClose    AccountAction = "close"
+	AccountActionReopen   AccountAction = "reopen"
+)
+
+// accountTransitions lists, for each action, the statuses it applies to and
+// the status it leads to
+var accountTransitions = map[AccountAction]struct {
+	from []AccountStatus
+	to   AccountStatus
+}{
+	AccountActionFreeze:   {from: []AccountStatus{AccountStatusActive}, to: AccountStatusFrozen},
+	AccountActionUnfreeze: {from: []AccountStatus{AccountStatusFrozen}, to: AccountStatusActive},
+	AccountActionClose:    {from: []AccountStatus{AccountStatusActive, AccountStatusFrozen}, to: AccountStatusClosed},
+	AccountActionReopen:   {from: []AccountStatus{AccountStatusClosed}, to: AccountStatusActive},
+}
+
+// Reason codes explaining a status transition
+const (
+	AccountReasonCustomerRequest = "customer_request"
+	AccountReasonSuspectedFraud  = "suspected_fraud"
+	AccountReasonCompliance      = "compliance"
+	AccountReasonCourtOrder      = "court_order"
+	AccountReasonDormant         = "dormant"
+	AccountReasonResolved        = "resolved"
+)
+
+var accountReasons = map[string]bool{
+	AccountReasonCustomerRequest: true,
+	AccountReasonSuspectedFraud:  true,
+	AccountReasonCompliance:      true,
+	AccountReasonCourtOrder:      true,
+	AccountReasonDormant:         true,
+	AccountReasonResolved:        true,
+}
+
+// ValidAccountReason reports whether reason is a known reason code
+func ValidAccountReason(reason string) bool {
+	return accountReasons[reason]
+}
+
 type Account struct {
-	ID            uint           `gorm:"primarykey" json:"id"`
-	AccountNumber string         `gorm:"uniqueIndex;not null" json:"account_number"`
-	Balance       float64        `gorm:"not null;default:0" json:"balance"`
-	CreatedAt     time.Time      `json:"created_at"`
-	UpdatedAt     time.Time      `json:"updated_at"`
-	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
+	ID              uint           `gorm:"primarykey" json:"id"`
+	AccountNumber   string         `gorm:"uniqueIndex;not null" json:"account_number"`
+	Balance         money.Money    `gorm:"embedded;embeddedPrefix:balance_" json:"balance"`
+	OverdraftLimit  money.Money    `gorm:"embedded;embeddedPrefix:overdraft_limit_" json:"overdraft_limit"`
+	HeldAmount      money.Money    `gorm:"embedded;embeddedPrefix:held_amount_" json:"held_amount"`
+	Status          AccountStatus  `gorm:"not null;default:active;index" json:"status"`
+	StatusReason    string         `json:"status_reason,omitempty"`
+	StatusChangedAt *time.Time     `json:"status_changed_at,omitempty"`
+	Tier            string         `gorm:"not null;default:standard" json:"tier"`
+	Owners          []Customer     `gorm:"many2many:account_owners" json:"owners,omitempty"`
+	Version         int64          `gorm:"not null;default:0" json:"version"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// Currency returns the currency the account is denominated in
+func (a *Account) Currency() money.Currency {
+	return a.Balance.Currency
+}
+
+// OverdraftDrawn returns the part of the overdraft limit in use, which is
+// the negative balance as a positive amount
+func (a *Account) OverdraftDrawn() money.Money {
+	if a.Balance.IsNegative() {
+		return a.Balance.Neg()
+	}
+	return money.Zero(a.Currency())
 }
 
+// AvailableBalance returns what the account can still spend: its balance
+// plus the undrawn overdraft, less the amount held by authorized debits
+func (a *Account) AvailableBalance() money.Money {
+	return money.New(a.Balance.Minor+a.OverdraftLimit.Minor-a.HeldAmount.Minor, a.Currency())
+}
+
+// MarshalJSON adds the drawn overdraft and the available balance, which are
+// derived from the balance and the overdraft limit
+func (a Account) MarshalJSON() ([]byte, error) {
+	type account Account
+	return json.Marshal(struct {
+		account
+		OverdraftDrawn   money.Money `json:"overdraft_drawn"`
+		AvailableBalance money.Money `json:"available_balance"`
+	}{account(a), a.OverdraftDrawn(), a.AvailableBalance()})
+}
+
+// OwnedBy reports whether the customer is one of the account's owners
+func (a *Account) OwnedBy(customerID uint) bool {
+	for _, owner := range a.Owners {
+		if owner.ID == customerID {
+			return true
+		}
+	}
+	return false
+}
+
+// Transition returns the status action leads to from the account's current
+// status, or ErrInvalidStatusTransition if the action does not apply to it
+func (a *Account) Transition(action AccountAction) (AccountStatus, error) {
+	transition, ok := accountTransitions[action]
+	if !ok {
+		return "", fmt.Errorf("%w: unknown action %q", ErrInvalidStatusTransition, action)
+	}
+	for _, from := range transition.from {
+		if a.Status == from {
+			return transition.to, nil
+		}
+	}
+	return "", fmt.Errorf("%w: cannot %s a %s account", ErrInvalidStatusTransition, action, a.Status)
+}
+
+// CheckActive returns ErrAccountFrozen or ErrAccountClosed unless the account
+// can send and receive money
+func (a *Account) CheckActive() error {
+	switch a.Status {
+	case AccountStatusFrozen:
+		return fmt.Errorf("%w: %s", ErrAccountFrozen, a.AccountNumber)
+	case AccountStatusClosed:
+		return fmt.Errorf("%w: %s", ErrAccountClosed, a.AccountNumber)
+	}
+	return nil
+}
+
+// CreateAccountRequest opens an account. OwnerIDs lists the customers that
+// own it; more than one makes it a joint account. Tier defaults to the
+// catalog's default tier.
 type CreateAccountRequest struct {
-	AccountNumber string  `json:"account_number" binding:"required"`
-	InitialBalance float64 `json:"initial_balance"`
+	AccountNumber  string        `json:"account_number" binding:"required"`
+	Currency       string        `json:"currency"`
+	Tier           string        `json:"tier"`
+	InitialBalance money.Decimal `json:"initial_balance"`
+	OwnerIDs       []uint        `json:"owner_ids"`
+}
+
+// OverdraftRequest sets the overdraft limit of an account, in the account's
+// currency. Zero removes the overdraft.
+type OverdraftRequest struct {
+	Limit money.Decimal `json:"limit" binding:"required"`
+}
+
+// AccountStatusRequest changes the status of an account, giving one of the
+// reason codes
+type AccountStatusRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// AccountEntry is a signed balance movement posted to an account, e.g. by
+// transfers-api debiting or crediting one leg of a transfer. Entries with a
+// Key are applied at most once, so callers can safely retry them. Refunds
+// return money that already left the account and are accepted whatever its
+// status. A debit with a HoldKey captures that hold: the hold is released in
+// the same transaction, so the money it reserved pays for the debit. An entry
+// with OccurredAt is historical: it is recorded as a transaction dated then,
+// whatever the status of the account, but moves no balance.
+type AccountEntry struct {
+	Key         string          `json:"key,omitempty"`
+	Type        TransactionType `json:"type" binding:"required"`
+	Amount      money.Money     `json:"amount"`
+	Reference   string          `json:"reference"`
+	Description string          `json:"description"`
+	Refund      bool            `json:"refund,omitempty"`
+	HoldKey     string          `json:"hold_key,omitempty"`
+	OccurredAt  *time.Time      `json:"occurred_at,omitempty"`
+}
+
+// CashTransactionRequest is a deposit into or withdrawal from an account. The
+// amount is positive and in the account's currency; Currency is optional and,
+// when given, must match it.
+type CashTransactionRequest struct {
+	Amount      money.Decimal `json:"amount" binding:"required"`
+	Currency    string        `json:"currency"`
+	Reference   string        `json:"reference"`
+	Description string        `json:"description"`
 }
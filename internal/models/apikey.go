@@ -0,0 +1,40 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// APIKey is a credential for machine clients. Only the SHA-256 of the key is
+// stored; Prefix identifies it without revealing it.
+type APIKey struct {
+	ID         uint       `gorm:"primarykey" json:"id"`
+	Name       string     `gorm:"not null" json:"name"`
+	Prefix     string     `gorm:"uniqueIndex;not null" json:"prefix"`
+	Hash       string     `gorm:"not null" json:"-"`
+	Subject    string     `gorm:"not null" json:"subject"`
+	CustomerID *uint      `json:"customer_id,omitempty"`
+	Roles      string     `json:"roles"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// RoleList returns the roles of the key, stored comma-separated
+func (k *APIKey) RoleList() []string {
+	var roles []string
+	for _, role := range strings.Split(k.Roles, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// Active reports whether the key can be used at now
+func (k *APIKey) Active(now time.Time) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || now.Before(*k.ExpiresAt)
+}
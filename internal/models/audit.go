@@ -0,0 +1,120 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// Audited actions
+const (
+	AuditAccountCreated           = "account.created"
+	AuditAccountBalanceChanged    = "account.balance_changed"
+	AuditAccountFrozen            = "account.frozen"
+	AuditAccountUnfrozen          = "account.unfrozen"
+	AuditAccountClosed            = "account.closed"
+	AuditAccountReopened          = "account.reopened"
+	AuditAccountOwnerAdded        = "account.owner_added"
+	AuditAccountOwnerRemoved      = "account.owner_removed"
+	AuditAccountOverdraftChanged  = "account.overdraft_changed"
+	AuditAccountHoldPlaced        = "account.hold_placed"
+	AuditAccountHoldCaptured      = "account.hold_captured"
+	AuditAccountHoldReleased      = "account.hold_released"
+	AuditCustomerCreated          = "customer.created"
+	AuditCustomerUpdated          = "customer.updated"
+	AuditCustomerDeleted          = "customer.deleted"
+	AuditTransferCreated          = "transfer.created"
+	AuditTransferImported         = "transfer.imported"
+	AuditTransferStatusChanged    = "transfer.status_changed"
+	AuditTransferReversalsChanged = "transfer.reversals_changed"
+	AuditReversalCreated          = "reversal.created"
+	AuditReversalStatusChanged    = "reversal.status_changed"
+	AuditScheduleCreated          = "schedule.created"
+	AuditScheduleStatusChanged    = "schedule.status_changed"
+	AuditBatchCreated             = "batch.created"
+	AuditBatchStatusChanged       = "batch.status_changed"
+)
+
+// Audited entity types
+const (
+	AuditEntityAccount  = "account"
+	AuditEntityCustomer = "customer"
+	AuditEntityTransfer = "transfer"
+	AuditEntityReversal = "reversal"
+	AuditEntitySchedule = "schedule"
+	AuditEntityBatch    = "batch"
+)
+
+// AuditState is a JSON snapshot of an entity. It is stored as text and
+// rendered as the JSON value it holds.
+type AuditState string
+
+func (s AuditState) MarshalJSON() ([]byte, error) {
+	if s == "" {
+		return []byte("null"), nil
+	}
+	return []byte(s), nil
+}
+
+func (s *AuditState) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*s = ""
+		return nil
+	}
+	*s = AuditState(data)
+	return nil
+}
+
+// AuditEntry records one state change. Entries form a chain: each one stores
+// the hash of the previous entry and a hash over its own content, so editing,
+// removing or reordering entries breaks the chain from that point on.
+type AuditEntry struct {
+	ID         uint       `gorm:"primarykey" json:"id"`
+	Sequence   uint       `gorm:"not null;uniqueIndex" json:"sequence"`
+	Action     string     `gorm:"not null;index" json:"action"`
+	EntityType string     `gorm:"not null;index:idx_audit_entity" json:"entity_type"`
+	EntityID   uint       `gorm:"not null;index:idx_audit_entity" json:"entity_id"`
+	Actor      string     `gorm:"not null" json:"actor"`
+	RequestID  string     `json:"request_id,omitempty"`
+	TraceID    string     `json:"trace_id,omitempty"`
+	Before     AuditState `gorm:"column:state_before" json:"before"`
+	After      AuditState `gorm:"column:state_after" json:"after"`
+	PrevHash   string     `gorm:"size:64" json:"prev_hash"`
+	Hash       string     `gorm:"size:64;not null" json:"hash"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// ComputeHash returns the SHA-256 of the entry's content chained to
+// PrevHash. CreatedAt is hashed in UTC with microsecond precision, the
+// finest every supported database stores.
+func (e *AuditEntry) ComputeHash() string {
+	fields := []string{
+		strconv.FormatUint(uint64(e.Sequence), 10),
+		e.Action,
+		e.EntityType,
+		strconv.FormatUint(uint64(e.EntityID), 10),
+		e.Actor,
+		e.RequestID,
+		e.TraceID,
+		string(e.Before),
+		string(e.After),
+		e.CreatedAt.UTC().Truncate(time.Microsecond).Format(time.RFC3339Nano),
+		e.PrevHash,
+	}
+	// JSON-encoding the list keeps field boundaries unambiguous
+	data, _ := json.Marshal(fields)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditReport is the outcome of verifying the audit chain. FirstInvalid is
+// the sequence of the first entry that does not match the chain.
+type AuditReport struct {
+	Valid        bool      `json:"valid"`
+	Entries      int64     `json:"entries"`
+	FirstInvalid uint      `json:"first_invalid,omitempty"`
+	Problem      string    `json:"problem,omitempty"`
+	CheckedAt    time.Time `json:"checked_at"`
+}
@@ -0,0 +1,161 @@
+package models
+
+import (
+	"time"
+
+	"github.com/tribal/bank-api/pkg/money"
+)
+
+// TransferBatchMode is how the transfers of a batch relate to each other
+type TransferBatchMode string
+
+const (
+	// BatchModeCompensating tries to move the money of every transfer of the
+	// batch or of none of them. It is best effort, not transactional: the
+	// transfers are held first and captured one by one, and captures already
+	// made are reversed when a later one fails. A capture or reversal that
+	// cannot be confirmed leaves its item, and the batch, in needs_attention
+	// with the money possibly moved.
+	BatchModeCompensating TransferBatchMode = "compensating"
+	// BatchModeBestEffort runs each transfer on its own and reports the
+	// outcome of each one
+	BatchModeBestEffort TransferBatchMode = "best_effort"
+)
+
+type TransferBatchStatus string
+
+const (
+	// TransferBatchStatusProcessing marks batches still running or with
+	// transfers the relay has yet to finish
+	TransferBatchStatusProcessing         TransferBatchStatus = "processing"
+	TransferBatchStatusCompleted          TransferBatchStatus = "completed"
+	TransferBatchStatusPartiallyCompleted TransferBatchStatus = "partially_completed"
+	TransferBatchStatusFailed             TransferBatchStatus = "failed"
+	// TransferBatchStatusNeedsAttention marks batches with an item whose
+	// money may or may not have moved: a compensating batch that could not
+	// confirm a capture or the reversal of one, or a transfer whose saga
+	// gave up. It is final; an operator settles the items flagged.
+	TransferBatchStatusNeedsAttention TransferBatchStatus = "needs_attention"
+)
+
+type TransferBatchItemStatus string
+
+const (
+	// BatchItemPending marks items whose transfer is recorded but not
+	// finished yet
+	BatchItemPending   TransferBatchItemStatus = "pending"
+	BatchItemSucceeded TransferBatchItemStatus = "succeeded"
+	BatchItemFailed    TransferBatchItemStatus = "failed"
+	// BatchItemSkipped marks items of a compensating batch that moved no money
+	// because another item failed
+	BatchItemSkipped TransferBatchItemStatus = "skipped"
+	// BatchItemNeedsAttention marks items whose outcome could not be
+	// confirmed and must be checked by an operator
+	BatchItemNeedsAttention TransferBatchItemStatus = "needs_attention"
+)
+
+// TransferBatchSummary counts the items of a batch by status
+type TransferBatchSummary struct {
+	Total          int `gorm:"not null;default:0" json:"total"`
+	Succeeded      int `gorm:"not null;default:0" json:"succeeded"`
+	Pending        int `gorm:"not null;default:0" json:"pending"`
+	Failed         int `gorm:"not null;default:0" json:"failed"`
+	Skipped        int `gorm:"not null;default:0" json:"skipped"`
+	NeedsAttention int `gorm:"not null;default:0" json:"needs_attention"`
+}
+
+// TransferBatch is a set of transfers submitted together, such as a payroll
+// run. Its summary and status are derived from its items.
+type TransferBatch struct {
+	ID uint `gorm:"primarykey" json:"id"`
+	// Mode is compensating or best_effort. Compensating batches undo the
+	// transfers already made when one fails, but an undo that cannot be
+	// confirmed leaves the batch in needs_attention.
+	Mode    TransferBatchMode    `gorm:"size:20;not null" json:"mode"`
+	Status  TransferBatchStatus  `gorm:"size:20;not null;index" json:"status"`
+	Summary TransferBatchSummary `gorm:"embedded;embeddedPrefix:summary_" json:"summary"`
+	// CreatedBy is the actor the transfers of the batch are attributed to
+	CreatedBy string    `gorm:"not null" json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Items []TransferBatchItem `gorm:"foreignKey:BatchID" json:"items"`
+}
+
+// TransferBatchItem is one transfer of a batch. Amount is kept as requested;
+// the transfer it created, if any, holds the amounts moved.
+type TransferBatchItem struct {
+	ID                uint                    `gorm:"primarykey" json:"-"`
+	BatchID           uint                    `gorm:"not null;index" json:"-"`
+	Position          int                     `gorm:"not null" json:"position"`
+	FromAccountNumber string                  `gorm:"not null" json:"from_account_number"`
+	ToAccountNumber   string                  `gorm:"not null" json:"to_account_number"`
+	Amount            money.Decimal           `gorm:"not null" json:"amount"`
+	Description       string                  `json:"description"`
+	Status            TransferBatchItemStatus `gorm:"size:20;not null" json:"status"`
+	TransferID        *uint                   `json:"transfer_id,omitempty"`
+	FailureReason     string                  `json:"failure_reason,omitempty"`
+	FailureCode       string                  `json:"failure_code,omitempty"`
+	CreatedAt         time.Time               `json:"created_at"`
+	UpdatedAt         time.Time               `json:"updated_at"`
+}
+
+// Tally derives the summary and status of the batch from its items
+func (b *TransferBatch) Tally() {
+	summary := TransferBatchSummary{Total: len(b.Items)}
+	for _, item := range b.Items {
+		switch item.Status {
+		case BatchItemSucceeded:
+			summary.Succeeded++
+		case BatchItemPending:
+			summary.Pending++
+		case BatchItemFailed:
+			summary.Failed++
+		case BatchItemSkipped:
+			summary.Skipped++
+		case BatchItemNeedsAttention:
+			summary.NeedsAttention++
+		}
+	}
+	b.Summary = summary
+
+	switch {
+	case summary.NeedsAttention > 0:
+		b.Status = TransferBatchStatusNeedsAttention
+	case summary.Pending > 0:
+		b.Status = TransferBatchStatusProcessing
+	case summary.Succeeded == summary.Total:
+		b.Status = TransferBatchStatusCompleted
+	case summary.Succeeded == 0:
+		b.Status = TransferBatchStatusFailed
+	default:
+		b.Status = TransferBatchStatusPartiallyCompleted
+	}
+}
+
+// BatchItemStatusOf returns the status of the batch item that created
+// transfer. Only compensating batches that were undone void their transfers.
+func BatchItemStatusOf(transfer *Transfer) TransferBatchItemStatus {
+	switch transfer.Status {
+	case TransferStatusCompleted:
+		return BatchItemSucceeded
+	case TransferStatusFailed, TransferStatusCompensated:
+		return BatchItemFailed
+	case TransferStatusVoided, TransferStatusExpired:
+		return BatchItemSkipped
+	case TransferStatusNeedsAttention:
+		return BatchItemNeedsAttention
+	default:
+		return BatchItemPending
+	}
+}
+
+// CreateTransferBatchRequest submits up to MaxBatchTransfers transfers. Its
+// transfers cannot ask for a hold.
+type CreateTransferBatchRequest struct {
+	Mode      TransferBatchMode       `json:"mode" binding:"required"`
+	Transfers []CreateTransferRequest `json:"transfers" binding:"required,min=1,dive"`
+}
+
+// MaxBatchTransfers is the most transfers a batch can hold
+const MaxBatchTransfers = 500
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Customer is a person or company that owns accounts. An account may have
+// several owners (a joint account) and a customer may own several accounts.
+type Customer struct {
+	ID         uint           `gorm:"primarykey" json:"id"`
+	Name       string         `gorm:"not null" json:"name"`
+	Email      string         `gorm:"uniqueIndex;not null" json:"email"`
+	ExternalID *string        `gorm:"uniqueIndex" json:"external_id,omitempty"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// AccountOwner links an account to one of its owners
+type AccountOwner struct {
+	AccountID  uint      `gorm:"primaryKey" json:"account_id"`
+	CustomerID uint      `gorm:"primaryKey;index" json:"customer_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// CustomerRequest creates or replaces the details of a customer
+type CustomerRequest struct {
+	Name       string `json:"name" binding:"required"`
+	Email      string `json:"email" binding:"required,email"`
+	ExternalID string `json:"external_id"`
+}
+
+// AccountOwnerRequest adds an owner to an account
+type AccountOwnerRequest struct {
+	CustomerID uint `json:"customer_id" binding:"required"`
+}
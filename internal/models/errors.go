@@ -0,0 +1,130 @@
+package models
+
+import (
+	"errors"
+)
+
+var (
+	ErrAccountNotFound     = errors.New("account not found")
+	ErrAccountExists       = errors.New("an account with this number already exists")
+	ErrInsufficientBalance = errors.New("insufficient balance")
+	ErrCurrencyMismatch    = errors.New("currency does not match account currency")
+
+	ErrAccountFrozen           = errors.New("account is frozen")
+	ErrAccountClosed           = errors.New("account is closed")
+	ErrInvalidStatusTransition = errors.New("invalid account status transition")
+	ErrInvalidStatusReason     = errors.New("invalid status reason")
+	ErrBalanceNotZero          = errors.New("account balance must be zero to close it")
+	ErrUnknownTier             = errors.New("unknown account tier")
+	ErrOverdraftInUse          = errors.New("overdraft limit is below the overdraft drawn")
+
+	ErrCustomerNotFound    = errors.New("customer not found")
+	ErrCustomerExists      = errors.New("a customer with this email or external ID already exists")
+	ErrCustomerHasAccounts = errors.New("customer still owns accounts")
+	ErrOwnerExists         = errors.New("customer already owns the account")
+	ErrOwnerNotFound       = errors.New("customer does not own the account")
+	ErrLastOwner           = errors.New("cannot remove the last owner of an account")
+	ErrNotAccountOwner     = errors.New("caller does not own the account")
+
+	ErrTransferNotFound      = errors.New("transfer not found")
+	ErrSameAccount           = errors.New("cannot transfer to the same account")
+	ErrTransferFailed        = errors.New("transfer failed")
+	ErrTransferNotReversible = errors.New("only completed transfers can be reversed")
+	ErrReversalExceedsAmount = errors.New("reversal exceeds the amount left to reverse")
+	ErrReversalFailed        = errors.New("reversal failed")
+	ErrTransferRateExceeded  = errors.New("too many transfers from the account in the last hour")
+	ErrDailyAmountExceeded   = errors.New("transfer exceeds the daily amount limit of the account")
+	ErrTransferAmountRange   = errors.New("transfer amount is outside the per-transaction limits of the account tier")
+	ErrTierLimitExceeded     = errors.New("transfer exceeds the outgoing limits of the account tier")
+	ErrTransferNotAuthorized = errors.New("only authorized transfers can be captured or voided")
+	ErrHoldExpired           = errors.New("the hold of the transfer has expired")
+	ErrHoldNotFound          = errors.New("hold not found")
+	ErrHoldNotActive         = errors.New("hold was already captured or released")
+	ErrOccurredInFuture      = errors.New("historical transfers must have occurred in the past")
+
+	ErrScheduleNotFound          = errors.New("schedule not found")
+	ErrInvalidSchedule           = errors.New("invalid schedule")
+	ErrInvalidScheduleTransition = errors.New("invalid schedule status transition")
+
+	ErrBatchNotFound = errors.New("transfer batch not found")
+	ErrInvalidBatch  = errors.New("invalid transfer batch")
+
+	ErrInvalidListQuery = errors.New("invalid list query")
+	ErrInvalidImport    = errors.New("invalid import file")
+	ErrInvalidStatement = errors.New("invalid statement request")
+
+	// ErrConcurrentUpdate means the account changed since it was read. It has
+	// no wire code so callers treat it as transient and retry.
+	ErrConcurrentUpdate = errors.New("account was modified concurrently")
+)
+
+// errorCodes identifies domain errors on the wire between services
+var errorCodes = map[error]string{
+	ErrAccountNotFound:     "account_not_found",
+	ErrAccountExists:       "account_exists",
+	ErrInsufficientBalance: "insufficient_balance",
+	ErrCurrencyMismatch:    "currency_mismatch",
+
+	ErrAccountFrozen:           "account_frozen",
+	ErrAccountClosed:           "account_closed",
+	ErrInvalidStatusTransition: "invalid_status_transition",
+	ErrInvalidStatusReason:     "invalid_status_reason",
+	ErrBalanceNotZero:          "balance_not_zero",
+	ErrUnknownTier:             "unknown_tier",
+	ErrOverdraftInUse:          "overdraft_in_use",
+
+	ErrCustomerNotFound:    "customer_not_found",
+	ErrCustomerExists:      "customer_exists",
+	ErrCustomerHasAccounts: "customer_has_accounts",
+	ErrOwnerExists:         "owner_exists",
+	ErrOwnerNotFound:       "owner_not_found",
+	ErrLastOwner:           "last_owner",
+	ErrNotAccountOwner:     "not_account_owner",
+
+	ErrTransferNotFound:      "transfer_not_found",
+	ErrSameAccount:           "same_account",
+	ErrTransferFailed:        "transfer_failed",
+	ErrTransferNotReversible: "transfer_not_reversible",
+	ErrReversalExceedsAmount: "reversal_exceeds_amount",
+	ErrReversalFailed:        "reversal_failed",
+	ErrTransferRateExceeded:  "transfer_rate_exceeded",
+	ErrDailyAmountExceeded:   "daily_amount_exceeded",
+	ErrTransferAmountRange:   "transfer_amount_out_of_range",
+	ErrTierLimitExceeded:     "tier_limit_exceeded",
+	ErrTransferNotAuthorized: "transfer_not_authorized",
+	ErrHoldExpired:           "hold_expired",
+	ErrHoldNotFound:          "hold_not_found",
+	ErrHoldNotActive:         "hold_not_active",
+	ErrOccurredInFuture:      "occurred_in_future",
+
+	ErrScheduleNotFound:          "schedule_not_found",
+	ErrInvalidSchedule:           "invalid_schedule",
+	ErrInvalidScheduleTransition: "invalid_schedule_transition",
+
+	ErrBatchNotFound: "batch_not_found",
+	ErrInvalidBatch:  "invalid_batch",
+
+	ErrInvalidListQuery: "invalid_list_query",
+	ErrInvalidImport:    "invalid_import",
+	ErrInvalidStatement: "invalid_statement",
+}
+
+// ErrorCode returns the wire code of a domain error, or "" if err is not one
+func ErrorCode(err error) string {
+	for target, code := range errorCodes {
+		if errors.Is(err, target) {
+			return code
+		}
+	}
+	return ""
+}
+
+// ErrorFromCode returns the domain error for a wire code, or nil if unknown
+func ErrorFromCode(code string) error {
+	for target, c := range errorCodes {
+		if c == code {
+			return target
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"github.com/tribal/bank-api/pkg/money"
+)
+
+type HoldStatus string
+
+const (
+	HoldStatusActive   HoldStatus = "active"
+	HoldStatusCaptured HoldStatus = "captured"
+	HoldStatusReleased HoldStatus = "released"
+)
+
+// AccountHold reserves part of an account's available balance for a debit
+// that was authorized but not captured yet. Holds move no money and post
+// nothing to the ledger: the account's HeldAmount is the sum of its active
+// holds. Key identifies the hold for whoever placed it, e.g. transfers-api,
+// and makes placing it idempotent.
+type AccountHold struct {
+	ID          uint        `gorm:"primarykey" json:"id"`
+	AccountID   uint        `gorm:"not null;index" json:"account_id"`
+	Key         string      `gorm:"uniqueIndex;not null" json:"key"`
+	Amount      money.Money `gorm:"embedded;embeddedPrefix:amount_" json:"amount"`
+	Reference   string      `json:"reference"`
+	Description string      `json:"description"`
+	Status      HoldStatus  `gorm:"size:20;not null;default:active" json:"status"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+}
+
+// AccountHoldRequest places a hold of Amount, positive and in the account's
+// currency
+type AccountHoldRequest struct {
+	Key         string      `json:"key" binding:"required"`
+	Amount      money.Money `json:"amount"`
+	Reference   string      `json:"reference"`
+	Description string      `json:"description"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+)
+
+// IdempotencyKey stores the outcome of a request sent with an Idempotency-Key
+// header so retries can be answered without executing the request again.
+// A zero StatusCode means the original request is still being processed; it
+// holds the key until LockedUntil.
+type IdempotencyKey struct {
+	ID           uint       `gorm:"primarykey" json:"id"`
+	Key          string     `gorm:"column:idempotency_key;not null;size:255;uniqueIndex:idx_idempotency_scope_key" json:"key"`
+	Scope        string     `gorm:"not null;uniqueIndex:idx_idempotency_scope_key" json:"scope"`
+	RequestHash  string     `gorm:"not null;size:64" json:"request_hash"`
+	StatusCode   int        `gorm:"not null;default:0" json:"status_code"`
+	ContentType  string     `json:"content_type"`
+	ResponseBody []byte     `json:"-"`
+	LockedUntil  *time.Time `json:"-"`
+	ExpiresAt    time.Time  `gorm:"not null;index" json:"expires_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,30 @@
+package models
+
+// What a CSV import creates
+const (
+	ImportAccounts  = "accounts"
+	ImportTransfers = "transfers"
+)
+
+// ImportReport is the outcome of a CSV import. In a dry run nothing is
+// created and Imported counts the rows that passed validation.
+type ImportReport struct {
+	Kind     string        `json:"kind"`
+	DryRun   bool          `json:"dry_run"`
+	Rows     int           `json:"rows"`
+	Imported int           `json:"imported"`
+	Failed   int           `json:"failed"`
+	Errors   []ImportError `json:"errors"`
+}
+
+// ImportError is why a line of a CSV import was not imported
+type ImportError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+	Code  string `json:"code,omitempty"`
+}
+
+// ImportQuery are the query parameters of the import endpoints
+type ImportQuery struct {
+	DryRun bool `form:"dry_run"`
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"time"
+
+	"github.com/tribal/bank-api/pkg/money"
+)
+
+// System ledger accounts. Every movement on a customer account is balanced
+// by an opposite posting on one of these.
+const (
+	// SystemAccountCash is money entering or leaving the bank
+	SystemAccountCash = "cash"
+	// SystemAccountTransferClearing holds funds between the legs of a transfer
+	// and the FX position of cross-currency transfers
+	SystemAccountTransferClearing = "transfer_clearing"
+	// SystemAccountFees collects fees charged to customers
+	SystemAccountFees = "fees"
+	// SystemAccountOpeningBalances offsets balances that predate the ledger
+	SystemAccountOpeningBalances = "opening_balances"
+)
+
+// JournalEntry is a balanced set of postings: for each currency the amounts
+// of its postings add up to zero.
+type JournalEntry struct {
+	ID          uint      `gorm:"primarykey" json:"id"`
+	Reference   string    `gorm:"index" json:"reference"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	Postings []Posting `gorm:"foreignKey:JournalEntryID" json:"postings"`
+}
+
+// Posting moves an amount on a single ledger account: either a customer
+// account (AccountID) or a system account (SystemAccount). Positive amounts
+// increase the account's balance.
+type Posting struct {
+	ID             uint        `gorm:"primarykey" json:"id"`
+	JournalEntryID uint        `gorm:"not null;index" json:"journal_entry_id"`
+	AccountID      *uint       `gorm:"index" json:"account_id,omitempty"`
+	SystemAccount  string      `gorm:"index" json:"system_account,omitempty"`
+	Amount         money.Money `gorm:"embedded;embeddedPrefix:amount_" json:"amount"`
+	CreatedAt      time.Time   `json:"created_at"`
+}
+
+// LedgerReport is the outcome of a ledger verification
+type LedgerReport struct {
+	Balanced          bool                     `json:"balanced"`
+	JournalEntries    int64                    `json:"journal_entries"`
+	UnbalancedEntries []UnbalancedEntry        `json:"unbalanced_entries"`
+	BalanceMismatches []BalanceMismatch        `json:"balance_mismatches"`
+	TrialBalance      []money.Money            `json:"trial_balance"`
+	SystemBalances    map[string][]money.Money `json:"system_balances"`
+	CheckedAt         time.Time                `json:"checked_at"`
+}
+
+// UnbalancedEntry is a journal entry whose postings do not sum to zero
+type UnbalancedEntry struct {
+	JournalEntryID uint        `json:"journal_entry_id"`
+	Difference     money.Money `json:"difference"`
+}
+
+// BalanceMismatch is an account whose cached balance differs from the sum
+// of its postings
+type BalanceMismatch struct {
+	AccountID     uint        `json:"account_id"`
+	AccountNumber string      `json:"account_number"`
+	Cached        money.Money `json:"cached"`
+	Derived       money.Money `json:"derived"`
+}
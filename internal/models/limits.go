@@ -0,0 +1,25 @@
+package models
+
+import "github.com/tribal/bank-api/pkg/money"
+
+// AccountLimits are the transfer limits of an account's tier, in the
+// account's currency, and how much of the rolling ones the account has used.
+// Limits the tier does not set are left out.
+type AccountLimits struct {
+	AccountID         uint         `json:"account_id"`
+	AccountNumber     string       `json:"account_number"`
+	Tier              string       `json:"tier"`
+	MinPerTransaction *money.Money `json:"min_per_transaction,omitempty"`
+	MaxPerTransaction *money.Money `json:"max_per_transaction,omitempty"`
+	Daily             *LimitUsage  `json:"daily,omitempty"`
+	Monthly           *LimitUsage  `json:"monthly,omitempty"`
+}
+
+// LimitUsage is a cap on the amount an account sends over a rolling window
+// ending now
+type LimitUsage struct {
+	Window    string      `json:"window"`
+	Limit     money.Money `json:"limit"`
+	Used      money.Money `json:"used"`
+	Remaining money.Money `json:"remaining"`
+}
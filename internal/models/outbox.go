@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+)
+
+type OutboxStatus string
+
+const (
+	OutboxStatusPending   OutboxStatus = "pending"
+	OutboxStatusProcessed OutboxStatus = "processed"
+	// OutboxStatusDead marks messages that exhausted their retries and need
+	// manual intervention
+	OutboxStatusDead OutboxStatus = "dead"
+)
+
+// OutboxMessage is a command written in the same local transaction as the
+// state change that produced it and delivered afterwards, at least once, by
+// a relay. TraceContext carries the W3C trace headers of the originating
+// request so asynchronous processing joins its trace.
+type OutboxMessage struct {
+	ID            uint         `gorm:"primarykey" json:"id"`
+	AggregateType string       `gorm:"not null;index:idx_outbox_aggregate" json:"aggregate_type"`
+	AggregateID   uint         `gorm:"not null;index:idx_outbox_aggregate" json:"aggregate_id"`
+	Type          string       `gorm:"not null" json:"type"`
+	Payload       string       `json:"payload"`
+	TraceContext  string       `json:"-"`
+	Status        OutboxStatus `gorm:"not null;default:pending;index" json:"status"`
+	Attempts      int          `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt time.Time    `gorm:"index" json:"next_attempt_at"`
+	LockedUntil   *time.Time   `json:"-"`
+	LastError     string       `json:"last_error,omitempty"`
+	ProcessedAt   *time.Time   `json:"processed_at,omitempty"`
+	CreatedAt     time.Time    `json:"created_at"`
+	UpdatedAt     time.Time    `json:"updated_at"`
+}
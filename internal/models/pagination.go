@@ -0,0 +1,37 @@
+package models
+
+import (
+	"github.com/tribal/bank-api/pkg/money"
+)
+
+// ListQuery holds the pagination, sorting and filtering parameters of list
+// endpoints, bound from the query string. Filters that do not apply to a
+// list are ignored.
+//
+// Sort names a field, prefixed with "-" for descending order. From is
+// inclusive and To exclusive; both accept RFC 3339 timestamps or dates
+// (YYYY-MM-DD). Amounts are decimals in the currency of the listed rows.
+type ListQuery struct {
+	Limit         int           `form:"limit"`
+	Cursor        string        `form:"cursor"`
+	Sort          string        `form:"sort"`
+	From          string        `form:"from"`
+	To            string        `form:"to"`
+	Type          string        `form:"type"`
+	MinAmount     money.Decimal `form:"min_amount"`
+	MaxAmount     money.Decimal `form:"max_amount"`
+	Reference     string        `form:"reference"`
+	Currency      string        `form:"currency"`
+	AccountNumber string        `form:"account_number"`
+	Status        string        `form:"status"`
+	Action        string        `form:"action"`
+	EntityType    string        `form:"entity_type"`
+	EntityID      uint          `form:"entity_id"`
+	Actor         string        `form:"actor"`
+}
+
+// Page is one page of a list. NextCursor is empty on the last page.
+type Page[T any] struct {
+	Data       []T    `json:"data"`
+	NextCursor string `json:"next_cursor"`
+}
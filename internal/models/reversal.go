@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/tribal/bank-api/pkg/money"
+)
+
+type ReversalStatus string
+
+const (
+	ReversalStatusPending   ReversalStatus = "pending"
+	ReversalStatusCompleted ReversalStatus = "completed"
+	ReversalStatusFailed    ReversalStatus = "failed"
+
+	// ReversalStatusNeedsAttention marks reversals whose saga gave up on a
+	// step. The reversed amount stays reserved until an operator settles it.
+	ReversalStatusNeedsAttention ReversalStatus = "needs_attention"
+)
+
+// TransferReversal undoes all or part of a completed transfer by debiting
+// CreditAmount from the destination account and refunding Amount to the
+// source. Amounts mirror those of the transfer: Amount is in the source
+// currency and CreditAmount in the destination currency.
+type TransferReversal struct {
+	ID            uint           `gorm:"primarykey" json:"id"`
+	TransferID    uint           `gorm:"not null;index" json:"transfer_id"`
+	Amount        money.Money    `gorm:"embedded;embeddedPrefix:amount_" json:"amount"`
+	CreditAmount  money.Money    `gorm:"embedded;embeddedPrefix:credit_amount_" json:"credit_amount"`
+	Status        ReversalStatus `gorm:"size:20;index" json:"status"`
+	Reason        string         `json:"reason"`
+	FailureReason string         `json:"failure_reason,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+}
+
+// CreateReversalRequest reverses Amount, expressed in the source account's
+// currency, of a transfer. An empty amount reverses whatever is left.
+type CreateReversalRequest struct {
+	Amount money.Decimal `json:"amount"`
+	Reason string        `json:"reason"`
+}
@@ -0,0 +1,119 @@
+package models
+
+import (
+	"time"
+
+	"github.com/tribal/bank-api/pkg/money"
+)
+
+type ScheduleStatus string
+
+const (
+	ScheduleStatusActive    ScheduleStatus = "active"
+	ScheduleStatusPaused    ScheduleStatus = "paused"
+	ScheduleStatusCancelled ScheduleStatus = "cancelled"
+	// ScheduleStatusCompleted marks schedules whose last occurrence ran
+	ScheduleStatusCompleted ScheduleStatus = "completed"
+)
+
+// ScheduleFrequency is how often a schedule repeats. Once schedules run a
+// single future-dated transfer.
+type ScheduleFrequency string
+
+const (
+	ScheduleOnce    ScheduleFrequency = "once"
+	ScheduleDaily   ScheduleFrequency = "daily"
+	ScheduleWeekly  ScheduleFrequency = "weekly"
+	ScheduleMonthly ScheduleFrequency = "monthly"
+)
+
+// TransferSchedule is a standing instruction to transfer Amount, in the
+// source account's currency, at StartAt and then repeatedly, Every days,
+// weeks or months apart, until EndAt. Monthly schedules anchored on a day a
+// month lacks run on its last day.
+//
+// Occurrence numbers, from zero, the occurrence the schedule runs next and
+// NextRunAt is when the scheduler picks it up: its due time, or later while
+// a run short of funds is being retried. When several occurrences came due
+// while the schedule could not run, the first one runs late and the others
+// are skipped.
+type TransferSchedule struct {
+	ID                uint              `gorm:"primarykey" json:"id"`
+	FromAccountID     uint              `gorm:"not null" json:"from_account_id"`
+	FromAccountNumber string            `gorm:"not null;index" json:"from_account_number"`
+	ToAccountNumber   string            `gorm:"not null" json:"to_account_number"`
+	Amount            money.Money       `gorm:"embedded;embeddedPrefix:amount_" json:"amount"`
+	Description       string            `json:"description"`
+	Frequency         ScheduleFrequency `gorm:"size:20;not null" json:"frequency"`
+	Every             int               `gorm:"not null;default:1" json:"every"`
+	StartAt           time.Time         `gorm:"not null" json:"start_at"`
+	EndAt             *time.Time        `json:"end_at,omitempty"`
+	Status            ScheduleStatus    `gorm:"size:20;not null;default:active" json:"status"`
+	Occurrence        int               `gorm:"not null;default:0" json:"occurrence"`
+	NextRunAt         time.Time         `gorm:"not null" json:"next_run_at"`
+	Attempts          int               `gorm:"not null;default:0" json:"attempts"`
+	LastRunAt         *time.Time        `json:"last_run_at,omitempty"`
+	LastTransferID    *uint             `json:"last_transfer_id,omitempty"`
+	LastError         string            `json:"last_error,omitempty"`
+	LockedUntil       *time.Time        `json:"-"`
+	// CreatedBy is the actor the runs of the schedule are attributed to
+	CreatedBy string `gorm:"not null" json:"created_by"`
+	// CustomerID is the customer that created the schedule with access to
+	// its own accounts only. Runs are cancelled once the customer no longer
+	// owns the source account.
+	CustomerID *uint     `json:"customer_id,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// OccurrenceAt returns when occurrence n of the schedule is due, counting
+// from zero
+func (s *TransferSchedule) OccurrenceAt(n int) time.Time {
+	steps := n * s.Every
+	switch s.Frequency {
+	case ScheduleDaily:
+		return s.StartAt.AddDate(0, 0, steps)
+	case ScheduleWeekly:
+		return s.StartAt.AddDate(0, 0, 7*steps)
+	case ScheduleMonthly:
+		// AddDate would roll Jan 31 over into March; stay in the month
+		year, month, day := s.StartAt.Date()
+		first := time.Date(year, month+time.Month(steps), 1, 0, 0, 0, 0, s.StartAt.Location())
+		last := first.AddDate(0, 1, -1).Day()
+		hour, minute, sec := s.StartAt.Clock()
+		return time.Date(first.Year(), first.Month(), min(day, last), hour, minute, sec, s.StartAt.Nanosecond(), s.StartAt.Location())
+	default:
+		return s.StartAt
+	}
+}
+
+// NextOccurrenceAfter returns the first occurrence after the current one
+// that is due after t, and false when the schedule has none left
+func (s *TransferSchedule) NextOccurrenceAfter(t time.Time) (int, time.Time, bool) {
+	if s.Frequency == ScheduleOnce || s.Frequency == "" {
+		return 0, time.Time{}, false
+	}
+	n := s.Occurrence + 1
+	at := s.OccurrenceAt(n)
+	for !at.After(t) {
+		n++
+		at = s.OccurrenceAt(n)
+	}
+	if s.EndAt != nil && at.After(*s.EndAt) {
+		return 0, time.Time{}, false
+	}
+	return n, at, true
+}
+
+// CreateScheduleRequest schedules transfers of Amount, expressed in the
+// source account's currency. Frequency defaults to once and Every to 1.
+type CreateScheduleRequest struct {
+	FromAccountNumber string            `json:"from_account_number" binding:"required"`
+	ToAccountNumber   string            `json:"to_account_number" binding:"required"`
+	Amount            money.Decimal     `json:"amount" binding:"required"`
+	Description       string            `json:"description"`
+	Frequency         ScheduleFrequency `json:"frequency"`
+	Every             int               `json:"every"`
+	StartAt           time.Time         `json:"start_at" binding:"required"`
+	EndAt             *time.Time        `json:"end_at"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"github.com/tribal/bank-api/pkg/money"
+)
+
+// StatementFormat is a file format account statements are exported in
+type StatementFormat string
+
+const (
+	StatementCSV  StatementFormat = "csv"
+	StatementText StatementFormat = "txt"
+	StatementOFX  StatementFormat = "ofx"
+	// StatementCAMT053 is the ISO 20022 bank-to-customer statement
+	StatementCAMT053 StatementFormat = "camt053"
+)
+
+// Statement is the header of an account statement: the balance of the
+// account when the period starts and when it ends. Its lines are the
+// transactions of the account created in the period, From inclusive and To
+// exclusive.
+type Statement struct {
+	Account        *Account        `json:"account"`
+	Format         StatementFormat `json:"format"`
+	From           time.Time       `json:"from"`
+	To             time.Time       `json:"to"`
+	OpeningBalance money.Money     `json:"opening_balance"`
+	ClosingBalance money.Money     `json:"closing_balance"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+// StatementQuery are the query parameters of the statement endpoint. From
+// and To accept RFC 3339 timestamps or dates like list queries; the period
+// defaults to the current month up to now.
+type StatementQuery struct {
+	From   string          `form:"from"`
+	To     string          `form:"to"`
+	Format StatementFormat `form:"format"`
+}
@@ -3,6 +3,7 @@ package models
 import (
 	"time"
 
+	"github.com/tribal/bank-api/pkg/money"
 	"gorm.io/gorm"
 )
 
@@ -12,15 +13,22 @@ const (
 	TransactionTypeDeposit    TransactionType = "deposit"
 	TransactionTypeWithdrawal TransactionType = "withdrawal"
 	TransactionTypeTransfer   TransactionType = "transfer"
+	TransactionTypeFee        TransactionType = "fee"
+	TransactionTypeReversal   TransactionType = "reversal"
 )
 
 type Transaction struct {
 	ID          uint            `gorm:"primarykey" json:"id"`
 	AccountID   uint            `gorm:"not null;index" json:"account_id"`
 	Type        TransactionType `gorm:"not null" json:"type"`
-	Amount      float64         `gorm:"not null" json:"amount"`
+	Amount      money.Money     `gorm:"embedded;embeddedPrefix:amount_" json:"amount"`
 	Reference   string          `json:"reference"`
 	Description string          `json:"description"`
+	EntryKey    *string         `gorm:"uniqueIndex" json:"-"`
+	JournalEntryID *uint        `gorm:"index" json:"journal_entry_id,omitempty"`
+	// OccurredAt marks the entries of historical transfers. They are dated
+	// then, have no journal entry and did not change the balance.
+	OccurredAt  *time.Time      `json:"occurred_at,omitempty"`
 	CreatedAt   time.Time       `json:"created_at"`
 	UpdatedAt   time.Time       `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt  `gorm:"index" json:"-"`
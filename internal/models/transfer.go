@@ -3,26 +3,122 @@ package models
 import (
 	"time"
 
+	"github.com/tribal/bank-api/pkg/money"
 	"gorm.io/gorm"
 )
 
+type TransferStatus string
+
+const (
+	TransferStatusPending     TransferStatus = "pending"
+	TransferStatusCompleted   TransferStatus = "completed"
+	TransferStatusFailed      TransferStatus = "failed"
+	TransferStatusCompensated TransferStatus = "compensated"
+
+	// Two-phase transfers are authorized first: a hold reserves the amount
+	// on the source account until the transfer is captured, which moves the
+	// money, voided or left to expire
+	TransferStatusAuthorized TransferStatus = "authorized"
+	TransferStatusVoided     TransferStatus = "voided"
+	TransferStatusExpired    TransferStatus = "expired"
+
+	// TransferStatusNeedsAttention marks transfers whose saga gave up on a
+	// step, so money may have moved on one side only. An operator has to
+	// settle them by hand.
+	TransferStatusNeedsAttention TransferStatus = "needs_attention"
+)
+
+// TransferReversalStatus summarizes how much of a completed transfer has been
+// reversed. It is empty while nothing has been reversed.
+type TransferReversalStatus string
+
+const (
+	TransferPartiallyReversed TransferReversalStatus = "partially_reversed"
+	TransferReversed          TransferReversalStatus = "reversed"
+)
+
 type Transfer struct {
 	ID                uint           `gorm:"primarykey" json:"id"`
 	FromAccountID     uint           `gorm:"not null" json:"from_account_id"`
 	ToAccountID       uint           `gorm:"not null" json:"to_account_id"`
-	Amount            float64        `gorm:"not null" json:"amount"`
+	FromAccountNumber string         `gorm:"index" json:"from_account_number"`
+	ToAccountNumber   string         `gorm:"index" json:"to_account_number"`
+	Amount            money.Money    `gorm:"embedded;embeddedPrefix:amount_" json:"amount"`
+	CreditAmount      money.Money    `gorm:"embedded;embeddedPrefix:credit_amount_" json:"credit_amount"`
+	FXRate            string         `json:"fx_rate,omitempty"`
+	Status            TransferStatus `gorm:"size:20;index" json:"status"`
+	FailureReason     string         `json:"failure_reason,omitempty"`
+	FailureCode       string         `json:"failure_code,omitempty"`
 	Description       string         `json:"description"`
+
+	// ReversedAmount and ReversedCreditAmount include reversals in progress,
+	// so the amount still reversible is never overstated
+	ReversedAmount       money.Money            `gorm:"embedded;embeddedPrefix:reversed_amount_" json:"reversed_amount"`
+	ReversedCreditAmount money.Money            `gorm:"embedded;embeddedPrefix:reversed_credit_amount_" json:"reversed_credit_amount"`
+	ReversalStatus       TransferReversalStatus `gorm:"size:20" json:"reversal_status,omitempty"`
+
+	// ScheduleKey identifies the run of a schedule that created the
+	// transfer. It is unique, so a run retried after a crash cannot transfer
+	// twice.
+	ScheduleID  *uint   `gorm:"index" json:"schedule_id,omitempty"`
+	ScheduleKey *string `gorm:"uniqueIndex" json:"-"`
+
+	// HoldExpiresAt is when an authorized transfer expires and its hold is
+	// released unless captured first
+	HoldExpiresAt *time.Time `gorm:"index" json:"hold_expires_at,omitempty"`
+
+	// BatchID is the batch the transfer was submitted in
+	BatchID *uint `gorm:"index" json:"batch_id,omitempty"`
+
+	// OccurredAt is set on historical transfers, recorded after the fact
+	// when accounts are imported from another system. They took place at
+	// that time, already count in the balances loaded, and so move no money
+	// here and count towards no limit.
+	OccurredAt *time.Time `json:"occurred_at,omitempty"`
+
 	CreatedAt         time.Time      `json:"created_at"`
 	UpdatedAt         time.Time      `json:"updated_at"`
 	DeletedAt         gorm.DeletedAt `gorm:"index" json:"-"`
 	
-	FromAccount       Account        `gorm:"foreignKey:FromAccountID" json:"from_account,omitempty"`
-	ToAccount         Account        `gorm:"foreignKey:ToAccountID" json:"to_account,omitempty"`
+	// Accounts are owned by accounts-api and resolved through it, not stored here
+	FromAccount       *Account       `gorm:"-" json:"from_account,omitempty"`
+	ToAccount         *Account       `gorm:"-" json:"to_account,omitempty"`
+
+	Reversals []TransferReversal `gorm:"foreignKey:TransferID" json:"reversals,omitempty"`
 }
 
+// TransferVelocity is the number and total debited amount, in minor units
+// of the account's currency, of the transfers an account sent in a window
+type TransferVelocity struct {
+	Count       int64
+	AmountMinor int64
+}
+
+// CreateTransferRequest moves Amount, expressed in the source account's
+// currency, to the destination account. With Hold the transfer is only
+// authorized: the amount is held on the source account until the transfer
+// is captured or voided.
 type CreateTransferRequest struct {
-	FromAccountNumber string  `json:"from_account_number" binding:"required"`
-	ToAccountNumber   string  `json:"to_account_number" binding:"required"`
-	Amount            float64 `json:"amount" binding:"required"`
-	Description       string  `json:"description"`
+	FromAccountNumber string        `json:"from_account_number" binding:"required"`
+	ToAccountNumber   string        `json:"to_account_number" binding:"required"`
+	Amount            money.Decimal `json:"amount" binding:"required"`
+	Description       string        `json:"description"`
+	Hold              bool          `json:"hold"`
+
+	// Set by the scheduler and by batches for the transfers they create,
+	// never bound from clients
+	ScheduleID  uint   `json:"-"`
+	ScheduleKey string `json:"-"`
+	BatchID     uint   `json:"-"`
+}
+
+// HistoricalTransferRequest records a transfer that took place at
+// OccurredAt, before the accounts were managed here. Both accounts must be in
+// the currency of Amount's account: no rate of the time is known to convert.
+type HistoricalTransferRequest struct {
+	FromAccountNumber string        `json:"from_account_number" binding:"required"`
+	ToAccountNumber   string        `json:"to_account_number" binding:"required"`
+	Amount            money.Decimal `json:"amount" binding:"required"`
+	Description       string        `json:"description"`
+	OccurredAt        time.Time     `json:"occurred_at" binding:"required"`
 }
@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/tribal/bank-api/internal/models"
+)
+
+func (r *gormRepository) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	return r.db.WithContext(ctx).Create(key).Error
+}
+
+func (r *gormRepository) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	var key models.APIKey
+	if err := r.db.WithContext(ctx).Where("prefix = ?", prefix).First(&key).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *gormRepository) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	err := r.db.WithContext(ctx).Order("id").Find(&keys).Error
+	return keys, err
+}
+
+func (r *gormRepository) RevokeAPIKey(ctx context.Context, prefix string, at time.Time) error {
+	result := r.db.WithContext(ctx).Model(&models.APIKey{}).
+		Where("prefix = ? AND revoked_at IS NULL", prefix).
+		Update("revoked_at", at)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/tribal/bank-api/internal/models"
+	"gorm.io/gorm"
+)
+
+// auditLockID keys the PostgreSQL advisory lock that serializes appends to
+// the audit chain
+const auditLockID = 7_240_612
+
+// AppendAuditEntry links entry to the last entry of the chain and stores it.
+// Appends are serialized until the surrounding transaction ends, so two
+// writers never chain to the same predecessor.
+func (r *gormRepository) AppendAuditEntry(ctx context.Context, entry *models.AuditEntry) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if r.dialect == DialectPostgres {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", auditLockID).Error; err != nil {
+				return err
+			}
+		}
+
+		var last models.AuditEntry
+		if err := tx.Order("sequence DESC").Limit(1).Find(&last).Error; err != nil {
+			return err
+		}
+
+		entry.Sequence = last.Sequence + 1
+		entry.PrevHash = last.Hash
+		entry.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+		entry.Hash = entry.ComputeHash()
+		return tx.Create(entry).Error
+	})
+}
+
+var auditList = listSpec[models.AuditEntry]{
+	fields: map[string]sortField[models.AuditEntry]{
+		"sequence":   {column: "sequence", kind: sortInt, value: func(e *models.AuditEntry) interface{} { return int64(e.Sequence) }},
+		"created_at": {column: "created_at", kind: sortTime, value: func(e *models.AuditEntry) interface{} { return e.CreatedAt }},
+	},
+	defaultSort: "-sequence",
+	id:          func(e *models.AuditEntry) uint { return e.ID },
+}
+
+// ListAuditEntries returns a page of audit entries filtered by date, action,
+// entity and actor
+func (r *gormRepository) ListAuditEntries(ctx context.Context, opts ListOptions) ([]models.AuditEntry, string, error) {
+	query := filterCreatedAt(r.db.WithContext(ctx).Model(&models.AuditEntry{}), opts)
+	if opts.Action != "" {
+		query = query.Where("action = ?", opts.Action)
+	}
+	if opts.EntityType != "" {
+		query = query.Where("entity_type = ?", opts.EntityType)
+	}
+	if opts.EntityID != 0 {
+		query = query.Where("entity_id = ?", opts.EntityID)
+	}
+	if opts.Actor != "" {
+		query = query.Where("actor = ?", opts.Actor)
+	}
+	return fetchPage(query, auditList, opts)
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/tribal/bank-api/internal/models"
+	"gorm.io/gorm"
+)
+
+// Batch operations
+func (r *gormRepository) CreateBatch(ctx context.Context, batch *models.TransferBatch) error {
+	return r.db.WithContext(ctx).Create(batch).Error
+}
+
+func (r *gormRepository) GetBatchByID(ctx context.Context, id uint) (*models.TransferBatch, error) {
+	var batch models.TransferBatch
+	err := r.db.WithContext(ctx).
+		Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("position") }).
+		First(&batch, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// UpdateBatch stores the status and summary of a batch and the outcome of
+// each of its items
+func (r *gormRepository) UpdateBatch(ctx context.Context, batch *models.TransferBatch) error {
+	err := r.db.WithContext(ctx).Model(batch).Updates(map[string]interface{}{
+		"status":                  batch.Status,
+		"summary_total":           batch.Summary.Total,
+		"summary_succeeded":       batch.Summary.Succeeded,
+		"summary_pending":         batch.Summary.Pending,
+		"summary_failed":          batch.Summary.Failed,
+		"summary_skipped":         batch.Summary.Skipped,
+		"summary_needs_attention": batch.Summary.NeedsAttention,
+	}).Error
+	if err != nil {
+		return err
+	}
+	for i := range batch.Items {
+		item := &batch.Items[i]
+		err := r.db.WithContext(ctx).Model(item).Updates(map[string]interface{}{
+			"status":         item.Status,
+			"transfer_id":    item.TransferID,
+			"failure_reason": item.FailureReason,
+			"failure_code":   item.FailureCode,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/tribal/bank-api/internal/models"
+)
+
+func (r *gormRepository) CreateCustomer(ctx context.Context, customer *models.Customer) error {
+	return r.db.WithContext(ctx).Create(customer).Error
+}
+
+func (r *gormRepository) GetCustomerByID(ctx context.Context, id uint) (*models.Customer, error) {
+	var customer models.Customer
+	if err := r.db.WithContext(ctx).First(&customer, id).Error; err != nil {
+		return nil, err
+	}
+	return &customer, nil
+}
+
+// UpdateCustomer stores the name, email and external ID of customer
+func (r *gormRepository) UpdateCustomer(ctx context.Context, customer *models.Customer) error {
+	now := time.Now()
+	result := r.db.WithContext(ctx).Model(&models.Customer{}).
+		Where("id = ?", customer.ID).
+		Updates(map[string]interface{}{
+			"name":        customer.Name,
+			"email":       customer.Email,
+			"external_id": customer.ExternalID,
+			"updated_at":  now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	customer.UpdatedAt = now
+	return nil
+}
+
+func (r *gormRepository) DeleteCustomer(ctx context.Context, id uint) error {
+	result := r.db.WithContext(ctx).Delete(&models.Customer{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+var customerList = listSpec[models.Customer]{
+	fields: map[string]sortField[models.Customer]{
+		"id":         {column: "id", kind: sortInt, value: func(c *models.Customer) interface{} { return int64(c.ID) }},
+		"created_at": {column: "created_at", kind: sortTime, value: func(c *models.Customer) interface{} { return c.CreatedAt }},
+		"name":       {column: "name", kind: sortString, value: func(c *models.Customer) interface{} { return c.Name }},
+	},
+	defaultSort: "id",
+	id:          func(c *models.Customer) uint { return c.ID },
+}
+
+// ListCustomers returns a page of customers filtered by creation date
+func (r *gormRepository) ListCustomers(ctx context.Context, opts ListOptions) ([]models.Customer, string, error) {
+	query := filterCreatedAt(r.db.WithContext(ctx).Model(&models.Customer{}), opts)
+	return fetchPage(query, customerList, opts)
+}
+
+// ListAccountsByCustomer returns a page of the accounts a customer owns,
+// alone or jointly, filtered like ListAccounts and by status
+func (r *gormRepository) ListAccountsByCustomer(ctx context.Context, customerID uint, opts ListOptions) ([]models.Account, string, error) {
+	query := r.db.WithContext(ctx).Model(&models.Account{}).Preload("Owners").
+		Where("id IN (?)", r.db.Model(&models.AccountOwner{}).Select("account_id").Where("customer_id = ?", customerID))
+	return r.listAccounts(query, opts)
+}
+
+// CountOpenAccountsByCustomer counts the accounts a customer owns that are
+// not closed
+func (r *gormRepository) CountOpenAccountsByCustomer(ctx context.Context, customerID uint) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.Account{}).
+		Where("id IN (?)", r.db.Model(&models.AccountOwner{}).Select("account_id").Where("customer_id = ?", customerID)).
+		Where("status <> ?", models.AccountStatusClosed).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *gormRepository) AddAccountOwner(ctx context.Context, accountID, customerID uint) error {
+	return r.db.WithContext(ctx).Create(&models.AccountOwner{AccountID: accountID, CustomerID: customerID}).Error
+}
+
+func (r *gormRepository) RemoveAccountOwner(ctx context.Context, accountID, customerID uint) error {
+	result := r.db.WithContext(ctx).
+		Where("account_id = ? AND customer_id = ?", accountID, customerID).
+		Delete(&models.AccountOwner{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormRepository) ListAccountOwners(ctx context.Context, accountID uint) ([]models.Customer, error) {
+	var owners []models.Customer
+	err := r.db.WithContext(ctx).
+		Where("id IN (?)", r.db.Model(&models.AccountOwner{}).Select("customer_id").Where("account_id = ?", accountID)).
+		Order("id").
+		Find(&owners).Error
+	return owners, err
+}
@@ -0,0 +1,458 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/pkg/money"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+)
+
+// gormRepository implements Repository on top of GORM for every supported
+// dialect. Inside WithTransaction it is bound to the transaction's session.
+type gormRepository struct {
+	db      *gorm.DB
+	dialect Dialect
+}
+
+var _ Repository = (*gormRepository)(nil)
+
+// connect opens a GORM session with the settings shared by every dialect
+func connect(dialector gorm.Dialector, logLevel logger.LogLevel) (*gorm.DB, error) {
+	db, err := gorm.Open(dialector, &gorm.Config{
+		Logger:         logger.Default.LogMode(logLevel),
+		TranslateError: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	return db, nil
+}
+
+// openGorm connects with dialector and refuses databases whose schema is
+// behind the migrations embedded in the binary
+func openGorm(dialector gorm.Dialector, dialect Dialect, logLevel logger.LogLevel) (*gormRepository, error) {
+	db, err := connect(dialector, logLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	migrator, err := newMigrator(db, dialect)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrator.Check(context.Background()); err != nil {
+		if sqlDB, dbErr := db.DB(); dbErr == nil {
+			sqlDB.Close()
+		}
+		return nil, err
+	}
+
+	return &gormRepository{db: db, dialect: dialect}, nil
+}
+
+func (r *gormRepository) Dialect() Dialect {
+	return r.dialect
+}
+
+func (r *gormRepository) Close() error {
+	sqlDB, err := r.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// WithTransaction runs fn with a repository bound to a new transaction
+func (r *gormRepository) WithTransaction(ctx context.Context, fn func(tx Store) error) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(&gormRepository{db: tx, dialect: r.dialect})
+	})
+}
+
+// WithSnapshot runs fn in a read-only transaction, so every read sees the
+// database as it was at the first one. PostgreSQL runs it at repeatable read.
+// On SQLite the driver begins every transaction with the write lock
+// (_txlock=immediate), so the snapshot is a deferred transaction on a pinned
+// connection instead: in WAL mode it reads without holding up writers.
+func (r *gormRepository) WithSnapshot(ctx context.Context, fn func(tx Store) error) error {
+	if r.dialect == DialectPostgres {
+		return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return fn(&gormRepository{db: tx, dialect: r.dialect})
+		}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	}
+	return r.db.WithContext(ctx).Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("BEGIN DEFERRED").Error; err != nil {
+			return err
+		}
+		err := fn(&gormRepository{db: conn, dialect: r.dialect})
+		// Ended even if ctx is done, so the connection goes back to the
+		// pool outside the transaction
+		end := conn.WithContext(context.WithoutCancel(ctx))
+		if err != nil {
+			end.Exec("ROLLBACK")
+			return err
+		}
+		return end.Exec("COMMIT").Error
+	})
+}
+
+// forUpdate locks the rows read by query until the transaction ends. SQLite
+// has no row locks; there every write transaction takes the database lock
+// when it begins (_txlock=immediate), which serializes them instead.
+func (r *gormRepository) forUpdate(query *gorm.DB) *gorm.DB {
+	if r.dialect == DialectSQLite {
+		return query
+	}
+	return query.Clauses(clause.Locking{Strength: "UPDATE"})
+}
+
+// Account operations
+func (r *gormRepository) CreateAccount(ctx context.Context, account *models.Account) error {
+	return r.db.WithContext(ctx).Create(account).Error
+}
+
+func (r *gormRepository) GetAccountByID(ctx context.Context, id uint) (*models.Account, error) {
+	var account models.Account
+	if err := r.db.WithContext(ctx).Preload("Owners").First(&account, id).Error; err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (r *gormRepository) GetAccountByNumber(ctx context.Context, accountNumber string) (*models.Account, error) {
+	var account models.Account
+	if err := r.db.WithContext(ctx).Preload("Owners").Where("account_number = ?", accountNumber).First(&account).Error; err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+var accountList = listSpec[models.Account]{
+	fields: map[string]sortField[models.Account]{
+		"id":             {column: "id", kind: sortInt, value: func(a *models.Account) interface{} { return int64(a.ID) }},
+		"created_at":     {column: "created_at", kind: sortTime, value: func(a *models.Account) interface{} { return a.CreatedAt }},
+		"account_number": {column: "account_number", kind: sortString, value: func(a *models.Account) interface{} { return a.AccountNumber }},
+		"balance":        {column: "balance_minor", kind: sortInt, value: func(a *models.Account) interface{} { return a.Balance.Minor }},
+	},
+	defaultSort: "id",
+	id:          func(a *models.Account) uint { return a.ID },
+}
+
+// ListAccounts returns a page of accounts filtered by creation date,
+// currency, status and balance range
+func (r *gormRepository) ListAccounts(ctx context.Context, opts ListOptions) ([]models.Account, string, error) {
+	return r.listAccounts(r.db.WithContext(ctx).Model(&models.Account{}).Preload("Owners"), opts)
+}
+
+func (r *gormRepository) listAccounts(query *gorm.DB, opts ListOptions) ([]models.Account, string, error) {
+	query = filterCreatedAt(query, opts)
+	if opts.Currency != "" {
+		query = query.Where("balance_currency = ?", opts.Currency)
+	}
+	if opts.Status != "" {
+		query = query.Where("status = ?", opts.Status)
+	}
+	query = filterAmount(query, "balance_minor", opts)
+	return fetchPage(query, accountList, opts)
+}
+
+func (r *gormRepository) LockAccount(ctx context.Context, id uint) (*models.Account, error) {
+	var account models.Account
+	if err := r.forUpdate(r.db.WithContext(ctx)).First(&account, id).Error; err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// ApplyBalanceDelta is a conditional update, so a stale read fails with
+// models.ErrConcurrentUpdate and the caller should retry with a fresh read
+func (r *gormRepository) ApplyBalanceDelta(ctx context.Context, account *models.Account, delta money.Money) error {
+	now := time.Now()
+	query := r.db.WithContext(ctx).Model(&models.Account{}).
+		Where("id = ? AND version = ? AND balance_currency = ?", account.ID, account.Version, delta.Currency)
+	if delta.IsNegative() {
+		query = query.Where("balance_minor + overdraft_limit_minor - held_amount_minor + ? >= 0", delta.Minor)
+	}
+
+	result := query.Updates(map[string]interface{}{
+		"balance_minor": gorm.Expr("balance_minor + ?", delta.Minor),
+		"version":       gorm.Expr("version + 1"),
+		"updated_at":    now,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.ErrConcurrentUpdate
+	}
+
+	balance, err := account.Balance.Add(delta)
+	if err != nil {
+		return err
+	}
+	account.Balance = balance
+	account.Version++
+	account.UpdatedAt = now
+	return nil
+}
+
+func (r *gormRepository) UpdateAccountStatus(ctx context.Context, account *models.Account) error {
+	now := time.Now()
+	result := r.db.WithContext(ctx).Model(&models.Account{}).
+		Where("id = ? AND version = ?", account.ID, account.Version).
+		Updates(map[string]interface{}{
+			"status":            account.Status,
+			"status_reason":     account.StatusReason,
+			"status_changed_at": now,
+			"version":           gorm.Expr("version + 1"),
+			"updated_at":        now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.ErrConcurrentUpdate
+	}
+
+	account.StatusChangedAt = &now
+	account.Version++
+	account.UpdatedAt = now
+	return nil
+}
+
+func (r *gormRepository) UpdateAccountOverdraft(ctx context.Context, account *models.Account) error {
+	now := time.Now()
+	result := r.db.WithContext(ctx).Model(&models.Account{}).
+		Where("id = ? AND version = ?", account.ID, account.Version).
+		Updates(map[string]interface{}{
+			"overdraft_limit_minor":    account.OverdraftLimit.Minor,
+			"overdraft_limit_currency": account.OverdraftLimit.Currency,
+			"version":                  gorm.Expr("version + 1"),
+			"updated_at":               now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.ErrConcurrentUpdate
+	}
+
+	account.Version++
+	account.UpdatedAt = now
+	return nil
+}
+
+// Transfer operations
+func (r *gormRepository) CreateTransfer(ctx context.Context, transfer *models.Transfer) error {
+	return r.db.WithContext(ctx).Create(transfer).Error
+}
+
+func (r *gormRepository) GetTransferByID(ctx context.Context, id uint) (*models.Transfer, error) {
+	var transfer models.Transfer
+	if err := r.db.WithContext(ctx).Preload("Reversals").First(&transfer, id).Error; err != nil {
+		return nil, err
+	}
+	return &transfer, nil
+}
+
+func (r *gormRepository) LockTransfer(ctx context.Context, id uint) (*models.Transfer, error) {
+	var transfer models.Transfer
+	if err := r.forUpdate(r.db.WithContext(ctx)).First(&transfer, id).Error; err != nil {
+		return nil, err
+	}
+	return &transfer, nil
+}
+
+func (r *gormRepository) UpdateTransferStatus(ctx context.Context, transfer *models.Transfer) error {
+	return r.db.WithContext(ctx).Model(transfer).Select("status", "failure_reason", "failure_code").Updates(transfer).Error
+}
+
+var transferList = listSpec[models.Transfer]{
+	fields: map[string]sortField[models.Transfer]{
+		"id":         {column: "id", kind: sortInt, value: func(t *models.Transfer) interface{} { return int64(t.ID) }},
+		"created_at": {column: "created_at", kind: sortTime, value: func(t *models.Transfer) interface{} { return t.CreatedAt }},
+		"amount":     {column: "amount_minor", kind: sortInt, value: func(t *models.Transfer) interface{} { return t.Amount.Minor }},
+	},
+	defaultSort: "-created_at",
+	id:          func(t *models.Transfer) uint { return t.ID },
+}
+
+// ListTransfers returns a page of transfers filtered by date, status,
+// currency and amount of the debited leg, and by the account on either side.
+// Type filters by status.
+func (r *gormRepository) ListTransfers(ctx context.Context, opts ListOptions) ([]models.Transfer, string, error) {
+	query := filterCreatedAt(r.db.WithContext(ctx).Model(&models.Transfer{}).Preload("Reversals"), opts)
+	if opts.Type != "" {
+		query = query.Where("status = ?", opts.Type)
+	}
+	if opts.Currency != "" {
+		query = query.Where("amount_currency = ?", opts.Currency)
+	}
+	if opts.AccountNumber != "" {
+		query = query.Where("(from_account_number = ? OR to_account_number = ?)", opts.AccountNumber, opts.AccountNumber)
+	}
+	query = filterAmount(query, "amount_minor", opts)
+	return fetchPage(query, transferList, opts)
+}
+
+// velocityLockSpace is the high half of the PostgreSQL advisory lock keys
+// that serialize the velocity checks of each source account
+const velocityLockSpace = 7_240_613
+
+// LockTransferVelocity takes a transaction-scoped advisory lock on the
+// account's outgoing transfers in PostgreSQL. SQLite transactions already
+// hold the database write lock.
+func (r *gormRepository) LockTransferVelocity(ctx context.Context, fromAccountID uint) error {
+	if r.dialect != DialectPostgres {
+		return nil
+	}
+	key := int64(velocityLockSpace)<<32 | int64(fromAccountID)
+	return r.db.WithContext(ctx).Exec("SELECT pg_advisory_xact_lock(?)", key).Error
+}
+
+func (r *gormRepository) GetTransferVelocity(ctx context.Context, fromAccountID uint, since time.Time) (*models.TransferVelocity, error) {
+	var velocity models.TransferVelocity
+	err := r.db.WithContext(ctx).Model(&models.Transfer{}).
+		Select("COUNT(*) AS count, COALESCE(SUM(amount_minor), 0) AS amount_minor").
+		Where("from_account_id = ? AND created_at >= ? AND occurred_at IS NULL", fromAccountID, since).
+		Where("status NOT IN ?", []models.TransferStatus{models.TransferStatusFailed, models.TransferStatusCompensated,
+			models.TransferStatusVoided, models.TransferStatusExpired}).
+		Scan(&velocity).Error
+	if err != nil {
+		return nil, err
+	}
+	return &velocity, nil
+}
+
+func (r *gormRepository) ListExpiredAuthorizations(ctx context.Context, now time.Time, limit int) ([]models.Transfer, error) {
+	var transfers []models.Transfer
+	if err := r.db.WithContext(ctx).
+		Where("status = ? AND hold_expires_at < ?", models.TransferStatusAuthorized, now).
+		Order("hold_expires_at, id").Limit(limit).Find(&transfers).Error; err != nil {
+		return nil, err
+	}
+	return transfers, nil
+}
+
+// Transaction operations
+func (r *gormRepository) CreateTransaction(ctx context.Context, transaction *models.Transaction) error {
+	return r.db.WithContext(ctx).Create(transaction).Error
+}
+
+func (r *gormRepository) EntryApplied(ctx context.Context, key string) (bool, error) {
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&models.Transaction{}).Where("entry_key = ?", key).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+var transactionList = listSpec[models.Transaction]{
+	fields: map[string]sortField[models.Transaction]{
+		"id":         {column: "id", kind: sortInt, value: func(t *models.Transaction) interface{} { return int64(t.ID) }},
+		"created_at": {column: "created_at", kind: sortTime, value: func(t *models.Transaction) interface{} { return t.CreatedAt }},
+		"amount":     {column: "amount_minor", kind: sortInt, value: func(t *models.Transaction) interface{} { return t.Amount.Minor }},
+	},
+	defaultSort: "-created_at",
+	id:          func(t *models.Transaction) uint { return t.ID },
+}
+
+// ListTransactionsByAccount returns a page of an account's transactions
+// filtered by date, type, reference and absolute amount, so a minimum of 10
+// matches both deposits and withdrawals of 10 or more
+func (r *gormRepository) ListTransactionsByAccount(ctx context.Context, accountID uint, opts ListOptions) ([]models.Transaction, string, error) {
+	query := filterCreatedAt(r.db.WithContext(ctx).Model(&models.Transaction{}).Where("account_id = ?", accountID), opts)
+	if opts.Type != "" {
+		query = query.Where("type = ?", opts.Type)
+	}
+	if opts.Reference != "" {
+		query = query.Where("reference = ?", opts.Reference)
+	}
+	query = filterAmount(query, "ABS(amount_minor)", opts)
+	return fetchPage(query, transactionList, opts)
+}
+
+func (r *gormRepository) SumTransactionsByAccount(ctx context.Context, accountID uint, before time.Time) (int64, error) {
+	sum, err := r.sumTransactions(ctx, accountID, before)
+	if err != nil {
+		return 0, err
+	}
+	opening, err := r.untrackedOpeningBalance(ctx, accountID, before)
+	if err != nil {
+		return 0, err
+	}
+	return sum + opening, nil
+}
+
+func (r *gormRepository) sumTransactions(ctx context.Context, accountID uint, before time.Time) (int64, error) {
+	var sum int64
+	err := r.db.WithContext(ctx).Model(&models.Transaction{}).
+		Select("COALESCE(SUM(amount_minor), 0)").
+		Where("account_id = ? AND created_at < ? AND occurred_at IS NULL", accountID, before).
+		Scan(&sum).Error
+	return sum, err
+}
+
+// untrackedOpeningBalance returns, for an account adopted from before the
+// ledger and created before a time, the part of the opening balance
+// backfilled for it that its transactions do not account for. Accounts of
+// the first release could hold a balance no transaction explains; it counts
+// from when the account was created.
+func (r *gormRepository) untrackedOpeningBalance(ctx context.Context, accountID uint, before time.Time) (int64, error) {
+	var opening struct {
+		AmountMinor int64
+		CreatedAt   time.Time
+	}
+	result := r.db.WithContext(ctx).Table("postings").
+		Select("postings.amount_minor, journal_entries.created_at").
+		Joins("JOIN journal_entries ON journal_entries.id = postings.journal_entry_id").
+		Joins("JOIN accounts ON accounts.id = postings.account_id").
+		Where("postings.account_id = ? AND journal_entries.reference = ? AND accounts.created_at < ?", accountID, openingReference(accountID), before).
+		Limit(1).Scan(&opening)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return 0, result.Error
+	}
+
+	tracked, err := r.sumTransactions(ctx, accountID, opening.CreatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return opening.AmountMinor - tracked, nil
+}
+
+// transactionBatch is how many transactions EachTransactionByAccount reads
+// at a time
+const transactionBatch = 500
+
+func (r *gormRepository) EachTransactionByAccount(ctx context.Context, accountID uint, from, to time.Time, fn func(*models.Transaction) error) error {
+	// Historical transactions are recorded after the fact, so the batches
+	// follow the date rather than the primary key
+	var last *models.Transaction
+	for {
+		query := r.db.WithContext(ctx).
+			Where("account_id = ? AND created_at >= ? AND created_at < ?", accountID, from, to)
+		if last != nil {
+			query = query.Where("(created_at > ? OR (created_at = ? AND id > ?))", last.CreatedAt, last.CreatedAt, last.ID)
+		}
+
+		var batch []models.Transaction
+		if err := query.Order("created_at, id").Limit(transactionBatch).Find(&batch).Error; err != nil {
+			return err
+		}
+		for i := range batch {
+			if err := fn(&batch[i]); err != nil {
+				return err
+			}
+		}
+		if len(batch) < transactionBatch {
+			return nil
+		}
+		last = &batch[len(batch)-1]
+	}
+}
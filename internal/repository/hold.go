@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/pkg/money"
+	"gorm.io/gorm"
+)
+
+// Hold operations
+func (r *gormRepository) CreateHold(ctx context.Context, hold *models.AccountHold) error {
+	return r.db.WithContext(ctx).Create(hold).Error
+}
+
+func (r *gormRepository) GetHoldByKey(ctx context.Context, key string) (*models.AccountHold, error) {
+	var hold models.AccountHold
+	if err := r.db.WithContext(ctx).Where("key = ?", key).First(&hold).Error; err != nil {
+		return nil, err
+	}
+	return &hold, nil
+}
+
+func (r *gormRepository) UpdateHoldStatus(ctx context.Context, hold *models.AccountHold) error {
+	return r.db.WithContext(ctx).Model(hold).Select("status").Updates(hold).Error
+}
+
+// ApplyHeldDelta is a conditional update, so a stale read fails with
+// models.ErrConcurrentUpdate and the caller should retry with a fresh read
+func (r *gormRepository) ApplyHeldDelta(ctx context.Context, account *models.Account, delta money.Money) error {
+	now := time.Now()
+	query := r.db.WithContext(ctx).Model(&models.Account{}).
+		Where("id = ? AND version = ? AND held_amount_currency = ?", account.ID, account.Version, delta.Currency)
+	if delta.IsPositive() {
+		query = query.Where("balance_minor + overdraft_limit_minor - held_amount_minor - ? >= 0", delta.Minor)
+	}
+
+	result := query.Updates(map[string]interface{}{
+		"held_amount_minor": gorm.Expr("held_amount_minor + ?", delta.Minor),
+		"version":           gorm.Expr("version + 1"),
+		"updated_at":        now,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.ErrConcurrentUpdate
+	}
+
+	held, err := account.HeldAmount.Add(delta)
+	if err != nil {
+		return err
+	}
+	account.HeldAmount = held
+	account.Version++
+	account.UpdatedAt = now
+	return nil
+}
@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/tribal/bank-api/internal/models"
+)
+
+// Idempotency key operations
+func (r *gormRepository) CreateIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) error {
+	return r.db.WithContext(ctx).Create(key).Error
+}
+
+func (r *gormRepository) GetIdempotencyKey(ctx context.Context, scope, key string) (*models.IdempotencyKey, error) {
+	var record models.IdempotencyKey
+	if err := r.db.WithContext(ctx).Where("scope = ? AND idempotency_key = ?", scope, key).First(&record).Error; err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (r *gormRepository) CompleteIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) error {
+	return r.db.WithContext(ctx).Model(key).Select("status_code", "content_type", "response_body").Updates(key).Error
+}
+
+func (r *gormRepository) ExtendIdempotencyLease(ctx context.Context, id uint, until time.Time) error {
+	result := r.db.WithContext(ctx).Model(&models.IdempotencyKey{}).
+		Where("id = ? AND status_code = 0", id).
+		Update("locked_until", until)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormRepository) DeleteIdempotencyKey(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&models.IdempotencyKey{}, id).Error
+}
+
+func (r *gormRepository) PurgeExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Where("expires_at <= ?", now).Delete(&models.IdempotencyKey{})
+	return result.RowsAffected, result.Error
+}
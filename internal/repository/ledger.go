@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/pkg/money"
+	"gorm.io/gorm"
+)
+
+// LedgerSum is the sum of a group of postings in one currency
+type LedgerSum struct {
+	JournalEntryID uint
+	AccountID      uint
+	SystemAccount  string
+	Currency       money.Currency
+	Minor          int64
+}
+
+func (s LedgerSum) Money() money.Money {
+	return money.New(s.Minor, s.Currency)
+}
+
+// Ledger operations
+func (r *gormRepository) CountJournalEntries(ctx context.Context) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.JournalEntry{}).Count(&count).Error
+	return count, err
+}
+
+// ListUnbalancedJournalEntries returns, per journal entry and currency, the
+// postings that do not sum to zero
+func (r *gormRepository) ListUnbalancedJournalEntries(ctx context.Context) ([]LedgerSum, error) {
+	var sums []LedgerSum
+	err := r.db.WithContext(ctx).Model(&models.Posting{}).
+		Select("journal_entry_id, amount_currency AS currency, SUM(amount_minor) AS minor").
+		Group("journal_entry_id, amount_currency").
+		Having("SUM(amount_minor) <> 0").
+		Order("journal_entry_id").
+		Scan(&sums).Error
+	return sums, err
+}
+
+// SumPostingsByAccount derives the balance of every customer account from
+// its postings
+func (r *gormRepository) SumPostingsByAccount(ctx context.Context) ([]LedgerSum, error) {
+	var sums []LedgerSum
+	err := r.db.WithContext(ctx).Model(&models.Posting{}).
+		Select("account_id, amount_currency AS currency, SUM(amount_minor) AS minor").
+		Where("account_id IS NOT NULL").
+		Group("account_id, amount_currency").
+		Scan(&sums).Error
+	return sums, err
+}
+
+// SumPostingsBySystemAccount returns the balance of every system account
+func (r *gormRepository) SumPostingsBySystemAccount(ctx context.Context) ([]LedgerSum, error) {
+	var sums []LedgerSum
+	err := r.db.WithContext(ctx).Model(&models.Posting{}).
+		Select("system_account, amount_currency AS currency, SUM(amount_minor) AS minor").
+		Where("account_id IS NULL").
+		Group("system_account, amount_currency").
+		Order("system_account, amount_currency").
+		Scan(&sums).Error
+	return sums, err
+}
+
+// SumPostingsByCurrency returns the trial balance, which is zero in every
+// currency when the ledger is balanced
+func (r *gormRepository) SumPostingsByCurrency(ctx context.Context) ([]LedgerSum, error) {
+	var sums []LedgerSum
+	err := r.db.WithContext(ctx).Model(&models.Posting{}).
+		Select("amount_currency AS currency, SUM(amount_minor) AS minor").
+		Group("amount_currency").
+		Order("amount_currency").
+		Scan(&sums).Error
+	return sums, err
+}
+
+func (r *gormRepository) CreateJournalEntry(ctx context.Context, entry *models.JournalEntry) error {
+	return createJournalEntry(r.db.WithContext(ctx), entry)
+}
+
+func createJournalEntry(tx *gorm.DB, entry *models.JournalEntry) error {
+	if len(entry.Postings) < 2 {
+		return fmt.Errorf("journal entry %q needs at least two postings", entry.Reference)
+	}
+
+	sums := make(map[money.Currency]money.Money)
+	for _, p := range entry.Postings {
+		if p.AccountID == nil && p.SystemAccount == "" {
+			return fmt.Errorf("journal entry %q has a posting without an account", entry.Reference)
+		}
+		sum, ok := sums[p.Amount.Currency]
+		if !ok {
+			sum = money.Zero(p.Amount.Currency)
+		}
+		sum, err := sum.Add(p.Amount)
+		if err != nil {
+			return err
+		}
+		sums[p.Amount.Currency] = sum
+	}
+	for currency, sum := range sums {
+		if !sum.IsZero() {
+			return fmt.Errorf("journal entry %q is unbalanced by %s %s", entry.Reference, sum, currency)
+		}
+	}
+
+	return tx.Create(entry).Error
+}
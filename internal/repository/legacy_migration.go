@@ -0,0 +1,211 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/pkg/money"
+	"gorm.io/gorm"
+)
+
+// legacyAmountColumn describes a REAL column from the float-based schema that
+// is replaced by an embedded money.Money (<prefix>minor, <prefix>currency).
+type legacyAmountColumn struct {
+	table  string
+	column string
+	prefix string
+}
+
+var legacyAmountColumns = []legacyAmountColumn{
+	{table: "accounts", column: "balance", prefix: "balance_"},
+	{table: "transfers", column: "amount", prefix: "amount_"},
+	{table: "transactions", column: "amount", prefix: "amount_"},
+}
+
+// migrateLegacyAmounts converts databases created with float64 amounts to
+// integer minor units. Existing rows are assumed to be in the default
+// currency; the migration aborts instead of rounding if any stored value has
+// more decimals than that currency allows.
+func migrateLegacyAmounts(db *gorm.DB) error {
+	currency := money.DefaultCurrency
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		m := tx.Migrator()
+		for _, col := range legacyAmountColumns {
+			if !m.HasTable(col.table) || !m.HasColumn(col.table, col.column) {
+				continue
+			}
+
+			var rows []struct {
+				ID    uint
+				Value float64
+			}
+			if err := tx.Raw(fmt.Sprintf("SELECT id, COALESCE(%s, 0) AS value FROM %s", col.column, col.table)).
+				Scan(&rows).Error; err != nil {
+				return fmt.Errorf("failed to read %s.%s: %w", col.table, col.column, err)
+			}
+
+			// Each value is converted from the shortest decimal that reads
+			// back as the stored float, i.e. the amount as it was written.
+			// Counting its decimals is exact at any magnitude, where comparing
+			// the scaled float with a fixed tolerance is not.
+			minor := make(map[uint]int64, len(rows))
+			inexact := 0
+			for _, row := range rows {
+				amount, err := money.Parse(strconv.FormatFloat(row.Value, 'f', -1, 64), currency)
+				if errors.Is(err, money.ErrTooManyDecimals) {
+					inexact++
+					continue
+				}
+				if err != nil {
+					return fmt.Errorf("failed to convert %s.%s of row %d: %w", col.table, col.column, row.ID, err)
+				}
+				minor[row.ID] = amount.Minor
+			}
+			if inexact > 0 {
+				return fmt.Errorf("%d rows in %s.%s have more than %d decimals and cannot be converted losslessly",
+					inexact, col.table, col.column, currency.Exponent())
+			}
+
+			minorCol := col.prefix + "minor"
+			currencyCol := col.prefix + "currency"
+			stmts := []string{
+				fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s INTEGER NOT NULL DEFAULT 0", col.table, minorCol),
+				fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s TEXT NOT NULL DEFAULT '%s'", col.table, currencyCol, currency),
+			}
+			for _, stmt := range stmts {
+				if err := tx.Exec(stmt).Error; err != nil {
+					return fmt.Errorf("failed to migrate %s.%s: %w", col.table, col.column, err)
+				}
+			}
+			update := fmt.Sprintf("UPDATE %s SET %s = ? WHERE id = ?", col.table, minorCol)
+			for id, value := range minor {
+				if value == 0 {
+					continue
+				}
+				if err := tx.Exec(update, value, id).Error; err != nil {
+					return fmt.Errorf("failed to migrate %s.%s: %w", col.table, col.column, err)
+				}
+			}
+			if err := tx.Exec(fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", col.table, col.column)).Error; err != nil {
+				return fmt.Errorf("failed to migrate %s.%s: %w", col.table, col.column, err)
+			}
+		}
+		return nil
+	})
+}
+
+var createTableRe = regexp.MustCompile(`(?s)CREATE TABLE IF NOT EXISTS (\w+) \((.*?)\n\);`)
+
+// addMissingColumns adds to the tables of a database created before
+// versioned migrations the columns of the baseline script they lack. The
+// script creates its tables with IF NOT EXISTS, which leaves existing tables
+// as they are, so without this its indexes and every later migration would
+// refer to columns those tables do not have. Columns are added with the
+// definition the script gives them.
+func addMissingColumns(db *gorm.DB, script string) error {
+	m := db.Migrator()
+	for _, table := range createTableRe.FindAllStringSubmatch(script, -1) {
+		name, body := table[1], table[2]
+		if !m.HasTable(name) {
+			continue
+		}
+		for _, line := range strings.Split(body, "\n") {
+			definition := strings.TrimSuffix(strings.TrimSpace(line), ",")
+			column, _, _ := strings.Cut(definition, " ")
+			if column == "" || strings.HasPrefix(definition, "--") || m.HasColumn(name, column) {
+				continue
+			}
+			if err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", name, definition)).Error; err != nil {
+				return fmt.Errorf("failed to add %s.%s: %w", name, column, err)
+			}
+		}
+	}
+	return nil
+}
+
+// backfillLegacyRows fills the columns that rows written before they existed
+// left empty. It runs once, when a database created before versioned
+// migrations adopts the baseline schema.
+func backfillLegacyRows(db *gorm.DB) error {
+	if err := backfillTransferCreditAmounts(db); err != nil {
+		return fmt.Errorf("failed to backfill transfer credit amounts: %w", err)
+	}
+	if err := backfillTransferStatuses(db); err != nil {
+		return fmt.Errorf("failed to backfill transfer statuses: %w", err)
+	}
+	if err := backfillTransferReversedAmounts(db); err != nil {
+		return fmt.Errorf("failed to backfill transfer reversed amounts: %w", err)
+	}
+	if err := backfillOpeningBalances(db); err != nil {
+		return fmt.Errorf("failed to backfill opening balances: %w", err)
+	}
+	return nil
+}
+
+// backfillTransferCreditAmounts fills the credit leg of transfers recorded
+// before multi-currency support, which always credited the debited amount.
+func backfillTransferCreditAmounts(db *gorm.DB) error {
+	return db.Exec(
+		"UPDATE transfers SET credit_amount_minor = amount_minor, credit_amount_currency = amount_currency WHERE credit_amount_minor = 0 AND amount_minor <> 0",
+	).Error
+}
+
+// backfillTransferStatuses marks transfers recorded before the saga existed,
+// which were always applied synchronously, as completed
+func backfillTransferStatuses(db *gorm.DB) error {
+	return db.Exec(
+		"UPDATE transfers SET status = 'completed' WHERE status IS NULL OR status = ''",
+	).Error
+}
+
+// backfillTransferReversedAmounts gives transfers recorded before reversals
+// existed their reversed amounts in the currencies of each leg
+func backfillTransferReversedAmounts(db *gorm.DB) error {
+	return db.Exec(
+		"UPDATE transfers SET reversed_amount_currency = amount_currency, reversed_credit_amount_currency = credit_amount_currency WHERE reversed_amount_minor = 0 AND reversed_credit_amount_minor = 0",
+	).Error
+}
+
+// openingReference is the reference of the opening journal entry
+// backfillOpeningBalances gives an account
+func openingReference(accountID uint) string {
+	return fmt.Sprintf("OPEN-%d", accountID)
+}
+
+// backfillOpeningBalances gives accounts that predate the ledger an opening
+// journal entry so their balance can be derived from postings
+func backfillOpeningBalances(db *gorm.DB) error {
+	var accounts []models.Account
+	err := db.Unscoped().
+		Where("balance_minor <> 0").
+		Where("NOT EXISTS (SELECT 1 FROM postings WHERE postings.account_id = accounts.id)").
+		Find(&accounts).Error
+	if err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for i := range accounts {
+			account := &accounts[i]
+			entry := &models.JournalEntry{
+				Reference:   openingReference(account.ID),
+				Description: "Opening balance",
+				CreatedAt:   time.Now(),
+				Postings: []models.Posting{
+					{AccountID: &account.ID, Amount: account.Balance},
+					{SystemAccount: models.SystemAccountOpeningBalances, Amount: account.Balance.Neg()},
+				},
+			}
+			if err := createJournalEntry(tx, entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
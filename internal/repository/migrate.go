@@ -0,0 +1,390 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tribal/bank-api/migrations"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var (
+	// ErrSchemaBehind is returned when opening a database that has pending
+	// migrations; run `migrate up` first
+	ErrSchemaBehind = errors.New("database schema is behind")
+	// ErrMigrationModified is returned when the file of an applied migration
+	// no longer matches the checksum recorded when it was applied
+	ErrMigrationModified = errors.New("applied migration was modified")
+	// ErrNoDownMigration is returned when rolling back a migration that has
+	// no .down.sql file
+	ErrNoDownMigration = errors.New("migration cannot be rolled back")
+)
+
+// migrationLockID keys the PostgreSQL advisory lock held while a migration
+// is applied or rolled back
+const migrationLockID = 7_240_611
+
+var migrationFile = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is a numbered schema change read from the migrations directory
+type Migration struct {
+	Version  uint
+	Name     string
+	Checksum string
+	up       string
+	down     string
+}
+
+// MigrationStatus is a migration and whether it was applied. Migrations
+// recorded in the database but missing from the binary have an empty Name.
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt *time.Time
+	Modified  bool
+}
+
+// schemaMigration is a row of the schema_migrations table
+type schemaMigration struct {
+	Version   uint
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Migrator applies the migrations of its dialect in version order and records
+// them in schema_migrations. Each migration runs in its own transaction under
+// a lock, so several replicas can run `migrate up` at once.
+type Migrator struct {
+	db         *gorm.DB
+	dialect    Dialect
+	migrations []Migration
+}
+
+// OpenMigrator connects like Open but does not require the schema to be up
+// to date
+func OpenMigrator(databaseURL, sqlitePath string) (*Migrator, error) {
+	dialector, dialect := dialectorFor(databaseURL, sqlitePath)
+	db, err := connect(dialector, logger.Warn)
+	if err != nil {
+		return nil, err
+	}
+	return newMigrator(db, dialect)
+}
+
+func newMigrator(db *gorm.DB, dialect Dialect) (*Migrator, error) {
+	loaded, err := loadMigrations(migrations.FS, string(dialect))
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, dialect: dialect, migrations: loaded}, nil
+}
+
+// loadMigrations reads the migrations of a dialect from dir, sorted by version
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[uint]*Migration)
+	for _, entry := range entries {
+		match := migrationFile.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.ParseUint(match[1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %w", entry.Name(), err)
+		}
+		data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		m, ok := byVersion[uint(version)]
+		if !ok {
+			m = &Migration{Version: uint(version), Name: match[2]}
+			byVersion[uint(version)] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.up = string(data)
+			sum := sha256.Sum256(data)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.down = string(data)
+		}
+	}
+
+	loaded := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no .up.sql file", m.Version, m.Name)
+		}
+		loaded = append(loaded, *m)
+	}
+	sort.Slice(loaded, func(i, j int) bool { return loaded[i].Version < loaded[j].Version })
+	return loaded, nil
+}
+
+// Close closes the database connection
+func (m *Migrator) Close() error {
+	sqlDB, err := m.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// Status lists every known migration and those recorded in the database that
+// this binary does not know about
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied := make(map[uint]schemaMigration)
+	db := m.db.WithContext(ctx)
+	if db.Migrator().HasTable(&schemaMigration{}) {
+		var err error
+		if applied, err = appliedMigrations(db); err != nil {
+			return nil, err
+		}
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Migration: migration}
+		if row, ok := applied[migration.Version]; ok {
+			appliedAt := row.AppliedAt
+			status.Applied = true
+			status.AppliedAt = &appliedAt
+			status.Modified = row.Checksum != migration.Checksum
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for _, row := range applied {
+		appliedAt := row.AppliedAt
+		statuses = append(statuses, MigrationStatus{
+			Migration: Migration{Version: row.Version, Checksum: row.Checksum},
+			Applied:   true,
+			AppliedAt: &appliedAt,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// Check returns ErrSchemaBehind if any migration is pending and
+// ErrMigrationModified if an applied one changed since it ran
+func (m *Migrator) Check(ctx context.Context) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	var pending []string
+	for _, status := range statuses {
+		if status.Modified {
+			return fmt.Errorf("%w: %03d_%s", ErrMigrationModified, status.Version, status.Name)
+		}
+		if !status.Applied {
+			pending = append(pending, fmt.Sprintf("%03d_%s", status.Version, status.Name))
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%w: pending migrations %s; run `migrate up`", ErrSchemaBehind, strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+// Up applies every pending migration in version order and returns the ones
+// it applied
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	if err := m.verifyChecksums(ctx); err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, migration := range m.migrations {
+		var ran bool
+		err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := m.lock(tx); err != nil {
+				return err
+			}
+			applied, err := appliedMigrations(tx)
+			if err != nil {
+				return err
+			}
+			// Another process may have applied it while we waited for the lock
+			if _, ok := applied[migration.Version]; ok {
+				return nil
+			}
+
+			adopting := len(applied) == 0 && tx.Migrator().HasTable("accounts")
+			if adopting {
+				if err := migrateLegacyAmounts(tx); err != nil {
+					return fmt.Errorf("failed to migrate legacy amounts: %w", err)
+				}
+				if err := addMissingColumns(tx, migration.up); err != nil {
+					return fmt.Errorf("failed to adopt legacy tables: %w", err)
+				}
+			}
+			if err := execScript(tx, migration.up); err != nil {
+				return fmt.Errorf("migration %03d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			if adopting {
+				if err := backfillLegacyRows(tx); err != nil {
+					return err
+				}
+			}
+
+			ran = true
+			return tx.Create(&schemaMigration{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				Checksum:  migration.Checksum,
+				AppliedAt: time.Now(),
+			}).Error
+		})
+		if err != nil {
+			return done, err
+		}
+		if ran {
+			done = append(done, migration)
+		}
+	}
+	return done, nil
+}
+
+// Down rolls back the last steps applied migrations, newest first, and
+// returns the ones it rolled back
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	byVersion := make(map[uint]Migration, len(m.migrations))
+	for _, migration := range m.migrations {
+		byVersion[migration.Version] = migration
+	}
+
+	var done []Migration
+	for i := 0; i < steps; i++ {
+		var rolledBack *Migration
+		err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := m.lock(tx); err != nil {
+				return err
+			}
+			var last schemaMigration
+			err := tx.Order("version DESC").Limit(1).Find(&last).Error
+			if err != nil || last.Version == 0 {
+				return err
+			}
+
+			migration, ok := byVersion[last.Version]
+			if !ok {
+				return fmt.Errorf("%w: migration %d is not known to this binary", ErrNoDownMigration, last.Version)
+			}
+			if migration.down == "" {
+				return fmt.Errorf("%w: %03d_%s has no .down.sql file", ErrNoDownMigration, migration.Version, migration.Name)
+			}
+			if err := execScript(tx, migration.down); err != nil {
+				return fmt.Errorf("rollback of %03d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			rolledBack = &migration
+			return tx.Where("version = ?", migration.Version).Delete(&schemaMigration{}).Error
+		})
+		if err != nil {
+			return done, err
+		}
+		if rolledBack == nil {
+			break
+		}
+		done = append(done, *rolledBack)
+	}
+	return done, nil
+}
+
+// verifyChecksums refuses to continue if an applied migration was edited
+// after it ran, since the database would not match the files
+func (m *Migrator) verifyChecksums(ctx context.Context) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	for _, status := range statuses {
+		if status.Modified {
+			return fmt.Errorf("%w: %03d_%s", ErrMigrationModified, status.Version, status.Name)
+		}
+	}
+	return nil
+}
+
+// lock serializes migrations across processes for the rest of the
+// transaction. SQLite transactions already hold the database write lock from
+// the start (_txlock=immediate).
+func (m *Migrator) lock(tx *gorm.DB) error {
+	if m.dialect == DialectPostgres {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLockID).Error; err != nil {
+			return fmt.Errorf("failed to take migration lock: %w", err)
+		}
+	}
+	return createSchemaTable(tx)
+}
+
+func createSchemaTable(db *gorm.DB) error {
+	return db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		name TEXT NOT NULL,
+		checksum TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`).Error
+}
+
+func appliedMigrations(db *gorm.DB) (map[uint]schemaMigration, error) {
+	var rows []schemaMigration
+	if err := db.Order("version").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	applied := make(map[uint]schemaMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// execScript runs the statements of a migration file one by one. Statements
+// end with a semicolon at the end of a line; lines starting with -- are
+// comments.
+func execScript(tx *gorm.DB, script string) error {
+	var stmt strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		stmt.WriteString(line)
+		stmt.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			if err := tx.Exec(stmt.String()).Error; err != nil {
+				return err
+			}
+			stmt.Reset()
+		}
+	}
+	if strings.TrimSpace(stmt.String()) != "" {
+		return tx.Exec(stmt.String()).Error
+	}
+	return nil
+}
@@ -0,0 +1,486 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/pkg/money"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func openTestMigrator(t *testing.T, path string) *Migrator {
+	t.Helper()
+	migrator, err := OpenMigrator("", path)
+	if err != nil {
+		t.Fatalf("open migrator: %v", err)
+	}
+	t.Cleanup(func() { migrator.Close() })
+	return migrator
+}
+
+func TestMigrateUpDownStatus(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "bank.db")
+	migrator := openTestMigrator(t, path)
+
+	if _, err := NewSQLite(path); !errors.Is(err, ErrSchemaBehind) {
+		t.Fatalf("open before migrating: got %v, want ErrSchemaBehind", err)
+	}
+
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	if len(applied) != len(migrator.migrations) {
+		t.Fatalf("applied %d migrations, want %d", len(applied), len(migrator.migrations))
+	}
+	if again, err := migrator.Up(ctx); err != nil || len(again) != 0 {
+		t.Fatalf("second up applied %d migrations: %v", len(again), err)
+	}
+
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	for _, status := range statuses {
+		if !status.Applied || status.Modified {
+			t.Fatalf("migration %d: applied=%v modified=%v", status.Version, status.Applied, status.Modified)
+		}
+	}
+
+	repo, err := NewSQLite(path)
+	if err != nil {
+		t.Fatalf("open after migrating: %v", err)
+	}
+	repo.Close()
+
+	rolledBack, err := migrator.Down(ctx, len(migrator.migrations))
+	if err != nil {
+		t.Fatalf("down: %v", err)
+	}
+	if len(rolledBack) != len(migrator.migrations) {
+		t.Fatalf("rolled back %d migrations, want %d", len(rolledBack), len(migrator.migrations))
+	}
+	if migrator.db.Migrator().HasTable("accounts") {
+		t.Fatal("accounts table still exists after rolling back every migration")
+	}
+	if _, err := NewSQLite(path); !errors.Is(err, ErrSchemaBehind) {
+		t.Fatalf("open after rolling back: got %v, want ErrSchemaBehind", err)
+	}
+}
+
+func TestMigrateRefusesModifiedMigration(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "bank.db")
+	migrator := openTestMigrator(t, path)
+
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	if err := migrator.db.Exec("UPDATE schema_migrations SET checksum = 'edited' WHERE version = 1").Error; err != nil {
+		t.Fatalf("edit checksum: %v", err)
+	}
+
+	if _, err := migrator.Up(ctx); !errors.Is(err, ErrMigrationModified) {
+		t.Fatalf("up: got %v, want ErrMigrationModified", err)
+	}
+	if _, err := NewSQLite(path); !errors.Is(err, ErrMigrationModified) {
+		t.Fatalf("open: got %v, want ErrMigrationModified", err)
+	}
+}
+
+// legacyAccount is the accounts table as AutoMigrate created it, before
+// versioned migrations added columns to it
+type legacyAccount struct {
+	ID            uint        `gorm:"primarykey"`
+	AccountNumber string      `gorm:"uniqueIndex;not null"`
+	Balance       money.Money `gorm:"embedded;embeddedPrefix:balance_"`
+	Version       int64       `gorm:"not null;default:0"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	DeletedAt     gorm.DeletedAt `gorm:"index"`
+}
+
+func (legacyAccount) TableName() string {
+	return "accounts"
+}
+
+// legacyTransfer is the transfers table as AutoMigrate created it, before
+// versioned migrations added columns to it
+type legacyTransfer struct {
+	ID                   uint        `gorm:"primarykey"`
+	FromAccountID        uint        `gorm:"not null"`
+	ToAccountID          uint        `gorm:"not null"`
+	FromAccountNumber    string      `gorm:"index"`
+	ToAccountNumber      string      `gorm:"index"`
+	Amount               money.Money `gorm:"embedded;embeddedPrefix:amount_"`
+	CreditAmount         money.Money `gorm:"embedded;embeddedPrefix:credit_amount_"`
+	FXRate               string
+	Status               string `gorm:"size:20;index"`
+	FailureReason        string
+	Description          string
+	ReversedAmount       money.Money `gorm:"embedded;embeddedPrefix:reversed_amount_"`
+	ReversedCreditAmount money.Money `gorm:"embedded;embeddedPrefix:reversed_credit_amount_"`
+	ReversalStatus       string      `gorm:"size:20"`
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
+	DeletedAt            gorm.DeletedAt `gorm:"index"`
+}
+
+func (legacyTransfer) TableName() string {
+	return "transfers"
+}
+
+// legacyTransaction is the transactions table as AutoMigrate created it,
+// before versioned migrations added columns to it
+type legacyTransaction struct {
+	ID             uint        `gorm:"primarykey"`
+	AccountID      uint        `gorm:"not null;index"`
+	Type           string      `gorm:"not null"`
+	Amount         money.Money `gorm:"embedded;embeddedPrefix:amount_"`
+	Reference      string
+	Description    string
+	EntryKey       *string `gorm:"uniqueIndex"`
+	JournalEntryID *uint   `gorm:"index"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	DeletedAt      gorm.DeletedAt `gorm:"index"`
+}
+
+func (legacyTransaction) TableName() string {
+	return "transactions"
+}
+
+// TestMigrateAdoptsAutoMigratedDatabase upgrades a database created by GORM
+// AutoMigrate before versioned migrations existed
+func TestMigrateAdoptsAutoMigratedDatabase(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "bank.db")
+
+	db, err := connect(sqlite.Open(sqliteDSN(path)), logger.Warn)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if err := db.AutoMigrate(&legacyAccount{}, &legacyTransfer{}, &legacyTransaction{}, &models.JournalEntry{}, &models.Posting{}); err != nil {
+		t.Fatalf("auto migrate: %v", err)
+	}
+	account := &legacyAccount{AccountNumber: "LEGACY", Balance: usd(2500)}
+	if err := db.Create(account).Error; err != nil {
+		t.Fatalf("create account: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.Close()
+
+	if _, err := openTestMigrator(t, path).Up(ctx); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+
+	repo, err := NewSQLite(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer repo.Close()
+
+	// The adopted account got an opening journal entry
+	sums, err := repo.SumPostingsByAccount(ctx)
+	if err != nil {
+		t.Fatalf("sum postings: %v", err)
+	}
+	if len(sums) != 1 || sums[0].AccountID != account.ID || sums[0].Money() != usd(2500) {
+		t.Fatalf("got posting sums %+v, want the opening balance of account %d", sums, account.ID)
+	}
+}
+
+// baselineAccount, baselineTransfer and baselineTransaction are the tables
+// of the first release, which stored amounts as floats with no currency
+type baselineAccount struct {
+	ID            uint    `gorm:"primarykey"`
+	AccountNumber string  `gorm:"uniqueIndex;not null"`
+	Balance       float64 `gorm:"not null;default:0"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	DeletedAt     gorm.DeletedAt `gorm:"index"`
+}
+
+func (baselineAccount) TableName() string {
+	return "accounts"
+}
+
+type baselineTransfer struct {
+	ID            uint    `gorm:"primarykey"`
+	FromAccountID uint    `gorm:"not null"`
+	ToAccountID   uint    `gorm:"not null"`
+	Amount        float64 `gorm:"not null"`
+	Description   string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	DeletedAt     gorm.DeletedAt `gorm:"index"`
+}
+
+func (baselineTransfer) TableName() string {
+	return "transfers"
+}
+
+type baselineTransaction struct {
+	ID          uint    `gorm:"primarykey"`
+	AccountID   uint    `gorm:"not null;index"`
+	Type        string  `gorm:"not null"`
+	Amount      float64 `gorm:"not null"`
+	Reference   string
+	Description string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	DeletedAt   gorm.DeletedAt `gorm:"index"`
+}
+
+func (baselineTransaction) TableName() string {
+	return "transactions"
+}
+
+// openBaselineDatabase creates a database with the schema of the first
+// release, as its AutoMigrate left it
+func openBaselineDatabase(t *testing.T, path string) *gorm.DB {
+	t.Helper()
+	db, err := connect(sqlite.Open(sqliteDSN(path)), logger.Warn)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if err := db.AutoMigrate(&baselineAccount{}, &baselineTransfer{}, &baselineTransaction{}); err != nil {
+		t.Fatalf("auto migrate: %v", err)
+	}
+	return db
+}
+
+func TestMigrateLegacyAmounts(t *testing.T) {
+	db := openBaselineDatabase(t, filepath.Join(t.TempDir(), "bank.db"))
+
+	// None of these is exact in binary floating point
+	balances := map[string]float64{"A": 0.29, "B": 1234567.89, "C": -0.07, "D": 10.1}
+	for number, balance := range balances {
+		if err := db.Create(&baselineAccount{AccountNumber: number, Balance: balance}).Error; err != nil {
+			t.Fatalf("create account: %v", err)
+		}
+	}
+	if err := db.Create(&baselineTransfer{FromAccountID: 1, ToAccountID: 2, Amount: 0.57}).Error; err != nil {
+		t.Fatalf("create transfer: %v", err)
+	}
+	if err := db.Create(&baselineTransaction{AccountID: 1, Type: "deposit", Amount: 19.99}).Error; err != nil {
+		t.Fatalf("create transaction: %v", err)
+	}
+
+	if err := migrateLegacyAmounts(db); err != nil {
+		t.Fatalf("migrate legacy amounts: %v", err)
+	}
+
+	want := map[string]int64{"A": 29, "B": 123456789, "C": -7, "D": 1010}
+	var rows []struct {
+		AccountNumber   string
+		BalanceMinor    int64
+		BalanceCurrency string
+	}
+	if err := db.Table("accounts").Find(&rows).Error; err != nil {
+		t.Fatalf("read accounts: %v", err)
+	}
+	for _, row := range rows {
+		if row.BalanceMinor != want[row.AccountNumber] || row.BalanceCurrency != string(money.DefaultCurrency) {
+			t.Errorf("account %s: got %d %s, want %d %s", row.AccountNumber, row.BalanceMinor, row.BalanceCurrency, want[row.AccountNumber], money.DefaultCurrency)
+		}
+	}
+	for table, want := range map[string]int64{"transfers": 57, "transactions": 1999} {
+		var minor int64
+		if err := db.Table(table).Select("amount_minor").Scan(&minor).Error; err != nil || minor != want {
+			t.Errorf("%s amount: got %d, %v, want %d", table, minor, err, want)
+		}
+	}
+	if db.Migrator().HasColumn("accounts", "balance") {
+		t.Error("accounts.balance was not dropped")
+	}
+}
+
+func TestMigrateLegacyAmountsRefusesToRound(t *testing.T) {
+	db := openBaselineDatabase(t, filepath.Join(t.TempDir(), "bank.db"))
+	if err := db.Create(&baselineAccount{AccountNumber: "A", Balance: 10.005}).Error; err != nil {
+		t.Fatalf("create account: %v", err)
+	}
+
+	if err := migrateLegacyAmounts(db); err == nil {
+		t.Fatal("an amount with three decimals was rounded")
+	}
+	if !db.Migrator().HasColumn("accounts", "balance") || db.Migrator().HasColumn("accounts", "balance_minor") {
+		t.Fatal("a failed migration left the schema changed")
+	}
+}
+
+// TestMigrateLegacyLargeAmounts converts balances around 1e12, where a float
+// scaled to cents can be off from a whole number by hundredths
+func TestMigrateLegacyLargeAmounts(t *testing.T) {
+	db := openBaselineDatabase(t, filepath.Join(t.TempDir(), "bank.db"))
+	balances := map[string]float64{"A": 999999999999.99, "B": 1234567890123.1, "C": -1234567890123.35}
+	for number, balance := range balances {
+		if err := db.Create(&baselineAccount{AccountNumber: number, Balance: balance}).Error; err != nil {
+			t.Fatalf("create account: %v", err)
+		}
+	}
+
+	if err := migrateLegacyAmounts(db); err != nil {
+		t.Fatalf("migrate legacy amounts: %v", err)
+	}
+
+	want := map[string]int64{"A": 99999999999999, "B": 123456789012310, "C": -123456789012335}
+	var rows []struct {
+		AccountNumber string
+		BalanceMinor  int64
+	}
+	if err := db.Table("accounts").Find(&rows).Error; err != nil {
+		t.Fatalf("read accounts: %v", err)
+	}
+	for _, row := range rows {
+		if row.BalanceMinor != want[row.AccountNumber] {
+			t.Errorf("account %s: got %d, want %d", row.AccountNumber, row.BalanceMinor, want[row.AccountNumber])
+		}
+	}
+
+	// A third decimal is still refused at that magnitude
+	db = openBaselineDatabase(t, filepath.Join(t.TempDir(), "bank.db"))
+	if err := db.Create(&baselineAccount{AccountNumber: "A", Balance: 1000000000000.005}).Error; err != nil {
+		t.Fatalf("create account: %v", err)
+	}
+	if err := migrateLegacyAmounts(db); err == nil {
+		t.Fatal("an amount with three decimals was rounded")
+	}
+}
+
+// TestMigrateAdoptsBaselineDatabase runs every migration on a database of
+// the first release, whose tables lack most of the baseline's columns
+func TestMigrateAdoptsBaselineDatabase(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "bank.db")
+
+	db := openBaselineDatabase(t, path)
+	accounts := []*baselineAccount{
+		{AccountNumber: "BASE-A", Balance: 90.25},
+		{AccountNumber: "BASE-B", Balance: 10.1},
+	}
+	for _, account := range accounts {
+		if err := db.Create(account).Error; err != nil {
+			t.Fatalf("create account: %v", err)
+		}
+	}
+	transfer := &baselineTransfer{FromAccountID: accounts[0].ID, ToAccountID: accounts[1].ID, Amount: 9.75, Description: "rent"}
+	if err := db.Create(transfer).Error; err != nil {
+		t.Fatalf("create transfer: %v", err)
+	}
+	if err := db.Create(&baselineTransaction{AccountID: accounts[0].ID, Type: "deposit", Amount: 100, Reference: "INIT"}).Error; err != nil {
+		t.Fatalf("create transaction: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.Close()
+
+	if _, err := openTestMigrator(t, path).Up(ctx); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+
+	repo, err := NewSQLite(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer repo.Close()
+
+	want := map[string]int64{"BASE-A": 9025, "BASE-B": 1010}
+	for number, minor := range want {
+		account, err := repo.GetAccountByNumber(ctx, number)
+		if err != nil {
+			t.Fatalf("get account %s: %v", number, err)
+		}
+		if account.Balance != usd(minor) {
+			t.Errorf("account %s: got balance %v, want %v", number, account.Balance, usd(minor))
+		}
+	}
+
+	got, err := repo.GetTransferByID(ctx, transfer.ID)
+	if err != nil {
+		t.Fatalf("get transfer: %v", err)
+	}
+	if got.Amount != usd(975) || got.CreditAmount != usd(975) || got.Status != models.TransferStatusCompleted {
+		t.Errorf("transfer: got %v, credit %v, status %q, want %v completed", got.Amount, got.CreditAmount, got.Status, usd(975))
+	}
+
+	// Every balance is backed by an opening journal entry
+	sums, err := repo.SumPostingsByAccount(ctx)
+	if err != nil {
+		t.Fatalf("sum postings: %v", err)
+	}
+	if len(sums) != len(accounts) {
+		t.Fatalf("got posting sums for %d accounts, want %d", len(sums), len(accounts))
+	}
+	for _, sum := range sums {
+		account, err := repo.GetAccountByID(ctx, sum.AccountID)
+		if err != nil {
+			t.Fatalf("get account %d: %v", sum.AccountID, err)
+		}
+		if sum.Money() != account.Balance {
+			t.Errorf("account %s: postings sum to %v, balance is %v", account.AccountNumber, sum.Money(), account.Balance)
+		}
+	}
+
+	// The adopted database takes new rows like a migrated one
+	account := createAccount(t, repo, usd(500))
+	createTransfer(t, repo, account, account, usd(100))
+}
+
+// TestStatementBalanceOfAdoptedAccount checks that the balance of an account
+// of the first release, which no transaction explains, counts towards the
+// sums that statements start and end with
+func TestStatementBalanceOfAdoptedAccount(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "bank.db")
+
+	opened := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	db := openBaselineDatabase(t, path)
+	account := &baselineAccount{AccountNumber: "BASE-A", Balance: 150, CreatedAt: opened}
+	if err := db.Create(account).Error; err != nil {
+		t.Fatalf("create account: %v", err)
+	}
+	deposit := &baselineTransaction{AccountID: account.ID, Type: "deposit", Amount: 100, CreatedAt: opened.AddDate(0, 0, 9)}
+	if err := db.Create(deposit).Error; err != nil {
+		t.Fatalf("create transaction: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.Close()
+
+	if _, err := openTestMigrator(t, path).Up(ctx); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	repo, err := NewSQLite(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer repo.Close()
+
+	withdrawal := &models.Transaction{AccountID: account.ID, Type: models.TransactionTypeWithdrawal, Amount: usd(-2500), CreatedAt: time.Now()}
+	if err := repo.CreateTransaction(ctx, withdrawal); err != nil {
+		t.Fatalf("create transaction: %v", err)
+	}
+
+	// 50.00 of the 150.00 adopted predates the only legacy transaction
+	for _, tt := range []struct {
+		before time.Time
+		want   int64
+	}{
+		{opened.AddDate(0, -1, 0), 0},
+		{opened.AddDate(0, 0, 5), 5000},
+		{opened.AddDate(0, 0, 10), 15000},
+		{time.Now().Add(time.Hour), 12500},
+	} {
+		got, err := repo.SumTransactionsByAccount(ctx, account.ID, tt.before)
+		if err != nil || got != tt.want {
+			t.Errorf("balance before %v: got %d, %v, want %d", tt.before, got, err, tt.want)
+		}
+	}
+}
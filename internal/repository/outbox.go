@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/tribal/bank-api/internal/models"
+	"gorm.io/gorm"
+)
+
+// Outbox operations
+func (r *gormRepository) CreateOutboxMessage(ctx context.Context, message *models.OutboxMessage) error {
+	return r.db.WithContext(ctx).Create(message).Error
+}
+
+func (r *gormRepository) ListPendingOutboxMessages(ctx context.Context, aggregateType string, aggregateID uint) ([]models.OutboxMessage, error) {
+	var messages []models.OutboxMessage
+	if err := r.db.WithContext(ctx).
+		Where("aggregate_type = ? AND aggregate_id = ? AND status = ?", aggregateType, aggregateID, models.OutboxStatusPending).
+		Order("id").Find(&messages).Error; err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+func (r *gormRepository) ListDueOutboxMessages(ctx context.Context, now time.Time, limit int) ([]models.OutboxMessage, error) {
+	var messages []models.OutboxMessage
+	if err := r.db.WithContext(ctx).
+		Where("status = ? AND next_attempt_at <= ?", models.OutboxStatusPending, now).
+		Where("locked_until IS NULL OR locked_until < ?", now).
+		Order("id").Limit(limit).Find(&messages).Error; err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+func (r *gormRepository) ClaimOutboxMessage(ctx context.Context, id uint, now time.Time, lease time.Duration) (bool, error) {
+	lockedUntil := now.Add(lease)
+	result := r.db.WithContext(ctx).Model(&models.OutboxMessage{}).
+		Where("id = ? AND status = ?", id, models.OutboxStatusPending).
+		Where("locked_until IS NULL OR locked_until < ?", now).
+		Update("locked_until", lockedUntil)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *gormRepository) RescheduleOutboxMessage(ctx context.Context, message *models.OutboxMessage) error {
+	return r.db.WithContext(ctx).Model(message).Updates(map[string]interface{}{
+		"status":          message.Status,
+		"attempts":        message.Attempts,
+		"next_attempt_at": message.NextAttemptAt,
+		"last_error":      message.LastError,
+		"locked_until":    gorm.Expr("NULL"),
+	}).Error
+}
+
+// MarkOutboxMessageProcessed is meant to run inside the transaction that
+// applies the message's outcome
+func (r *gormRepository) MarkOutboxMessageProcessed(ctx context.Context, message *models.OutboxMessage, now time.Time) error {
+	return r.db.WithContext(ctx).Model(message).Updates(map[string]interface{}{
+		"status":       models.OutboxStatusProcessed,
+		"processed_at": now,
+		"locked_until": gorm.Expr("NULL"),
+	}).Error
+}
+
+func (r *gormRepository) MarkOutboxMessageDead(ctx context.Context, message *models.OutboxMessage, lastError string) error {
+	return r.db.WithContext(ctx).Model(message).Updates(map[string]interface{}{
+		"status":     models.OutboxStatusDead,
+		"last_error": lastError,
+	}).Error
+}
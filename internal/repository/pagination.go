@@ -0,0 +1,213 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tribal/bank-api/internal/models"
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 200
+)
+
+// ListOptions selects a page of rows. Amounts are in minor units; nil and
+// empty fields do not filter.
+type ListOptions struct {
+	Limit         int
+	Cursor        string
+	Sort          string
+	From          *time.Time
+	To            *time.Time
+	Type          string
+	MinAmount     *int64
+	MaxAmount     *int64
+	Reference     string
+	Currency      string
+	AccountNumber string
+	Status        string
+	Action        string
+	EntityType    string
+	EntityID      uint
+	Actor         string
+}
+
+type sortKind int
+
+const (
+	sortInt sortKind = iota
+	sortString
+	sortTime
+)
+
+// sortField is a column a list can be ordered by. value extracts the column
+// from a row to build the cursor of the next page.
+type sortField[T any] struct {
+	column string
+	kind   sortKind
+	value  func(*T) interface{}
+}
+
+// listSpec describes how a model is paginated: the fields it can be sorted
+// by and how to read a row's id, which breaks ties between equal values
+type listSpec[T any] struct {
+	fields      map[string]sortField[T]
+	defaultSort string
+	id          func(*T) uint
+}
+
+// cursor marks the last row of a page. It is handed to clients as an opaque
+// base64 string and only valid for the sort it was issued for.
+type cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    uint   `json:"id"`
+}
+
+// fetchPage applies the sort and cursor of opts to query and returns one page
+// of rows with the cursor of the next one. Rows are ordered by the sort field
+// and then by id, so pages never overlap or skip rows that tie on the value.
+func fetchPage[T any](query *gorm.DB, spec listSpec[T], opts ListOptions) ([]T, string, error) {
+	sort := opts.Sort
+	if sort == "" {
+		sort = spec.defaultSort
+	}
+	name := strings.TrimPrefix(sort, "-")
+	desc := name != sort
+	field, ok := spec.fields[name]
+	if !ok {
+		return nil, "", fmt.Errorf("%w: cannot sort by %q", models.ErrInvalidListQuery, name)
+	}
+
+	limit := opts.Limit
+	switch {
+	case limit < 0:
+		return nil, "", fmt.Errorf("%w: limit cannot be negative", models.ErrInvalidListQuery)
+	case limit == 0:
+		limit = DefaultPageLimit
+	case limit > MaxPageLimit:
+		limit = MaxPageLimit
+	}
+
+	op, direction := ">", "ASC"
+	if desc {
+		op, direction = "<", "DESC"
+	}
+
+	if opts.Cursor != "" {
+		after, err := decodeCursor(opts.Cursor, sort)
+		if err != nil {
+			return nil, "", err
+		}
+		value, err := parseCursorValue(field.kind, after.Value)
+		if err != nil {
+			return nil, "", err
+		}
+		query = query.Where(
+			fmt.Sprintf("(%s %s ? OR (%s = ? AND id %s ?))", field.column, op, field.column, op),
+			value, value, after.ID,
+		)
+	}
+
+	var rows []T
+	err := query.
+		Order(fmt.Sprintf("%s %s, id %s", field.column, direction, direction)).
+		Limit(limit + 1).
+		Find(&rows).Error
+	if err != nil {
+		return nil, "", err
+	}
+	if len(rows) <= limit {
+		return rows, "", nil
+	}
+
+	rows = rows[:limit]
+	last := &rows[limit-1]
+	next, err := encodeCursor(cursor{
+		Sort:  sort,
+		Value: formatCursorValue(field.value(last)),
+		ID:    spec.id(last),
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return rows, next, nil
+}
+
+func encodeCursor(c cursor) (string, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeCursor(s, sort string) (cursor, error) {
+	var c cursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || json.Unmarshal(data, &c) != nil {
+		return cursor{}, fmt.Errorf("%w: malformed cursor", models.ErrInvalidListQuery)
+	}
+	if c.Sort != sort {
+		return cursor{}, fmt.Errorf("%w: cursor was issued for sort %q", models.ErrInvalidListQuery, c.Sort)
+	}
+	return c, nil
+}
+
+func formatCursorValue(v interface{}) string {
+	switch v := v.(type) {
+	case time.Time:
+		// Keep the offset so the value compares like the stored one
+		return v.Format(time.RFC3339Nano)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func parseCursorValue(kind sortKind, s string) (interface{}, error) {
+	var v interface{}
+	var err error
+	switch kind {
+	case sortTime:
+		v, err = time.Parse(time.RFC3339Nano, s)
+	case sortInt:
+		v, err = strconv.ParseInt(s, 10, 64)
+	default:
+		v = s
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", models.ErrInvalidListQuery)
+	}
+	return v, nil
+}
+
+// filterCreatedAt restricts query to rows created in [from, to)
+func filterCreatedAt(query *gorm.DB, opts ListOptions) *gorm.DB {
+	if opts.From != nil {
+		query = query.Where("created_at >= ?", *opts.From)
+	}
+	if opts.To != nil {
+		query = query.Where("created_at < ?", *opts.To)
+	}
+	return query
+}
+
+// filterAmount restricts query to rows whose amount expression lies within
+// the bounds of opts
+func filterAmount(query *gorm.DB, expr string, opts ListOptions) *gorm.DB {
+	if opts.MinAmount != nil {
+		query = query.Where(expr+" >= ?", *opts.MinAmount)
+	}
+	if opts.MaxAmount != nil {
+		query = query.Where(expr+" <= ?", *opts.MaxAmount)
+	}
+	return query
+}
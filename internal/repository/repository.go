@@ -0,0 +1,270 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/pkg/money"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Errors returned by every backend
+var (
+	ErrNotFound     = gorm.ErrRecordNotFound
+	ErrDuplicateKey = gorm.ErrDuplicatedKey
+)
+
+// Dialect names a database backend
+type Dialect string
+
+const (
+	DialectSQLite   Dialect = "sqlite"
+	DialectPostgres Dialect = "postgres"
+)
+
+// Repository is the persistence layer of both services. Operations called on
+// the Store passed to WithTransaction run inside that transaction.
+type Repository interface {
+	Store
+
+	// WithTransaction runs fn in a database transaction, committing it when
+	// fn returns nil and rolling it back otherwise
+	WithTransaction(ctx context.Context, fn func(tx Store) error) error
+	// WithSnapshot runs fn in a read-only transaction in which every read
+	// sees the database as of the first one, without blocking writers. fn
+	// must not write.
+	WithSnapshot(ctx context.Context, fn func(tx Store) error) error
+	Dialect() Dialect
+	Close() error
+}
+
+// Store holds every repository operation
+type Store interface {
+	AccountStore
+	HoldStore
+	CustomerStore
+	TransactionStore
+	LedgerStore
+	TransferStore
+	OutboxStore
+	ScheduleStore
+	BatchStore
+	IdempotencyStore
+	AuditStore
+	APIKeyStore
+}
+
+type AccountStore interface {
+	CreateAccount(ctx context.Context, account *models.Account) error
+	GetAccountByID(ctx context.Context, id uint) (*models.Account, error)
+	GetAccountByNumber(ctx context.Context, accountNumber string) (*models.Account, error)
+	ListAccounts(ctx context.Context, opts ListOptions) ([]models.Account, string, error)
+
+	// LockAccount reads an account for update. Inside a transaction no other
+	// transaction can modify it until this one ends.
+	LockAccount(ctx context.Context, id uint) (*models.Account, error)
+	// ApplyBalanceDelta adds delta to the balance of account if the row still
+	// has the version that was read and, for debits, if the stored balance
+	// and overdraft limit cover the amount and the holds; otherwise it
+	// returns models.ErrConcurrentUpdate
+	ApplyBalanceDelta(ctx context.Context, account *models.Account, delta money.Money) error
+	// UpdateAccountStatus stores the status and status reason of account if
+	// the row still has the version that was read; otherwise it returns
+	// models.ErrConcurrentUpdate
+	UpdateAccountStatus(ctx context.Context, account *models.Account) error
+	// UpdateAccountOverdraft stores the overdraft limit of account like
+	// UpdateAccountStatus
+	UpdateAccountOverdraft(ctx context.Context, account *models.Account) error
+}
+
+// HoldStore persists the holds placed on accounts. Holds of an account are
+// read and changed with the account locked.
+type HoldStore interface {
+	CreateHold(ctx context.Context, hold *models.AccountHold) error
+	GetHoldByKey(ctx context.Context, key string) (*models.AccountHold, error)
+	UpdateHoldStatus(ctx context.Context, hold *models.AccountHold) error
+	// ApplyHeldDelta adds delta to the held amount of account like
+	// ApplyBalanceDelta: placing a hold requires the available balance to
+	// cover it
+	ApplyHeldDelta(ctx context.Context, account *models.Account, delta money.Money) error
+}
+
+// CustomerStore persists customers and the accounts they own. Accounts read
+// through AccountStore come with their owners.
+type CustomerStore interface {
+	CreateCustomer(ctx context.Context, customer *models.Customer) error
+	GetCustomerByID(ctx context.Context, id uint) (*models.Customer, error)
+	// UpdateCustomer replaces the name, email and external ID of a customer
+	UpdateCustomer(ctx context.Context, customer *models.Customer) error
+	DeleteCustomer(ctx context.Context, id uint) error
+	ListCustomers(ctx context.Context, opts ListOptions) ([]models.Customer, string, error)
+
+	ListAccountsByCustomer(ctx context.Context, customerID uint, opts ListOptions) ([]models.Account, string, error)
+	CountOpenAccountsByCustomer(ctx context.Context, customerID uint) (int64, error)
+	AddAccountOwner(ctx context.Context, accountID, customerID uint) error
+	// RemoveAccountOwner returns ErrNotFound if the customer does not own the
+	// account
+	RemoveAccountOwner(ctx context.Context, accountID, customerID uint) error
+	ListAccountOwners(ctx context.Context, accountID uint) ([]models.Customer, error)
+}
+
+type TransactionStore interface {
+	CreateTransaction(ctx context.Context, transaction *models.Transaction) error
+	ListTransactionsByAccount(ctx context.Context, accountID uint, opts ListOptions) ([]models.Transaction, string, error)
+	// SumTransactionsByAccount returns, in minor units, the sum of the
+	// transactions of an account created before a time: its balance then.
+	// It leaves out historical transactions, which the balance does not
+	// include, and adds the part of the opening balance of an account
+	// adopted from before the ledger that no transaction accounts for.
+	SumTransactionsByAccount(ctx context.Context, accountID uint, before time.Time) (int64, error)
+	// EachTransactionByAccount calls fn with the transactions of an account
+	// dated in [from, to), historical ones included, by date and then in the
+	// order they were recorded. Rows are read in batches, so ranges of any
+	// size use bounded memory; an error from fn stops the iteration and is
+	// returned.
+	EachTransactionByAccount(ctx context.Context, accountID uint, from, to time.Time, fn func(*models.Transaction) error) error
+	// EntryApplied reports whether a transaction with the entry key exists
+	EntryApplied(ctx context.Context, key string) (bool, error)
+}
+
+type LedgerStore interface {
+	// CreateJournalEntry stores a journal entry with its postings. Entries
+	// must have at least two postings and sum to zero in every currency.
+	CreateJournalEntry(ctx context.Context, entry *models.JournalEntry) error
+	CountJournalEntries(ctx context.Context) (int64, error)
+	ListUnbalancedJournalEntries(ctx context.Context) ([]LedgerSum, error)
+	SumPostingsByAccount(ctx context.Context) ([]LedgerSum, error)
+	SumPostingsBySystemAccount(ctx context.Context) ([]LedgerSum, error)
+	SumPostingsByCurrency(ctx context.Context) ([]LedgerSum, error)
+}
+
+type TransferStore interface {
+	CreateTransfer(ctx context.Context, transfer *models.Transfer) error
+	GetTransferByID(ctx context.Context, id uint) (*models.Transfer, error)
+	ListTransfers(ctx context.Context, opts ListOptions) ([]models.Transfer, string, error)
+	// LockTransfer reads a transfer for update, like LockAccount
+	LockTransfer(ctx context.Context, id uint) (*models.Transfer, error)
+	UpdateTransferStatus(ctx context.Context, transfer *models.Transfer) error
+	// GetTransferVelocity counts and sums the transfers an account sent since
+	// a time, leaving out those that failed or never moved money and
+	// historical ones
+	GetTransferVelocity(ctx context.Context, fromAccountID uint, since time.Time) (*models.TransferVelocity, error)
+	// LockTransferVelocity serializes velocity checks of an account until the
+	// transaction ends, so concurrent transfers cannot both pass a limit
+	LockTransferVelocity(ctx context.Context, fromAccountID uint) error
+	// ListExpiredAuthorizations returns authorized transfers whose hold
+	// expired before now
+	ListExpiredAuthorizations(ctx context.Context, now time.Time, limit int) ([]models.Transfer, error)
+
+	CreateReversal(ctx context.Context, reversal *models.TransferReversal) error
+	GetReversalByID(ctx context.Context, id uint) (*models.TransferReversal, error)
+	UpdateReversalStatus(ctx context.Context, reversal *models.TransferReversal) error
+	// ReserveTransferReversal adds a reversal to the reversed amounts of a
+	// completed transfer, or returns models.ErrReversalExceedsAmount when the
+	// total would exceed the original amounts
+	ReserveTransferReversal(ctx context.Context, transfer *models.Transfer, amount, credit money.Money) error
+	// ReleaseTransferReversal gives back the amounts of a failed reversal
+	ReleaseTransferReversal(ctx context.Context, reversal *models.TransferReversal) error
+	// UpdateTransferReversalStatus derives the reversal status of a transfer
+	// from its completed reversals
+	UpdateTransferReversalStatus(ctx context.Context, transferID uint) error
+}
+
+type OutboxStore interface {
+	CreateOutboxMessage(ctx context.Context, message *models.OutboxMessage) error
+	ListPendingOutboxMessages(ctx context.Context, aggregateType string, aggregateID uint) ([]models.OutboxMessage, error)
+	ListDueOutboxMessages(ctx context.Context, now time.Time, limit int) ([]models.OutboxMessage, error)
+	// ClaimOutboxMessage leases a pending message until now+lease. It reports
+	// false when another worker or replica holds the message or it was
+	// already processed.
+	ClaimOutboxMessage(ctx context.Context, id uint, now time.Time, lease time.Duration) (bool, error)
+	// RescheduleOutboxMessage records a failed delivery attempt and releases
+	// the lease
+	RescheduleOutboxMessage(ctx context.Context, message *models.OutboxMessage) error
+	MarkOutboxMessageProcessed(ctx context.Context, message *models.OutboxMessage, now time.Time) error
+	MarkOutboxMessageDead(ctx context.Context, message *models.OutboxMessage, lastError string) error
+}
+
+// ScheduleStore persists scheduled and recurring transfers. Replicas claim
+// due schedules with a lease like outbox messages, so each run is executed by
+// one of them.
+type ScheduleStore interface {
+	CreateSchedule(ctx context.Context, schedule *models.TransferSchedule) error
+	GetScheduleByID(ctx context.Context, id uint) (*models.TransferSchedule, error)
+	ListSchedules(ctx context.Context, opts ListOptions) ([]models.TransferSchedule, string, error)
+	// LockSchedule reads a schedule for update, like LockAccount
+	LockSchedule(ctx context.Context, id uint) (*models.TransferSchedule, error)
+	UpdateScheduleStatus(ctx context.Context, schedule *models.TransferSchedule) error
+
+	ListDueSchedules(ctx context.Context, now time.Time, limit int) ([]models.TransferSchedule, error)
+	// ClaimSchedule leases an active schedule that is due until now+lease. It
+	// reports false when another replica holds it or it is no longer due.
+	ClaimSchedule(ctx context.Context, id uint, now time.Time, lease time.Duration) (bool, error)
+	// RecordScheduleRun stores the outcome of a run and releases the lease
+	RecordScheduleRun(ctx context.Context, schedule *models.TransferSchedule) error
+	// GetTransferByScheduleKey returns the transfer a schedule run created
+	GetTransferByScheduleKey(ctx context.Context, key string) (*models.Transfer, error)
+}
+
+// BatchStore persists transfer batches together with their items
+type BatchStore interface {
+	// CreateBatch stores a batch and its items
+	CreateBatch(ctx context.Context, batch *models.TransferBatch) error
+	// GetBatchByID returns a batch with its items in submission order
+	GetBatchByID(ctx context.Context, id uint) (*models.TransferBatch, error)
+	UpdateBatch(ctx context.Context, batch *models.TransferBatch) error
+}
+
+// AuditStore is append-only: entries can be added and read but never changed
+type AuditStore interface {
+	// AppendAuditEntry assigns the entry its sequence, creation time and
+	// chain hashes and stores it
+	AppendAuditEntry(ctx context.Context, entry *models.AuditEntry) error
+	ListAuditEntries(ctx context.Context, opts ListOptions) ([]models.AuditEntry, string, error)
+}
+
+type IdempotencyStore interface {
+	CreateIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) error
+	GetIdempotencyKey(ctx context.Context, scope, key string) (*models.IdempotencyKey, error)
+	CompleteIdempotencyKey(ctx context.Context, key *models.IdempotencyKey) error
+	// ExtendIdempotencyLease moves the lease of a key still in progress to
+	// until. It returns ErrNotFound once the key is completed or removed.
+	ExtendIdempotencyLease(ctx context.Context, id uint, until time.Time) error
+	DeleteIdempotencyKey(ctx context.Context, id uint) error
+	PurgeExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error)
+}
+
+// Open connects to PostgreSQL when databaseURL is set and to the SQLite
+// file at sqlitePath otherwise. It fails with ErrSchemaBehind until pending
+// migrations are applied with OpenMigrator.
+func Open(databaseURL, sqlitePath string) (Repository, error) {
+	dialector, dialect := dialectorFor(databaseURL, sqlitePath)
+	return openGorm(dialector, dialect, logger.Info)
+}
+
+// OpenQuiet is Open for commands whose output is a report: it only logs
+// failed or slow queries
+func OpenQuiet(databaseURL, sqlitePath string) (Repository, error) {
+	dialector, dialect := dialectorFor(databaseURL, sqlitePath)
+	return openGorm(dialector, dialect, logger.Warn)
+}
+
+func dialectorFor(databaseURL, sqlitePath string) (gorm.Dialector, Dialect) {
+	if databaseURL != "" {
+		return postgres.Open(databaseURL), DialectPostgres
+	}
+	return sqlite.Open(sqliteDSN(sqlitePath)), DialectSQLite
+}
+
+// APIKeyStore persists the hashed API keys of machine clients
+type APIKeyStore interface {
+	CreateAPIKey(ctx context.Context, key *models.APIKey) error
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error)
+	ListAPIKeys(ctx context.Context) ([]models.APIKey, error)
+	// RevokeAPIKey returns ErrNotFound if no active key has the prefix
+	RevokeAPIKey(ctx context.Context, prefix string, at time.Time) error
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/pkg/money"
+	"gorm.io/gorm"
+)
+
+// Reversal operations
+func (r *gormRepository) CreateReversal(ctx context.Context, reversal *models.TransferReversal) error {
+	return r.db.WithContext(ctx).Create(reversal).Error
+}
+
+func (r *gormRepository) GetReversalByID(ctx context.Context, id uint) (*models.TransferReversal, error) {
+	var reversal models.TransferReversal
+	if err := r.db.WithContext(ctx).First(&reversal, id).Error; err != nil {
+		return nil, err
+	}
+	return &reversal, nil
+}
+
+func (r *gormRepository) UpdateReversalStatus(ctx context.Context, reversal *models.TransferReversal) error {
+	return r.db.WithContext(ctx).Model(reversal).Select("status", "failure_reason").Updates(reversal).Error
+}
+
+// ReserveTransferReversal is a conditional update, so concurrent reversals
+// can never exceed the original amounts together
+func (r *gormRepository) ReserveTransferReversal(ctx context.Context, transfer *models.Transfer, amount, credit money.Money) error {
+	result := r.db.WithContext(ctx).Model(&models.Transfer{}).
+		Where("id = ? AND status = ?", transfer.ID, models.TransferStatusCompleted).
+		Where("reversed_amount_minor + ? <= amount_minor", amount.Minor).
+		Where("reversed_credit_amount_minor + ? <= credit_amount_minor", credit.Minor).
+		Updates(map[string]interface{}{
+			"reversed_amount_minor":        gorm.Expr("reversed_amount_minor + ?", amount.Minor),
+			"reversed_credit_amount_minor": gorm.Expr("reversed_credit_amount_minor + ?", credit.Minor),
+			"updated_at":                   time.Now(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.ErrReversalExceedsAmount
+	}
+	return nil
+}
+
+func (r *gormRepository) ReleaseTransferReversal(ctx context.Context, reversal *models.TransferReversal) error {
+	return r.db.WithContext(ctx).Model(&models.Transfer{}).Where("id = ?", reversal.TransferID).Updates(map[string]interface{}{
+		"reversed_amount_minor":        gorm.Expr("reversed_amount_minor - ?", reversal.Amount.Minor),
+		"reversed_credit_amount_minor": gorm.Expr("reversed_credit_amount_minor - ?", reversal.CreditAmount.Minor),
+		"updated_at":                   time.Now(),
+	}).Error
+}
+
+func (r *gormRepository) UpdateTransferReversalStatus(ctx context.Context, transferID uint) error {
+	tx := r.db.WithContext(ctx)
+	completed := tx.Model(&models.TransferReversal{}).
+		Select("COALESCE(SUM(amount_minor), 0)").
+		Where("transfer_id = ? AND status = ?", transferID, models.ReversalStatusCompleted)
+
+	return tx.Model(&models.Transfer{}).Where("id = ?", transferID).
+		Update("reversal_status", gorm.Expr("CASE WHEN (?) = 0 THEN '' WHEN (?) >= amount_minor THEN ? ELSE ? END",
+			completed, completed, models.TransferReversed, models.TransferPartiallyReversed)).Error
+}
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/tribal/bank-api/internal/models"
+	"gorm.io/gorm"
+)
+
+// Schedule operations
+func (r *gormRepository) CreateSchedule(ctx context.Context, schedule *models.TransferSchedule) error {
+	return r.db.WithContext(ctx).Create(schedule).Error
+}
+
+func (r *gormRepository) GetScheduleByID(ctx context.Context, id uint) (*models.TransferSchedule, error) {
+	var schedule models.TransferSchedule
+	if err := r.db.WithContext(ctx).First(&schedule, id).Error; err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+func (r *gormRepository) LockSchedule(ctx context.Context, id uint) (*models.TransferSchedule, error) {
+	var schedule models.TransferSchedule
+	if err := r.forUpdate(r.db.WithContext(ctx)).First(&schedule, id).Error; err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+var scheduleList = listSpec[models.TransferSchedule]{
+	fields: map[string]sortField[models.TransferSchedule]{
+		"id":          {column: "id", kind: sortInt, value: func(s *models.TransferSchedule) interface{} { return int64(s.ID) }},
+		"created_at":  {column: "created_at", kind: sortTime, value: func(s *models.TransferSchedule) interface{} { return s.CreatedAt }},
+		"next_run_at": {column: "next_run_at", kind: sortTime, value: func(s *models.TransferSchedule) interface{} { return s.NextRunAt }},
+	},
+	defaultSort: "-created_at",
+	id:          func(s *models.TransferSchedule) uint { return s.ID },
+}
+
+// ListSchedules returns a page of schedules filtered by creation date,
+// status and source account
+func (r *gormRepository) ListSchedules(ctx context.Context, opts ListOptions) ([]models.TransferSchedule, string, error) {
+	query := filterCreatedAt(r.db.WithContext(ctx).Model(&models.TransferSchedule{}), opts)
+	if opts.Status != "" {
+		query = query.Where("status = ?", opts.Status)
+	}
+	if opts.AccountNumber != "" {
+		query = query.Where("from_account_number = ?", opts.AccountNumber)
+	}
+	return fetchPage(query, scheduleList, opts)
+}
+
+func (r *gormRepository) UpdateScheduleStatus(ctx context.Context, schedule *models.TransferSchedule) error {
+	return r.db.WithContext(ctx).Model(schedule).Select("status").Updates(schedule).Error
+}
+
+func (r *gormRepository) ListDueSchedules(ctx context.Context, now time.Time, limit int) ([]models.TransferSchedule, error) {
+	var schedules []models.TransferSchedule
+	if err := r.db.WithContext(ctx).
+		Where("status = ? AND next_run_at <= ?", models.ScheduleStatusActive, now).
+		Where("locked_until IS NULL OR locked_until < ?", now).
+		Order("next_run_at, id").Limit(limit).Find(&schedules).Error; err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
+
+func (r *gormRepository) ClaimSchedule(ctx context.Context, id uint, now time.Time, lease time.Duration) (bool, error) {
+	lockedUntil := now.Add(lease)
+	result := r.db.WithContext(ctx).Model(&models.TransferSchedule{}).
+		Where("id = ? AND status = ? AND next_run_at <= ?", id, models.ScheduleStatusActive, now).
+		Where("locked_until IS NULL OR locked_until < ?", now).
+		Update("locked_until", lockedUntil)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// RecordScheduleRun stores the progress of a schedule after a run. It leaves
+// the status alone unless the run completed or cancelled the schedule while
+// still active, so a pause or cancellation made during the run is kept.
+func (r *gormRepository) RecordScheduleRun(ctx context.Context, schedule *models.TransferSchedule) error {
+	status := gorm.Expr("status")
+	if schedule.Status != models.ScheduleStatusActive {
+		status = gorm.Expr("CASE WHEN status = ? THEN ? ELSE status END", models.ScheduleStatusActive, schedule.Status)
+	}
+	return r.db.WithContext(ctx).Model(schedule).Updates(map[string]interface{}{
+		"status":           status,
+		"occurrence":       schedule.Occurrence,
+		"next_run_at":      schedule.NextRunAt,
+		"attempts":         schedule.Attempts,
+		"last_run_at":      schedule.LastRunAt,
+		"last_transfer_id": schedule.LastTransferID,
+		"last_error":       schedule.LastError,
+		"locked_until":     gorm.Expr("NULL"),
+	}).Error
+}
+
+func (r *gormRepository) GetTransferByScheduleKey(ctx context.Context, key string) (*models.Transfer, error) {
+	var transfer models.Transfer
+	if err := r.db.WithContext(ctx).Where("schedule_key = ?", key).First(&transfer).Error; err != nil {
+		return nil, err
+	}
+	return &transfer, nil
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/internal/repository"
+	"github.com/tribal/bank-api/pkg/money"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// PlaceHold reserves an amount of an account's available balance without
+// moving money, e.g. for a transfer that is authorized now and captured
+// later. Holds beyond the available balance are rejected with
+// models.ErrInsufficientBalance. Placing a hold whose key already exists
+// returns the account unchanged.
+func (s *AccountService) PlaceHold(ctx context.Context, accountID uint, req models.AccountHoldRequest) (*models.Account, error) {
+	ctx, span := accountTracer.Start(ctx, "AccountService.PlaceHold")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("account.id", int(accountID)),
+		attribute.String("hold.key", req.Key),
+		attribute.String("hold.amount", req.Amount.String()),
+		attribute.String("hold.currency", string(req.Amount.Currency)),
+	)
+
+	if !req.Amount.IsPositive() {
+		err := fmt.Errorf("%w: hold amount must be greater than zero", money.ErrInvalidAmount)
+		span.RecordError(err)
+		return nil, err
+	}
+
+	var account *models.Account
+	err := retryOnConcurrentUpdate(ctx, func() error {
+		return s.repo.WithTransaction(ctx, func(tx repository.Store) error {
+			var err error
+			account, err = tx.LockAccount(ctx, accountID)
+			if err != nil {
+				return notFound(err)
+			}
+
+			// A hold whose key was already placed is acknowledged, not repeated
+			if _, err := tx.GetHoldByKey(ctx, req.Key); err == nil {
+				span.SetAttributes(attribute.Bool("hold.duplicate", true))
+				return nil
+			} else if !errors.Is(err, repository.ErrNotFound) {
+				return err
+			}
+
+			if err := account.CheckActive(); err != nil {
+				return err
+			}
+			if req.Amount.Currency != account.Currency() {
+				return fmt.Errorf("%w: hold in %s, account in %s", models.ErrCurrencyMismatch, req.Amount.Currency, account.Currency())
+			}
+			if cmp, _ := req.Amount.Cmp(account.AvailableBalance()); cmp > 0 {
+				return fmt.Errorf("%w: %s %s available", models.ErrInsufficientBalance, account.AvailableBalance(), account.Currency())
+			}
+
+			hold := &models.AccountHold{
+				AccountID:   account.ID,
+				Key:         req.Key,
+				Amount:      req.Amount,
+				Reference:   req.Reference,
+				Description: req.Description,
+				Status:      models.HoldStatusActive,
+			}
+			if err := tx.CreateHold(ctx, hold); err != nil {
+				return fmt.Errorf("failed to create hold: %w", err)
+			}
+			before := *account
+			if err := tx.ApplyHeldDelta(ctx, account, req.Amount); err != nil {
+				return err
+			}
+			return recordAudit(ctx, tx, models.AuditAccountHoldPlaced, models.AuditEntityAccount, account.ID, before, account)
+		})
+	})
+
+	// A concurrent request with the same key won the race: acknowledge it
+	if errors.Is(err, repository.ErrDuplicateKey) {
+		span.SetAttributes(attribute.Bool("hold.duplicate", true))
+		account, err = s.repo.GetAccountByID(ctx, accountID)
+	}
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.String("account.held_amount", account.HeldAmount.String()))
+
+	return account, nil
+}
+
+// ReleaseHold gives the amount of an active hold back to the account's
+// available balance. Releasing a hold twice returns the account unchanged;
+// captured holds cannot be released.
+func (s *AccountService) ReleaseHold(ctx context.Context, accountID uint, key string) (*models.Account, error) {
+	ctx, span := accountTracer.Start(ctx, "AccountService.ReleaseHold")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("account.id", int(accountID)),
+		attribute.String("hold.key", key),
+	)
+
+	var account *models.Account
+	err := retryOnConcurrentUpdate(ctx, func() error {
+		return s.repo.WithTransaction(ctx, func(tx repository.Store) error {
+			var err error
+			account, err = tx.LockAccount(ctx, accountID)
+			if err != nil {
+				return notFound(err)
+			}
+
+			hold, err := accountHold(ctx, tx, account, key)
+			if err != nil {
+				return err
+			}
+			switch hold.Status {
+			case models.HoldStatusReleased:
+				span.SetAttributes(attribute.Bool("hold.duplicate", true))
+				return nil
+			case models.HoldStatusCaptured:
+				return fmt.Errorf("%w: %s was captured", models.ErrHoldNotActive, key)
+			}
+
+			before := *account
+			if err := tx.ApplyHeldDelta(ctx, account, hold.Amount.Neg()); err != nil {
+				return err
+			}
+			hold.Status = models.HoldStatusReleased
+			if err := tx.UpdateHoldStatus(ctx, hold); err != nil {
+				return err
+			}
+			return recordAudit(ctx, tx, models.AuditAccountHoldReleased, models.AuditEntityAccount, account.ID, before, account)
+		})
+	})
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.String("account.held_amount", account.HeldAmount.String()))
+
+	return account, nil
+}
+
+// captureHold releases the hold an entry captures so the money it reserved
+// can be debited. The entry must be a debit no larger than the hold; the
+// whole hold is released either way.
+func captureHold(ctx context.Context, tx repository.Store, account *models.Account, entry models.AccountEntry) error {
+	hold, err := accountHold(ctx, tx, account, entry.HoldKey)
+	if err != nil {
+		return err
+	}
+	if hold.Status != models.HoldStatusActive {
+		return fmt.Errorf("%w: %s was %s", models.ErrHoldNotActive, hold.Key, hold.Status)
+	}
+	if cmp, _ := entry.Amount.Neg().Cmp(hold.Amount); !entry.Amount.IsNegative() || cmp > 0 {
+		return fmt.Errorf("%w: a capture must debit at most the %s %s held", money.ErrInvalidAmount, hold.Amount, hold.Amount.Currency)
+	}
+
+	before := *account
+	if err := tx.ApplyHeldDelta(ctx, account, hold.Amount.Neg()); err != nil {
+		return err
+	}
+	hold.Status = models.HoldStatusCaptured
+	if err := tx.UpdateHoldStatus(ctx, hold); err != nil {
+		return err
+	}
+	return recordAudit(ctx, tx, models.AuditAccountHoldCaptured, models.AuditEntityAccount, account.ID, before, account)
+}
+
+// accountHold returns the hold of the account with the key, or
+// models.ErrHoldNotFound
+func accountHold(ctx context.Context, tx repository.Store, account *models.Account, key string) (*models.AccountHold, error) {
+	hold, err := tx.GetHoldByKey(ctx, key)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && hold.AccountID != account.ID) {
+		return nil, fmt.Errorf("%w: %s", models.ErrHoldNotFound, key)
+	}
+	return hold, err
+}
+
+// retryOnConcurrentUpdate runs fn again, a few times, while the account it
+// changes keeps changing underneath it
+func retryOnConcurrentUpdate(ctx context.Context, fn func() error) error {
+	span := trace.SpanFromContext(ctx)
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if !errors.Is(err, models.ErrConcurrentUpdate) || attempt == maxEntryAttempts {
+			return err
+		}
+		span.AddEvent("retry on concurrent update", trace.WithAttributes(attribute.Int("attempt", attempt)))
+		if err := sleepContext(ctx, time.Duration(attempt)*entryRetryBackoff); err != nil {
+			return err
+		}
+	}
+}
@@ -2,23 +2,38 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/tribal/bank-api/internal/auth"
 	"github.com/tribal/bank-api/internal/models"
 	"github.com/tribal/bank-api/internal/repository"
+	"github.com/tribal/bank-api/internal/tier"
+	"github.com/tribal/bank-api/pkg/money"
 	"github.com/tribal/bank-api/pkg/telemetry"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var accountTracer = otel.Tracer("accounts-api")
 
+const (
+	// Attempts to apply an entry when the account keeps changing underneath
+	maxEntryAttempts  = 5
+	entryRetryBackoff = 10 * time.Millisecond
+)
+
 type AccountService struct {
-	repo *repository.Repository
+	repo  repository.Repository
+	tiers *tier.Catalog
 }
 
-func NewAccountService(repo *repository.Repository) *AccountService {
-	return &AccountService{repo: repo}
+// NewAccountService creates the service. Accounts are opened in one of the
+// tiers of the catalog.
+func NewAccountService(repo repository.Repository, tiers *tier.Catalog) *AccountService {
+	return &AccountService{repo: repo, tiers: tiers}
 }
 
 func (s *AccountService) CreateAccount(ctx context.Context, req models.CreateAccountRequest) (*models.Account, error) {
@@ -27,35 +42,251 @@ func (s *AccountService) CreateAccount(ctx context.Context, req models.CreateAcc
 
 	span.SetAttributes(attribute.String("account.number", req.AccountNumber))
 
-	account := &models.Account{
-		AccountNumber: req.AccountNumber,
-		Balance:       req.InitialBalance,
+	if err := auth.Authorize(ctx, auth.PermAccountsCreate); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	account, initialBalance, err := s.prepareAccount(req)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
 	}
+	span.SetAttributes(
+		attribute.String("account.currency", string(account.Currency())),
+		attribute.String("account.tier", account.Tier),
+	)
 
-	if err := s.repo.CreateAccount(ctx, account); err != nil {
+	// The account and its initial deposit are created together so the opening
+	// balance is backed by a journal entry
+	err = s.repo.WithTransaction(ctx, func(tx repository.Store) error {
+		if err := tx.CreateAccount(ctx, account); err != nil {
+			if errors.Is(err, repository.ErrDuplicateKey) {
+				return fmt.Errorf("%w: %s", models.ErrAccountExists, account.AccountNumber)
+			}
+			return fmt.Errorf("failed to create account: %w", err)
+		}
+		if err := addOwners(ctx, tx, account, req.OwnerIDs); err != nil {
+			return err
+		}
+		if err := recordAudit(ctx, tx, models.AuditAccountCreated, models.AuditEntityAccount, account.ID, nil, account); err != nil {
+			return err
+		}
+		if initialBalance.IsZero() {
+			return nil
+		}
+		_, err := applyEntry(ctx, tx, account, models.AccountEntry{
+			Type:        models.TransactionTypeDeposit,
+			Amount:      initialBalance,
+			Description: "Initial deposit",
+			Reference:   fmt.Sprintf("INIT-%d", account.ID),
+		})
+		return err
+	})
+	if err != nil {
 		span.RecordError(err)
-		return nil, fmt.Errorf("failed to create account: %w", err)
+		return nil, err
 	}
 
 	// Record Prometheus metric
 	telemetry.RecordAccountCreation()
+	updateBalanceGauges(account)
+
+	return account, nil
+}
+
+// ValidateAccount runs the checks of CreateAccount without creating the
+// account: the request must be valid, the account number free and the
+// owners must exist
+func (s *AccountService) ValidateAccount(ctx context.Context, req models.CreateAccountRequest) error {
+	ctx, span := accountTracer.Start(ctx, "AccountService.ValidateAccount")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("account.number", req.AccountNumber))
+
+	err := s.validateAccount(ctx, req)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+func (s *AccountService) validateAccount(ctx context.Context, req models.CreateAccountRequest) error {
+	if err := auth.Authorize(ctx, auth.PermAccountsCreate); err != nil {
+		return err
+	}
+	if _, _, err := s.prepareAccount(req); err != nil {
+		return err
+	}
+
+	_, err := s.repo.GetAccountByNumber(ctx, req.AccountNumber)
+	if err == nil {
+		return fmt.Errorf("%w: %s", models.ErrAccountExists, req.AccountNumber)
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("failed to get account: %w", err)
+	}
+	for _, id := range req.OwnerIDs {
+		if _, err := s.repo.GetCustomerByID(ctx, id); err != nil {
+			return fmt.Errorf("owner %d: %w", id, customerNotFound(err))
+		}
+	}
+	return nil
+}
+
+// prepareAccount checks the currency, initial balance and tier of a request
+// and returns the account to create, still empty, with the initial balance
+func (s *AccountService) prepareAccount(req models.CreateAccountRequest) (*models.Account, money.Money, error) {
+	currency, err := money.ParseCurrency(req.Currency)
+	if err != nil {
+		return nil, money.Money{}, err
+	}
+
+	initialBalance, err := req.InitialBalance.Money(currency)
+	if err != nil {
+		return nil, money.Money{}, fmt.Errorf("invalid initial balance: %w", err)
+	}
+	if initialBalance.IsNegative() {
+		return nil, money.Money{}, fmt.Errorf("%w: initial balance cannot be negative", money.ErrInvalidAmount)
+	}
+
+	accountTier, err := s.tiers.Resolve(req.Tier)
+	if err != nil {
+		return nil, money.Money{}, err
+	}
+
+	return &models.Account{
+		AccountNumber:  req.AccountNumber,
+		Balance:        money.Zero(currency),
+		Status:         models.AccountStatusActive,
+		Tier:           accountTier,
+		OverdraftLimit: money.Zero(currency),
+		HeldAmount:     money.Zero(currency),
+	}, initialBalance, nil
+}
+
+// updateBalanceGauges refreshes the balance and overdraft gauges of an account
+func updateBalanceGauges(account *models.Account) {
 	telemetry.UpdateAccountBalance(account.AccountNumber, account.Balance)
+	telemetry.UpdateAccountOverdraft(account.AccountNumber, account.OverdraftLimit, account.OverdraftDrawn())
+}
 
-	// Create initial transaction if there's an initial balance
-	if req.InitialBalance > 0 {
-		transaction := &models.Transaction{
-			AccountID:   account.ID,
-			Type:        models.TransactionTypeDeposit,
-			Amount:      req.InitialBalance,
-			Description: "Initial deposit",
-			Reference:   fmt.Sprintf("INIT-%d", account.ID),
+// addOwners makes each customer in ids an owner of a new account
+func addOwners(ctx context.Context, tx repository.Store, account *models.Account, ids []uint) error {
+	seen := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
 		}
-		if err := s.repo.CreateTransaction(ctx, transaction); err != nil {
-			span.RecordError(err)
-			// Log error but don't fail account creation
+		seen[id] = true
+
+		customer, err := tx.GetCustomerByID(ctx, id)
+		if err != nil {
+			return fmt.Errorf("owner %d: %w", id, customerNotFound(err))
+		}
+		if err := tx.AddAccountOwner(ctx, account.ID, id); err != nil {
+			return fmt.Errorf("failed to add owner: %w", err)
+		}
+		account.Owners = append(account.Owners, *customer)
+	}
+	return nil
+}
+
+// AddOwner makes a customer an owner of an account, turning it into a joint
+// account if it already had one
+func (s *AccountService) AddOwner(ctx context.Context, accountID uint, req models.AccountOwnerRequest) (*models.Account, error) {
+	ctx, span := accountTracer.Start(ctx, "AccountService.AddOwner")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("account.id", int(accountID)),
+		attribute.Int("customer.id", int(req.CustomerID)),
+	)
+
+	if err := auth.Authorize(ctx, auth.PermAccountsOwners); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	err := s.repo.WithTransaction(ctx, func(tx repository.Store) error {
+		if _, err := tx.LockAccount(ctx, accountID); err != nil {
+			return notFound(err)
+		}
+		if _, err := tx.GetCustomerByID(ctx, req.CustomerID); err != nil {
+			return customerNotFound(err)
+		}
+		owner := &models.AccountOwner{AccountID: accountID, CustomerID: req.CustomerID}
+		if err := tx.AddAccountOwner(ctx, accountID, req.CustomerID); err != nil {
+			if errors.Is(err, repository.ErrDuplicateKey) {
+				return models.ErrOwnerExists
+			}
+			return fmt.Errorf("failed to add owner: %w", err)
+		}
+		return recordAudit(ctx, tx, models.AuditAccountOwnerAdded, models.AuditEntityAccount, accountID, nil, owner)
+	})
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	account, err := s.repo.GetAccountByID(ctx, accountID)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to get account: %w", notFound(err))
+	}
+	return account, nil
+}
+
+// RemoveOwner stops a customer from owning an account. Every account keeps at
+// least one owner once it has one.
+func (s *AccountService) RemoveOwner(ctx context.Context, accountID, customerID uint) (*models.Account, error) {
+	ctx, span := accountTracer.Start(ctx, "AccountService.RemoveOwner")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("account.id", int(accountID)),
+		attribute.Int("customer.id", int(customerID)),
+	)
+
+	if err := auth.Authorize(ctx, auth.PermAccountsOwners); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	err := s.repo.WithTransaction(ctx, func(tx repository.Store) error {
+		if _, err := tx.LockAccount(ctx, accountID); err != nil {
+			return notFound(err)
+		}
+		owners, err := tx.ListAccountOwners(ctx, accountID)
+		if err != nil {
+			return err
+		}
+		owned := false
+		for _, owner := range owners {
+			owned = owned || owner.ID == customerID
 		}
+		if !owned {
+			return models.ErrOwnerNotFound
+		}
+		if len(owners) == 1 {
+			return models.ErrLastOwner
+		}
+		if err := tx.RemoveAccountOwner(ctx, accountID, customerID); err != nil {
+			return fmt.Errorf("failed to remove owner: %w", err)
+		}
+		owner := &models.AccountOwner{AccountID: accountID, CustomerID: customerID}
+		return recordAudit(ctx, tx, models.AuditAccountOwnerRemoved, models.AuditEntityAccount, accountID, owner, nil)
+	})
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
 	}
 
+	account, err := s.repo.GetAccountByID(ctx, accountID)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to get account: %w", notFound(err))
+	}
 	return account, nil
 }
 
@@ -68,17 +299,397 @@ func (s *AccountService) GetAccount(ctx context.Context, id uint) (*models.Accou
 	account, err := s.repo.GetAccountByID(ctx, id)
 	if err != nil {
 		span.RecordError(err)
-		return nil, fmt.Errorf("failed to get account: %w", err)
+		return nil, fmt.Errorf("failed to get account: %w", notFound(err))
+	}
+	if err := auth.AuthorizeAccount(ctx, auth.PermAccountsRead, account); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	return account, nil
+}
+
+func (s *AccountService) GetAccountByNumber(ctx context.Context, accountNumber string) (*models.Account, error) {
+	ctx, span := accountTracer.Start(ctx, "AccountService.GetAccountByNumber")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("account.number", accountNumber))
+
+	account, err := s.repo.GetAccountByNumber(ctx, accountNumber)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to get account: %w", notFound(err))
+	}
+	if err := auth.AuthorizeAccount(ctx, auth.PermAccountsRead, account); err != nil {
+		span.RecordError(err)
+		return nil, err
 	}
 
 	return account, nil
 }
 
-func (s *AccountService) ListAccounts(ctx context.Context) ([]models.Account, error) {
+// accountStatusPermissions names the permission each status transition needs
+var accountStatusPermissions = map[models.AccountAction]auth.Permission{
+	models.AccountActionFreeze:   auth.PermAccountsFreeze,
+	models.AccountActionUnfreeze: auth.PermAccountsFreeze,
+	models.AccountActionClose:    auth.PermAccountsClose,
+	models.AccountActionReopen:   auth.PermAccountsClose,
+}
+
+// accountAuditActions names the audit action of each status transition
+var accountAuditActions = map[models.AccountAction]string{
+	models.AccountActionFreeze:   models.AuditAccountFrozen,
+	models.AccountActionUnfreeze: models.AuditAccountUnfrozen,
+	models.AccountActionClose:    models.AuditAccountClosed,
+	models.AccountActionReopen:   models.AuditAccountReopened,
+}
+
+// ChangeStatus freezes, unfreezes, closes or reopens an account, recording
+// the reason code and auditing the transition. Only accounts with a zero
+// balance can be closed.
+func (s *AccountService) ChangeStatus(ctx context.Context, id uint, action models.AccountAction, req models.AccountStatusRequest) (*models.Account, error) {
+	ctx, span := accountTracer.Start(ctx, "AccountService.ChangeStatus")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("account.id", int(id)),
+		attribute.String("account.action", string(action)),
+		attribute.String("account.status_reason", req.Reason),
+	)
+
+	perm, ok := accountStatusPermissions[action]
+	if !ok {
+		err := fmt.Errorf("%w: unknown action %q", models.ErrInvalidStatusTransition, action)
+		span.RecordError(err)
+		return nil, err
+	}
+	if err := auth.Authorize(ctx, perm); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	if !models.ValidAccountReason(req.Reason) {
+		err := fmt.Errorf("%w: %q", models.ErrInvalidStatusReason, req.Reason)
+		span.RecordError(err)
+		return nil, err
+	}
+
+	var account *models.Account
+	err := s.repo.WithTransaction(ctx, func(tx repository.Store) error {
+		var err error
+		account, err = tx.LockAccount(ctx, id)
+		if err != nil {
+			return notFound(err)
+		}
+		before := *account
+
+		status, err := account.Transition(action)
+		if err != nil {
+			return err
+		}
+		if status == models.AccountStatusClosed && !account.Balance.IsZero() {
+			return fmt.Errorf("%w: balance is %s %s", models.ErrBalanceNotZero, account.Balance, account.Currency())
+		}
+
+		account.Status = status
+		account.StatusReason = req.Reason
+		if err := tx.UpdateAccountStatus(ctx, account); err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, accountAuditActions[action], models.AuditEntityAccount, account.ID, before, account)
+	})
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.String("account.status", string(account.Status)))
+
+	return account, nil
+}
+
+// SetOverdraft changes the overdraft limit of an account. The limit cannot
+// be lowered below the overdraft already drawn, and closed accounts keep
+// theirs.
+func (s *AccountService) SetOverdraft(ctx context.Context, id uint, req models.OverdraftRequest) (*models.Account, error) {
+	ctx, span := accountTracer.Start(ctx, "AccountService.SetOverdraft")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int("account.id", int(id)))
+
+	if err := auth.Authorize(ctx, auth.PermAccountsOverdraft); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	var account *models.Account
+	err := s.repo.WithTransaction(ctx, func(tx repository.Store) error {
+		var err error
+		account, err = tx.LockAccount(ctx, id)
+		if err != nil {
+			return notFound(err)
+		}
+		before := *account
+
+		if account.Status == models.AccountStatusClosed {
+			return fmt.Errorf("%w: %s", models.ErrAccountClosed, account.AccountNumber)
+		}
+		limit, err := req.Limit.Money(account.Currency())
+		if err != nil {
+			return fmt.Errorf("invalid overdraft limit: %w", err)
+		}
+		if limit.IsNegative() {
+			return fmt.Errorf("%w: overdraft limit cannot be negative", money.ErrInvalidAmount)
+		}
+		if drawn := account.OverdraftDrawn(); limit.Minor < drawn.Minor {
+			return fmt.Errorf("%w: %s %s drawn", models.ErrOverdraftInUse, drawn, drawn.Currency)
+		}
+
+		account.OverdraftLimit = limit
+		if err := tx.UpdateAccountOverdraft(ctx, account); err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, models.AuditAccountOverdraftChanged, models.AuditEntityAccount, account.ID, before, account)
+	})
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.String("account.overdraft_limit", account.OverdraftLimit.String()))
+	updateBalanceGauges(account)
+
+	return account, nil
+}
+
+// PostEntry atomically applies a signed amount to an account's balance,
+// posting a balanced journal entry and recording the matching transaction.
+// Debits beyond the available balance are rejected with
+// models.ErrInsufficientBalance. Replaying an entry whose key was already
+// applied returns the account unchanged. Concurrent updates to the same
+// account are retried a few times before giving up.
+func (s *AccountService) PostEntry(ctx context.Context, accountID uint, entry models.AccountEntry) (*models.Account, error) {
+	ctx, span := accountTracer.Start(ctx, "AccountService.PostEntry")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("account.id", int(accountID)),
+		attribute.String("entry.type", string(entry.Type)),
+		attribute.String("entry.amount", entry.Amount.String()),
+		attribute.String("entry.currency", string(entry.Amount.Currency)),
+		attribute.String("entry.reference", entry.Reference),
+	)
+
+	account, _, err := s.postEntry(ctx, accountID, entry)
+
+	// A concurrent request with the same key won the race: acknowledge it
+	if errors.Is(err, repository.ErrDuplicateKey) && entry.Key != "" {
+		span.SetAttributes(attribute.Bool("entry.duplicate", true))
+		account, err = s.repo.GetAccountByID(ctx, accountID)
+	}
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	updateBalanceGauges(account)
+
+	return account, nil
+}
+
+// Deposit adds money to an account
+func (s *AccountService) Deposit(ctx context.Context, accountID uint, req models.CashTransactionRequest) (*models.Transaction, error) {
+	return s.cashTransaction(ctx, "AccountService.Deposit", accountID, models.TransactionTypeDeposit, req)
+}
+
+// Withdraw takes money out of an account. Withdrawals larger than the balance
+// plus the undrawn overdraft are rejected with models.ErrInsufficientBalance.
+func (s *AccountService) Withdraw(ctx context.Context, accountID uint, req models.CashTransactionRequest) (*models.Transaction, error) {
+	return s.cashTransaction(ctx, "AccountService.Withdraw", accountID, models.TransactionTypeWithdrawal, req)
+}
+
+// cashTransaction validates and books a deposit or withdrawal. The returned
+// transaction carries the updated account.
+func (s *AccountService) cashTransaction(ctx context.Context, spanName string, accountID uint, txType models.TransactionType, req models.CashTransactionRequest) (*models.Transaction, error) {
+	ctx, span := accountTracer.Start(ctx, spanName)
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("account.id", int(accountID)),
+		attribute.String("transaction.type", string(txType)),
+	)
+
+	perm := auth.PermAccountsDeposit
+	if txType == models.TransactionTypeWithdrawal {
+		perm = auth.PermAccountsWithdraw
+	}
+	if err := auth.Authorize(ctx, perm); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	account, err := s.repo.GetAccountByID(ctx, accountID)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to get account: %w", notFound(err))
+	}
+
+	if req.Currency != "" {
+		currency, err := money.ParseCurrency(req.Currency)
+		if err != nil {
+			span.RecordError(err)
+			return nil, err
+		}
+		if currency != account.Currency() {
+			err := fmt.Errorf("%w: %s requested, account in %s", models.ErrCurrencyMismatch, currency, account.Currency())
+			span.RecordError(err)
+			return nil, err
+		}
+	}
+
+	amount, err := req.Amount.Money(account.Currency())
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("invalid amount: %w", err)
+	}
+	if !amount.IsPositive() {
+		err := fmt.Errorf("%w: amount must be greater than zero", money.ErrInvalidAmount)
+		span.RecordError(err)
+		return nil, err
+	}
+
+	span.SetAttributes(
+		attribute.String("transaction.amount", amount.String()),
+		attribute.String("transaction.currency", string(amount.Currency)),
+	)
+
+	entry := models.AccountEntry{
+		Type:        txType,
+		Amount:      amount,
+		Reference:   req.Reference,
+		Description: req.Description,
+	}
+	if txType == models.TransactionTypeWithdrawal {
+		entry.Amount = amount.Neg()
+	}
+
+	account, transaction, err := s.postEntry(ctx, accountID, entry)
+	if err != nil {
+		span.RecordError(err)
+		telemetry.RecordAccountTransaction(string(txType), amount, false)
+		return nil, err
+	}
+
+	telemetry.RecordAccountTransaction(string(txType), amount, true)
+	updateBalanceGauges(account)
+
+	transaction.Account = *account
+	return transaction, nil
+}
+
+// postEntry applies an entry, retrying a few times when the account keeps
+// changing underneath it. It returns a nil transaction when the entry's key
+// was already applied.
+func (s *AccountService) postEntry(ctx context.Context, accountID uint, entry models.AccountEntry) (*models.Account, *models.Transaction, error) {
+	span := trace.SpanFromContext(ctx)
+	for attempt := 1; ; attempt++ {
+		account, transaction, err := s.applyEntryOnce(ctx, accountID, entry)
+		if !errors.Is(err, models.ErrConcurrentUpdate) || attempt == maxEntryAttempts {
+			return account, transaction, err
+		}
+		span.AddEvent("retry on concurrent update", trace.WithAttributes(attribute.Int("attempt", attempt)))
+		if err := sleepContext(ctx, time.Duration(attempt)*entryRetryBackoff); err != nil {
+			return nil, nil, err
+		}
+	}
+}
+
+// sleepContext waits for d, returning early with the context's error when
+// ctx is done first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// applyEntryOnce applies an entry in one database transaction
+func (s *AccountService) applyEntryOnce(ctx context.Context, accountID uint, entry models.AccountEntry) (*models.Account, *models.Transaction, error) {
+	var account *models.Account
+	var transaction *models.Transaction
+	err := s.repo.WithTransaction(ctx, func(tx repository.Store) error {
+		var err error
+		account, err = tx.LockAccount(ctx, accountID)
+		if err != nil {
+			return notFound(err)
+		}
+
+		// An entry whose key was already applied is acknowledged, not repeated
+		if entry.Key != "" {
+			applied, err := tx.EntryApplied(ctx, entry.Key)
+			if err != nil {
+				return err
+			}
+			if applied {
+				trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("entry.duplicate", true))
+				return nil
+			}
+		}
+
+		transaction, err = applyEntry(ctx, tx, account, entry)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return account, transaction, nil
+}
+
+// notFound maps a missing row to models.ErrAccountNotFound
+func notFound(err error) error {
+	if errors.Is(err, repository.ErrNotFound) {
+		return models.ErrAccountNotFound
+	}
+	return err
+}
+
+// ListAccounts returns a page of accounts. Amount filters apply to the
+// balance and are read in the currency filter, or the default currency.
+func (s *AccountService) ListAccounts(ctx context.Context, q models.ListQuery) (*models.Page[models.Account], error) {
 	ctx, span := accountTracer.Start(ctx, "AccountService.ListAccounts")
 	defer span.End()
 
-	accounts, err := s.repo.ListAccounts(ctx)
+	currency, err := money.ParseCurrency(q.Currency)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("%w: %w", models.ErrInvalidListQuery, err)
+	}
+	opts, err := listOptions(q, currency)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	if q.Currency != "" {
+		opts.Currency = string(currency)
+	}
+
+	// Callers limited to their own accounts only see those
+	customerID, err := auth.CustomerScope(ctx, auth.PermAccountsRead)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	var accounts []models.Account
+	var next string
+	if customerID != 0 {
+		accounts, next, err = s.repo.ListAccountsByCustomer(ctx, customerID, opts)
+	} else {
+		accounts, next, err = s.repo.ListAccounts(ctx, opts)
+	}
 	if err != nil {
 		span.RecordError(err)
 		return nil, fmt.Errorf("failed to list accounts: %w", err)
@@ -86,22 +697,35 @@ func (s *AccountService) ListAccounts(ctx context.Context) ([]models.Account, er
 
 	span.SetAttributes(attribute.Int("accounts.count", len(accounts)))
 
-	return accounts, nil
+	return &models.Page[models.Account]{Data: accounts, NextCursor: next}, nil
 }
 
-func (s *AccountService) GetAccountTransactions(ctx context.Context, id uint) ([]models.Transaction, error) {
+// GetAccountTransactions returns a page of an account's transactions, newest
+// first by default. Amount filters are in the account's currency.
+func (s *AccountService) GetAccountTransactions(ctx context.Context, id uint, q models.ListQuery) (*models.Page[models.Transaction], error) {
 	ctx, span := accountTracer.Start(ctx, "AccountService.GetAccountTransactions")
 	defer span.End()
 
 	span.SetAttributes(attribute.Int("account.id", int(id)))
 
 	// First verify account exists
-	if _, err := s.repo.GetAccountByID(ctx, id); err != nil {
+	account, err := s.repo.GetAccountByID(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to get account: %w", notFound(err))
+	}
+	if err := auth.AuthorizeAccount(ctx, auth.PermAccountsRead, account); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	opts, err := listOptions(q, account.Currency())
+	if err != nil {
 		span.RecordError(err)
-		return nil, fmt.Errorf("account not found: %w", err)
+		return nil, err
 	}
 
-	transactions, err := s.repo.ListTransactionsByAccount(ctx, id)
+	transactions, next, err := s.repo.ListTransactionsByAccount(ctx, id, opts)
 	if err != nil {
 		span.RecordError(err)
 		return nil, fmt.Errorf("failed to get transactions: %w", err)
@@ -109,5 +733,5 @@ func (s *AccountService) GetAccountTransactions(ctx context.Context, id uint) ([
 
 	span.SetAttributes(attribute.Int("transactions.count", len(transactions)))
 
-	return transactions, nil
+	return &models.Page[models.Transaction]{Data: transactions, NextCursor: next}, nil
 }
@@ -0,0 +1,457 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/tribal/bank-api/internal/auth"
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/internal/repository"
+	"github.com/tribal/bank-api/internal/tier"
+	"github.com/tribal/bank-api/pkg/money"
+)
+
+// conflictingRepository makes the next conflicts balance updates fail with
+// models.ErrConcurrentUpdate, as if another request had changed the account
+// between reading and writing it
+type conflictingRepository struct {
+	repository.Repository
+
+	mu        sync.Mutex
+	conflicts int
+}
+
+func (r *conflictingRepository) WithTransaction(ctx context.Context, fn func(tx repository.Store) error) error {
+	return r.Repository.WithTransaction(ctx, func(tx repository.Store) error {
+		return fn(&conflictingStore{Store: tx, repo: r})
+	})
+}
+
+type conflictingStore struct {
+	repository.Store
+	repo *conflictingRepository
+}
+
+func (s *conflictingStore) ApplyBalanceDelta(ctx context.Context, account *models.Account, delta money.Money) error {
+	s.repo.mu.Lock()
+	conflict := s.repo.conflicts > 0
+	if conflict {
+		s.repo.conflicts--
+	}
+	s.repo.mu.Unlock()
+	if conflict {
+		return models.ErrConcurrentUpdate
+	}
+	return s.Store.ApplyBalanceDelta(ctx, account, delta)
+}
+
+// transactionCount returns how many transactions an account has
+func (e *testEnv) transactionCount(t *testing.T, id uint) int {
+	t.Helper()
+	transactions, _, err := e.repo.ListTransactionsByAccount(asSystem(), id, repository.ListOptions{Limit: repository.MaxPageLimit})
+	if err != nil {
+		t.Fatalf("list transactions of account %d: %v", id, err)
+	}
+	return len(transactions)
+}
+
+func TestDepositAndWithdraw(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+	account := env.createAccount(t, "0")
+
+	deposit, err := env.accounts.Deposit(ctx, account.ID, models.CashTransactionRequest{Amount: "50.00", Reference: "DEP-1"})
+	if err != nil {
+		t.Fatalf("deposit: %v", err)
+	}
+	if deposit.Type != models.TransactionTypeDeposit || deposit.Amount != money.New(5000, "USD") || deposit.Account.Balance != money.New(5000, "USD") {
+		t.Fatalf("deposit: got %s of %s leaving %s, want a deposit of 50.00 leaving 50.00", deposit.Type, deposit.Amount, deposit.Account.Balance)
+	}
+
+	withdrawal, err := env.accounts.Withdraw(ctx, account.ID, models.CashTransactionRequest{Amount: "20.00", Currency: "USD"})
+	if err != nil {
+		t.Fatalf("withdraw: %v", err)
+	}
+	if withdrawal.Type != models.TransactionTypeWithdrawal || withdrawal.Amount != money.New(-2000, "USD") || withdrawal.Account.Balance != money.New(3000, "USD") {
+		t.Fatalf("withdrawal: got %s of %s leaving %s, want a withdrawal of -20.00 leaving 30.00", withdrawal.Type, withdrawal.Amount, withdrawal.Account.Balance)
+	}
+
+	// Cash is the other side of both
+	sums, err := env.repo.SumPostingsBySystemAccount(ctx)
+	if err != nil {
+		t.Fatalf("sum postings by system account: %v", err)
+	}
+	var cash money.Money
+	for _, sum := range sums {
+		if sum.SystemAccount == models.SystemAccountCash {
+			cash = sum.Money()
+		}
+	}
+	if cash != money.New(-3000, "USD") {
+		t.Errorf("cash postings: got %s, want -30.00", cash)
+	}
+	sums, err = env.repo.SumPostingsByAccount(ctx)
+	if err != nil {
+		t.Fatalf("sum postings by account: %v", err)
+	}
+	for _, sum := range sums {
+		if sum.AccountID == account.ID && sum.Money() != money.New(3000, "USD") {
+			t.Errorf("account postings: got %s, want 30.00", sum.Money())
+		}
+	}
+	if got := env.auditActions(t, models.AuditEntityAccount, account.ID); len(got) != 3 {
+		t.Errorf("audit actions: got %v, want the creation, deposit and withdrawal", got)
+	}
+}
+
+func TestCashTransactionRejectsInvalidAmounts(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+	account := env.createAccount(t, "10.00")
+
+	tests := []struct {
+		name   string
+		amount money.Decimal
+		want   error
+	}{
+		{"zero", "0", money.ErrInvalidAmount},
+		{"zero with decimals", "0.00", money.ErrInvalidAmount},
+		{"negative", "-5.00", money.ErrInvalidAmount},
+		{"too many decimals", "1.001", money.ErrTooManyDecimals},
+		{"not a number", "ten", money.ErrInvalidAmount},
+	}
+	for _, tt := range tests {
+		for name, fn := range map[string]func(context.Context, uint, models.CashTransactionRequest) (*models.Transaction, error){
+			"deposit":  env.accounts.Deposit,
+			"withdraw": env.accounts.Withdraw,
+		} {
+			if _, err := fn(ctx, account.ID, models.CashTransactionRequest{Amount: tt.amount}); !errors.Is(err, tt.want) {
+				t.Errorf("%s %s: got %v, want %v", name, tt.name, err, tt.want)
+			}
+		}
+	}
+
+	if _, err := env.accounts.Deposit(ctx, account.ID, models.CashTransactionRequest{Amount: "5.00", Currency: "EUR"}); !errors.Is(err, models.ErrCurrencyMismatch) {
+		t.Errorf("deposit in another currency: got %v, want ErrCurrencyMismatch", err)
+	}
+	if balance := env.balance(t, account.ID); balance != 1000 {
+		t.Errorf("balance: got %d, want 1000", balance)
+	}
+	if n := env.transactionCount(t, account.ID); n != 1 {
+		t.Errorf("transactions: got %d, want only the opening balance", n)
+	}
+}
+
+func TestWithdrawBeyondOverdraft(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+	account := env.createAccount(t, "30.00")
+	if _, err := env.accounts.SetOverdraft(ctx, account.ID, models.OverdraftRequest{Limit: "20.00"}); err != nil {
+		t.Fatalf("set overdraft: %v", err)
+	}
+
+	if _, err := env.accounts.Withdraw(ctx, account.ID, models.CashTransactionRequest{Amount: "50.01"}); !errors.Is(err, models.ErrInsufficientBalance) {
+		t.Fatalf("withdrawal past the overdraft: got %v, want ErrInsufficientBalance", err)
+	}
+	if balance := env.balance(t, account.ID); balance != 3000 {
+		t.Fatalf("balance after the rejected withdrawal: got %d, want 3000", balance)
+	}
+
+	// Balance plus overdraft is exactly enough
+	withdrawal, err := env.accounts.Withdraw(ctx, account.ID, models.CashTransactionRequest{Amount: "50.00"})
+	if err != nil {
+		t.Fatalf("withdrawal up to the overdraft: %v", err)
+	}
+	if withdrawal.Account.Balance != money.New(-2000, "USD") {
+		t.Fatalf("balance: got %s, want -20.00", withdrawal.Account.Balance)
+	}
+	if _, err := env.accounts.Withdraw(ctx, account.ID, models.CashTransactionRequest{Amount: "0.01"}); !errors.Is(err, models.ErrInsufficientBalance) {
+		t.Fatalf("withdrawal from an exhausted overdraft: got %v, want ErrInsufficientBalance", err)
+	}
+}
+
+func TestTransferWithinOverdraft(t *testing.T) {
+	env := newTestEnv(t)
+	from := env.createAccount(t, "30.00")
+	to := env.createAccount(t, "0")
+	if _, err := env.accounts.SetOverdraft(asSystem(), from.ID, models.OverdraftRequest{Limit: "20.00"}); err != nil {
+		t.Fatalf("set overdraft: %v", err)
+	}
+
+	// The debit is rejected when the saga posts it, so the transfer fails
+	refused := func(amount string) {
+		t.Helper()
+		transfer, _ := env.transfers.createTransfer(asSystem(), models.CreateTransferRequest{
+			FromAccountNumber: from.AccountNumber,
+			ToAccountNumber:   to.AccountNumber,
+			Amount:            money.Decimal(amount),
+		})
+		if transfer == nil || transfer.Status != models.TransferStatusFailed ||
+			transfer.FailureCode != models.ErrorCode(models.ErrInsufficientBalance) {
+			t.Fatalf("transfer of %s: got %v, want it failed for insufficient balance", amount, transfer)
+		}
+	}
+	refused("50.01")
+	env.completedTransfer(t, from, to, "45.00")
+	if balance := env.balance(t, from.ID); balance != -1500 {
+		t.Fatalf("source balance: got %d, want -1500", balance)
+	}
+	if available := env.available(t, from.ID); available != 500 {
+		t.Fatalf("available balance: got %d, want the 5.00 of overdraft left", available)
+	}
+	refused("5.01")
+	if balance := env.balance(t, to.ID); balance != 4500 {
+		t.Errorf("destination balance: got %d, want 4500", balance)
+	}
+}
+
+func TestSetOverdraftChecks(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+	account := env.createAccount(t, "10.00")
+	if _, err := env.accounts.SetOverdraft(ctx, account.ID, models.OverdraftRequest{Limit: "50.00"}); err != nil {
+		t.Fatalf("set overdraft: %v", err)
+	}
+	if _, err := env.accounts.Withdraw(ctx, account.ID, models.CashTransactionRequest{Amount: "40.00"}); err != nil {
+		t.Fatalf("withdraw into the overdraft: %v", err)
+	}
+
+	// 30.00 of the overdraft is drawn
+	if _, err := env.accounts.SetOverdraft(ctx, account.ID, models.OverdraftRequest{Limit: "29.99"}); !errors.Is(err, models.ErrOverdraftInUse) {
+		t.Fatalf("lowering the limit below the drawn overdraft: got %v, want ErrOverdraftInUse", err)
+	}
+	if _, err := env.accounts.SetOverdraft(ctx, account.ID, models.OverdraftRequest{Limit: "-1.00"}); !errors.Is(err, money.ErrInvalidAmount) {
+		t.Fatalf("negative limit: got %v, want ErrInvalidAmount", err)
+	}
+	lowered, err := env.accounts.SetOverdraft(ctx, account.ID, models.OverdraftRequest{Limit: "30.00"})
+	if err != nil {
+		t.Fatalf("lowering the limit to the drawn overdraft: %v", err)
+	}
+	if lowered.OverdraftLimit != money.New(3000, "USD") || env.available(t, account.ID) != 0 {
+		t.Fatalf("limit: got %s with %d available, want 30.00 with nothing available", lowered.OverdraftLimit, env.available(t, account.ID))
+	}
+
+	// Only roles granted accounts:overdraft change the limit
+	for _, ctx := range []context.Context{asRole("teller"), asRole("auditor"), asCustomer(1)} {
+		if _, err := env.accounts.SetOverdraft(ctx, account.ID, models.OverdraftRequest{Limit: "100.00"}); !errors.Is(err, auth.ErrForbidden) {
+			t.Errorf("set overdraft without the permission: got %v, want ErrForbidden", err)
+		}
+	}
+	if _, err := env.accounts.SetOverdraft(asRole("admin"), account.ID, models.OverdraftRequest{Limit: "100.00"}); err != nil {
+		t.Fatalf("set overdraft as admin: %v", err)
+	}
+
+	var changes int
+	for _, action := range env.auditActions(t, models.AuditEntityAccount, account.ID) {
+		if action == models.AuditAccountOverdraftChanged {
+			changes++
+		}
+	}
+	if changes != 3 {
+		t.Errorf("overdraft changes audited: got %d, want 3", changes)
+	}
+}
+
+func TestCashTransactionRetriesConcurrentUpdates(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+	repo := &conflictingRepository{Repository: env.repo}
+	accounts := NewAccountService(repo, tier.DefaultCatalog)
+	account := env.createAccount(t, "10.00")
+
+	// Conflicts short of the last attempt are retried
+	repo.conflicts = maxEntryAttempts - 1
+	deposit, err := accounts.Deposit(ctx, account.ID, models.CashTransactionRequest{Amount: "5.00"})
+	if err != nil {
+		t.Fatalf("deposit after %d conflicts: %v", maxEntryAttempts-1, err)
+	}
+	if deposit.Account.Balance != money.New(1500, "USD") {
+		t.Fatalf("balance: got %s, want 15.00", deposit.Account.Balance)
+	}
+	if n := env.transactionCount(t, account.ID); n != 2 {
+		t.Fatalf("transactions: got %d, want the opening balance and one deposit", n)
+	}
+
+	// Conflicting on every attempt gives up without a trace of the withdrawal
+	repo.conflicts = maxEntryAttempts
+	if _, err := accounts.Withdraw(ctx, account.ID, models.CashTransactionRequest{Amount: "5.00"}); !errors.Is(err, models.ErrConcurrentUpdate) {
+		t.Fatalf("withdrawal conflicting %d times: got %v, want ErrConcurrentUpdate", maxEntryAttempts, err)
+	}
+	if balance := env.balance(t, account.ID); balance != 1500 {
+		t.Fatalf("balance after giving up: got %d, want 1500", balance)
+	}
+	if n := env.transactionCount(t, account.ID); n != 2 {
+		t.Fatalf("transactions after giving up: got %d, want 2", n)
+	}
+	report, err := NewLedgerService(env.repo).Verify(ctx)
+	if err != nil || !report.Balanced {
+		t.Fatalf("ledger after the retries: got %v, %v, want it balanced", report, err)
+	}
+}
+
+// setStatus moves an account through actions, failing the test if any is
+// refused
+func (e *testEnv) setStatus(t *testing.T, id uint, actions ...models.AccountAction) {
+	t.Helper()
+	for _, action := range actions {
+		if _, err := e.accounts.ChangeStatus(asSystem(), id, action, models.AccountStatusRequest{Reason: models.AccountReasonCompliance}); err != nil {
+			t.Fatalf("%s account %d: %v", action, id, err)
+		}
+	}
+}
+
+func TestChangeStatusTransitions(t *testing.T) {
+	tests := []struct {
+		name   string
+		setup  []models.AccountAction
+		action models.AccountAction
+		want   models.AccountStatus
+		err    error
+	}{
+		{"freeze active", nil, models.AccountActionFreeze, models.AccountStatusFrozen, nil},
+		{"unfreeze frozen", []models.AccountAction{models.AccountActionFreeze}, models.AccountActionUnfreeze, models.AccountStatusActive, nil},
+		{"close active", nil, models.AccountActionClose, models.AccountStatusClosed, nil},
+		{"close frozen", []models.AccountAction{models.AccountActionFreeze}, models.AccountActionClose, models.AccountStatusClosed, nil},
+		{"reopen closed", []models.AccountAction{models.AccountActionClose}, models.AccountActionReopen, models.AccountStatusActive, nil},
+		{"freeze frozen", []models.AccountAction{models.AccountActionFreeze}, models.AccountActionFreeze, "", models.ErrInvalidStatusTransition},
+		{"freeze closed", []models.AccountAction{models.AccountActionClose}, models.AccountActionFreeze, "", models.ErrInvalidStatusTransition},
+		{"unfreeze active", nil, models.AccountActionUnfreeze, "", models.ErrInvalidStatusTransition},
+		{"unfreeze closed", []models.AccountAction{models.AccountActionClose}, models.AccountActionUnfreeze, "", models.ErrInvalidStatusTransition},
+		{"close closed", []models.AccountAction{models.AccountActionClose}, models.AccountActionClose, "", models.ErrInvalidStatusTransition},
+		{"reopen active", nil, models.AccountActionReopen, "", models.ErrInvalidStatusTransition},
+		{"reopen frozen", []models.AccountAction{models.AccountActionFreeze}, models.AccountActionReopen, "", models.ErrInvalidStatusTransition},
+		{"unknown action", nil, "suspend", "", models.ErrInvalidStatusTransition},
+	}
+
+	ctx := asSystem()
+	env := newTestEnv(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			account := env.createAccount(t, "0")
+			env.setStatus(t, account.ID, tt.setup...)
+			before := env.auditActions(t, models.AuditEntityAccount, account.ID)
+
+			got, err := env.accounts.ChangeStatus(ctx, account.ID, tt.action, models.AccountStatusRequest{Reason: models.AccountReasonCustomerRequest})
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("got %v, want %v", err, tt.err)
+				}
+				if after := env.auditActions(t, models.AuditEntityAccount, account.ID); len(after) != len(before) {
+					t.Fatalf("a refused transition was audited: %v", after[len(before):])
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("change status: %v", err)
+			}
+			if got.Status != tt.want || got.StatusReason != models.AccountReasonCustomerRequest {
+				t.Fatalf("got %s because of %q, want %s because of customer_request", got.Status, got.StatusReason, tt.want)
+			}
+			stored, err := env.repo.GetAccountByID(ctx, account.ID)
+			if err != nil || stored.Status != tt.want {
+				t.Fatalf("stored status: got %v, %v, want %s", stored, err, tt.want)
+			}
+			after := env.auditActions(t, models.AuditEntityAccount, account.ID)
+			if want := accountAuditActions[tt.action]; len(after) != len(before)+1 || after[len(after)-1] != want {
+				t.Fatalf("audit actions: got %v, want %s appended", after, want)
+			}
+		})
+	}
+}
+
+func TestChangeStatusChecks(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		balance string
+		action  models.AccountAction
+		reason  string
+		err     error
+	}{
+		{"close with a positive balance", ctx, "0.01", models.AccountActionClose, models.AccountReasonCustomerRequest, models.ErrBalanceNotZero},
+		{"unknown reason", ctx, "0", models.AccountActionFreeze, "bored", models.ErrInvalidStatusReason},
+		{"customer freezing", asCustomer(1), "0", models.AccountActionFreeze, models.AccountReasonSuspectedFraud, auth.ErrForbidden},
+		{"customer closing", asCustomer(1), "0", models.AccountActionClose, models.AccountReasonCustomerRequest, auth.ErrForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			account := env.createAccount(t, tt.balance)
+			if _, err := env.accounts.ChangeStatus(tt.ctx, account.ID, tt.action, models.AccountStatusRequest{Reason: tt.reason}); !errors.Is(err, tt.err) {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+			if stored, _ := env.repo.GetAccountByID(ctx, account.ID); stored.Status != models.AccountStatusActive {
+				t.Fatalf("status: got %s, want active", stored.Status)
+			}
+		})
+	}
+
+	// A negative balance, drawn from the overdraft, blocks closing too
+	account := env.createAccount(t, "0")
+	if _, err := env.accounts.SetOverdraft(ctx, account.ID, models.OverdraftRequest{Limit: "10.00"}); err != nil {
+		t.Fatalf("set overdraft: %v", err)
+	}
+	if _, err := env.accounts.Withdraw(ctx, account.ID, models.CashTransactionRequest{Amount: "1.00"}); err != nil {
+		t.Fatalf("withdraw: %v", err)
+	}
+	if _, err := env.accounts.ChangeStatus(ctx, account.ID, models.AccountActionClose, models.AccountStatusRequest{Reason: models.AccountReasonCustomerRequest}); !errors.Is(err, models.ErrBalanceNotZero) {
+		t.Fatalf("close with a negative balance: got %v, want ErrBalanceNotZero", err)
+	}
+
+	// Once the balance is back to zero it can be closed
+	if _, err := env.accounts.Deposit(ctx, account.ID, models.CashTransactionRequest{Amount: "1.00"}); err != nil {
+		t.Fatalf("deposit: %v", err)
+	}
+	env.setStatus(t, account.ID, models.AccountActionClose)
+}
+
+func TestInactiveAccountsRefuseTransfers(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+
+	tests := []struct {
+		name    string
+		actions []models.AccountAction
+		err     error
+	}{
+		{"frozen", []models.AccountAction{models.AccountActionFreeze}, models.ErrAccountFrozen},
+		{"closed", []models.AccountAction{models.AccountActionClose}, models.ErrAccountClosed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			active := env.createAccount(t, "100.00")
+			inactive := env.createAccount(t, "0")
+			env.setStatus(t, inactive.ID, tt.actions...)
+
+			for _, dir := range []struct {
+				name     string
+				from, to *models.Account
+			}{
+				{"source", inactive, active},
+				{"destination", active, inactive},
+			} {
+				_, err := env.transfers.CreateTransfer(ctx, models.CreateTransferRequest{
+					FromAccountNumber: dir.from.AccountNumber,
+					ToAccountNumber:   dir.to.AccountNumber,
+					Amount:            money.Decimal("1.00"),
+				})
+				if !errors.Is(err, tt.err) {
+					t.Errorf("%s account as %s: got %v, want %v", tt.name, dir.name, err, tt.err)
+				}
+			}
+			if _, err := env.accounts.Deposit(ctx, inactive.ID, models.CashTransactionRequest{Amount: "1.00"}); !errors.Is(err, tt.err) {
+				t.Errorf("deposit to a %s account: got %v, want %v", tt.name, err, tt.err)
+			}
+			if balance := env.balance(t, active.ID); balance != 10000 {
+				t.Errorf("active account balance: got %d, want 10000", balance)
+			}
+			if balance := env.balance(t, inactive.ID); balance != 0 {
+				t.Errorf("%s account balance: got %d, want 0", tt.name, balance)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tribal/bank-api/internal/auth"
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/internal/repository"
+	"github.com/tribal/bank-api/pkg/money"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// GetStatement checks that the account of a statement can be read and
+// returns the statement with its period, which defaults to the month of its
+// end, which defaults to now; ends in the future are moved to now.
+// ReadStatement fills in the balances and reads the lines.
+func (s *AccountService) GetStatement(ctx context.Context, id uint, q models.StatementQuery) (*models.Statement, error) {
+	ctx, span := accountTracer.Start(ctx, "AccountService.GetStatement")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int("account.id", int(id)))
+
+	account, err := s.repo.GetAccountByID(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to get account: %w", notFound(err))
+	}
+	if err := auth.AuthorizeAccount(ctx, auth.PermAccountsRead, account); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	statement, err := parseStatementQuery(q, now)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	statement.Account = account
+	statement.CreatedAt = now
+
+	span.SetAttributes(
+		attribute.String("statement.from", statement.From.Format(time.RFC3339)),
+		attribute.String("statement.to", statement.To.Format(time.RFC3339)),
+	)
+	return statement, nil
+}
+
+// ReadStatement sets the opening and closing balances of a statement from
+// GetStatement, both summed from the transactions of the account, and calls
+// read with a function that calls its argument with the transactions of the
+// period by date. Historical transactions are listed but left out of the
+// balances, which do not include them; statement.Write writes them as memo
+// lines. The balances and the lines are read from one snapshot, so a
+// transaction recorded meanwhile is in neither.
+func (s *AccountService) ReadStatement(ctx context.Context, statement *models.Statement, read func(each func(fn func(*models.Transaction) error) error) error) error {
+	ctx, span := accountTracer.Start(ctx, "AccountService.ReadStatement")
+	defer span.End()
+
+	account := statement.Account
+	span.SetAttributes(attribute.Int("account.id", int(account.ID)))
+
+	count := 0
+	err := s.repo.WithSnapshot(ctx, func(tx repository.Store) error {
+		opening, err := tx.SumTransactionsByAccount(ctx, account.ID, statement.From)
+		if err != nil {
+			return fmt.Errorf("failed to get opening balance: %w", err)
+		}
+		closing, err := tx.SumTransactionsByAccount(ctx, account.ID, statement.To)
+		if err != nil {
+			return fmt.Errorf("failed to get closing balance: %w", err)
+		}
+		statement.OpeningBalance = money.New(opening, account.Currency())
+		statement.ClosingBalance = money.New(closing, account.Currency())
+
+		return read(func(fn func(*models.Transaction) error) error {
+			err := tx.EachTransactionByAccount(ctx, account.ID, statement.From, statement.To, func(transaction *models.Transaction) error {
+				count++
+				return fn(transaction)
+			})
+			if err != nil {
+				return fmt.Errorf("failed to read transactions: %w", err)
+			}
+			return nil
+		})
+	})
+	span.SetAttributes(attribute.Int("transactions.count", count))
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+	return nil
+}
+
+// parseStatementQuery validates the format and period of a statement query
+func parseStatementQuery(q models.StatementQuery, now time.Time) (*models.Statement, error) {
+	switch q.Format {
+	case "":
+		q.Format = models.StatementCSV
+	case models.StatementCSV, models.StatementText, models.StatementOFX, models.StatementCAMT053:
+	default:
+		return nil, fmt.Errorf("%w: unknown format %q, want csv, txt, ofx or camt053", models.ErrInvalidStatement, q.Format)
+	}
+
+	from, err := parseListTime("from", q.From)
+	if err != nil {
+		return nil, err
+	}
+	to, err := parseListTime("to", q.To)
+	if err != nil {
+		return nil, err
+	}
+
+	end := now
+	if to != nil && to.Before(now) {
+		end = to.UTC()
+	}
+	var start time.Time
+	if from != nil {
+		start = from.UTC()
+	} else {
+		// The month the statement ends in; a period ending at midnight on
+		// the first of a month covers the month before
+		last := end.Add(-time.Nanosecond)
+		start = time.Date(last.Year(), last.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	if !start.Before(end) {
+		return nil, fmt.Errorf("%w: from must be before to and not in the future", models.ErrInvalidStatement)
+	}
+
+	return &models.Statement{Format: q.Format, From: start, To: end}, nil
+}
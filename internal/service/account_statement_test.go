@@ -0,0 +1,52 @@
+package service
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/pkg/money"
+)
+
+func TestStatementReadsOneSnapshot(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+
+	account := env.createAccount(t, "100.00")
+	stmt, err := env.accounts.GetStatement(ctx, account.ID, models.StatementQuery{From: "2024-01-01"})
+	if err != nil {
+		t.Fatalf("statement: %v", err)
+	}
+
+	var lines []int64
+	err = env.accounts.ReadStatement(ctx, stmt, func(each func(fn func(*models.Transaction) error) error) error {
+		// Recorded between the balances and the lines, dated inside the
+		// period
+		late := &models.Transaction{
+			AccountID: account.ID,
+			Type:      models.TransactionTypeDeposit,
+			Amount:    money.New(2500, account.Currency()),
+			CreatedAt: stmt.To.Add(-time.Second),
+		}
+		if err := env.repo.CreateTransaction(ctx, late); err != nil {
+			return err
+		}
+		return each(func(transaction *models.Transaction) error {
+			lines = append(lines, transaction.Amount.Minor)
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatalf("read statement: %v", err)
+	}
+
+	sum := stmt.OpeningBalance.Minor
+	for _, minor := range lines {
+		sum += minor
+	}
+	if slices.Contains(lines, 2500) || sum != stmt.ClosingBalance.Minor || sum != 10000 {
+		t.Fatalf("got opening %d, lines %v and closing %d, want the lines to add up to 10000 without the late deposit",
+			stmt.OpeningBalance.Minor, lines, stmt.ClosingBalance.Minor)
+	}
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/tribal/bank-api/internal/audit"
+	"github.com/tribal/bank-api/internal/auth"
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/internal/repository"
+	"github.com/tribal/bank-api/pkg/money"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var auditTracer = otel.Tracer("audit")
+
+// recordAudit appends an entry for a change to the audit log inside tx, so
+// the entry is stored if and only if the change is. before and after are
+// snapshots of the entity; nil means it did not exist.
+func recordAudit(ctx context.Context, tx repository.Store, action, entityType string, entityID uint, before, after interface{}) error {
+	md := audit.FromContext(ctx)
+	entry := &models.AuditEntry{
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+		Actor:      md.Actor,
+		RequestID:  md.RequestID,
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		entry.TraceID = sc.TraceID().String()
+	}
+
+	var err error
+	if entry.Before, err = auditState(before); err != nil {
+		return err
+	}
+	if entry.After, err = auditState(after); err != nil {
+		return err
+	}
+
+	if err := tx.AppendAuditEntry(ctx, entry); err != nil {
+		return fmt.Errorf("failed to append audit entry: %w", err)
+	}
+	return nil
+}
+
+func auditState(v interface{}) (models.AuditState, error) {
+	if v == nil {
+		return "", nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to snapshot audit state: %w", err)
+	}
+	return models.AuditState(data), nil
+}
+
+// AuditService reads the audit log of the service's database
+type AuditService struct {
+	repo repository.Repository
+}
+
+func NewAuditService(repo repository.Repository) *AuditService {
+	return &AuditService{repo: repo}
+}
+
+// ListEntries returns a page of audit entries, newest first by default
+func (s *AuditService) ListEntries(ctx context.Context, q models.ListQuery) (*models.Page[models.AuditEntry], error) {
+	ctx, span := auditTracer.Start(ctx, "AuditService.ListEntries")
+	defer span.End()
+
+	if err := auth.Authorize(ctx, auth.PermAuditRead); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	opts, err := listOptions(q, money.DefaultCurrency)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	entries, next, err := s.repo.ListAuditEntries(ctx, opts)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	return &models.Page[models.AuditEntry]{Data: entries, NextCursor: next}, nil
+}
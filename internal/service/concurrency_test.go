@@ -0,0 +1,145 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/pkg/money"
+)
+
+func TestConcurrentDebitsSQLite(t *testing.T) {
+	testConcurrentDebits(t, newTestEnv(t))
+}
+
+func TestConcurrentDebitsPostgres(t *testing.T) {
+	testConcurrentDebits(t, newTestEnvOn(t, postgresURL(t)))
+}
+
+// testConcurrentDebits races withdrawals posted straight to an account with
+// transfers out of it, asking for twice what the balance and overdraft
+// cover. The balance must never go past the overdraft limit, every accepted
+// debit must be accounted for and the ledger must stay balanced.
+func testConcurrentDebits(t *testing.T, env *testEnv) {
+	const (
+		workers = 20
+		debit   = 1500 // minor units
+		opening = 10000
+		limit   = 5000
+	)
+	ctx := asSystem()
+
+	source := env.createAccount(t, "100.00")
+	dest := env.createAccount(t, "0")
+	if _, err := env.accounts.SetOverdraft(ctx, source.ID, models.OverdraftRequest{Limit: "50.00"}); err != nil {
+		t.Fatalf("set overdraft: %v", err)
+	}
+
+	// Watch the balance while the debits run
+	done := make(chan struct{})
+	var lowest atomic.Int64
+	lowest.Store(opening)
+	var watcher sync.WaitGroup
+	watcher.Add(1)
+	go func() {
+		defer watcher.Done()
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Millisecond):
+			}
+			account, err := env.repo.GetAccountByID(ctx, source.ID)
+			if err != nil {
+				continue
+			}
+			if balance := account.Balance.Minor; balance < lowest.Load() {
+				lowest.Store(balance)
+			}
+		}
+	}()
+
+	var withdrawn, transferred, rejected atomic.Int64
+	errs := make(chan error, workers)
+	var wg sync.WaitGroup
+	for i := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if i%2 == 0 {
+				_, err := env.accounts.PostEntry(ctx, source.ID, models.AccountEntry{
+					Key:         fmt.Sprintf("WDL-%d-%d", source.ID, i),
+					Type:        models.TransactionTypeWithdrawal,
+					Amount:      money.New(-debit, "USD"),
+					Reference:   fmt.Sprintf("WDL-%d", i),
+					Description: "Concurrent withdrawal",
+				})
+				switch {
+				case err == nil:
+					withdrawn.Add(1)
+				case errors.Is(err, models.ErrInsufficientBalance):
+					rejected.Add(1)
+				default:
+					errs <- fmt.Errorf("withdrawal %d: %w", i, err)
+				}
+				return
+			}
+
+			transfer, err := env.transfers.createTransfer(ctx, models.CreateTransferRequest{
+				FromAccountNumber: source.AccountNumber,
+				ToAccountNumber:   dest.AccountNumber,
+				Amount:            money.Decimal("15.00"),
+			})
+			switch {
+			case err == nil && transfer.Status == models.TransferStatusCompleted:
+				transferred.Add(1)
+			case transfer != nil && transfer.FailureCode == models.ErrorCode(models.ErrInsufficientBalance):
+				rejected.Add(1)
+			case err != nil:
+				errs <- fmt.Errorf("transfer %d: %w", i, err)
+			default:
+				errs <- fmt.Errorf("transfer %d: status %s", i, transfer.Status)
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+	watcher.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	accepted := withdrawn.Load() + transferred.Load()
+	if accepted+rejected.Load() != workers {
+		t.Fatalf("outcomes: %d accepted and %d rejected, want %d in total", accepted, rejected.Load(), workers)
+	}
+	if want := int64((opening + limit) / debit); accepted != want {
+		t.Errorf("accepted debits: got %d, want %d", accepted, want)
+	}
+
+	balance := env.balance(t, source.ID)
+	if want := opening - accepted*debit; balance != want {
+		t.Errorf("source balance: got %d, want %d", balance, want)
+	}
+	if balance < -limit || lowest.Load() < -limit {
+		t.Errorf("source balance went past the overdraft: final %d, lowest %d, limit %d", balance, lowest.Load(), limit)
+	}
+	if got, want := env.balance(t, dest.ID), transferred.Load()*debit; got != want {
+		t.Errorf("destination balance: got %d, want %d", got, want)
+	}
+
+	report, err := NewLedgerService(env.repo).Verify(ctx)
+	if err != nil {
+		t.Fatalf("verify ledger: %v", err)
+	}
+	if !report.Balanced {
+		t.Fatalf("ledger unbalanced: %d unbalanced entries, %d balance mismatches",
+			len(report.UnbalancedEntries), len(report.BalanceMismatches))
+	}
+}
@@ -0,0 +1,245 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/tribal/bank-api/internal/auth"
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/internal/repository"
+	"github.com/tribal/bank-api/pkg/money"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// CustomerService manages customers and lists the accounts they own
+type CustomerService struct {
+	repo repository.Repository
+}
+
+func NewCustomerService(repo repository.Repository) *CustomerService {
+	return &CustomerService{repo: repo}
+}
+
+func (s *CustomerService) CreateCustomer(ctx context.Context, req models.CustomerRequest) (*models.Customer, error) {
+	ctx, span := accountTracer.Start(ctx, "CustomerService.CreateCustomer")
+	defer span.End()
+
+	if err := auth.Authorize(ctx, auth.PermCustomersWrite); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	customer := &models.Customer{}
+	applyCustomerRequest(customer, req)
+
+	err := s.repo.WithTransaction(ctx, func(tx repository.Store) error {
+		if err := tx.CreateCustomer(ctx, customer); err != nil {
+			return fmt.Errorf("failed to create customer: %w", customerExists(err))
+		}
+		return recordAudit(ctx, tx, models.AuditCustomerCreated, models.AuditEntityCustomer, customer.ID, nil, customer)
+	})
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("customer.id", int(customer.ID)))
+
+	return customer, nil
+}
+
+func (s *CustomerService) GetCustomer(ctx context.Context, id uint) (*models.Customer, error) {
+	ctx, span := accountTracer.Start(ctx, "CustomerService.GetCustomer")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int("customer.id", int(id)))
+
+	if err := auth.AuthorizeCustomer(ctx, auth.PermCustomersRead, id); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	customer, err := s.repo.GetCustomerByID(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to get customer: %w", customerNotFound(err))
+	}
+
+	return customer, nil
+}
+
+// UpdateCustomer replaces the name, email and external ID of a customer
+func (s *CustomerService) UpdateCustomer(ctx context.Context, id uint, req models.CustomerRequest) (*models.Customer, error) {
+	ctx, span := accountTracer.Start(ctx, "CustomerService.UpdateCustomer")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int("customer.id", int(id)))
+
+	if err := auth.Authorize(ctx, auth.PermCustomersWrite); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	var customer *models.Customer
+	err := s.repo.WithTransaction(ctx, func(tx repository.Store) error {
+		var err error
+		customer, err = tx.GetCustomerByID(ctx, id)
+		if err != nil {
+			return customerNotFound(err)
+		}
+		before := *customer
+
+		applyCustomerRequest(customer, req)
+		if err := tx.UpdateCustomer(ctx, customer); err != nil {
+			return fmt.Errorf("failed to update customer: %w", customerExists(err))
+		}
+		return recordAudit(ctx, tx, models.AuditCustomerUpdated, models.AuditEntityCustomer, customer.ID, before, customer)
+	})
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	return customer, nil
+}
+
+// DeleteCustomer removes a customer that no longer owns any open account
+func (s *CustomerService) DeleteCustomer(ctx context.Context, id uint) error {
+	ctx, span := accountTracer.Start(ctx, "CustomerService.DeleteCustomer")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int("customer.id", int(id)))
+
+	if err := auth.Authorize(ctx, auth.PermCustomersWrite); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	err := s.repo.WithTransaction(ctx, func(tx repository.Store) error {
+		customer, err := tx.GetCustomerByID(ctx, id)
+		if err != nil {
+			return customerNotFound(err)
+		}
+		open, err := tx.CountOpenAccountsByCustomer(ctx, id)
+		if err != nil {
+			return err
+		}
+		if open > 0 {
+			return fmt.Errorf("%w: %d not closed", models.ErrCustomerHasAccounts, open)
+		}
+		if err := tx.DeleteCustomer(ctx, id); err != nil {
+			return fmt.Errorf("failed to delete customer: %w", customerNotFound(err))
+		}
+		return recordAudit(ctx, tx, models.AuditCustomerDeleted, models.AuditEntityCustomer, id, customer, nil)
+	})
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+// ListCustomers returns a page of customers. Callers limited to their own
+// customer only see it.
+func (s *CustomerService) ListCustomers(ctx context.Context, q models.ListQuery) (*models.Page[models.Customer], error) {
+	ctx, span := accountTracer.Start(ctx, "CustomerService.ListCustomers")
+	defer span.End()
+
+	opts, err := listOptions(q, money.DefaultCurrency)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	customerID, err := auth.CustomerScope(ctx, auth.PermCustomersRead)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	if customerID != 0 {
+		customer, err := s.repo.GetCustomerByID(ctx, customerID)
+		if err != nil {
+			span.RecordError(err)
+			return nil, fmt.Errorf("failed to get customer: %w", customerNotFound(err))
+		}
+		return &models.Page[models.Customer]{Data: []models.Customer{*customer}}, nil
+	}
+
+	customers, next, err := s.repo.ListCustomers(ctx, opts)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to list customers: %w", err)
+	}
+
+	span.SetAttributes(attribute.Int("customers.count", len(customers)))
+
+	return &models.Page[models.Customer]{Data: customers, NextCursor: next}, nil
+}
+
+// ListCustomerAccounts returns a page of the accounts a customer owns, alone
+// or jointly. Filters work as in AccountService.ListAccounts.
+func (s *CustomerService) ListCustomerAccounts(ctx context.Context, id uint, q models.ListQuery) (*models.Page[models.Account], error) {
+	ctx, span := accountTracer.Start(ctx, "CustomerService.ListCustomerAccounts")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int("customer.id", int(id)))
+
+	if err := auth.AuthorizeCustomer(ctx, auth.PermCustomersRead, id); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	if _, err := s.repo.GetCustomerByID(ctx, id); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to get customer: %w", customerNotFound(err))
+	}
+
+	currency, err := money.ParseCurrency(q.Currency)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("%w: %w", models.ErrInvalidListQuery, err)
+	}
+	opts, err := listOptions(q, currency)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	if q.Currency != "" {
+		opts.Currency = string(currency)
+	}
+
+	accounts, next, err := s.repo.ListAccountsByCustomer(ctx, id, opts)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to list accounts: %w", err)
+	}
+
+	span.SetAttributes(attribute.Int("accounts.count", len(accounts)))
+
+	return &models.Page[models.Account]{Data: accounts, NextCursor: next}, nil
+}
+
+func applyCustomerRequest(customer *models.Customer, req models.CustomerRequest) {
+	customer.Name = strings.TrimSpace(req.Name)
+	customer.Email = strings.ToLower(strings.TrimSpace(req.Email))
+	customer.ExternalID = nil
+	if externalID := strings.TrimSpace(req.ExternalID); externalID != "" {
+		customer.ExternalID = &externalID
+	}
+}
+
+// customerNotFound maps a missing row to models.ErrCustomerNotFound
+func customerNotFound(err error) error {
+	if errors.Is(err, repository.ErrNotFound) {
+		return models.ErrCustomerNotFound
+	}
+	return err
+}
+
+// customerExists maps a unique index violation to models.ErrCustomerExists
+func customerExists(err error) error {
+	if errors.Is(err, repository.ErrDuplicateKey) {
+		return models.ErrCustomerExists
+	}
+	return err
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/tribal/bank-api/internal/auth"
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/pkg/money"
+)
+
+func TestCustomerCreateGetUpdate(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+	customers := NewCustomerService(env.repo)
+
+	alice := env.createCustomer(t, "alice")
+	bob := env.createCustomer(t, "bob")
+
+	got, err := customers.GetCustomer(ctx, alice.ID)
+	if err != nil {
+		t.Fatalf("get customer: %v", err)
+	}
+	if got.Name != "alice" || got.Email != alice.Email || got.ExternalID != nil {
+		t.Fatalf("customer: got %q <%s>, want alice <%s> without an external ID", got.Name, got.Email, alice.Email)
+	}
+
+	updated, err := customers.UpdateCustomer(ctx, alice.ID, models.CustomerRequest{
+		Name:       "Alice Liddell",
+		Email:      "  " + alice.Email + "  ",
+		ExternalID: "CRM-" + alice.Email,
+	})
+	if err != nil {
+		t.Fatalf("update customer: %v", err)
+	}
+	got, err = customers.GetCustomer(ctx, alice.ID)
+	if err != nil {
+		t.Fatalf("get updated customer: %v", err)
+	}
+	if got.Name != "Alice Liddell" || got.Email != alice.Email || got.ExternalID == nil || *got.ExternalID != *updated.ExternalID {
+		t.Fatalf("updated customer: got %q <%s> %v, want Alice Liddell <%s> with an external ID", got.Name, got.Email, got.ExternalID, alice.Email)
+	}
+	want := []string{models.AuditCustomerCreated, models.AuditCustomerUpdated}
+	if actions := env.auditActions(t, models.AuditEntityCustomer, alice.ID); !slices.Equal(actions, want) {
+		t.Errorf("audit: got %v, want %v", actions, want)
+	}
+
+	// Emails and external IDs identify a single customer
+	if _, err := customers.CreateCustomer(ctx, models.CustomerRequest{Name: "eve", Email: bob.Email}); !errors.Is(err, models.ErrCustomerExists) {
+		t.Errorf("creating a customer with bob's email: got %v, want ErrCustomerExists", err)
+	}
+	if _, err := customers.UpdateCustomer(ctx, bob.ID, models.CustomerRequest{Name: "bob", Email: bob.Email, ExternalID: *updated.ExternalID}); !errors.Is(err, models.ErrCustomerExists) {
+		t.Errorf("giving bob alice's external ID: got %v, want ErrCustomerExists", err)
+	}
+	if _, err := customers.GetCustomer(ctx, bob.ID+1000); !errors.Is(err, models.ErrCustomerNotFound) {
+		t.Errorf("get missing customer: got %v, want ErrCustomerNotFound", err)
+	}
+	if _, err := customers.UpdateCustomer(ctx, bob.ID+1000, models.CustomerRequest{Name: "nobody", Email: "nobody@example.com"}); !errors.Is(err, models.ErrCustomerNotFound) {
+		t.Errorf("update missing customer: got %v, want ErrCustomerNotFound", err)
+	}
+
+	// A customer reads itself only and changes nothing
+	asAlice := asCustomer(alice.ID)
+	if _, err := customers.GetCustomer(asAlice, alice.ID); err != nil {
+		t.Errorf("alice reading herself: %v", err)
+	}
+	if _, err := customers.GetCustomer(asAlice, bob.ID); !errors.Is(err, auth.ErrForbidden) {
+		t.Errorf("alice reading bob: got %v, want ErrForbidden", err)
+	}
+	if _, err := customers.UpdateCustomer(asAlice, alice.ID, models.CustomerRequest{Name: "alice", Email: alice.Email}); !errors.Is(err, auth.ErrForbidden) {
+		t.Errorf("alice updating herself: got %v, want ErrForbidden", err)
+	}
+	if _, err := customers.CreateCustomer(asAlice, models.CustomerRequest{Name: "mallory", Email: "mallory@example.com"}); !errors.Is(err, auth.ErrForbidden) {
+		t.Errorf("alice creating a customer: got %v, want ErrForbidden", err)
+	}
+}
+
+func TestCustomerRefusedOtherAccounts(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+
+	alice := env.createCustomer(t, "alice")
+	bob := env.createCustomer(t, "bob")
+	aliceAccount := env.createAccount(t, "100.00", alice.ID)
+	bobAccount := env.createAccount(t, "100.00", bob.ID)
+	joint := env.createAccount(t, "100.00", alice.ID, bob.ID)
+
+	asAlice := asCustomer(alice.ID)
+
+	// env.accounts reads as transfers-api does, so call accounts-api's
+	// service itself
+	reads := []struct {
+		name string
+		read func(ctx context.Context, account *models.Account) error
+	}{
+		{"get", func(ctx context.Context, account *models.Account) error {
+			_, err := env.accounts.AccountService.GetAccount(ctx, account.ID)
+			return err
+		}},
+		{"get by number", func(ctx context.Context, account *models.Account) error {
+			_, err := env.accounts.AccountService.GetAccountByNumber(ctx, account.AccountNumber)
+			return err
+		}},
+		{"transactions", func(ctx context.Context, account *models.Account) error {
+			_, err := env.accounts.GetAccountTransactions(ctx, account.ID, models.ListQuery{})
+			return err
+		}},
+	}
+	for _, tt := range reads {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.read(asAlice, aliceAccount); err != nil {
+				t.Errorf("alice reading her account: %v", err)
+			}
+			if err := tt.read(asAlice, joint); err != nil {
+				t.Errorf("alice reading the joint account: %v", err)
+			}
+			if err := tt.read(asAlice, bobAccount); !errors.Is(err, models.ErrNotAccountOwner) {
+				t.Errorf("alice reading bob's account: got %v, want ErrNotAccountOwner", err)
+			}
+		})
+	}
+
+	// Alice may send to bob but not from his account
+	send := func(from, to *models.Account) error {
+		_, err := env.transfers.CreateTransfer(asAlice, models.CreateTransferRequest{
+			FromAccountNumber: from.AccountNumber,
+			ToAccountNumber:   to.AccountNumber,
+			Amount:            money.Decimal("10.00"),
+		})
+		return err
+	}
+	if err := send(bobAccount, aliceAccount); !errors.Is(err, models.ErrNotAccountOwner) {
+		t.Fatalf("alice sending from bob's account: got %v, want ErrNotAccountOwner", err)
+	}
+	if err := send(aliceAccount, bobAccount); err != nil {
+		t.Fatalf("alice sending to bob: %v", err)
+	}
+	if err := send(joint, bobAccount); err != nil {
+		t.Fatalf("alice sending from the joint account: %v", err)
+	}
+
+	if balance := env.balance(t, bobAccount.ID); balance != 12000 {
+		t.Errorf("bob's balance: got %d, want 12000", balance)
+	}
+	if balance := env.balance(t, aliceAccount.ID); balance != 9000 {
+		t.Errorf("alice's balance: got %d, want 9000", balance)
+	}
+	page, err := env.transfers.ListTransfers(ctx, models.ListQuery{AccountNumber: bobAccount.AccountNumber})
+	if err != nil {
+		t.Fatalf("list bob's transfers: %v", err)
+	}
+	for _, transfer := range page.Data {
+		if transfer.FromAccountID == bobAccount.ID {
+			t.Errorf("transfer %d left bob's account, want none", transfer.ID)
+		}
+	}
+}
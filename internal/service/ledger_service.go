@@ -0,0 +1,257 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tribal/bank-api/internal/auth"
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/internal/repository"
+	"github.com/tribal/bank-api/pkg/money"
+	"github.com/tribal/bank-api/pkg/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// counterAccount is the system account that balances a customer entry
+func counterAccount(entryType models.TransactionType) string {
+	switch entryType {
+	case models.TransactionTypeTransfer, models.TransactionTypeReversal:
+		return models.SystemAccountTransferClearing
+	case models.TransactionTypeFee:
+		return models.SystemAccountFees
+	default:
+		return models.SystemAccountCash
+	}
+}
+
+// applyEntry books a signed amount on an account inside tx: it records a
+// balanced journal entry against the counter system account, updates the
+// cached balance, writes the matching transaction and audits the change.
+// Frozen and closed accounts only accept refunds. Debits that would take the
+// balance, less what is held, below minus the overdraft limit are rejected with
+// models.ErrInsufficientBalance; if the account changed since it was read,
+// models.ErrConcurrentUpdate is returned. An entry with a HoldKey captures
+// that hold before it is applied. Historical entries are only recorded, see
+// recordHistoricalEntry.
+func applyEntry(ctx context.Context, tx repository.Store, account *models.Account, entry models.AccountEntry) (*models.Transaction, error) {
+	if entry.OccurredAt != nil {
+		return recordHistoricalEntry(ctx, tx, account, entry)
+	}
+	if !entry.Refund {
+		if err := account.CheckActive(); err != nil {
+			return nil, err
+		}
+	}
+	if entry.Amount.Currency != account.Currency() {
+		return nil, fmt.Errorf("%w: entry in %s, account in %s", models.ErrCurrencyMismatch, entry.Amount.Currency, account.Currency())
+	}
+
+	if entry.HoldKey != "" {
+		if err := captureHold(ctx, tx, account, entry); err != nil {
+			return nil, err
+		}
+	}
+
+	balance, err := account.Balance.Add(entry.Amount)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Amount.IsNegative() && balance.Minor-account.HeldAmount.Minor < -account.OverdraftLimit.Minor {
+		return nil, fmt.Errorf("%w: %s %s available", models.ErrInsufficientBalance, account.AvailableBalance(), account.Currency())
+	}
+
+	journal := &models.JournalEntry{
+		Reference:   entry.Reference,
+		Description: entry.Description,
+		Postings: []models.Posting{
+			{AccountID: &account.ID, Amount: entry.Amount},
+			{SystemAccount: counterAccount(entry.Type), Amount: entry.Amount.Neg()},
+		},
+	}
+	if err := tx.CreateJournalEntry(ctx, journal); err != nil {
+		return nil, fmt.Errorf("failed to post journal entry: %w", err)
+	}
+
+	before := *account
+	if err := tx.ApplyBalanceDelta(ctx, account, entry.Amount); err != nil {
+		return nil, err
+	}
+
+	transaction := &models.Transaction{
+		AccountID:      account.ID,
+		Type:           entry.Type,
+		Amount:         entry.Amount,
+		Reference:      entry.Reference,
+		Description:    entry.Description,
+		JournalEntryID: &journal.ID,
+	}
+	if entry.Key != "" {
+		transaction.EntryKey = &entry.Key
+	}
+	if err := tx.CreateTransaction(ctx, transaction); err != nil {
+		return nil, fmt.Errorf("failed to create transaction: %w", err)
+	}
+
+	if err := recordAudit(ctx, tx, models.AuditAccountBalanceChanged, models.AuditEntityAccount, account.ID, before, account); err != nil {
+		return nil, err
+	}
+
+	return transaction, nil
+}
+
+// recordHistoricalEntry records an entry that took place at its OccurredAt,
+// before the account was managed here, as a transaction dated then. The
+// balance loaded for the account already includes it, so the entry posts no
+// journal entry, leaves the balance alone and is accepted whatever the status
+// of the account.
+func recordHistoricalEntry(ctx context.Context, tx repository.Store, account *models.Account, entry models.AccountEntry) (*models.Transaction, error) {
+	if entry.Amount.Currency != account.Currency() {
+		return nil, fmt.Errorf("%w: entry in %s, account in %s", models.ErrCurrencyMismatch, entry.Amount.Currency, account.Currency())
+	}
+
+	transaction := &models.Transaction{
+		AccountID:   account.ID,
+		Type:        entry.Type,
+		Amount:      entry.Amount,
+		Reference:   entry.Reference,
+		Description: entry.Description,
+		OccurredAt:  entry.OccurredAt,
+		CreatedAt:   *entry.OccurredAt,
+	}
+	if entry.Key != "" {
+		transaction.EntryKey = &entry.Key
+	}
+	if err := tx.CreateTransaction(ctx, transaction); err != nil {
+		return nil, fmt.Errorf("failed to create transaction: %w", err)
+	}
+	return transaction, nil
+}
+
+// LedgerService checks the double-entry invariants of the ledger
+type LedgerService struct {
+	repo repository.Repository
+}
+
+func NewLedgerService(repo repository.Repository) *LedgerService {
+	return &LedgerService{repo: repo}
+}
+
+// Verify checks that every journal entry balances, that the trial balance is
+// zero in every currency and that the cached balance of every account equals
+// the sum of its postings
+func (s *LedgerService) Verify(ctx context.Context) (*models.LedgerReport, error) {
+	ctx, span := accountTracer.Start(ctx, "LedgerService.Verify")
+	defer span.End()
+
+	if err := auth.Authorize(ctx, auth.PermLedgerVerify); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	report := &models.LedgerReport{
+		UnbalancedEntries: []models.UnbalancedEntry{},
+		BalanceMismatches: []models.BalanceMismatch{},
+		TrialBalance:      []money.Money{},
+		SystemBalances:    map[string][]money.Money{},
+		CheckedAt:         time.Now(),
+	}
+
+	count, err := s.repo.CountJournalEntries(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to count journal entries: %w", err)
+	}
+	report.JournalEntries = count
+
+	unbalanced, err := s.repo.ListUnbalancedJournalEntries(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to check journal entries: %w", err)
+	}
+	for _, sum := range unbalanced {
+		report.UnbalancedEntries = append(report.UnbalancedEntries, models.UnbalancedEntry{
+			JournalEntryID: sum.JournalEntryID,
+			Difference:     sum.Money(),
+		})
+	}
+
+	trial, err := s.repo.SumPostingsByCurrency(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to compute trial balance: %w", err)
+	}
+	for _, sum := range trial {
+		report.TrialBalance = append(report.TrialBalance, sum.Money())
+	}
+
+	system, err := s.repo.SumPostingsBySystemAccount(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to compute system balances: %w", err)
+	}
+	for _, sum := range system {
+		report.SystemBalances[sum.SystemAccount] = append(report.SystemBalances[sum.SystemAccount], sum.Money())
+	}
+
+	derived, err := s.repo.SumPostingsByAccount(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to derive account balances: %w", err)
+	}
+	postings := make(map[uint][]money.Money)
+	for _, sum := range derived {
+		postings[sum.AccountID] = append(postings[sum.AccountID], sum.Money())
+	}
+
+	var accounts []models.Account
+	opts := repository.ListOptions{Limit: repository.MaxPageLimit}
+	for {
+		page, next, err := s.repo.ListAccounts(ctx, opts)
+		if err != nil {
+			span.RecordError(err)
+			return nil, fmt.Errorf("failed to list accounts: %w", err)
+		}
+		accounts = append(accounts, page...)
+		if next == "" {
+			break
+		}
+		opts.Cursor = next
+	}
+	for _, account := range accounts {
+		balance := money.Zero(account.Currency())
+		consistent := true
+		for _, sum := range postings[account.ID] {
+			if sum.Currency == account.Currency() {
+				balance = sum
+			} else if !sum.IsZero() {
+				consistent = false
+			}
+		}
+		if !consistent || balance != account.Balance {
+			report.BalanceMismatches = append(report.BalanceMismatches, models.BalanceMismatch{
+				AccountID:     account.ID,
+				AccountNumber: account.AccountNumber,
+				Cached:        account.Balance,
+				Derived:       balance,
+			})
+		}
+	}
+
+	imbalances := len(report.UnbalancedEntries) + len(report.BalanceMismatches)
+	for _, sum := range report.TrialBalance {
+		if !sum.IsZero() {
+			imbalances++
+		}
+	}
+	report.Balanced = imbalances == 0
+	telemetry.UpdateLedgerImbalances(imbalances)
+
+	span.SetAttributes(
+		attribute.Int64("ledger.journal_entries", report.JournalEntries),
+		attribute.Int("ledger.imbalances", imbalances),
+		attribute.Bool("ledger.balanced", report.Balanced),
+	)
+
+	return report, nil
+}
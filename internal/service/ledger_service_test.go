@@ -0,0 +1,157 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/internal/repository"
+	"github.com/tribal/bank-api/pkg/money"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// postBalancedEntries moves money through every kind of journal entry: an
+// opening balance, a deposit, a withdrawal and a transfer
+func (e *testEnv) postBalancedEntries(t *testing.T) (*models.Account, *models.Account) {
+	t.Helper()
+	ctx := asSystem()
+
+	from := e.createAccount(t, "100.00")
+	to := e.createAccount(t, "0")
+	if _, err := e.accounts.Deposit(ctx, from.ID, models.CashTransactionRequest{Amount: "25.00"}); err != nil {
+		t.Fatalf("deposit: %v", err)
+	}
+	if _, err := e.accounts.Withdraw(ctx, from.ID, models.CashTransactionRequest{Amount: "5.00"}); err != nil {
+		t.Fatalf("withdraw: %v", err)
+	}
+	transfer, err := e.transfers.CreateTransfer(ctx, models.CreateTransferRequest{
+		FromAccountNumber: from.AccountNumber,
+		ToAccountNumber:   to.AccountNumber,
+		Amount:            money.Decimal("40.00"),
+	})
+	if err != nil || transfer.Status != models.TransferStatusCompleted {
+		t.Fatalf("transfer: got %v, want it completed", err)
+	}
+	return from, to
+}
+
+func TestLedgerVerifyBalanced(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+	env.postBalancedEntries(t)
+
+	report, err := NewLedgerService(env.repo).Verify(ctx)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if !report.Balanced || len(report.UnbalancedEntries) != 0 || len(report.BalanceMismatches) != 0 {
+		t.Fatalf("got unbalanced entries %v and mismatches %v, want a balanced ledger", report.UnbalancedEntries, report.BalanceMismatches)
+	}
+	// Opening balance, deposit, withdrawal and both legs of the transfer
+	if report.JournalEntries != 5 {
+		t.Errorf("journal entries: got %d, want 5", report.JournalEntries)
+	}
+	for _, sum := range report.TrialBalance {
+		if !sum.IsZero() {
+			t.Errorf("trial balance: got %s %s, want zero", sum, sum.Currency)
+		}
+	}
+
+	// Cash is the other side of the opening balance, the deposit and the
+	// withdrawal; the clearing account nets out once both legs of the
+	// transfer are posted
+	want := map[string]money.Money{
+		models.SystemAccountCash:             money.New(-12000, "USD"),
+		models.SystemAccountTransferClearing: money.New(0, "USD"),
+	}
+	for account, want := range want {
+		got := report.SystemBalances[account]
+		if len(got) != 1 || got[0] != want {
+			t.Errorf("%s balance: got %v, want %s", account, got, want)
+		}
+	}
+}
+
+func TestLedgerVerifyFlagsUnbalancedEntry(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+	from, _ := env.postBalancedEntries(t)
+
+	// The repository refuses unbalanced entries, so tamper with a posting of
+	// the account's opening entry in the database itself
+	db, err := gorm.Open(sqlite.Open(env.path), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	var posting models.Posting
+	if err := db.Where("account_id = ?", from.ID).Order("id").First(&posting).Error; err != nil {
+		t.Fatalf("find posting: %v", err)
+	}
+	if err := db.Model(&posting).Update("amount_minor", posting.Amount.Minor+100).Error; err != nil {
+		t.Fatalf("tamper with posting: %v", err)
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+
+	report, err := NewLedgerService(env.repo).Verify(ctx)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if report.Balanced {
+		t.Fatal("got a balanced ledger, want the tampered entry flagged")
+	}
+	if len(report.UnbalancedEntries) != 1 || report.UnbalancedEntries[0].JournalEntryID != posting.JournalEntryID ||
+		report.UnbalancedEntries[0].Difference != money.New(100, "USD") {
+		t.Errorf("unbalanced entries: got %v, want entry %d off by 1.00", report.UnbalancedEntries, posting.JournalEntryID)
+	}
+	if len(report.TrialBalance) != 1 || report.TrialBalance[0] != money.New(100, "USD") {
+		t.Errorf("trial balance: got %v, want 1.00", report.TrialBalance)
+	}
+
+	// The account's postings no longer add up to its balance either
+	if len(report.BalanceMismatches) != 1 {
+		t.Fatalf("balance mismatches: got %v, want the tampered account", report.BalanceMismatches)
+	}
+	mismatch := report.BalanceMismatches[0]
+	if mismatch.AccountID != from.ID || mismatch.Cached != money.New(8000, "USD") || mismatch.Derived != money.New(8100, "USD") {
+		t.Errorf("mismatch: got account %d cached %s derived %s, want %d cached 80.00 derived 81.00",
+			mismatch.AccountID, mismatch.Cached, mismatch.Derived, from.ID)
+	}
+}
+
+func TestLedgerVerifyFlagsBalanceMismatch(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+	_, to := env.postBalancedEntries(t)
+
+	// A balance changed without a journal entry
+	err := env.repo.WithTransaction(ctx, func(tx repository.Store) error {
+		account, err := tx.LockAccount(ctx, to.ID)
+		if err != nil {
+			return err
+		}
+		return tx.ApplyBalanceDelta(ctx, account, money.New(500, "USD"))
+	})
+	if err != nil {
+		t.Fatalf("apply balance delta: %v", err)
+	}
+
+	report, err := NewLedgerService(env.repo).Verify(ctx)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if report.Balanced || len(report.UnbalancedEntries) != 0 {
+		t.Fatalf("got balanced %v with unbalanced entries %v, want only a balance mismatch", report.Balanced, report.UnbalancedEntries)
+	}
+	if len(report.BalanceMismatches) != 1 {
+		t.Fatalf("balance mismatches: got %v, want the changed account", report.BalanceMismatches)
+	}
+	mismatch := report.BalanceMismatches[0]
+	if mismatch.AccountID != to.ID || mismatch.AccountNumber != to.AccountNumber ||
+		mismatch.Cached != money.New(4500, "USD") || mismatch.Derived != money.New(4000, "USD") {
+		t.Errorf("mismatch: got account %d cached %s derived %s, want %d cached 45.00 derived 40.00",
+			mismatch.AccountID, mismatch.Cached, mismatch.Derived, to.ID)
+	}
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/internal/repository"
+	"github.com/tribal/bank-api/pkg/money"
+)
+
+// listOptions validates a list query and converts its amounts to minor
+// units of currency
+func listOptions(q models.ListQuery, currency money.Currency) (repository.ListOptions, error) {
+	opts := repository.ListOptions{
+		Limit:         q.Limit,
+		Cursor:        q.Cursor,
+		Sort:          q.Sort,
+		Type:          q.Type,
+		Reference:     q.Reference,
+		AccountNumber: q.AccountNumber,
+		Status:        q.Status,
+		Action:        q.Action,
+		EntityType:    q.EntityType,
+		EntityID:      q.EntityID,
+		Actor:         q.Actor,
+	}
+
+	var err error
+	if opts.From, err = parseListTime("from", q.From); err != nil {
+		return opts, err
+	}
+	if opts.To, err = parseListTime("to", q.To); err != nil {
+		return opts, err
+	}
+	if opts.MinAmount, err = parseListAmount("min_amount", q.MinAmount, currency); err != nil {
+		return opts, err
+	}
+	if opts.MaxAmount, err = parseListAmount("max_amount", q.MaxAmount, currency); err != nil {
+		return opts, err
+	}
+	if opts.MinAmount != nil && opts.MaxAmount != nil && *opts.MinAmount > *opts.MaxAmount {
+		return opts, fmt.Errorf("%w: min_amount is greater than max_amount", models.ErrInvalidListQuery)
+	}
+	return opts, nil
+}
+
+// parseListTime accepts an RFC 3339 timestamp or a date, read as midnight UTC
+func parseListTime(name, s string) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, time.DateOnly} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s must be an RFC 3339 timestamp or a date", models.ErrInvalidListQuery, name)
+}
+
+func parseListAmount(name string, d money.Decimal, currency money.Currency) (*int64, error) {
+	if strings.TrimSpace(string(d)) == "" {
+		return nil, nil
+	}
+	amount, err := d.Money(currency)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", models.ErrInvalidListQuery, name, err)
+	}
+	return &amount.Minor, nil
+}
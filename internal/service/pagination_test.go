@@ -0,0 +1,281 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/tribal/bank-api/internal/fx"
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/internal/tier"
+	"github.com/tribal/bank-api/pkg/money"
+)
+
+// listIDs follows the cursors of list from the first page to the last and
+// returns the ids of every row, in order, and the size of each page
+func listIDs[T any](t *testing.T, list func(models.ListQuery) (*models.Page[T], error), q models.ListQuery, id func(*T) uint) ([]uint, []int) {
+	t.Helper()
+	var ids []uint
+	var sizes []int
+	for {
+		page, err := list(q)
+		if err != nil {
+			t.Fatalf("list with cursor %q: %v", q.Cursor, err)
+		}
+		for i := range page.Data {
+			ids = append(ids, id(&page.Data[i]))
+		}
+		sizes = append(sizes, len(page.Data))
+		if page.NextCursor == "" {
+			return ids, sizes
+		}
+		if len(sizes) > 100 {
+			t.Fatal("pagination does not end")
+		}
+		q.Cursor = page.NextCursor
+	}
+}
+
+func (e *testEnv) listAccountIDs(t *testing.T, q models.ListQuery) ([]uint, []int) {
+	t.Helper()
+	list := func(q models.ListQuery) (*models.Page[models.Account], error) {
+		return e.accounts.ListAccounts(asSystem(), q)
+	}
+	return listIDs(t, list, q, func(a *models.Account) uint { return a.ID })
+}
+
+func (e *testEnv) listTransferIDs(t *testing.T, q models.ListQuery) []uint {
+	t.Helper()
+	list := func(q models.ListQuery) (*models.Page[models.Transfer], error) {
+		return e.transfers.ListTransfers(asSystem(), q)
+	}
+	ids, _ := listIDs(t, list, q, func(t *models.Transfer) uint { return t.ID })
+	return ids
+}
+
+func (e *testEnv) listTransactionRefs(t *testing.T, accountID uint, q models.ListQuery) []string {
+	t.Helper()
+	list := func(q models.ListQuery) (*models.Page[models.Transaction], error) {
+		return e.accounts.GetAccountTransactions(asSystem(), accountID, q)
+	}
+	var refs []string
+	byID := make(map[uint]string)
+	ids, _ := listIDs(t, list, q, func(tx *models.Transaction) uint {
+		byID[tx.ID] = tx.Reference
+		return tx.ID
+	})
+	for _, id := range ids {
+		refs = append(refs, byID[id])
+	}
+	return refs
+}
+
+func TestListCursorRoundTrip(t *testing.T) {
+	env := newTestEnv(t)
+	var want []uint
+	for range 5 {
+		want = append(want, env.createAccount(t, "0").ID)
+	}
+
+	ids, sizes := env.listAccountIDs(t, models.ListQuery{Limit: 2})
+	if !slices.Equal(ids, want) || !slices.Equal(sizes, []int{2, 2, 1}) {
+		t.Fatalf("got %v in pages of %v, want %v in pages of [2 2 1]", ids, sizes, want)
+	}
+
+	// A limit that divides the rows exactly has no empty last page
+	if _, sizes := env.listAccountIDs(t, models.ListQuery{Limit: 5}); !slices.Equal(sizes, []int{5}) {
+		t.Errorf("pages of 5: got %v, want one", sizes)
+	}
+
+	slices.Reverse(want)
+	if ids, _ := env.listAccountIDs(t, models.ListQuery{Limit: 2, Sort: "-id"}); !slices.Equal(ids, want) {
+		t.Errorf("descending: got %v, want %v", ids, want)
+	}
+}
+
+func TestListBreaksTiesByID(t *testing.T) {
+	env := newTestEnv(t)
+
+	// Three accounts share a balance, so a page boundary falls among them
+	low := env.createAccount(t, "1.00")
+	var tied []uint
+	for range 3 {
+		tied = append(tied, env.createAccount(t, "5.00").ID)
+	}
+	high := env.createAccount(t, "9.00")
+
+	want := append(append([]uint{low.ID}, tied...), high.ID)
+	for _, limit := range []int{1, 2, 3} {
+		if ids, _ := env.listAccountIDs(t, models.ListQuery{Limit: limit, Sort: "balance"}); !slices.Equal(ids, want) {
+			t.Errorf("by balance in pages of %d: got %v, want %v", limit, ids, want)
+		}
+	}
+
+	// Descending order reverses the tie-break too
+	slices.Reverse(want)
+	if ids, _ := env.listAccountIDs(t, models.ListQuery{Limit: 2, Sort: "-balance"}); !slices.Equal(ids, want) {
+		t.Errorf("by balance descending: got %v, want %v", ids, want)
+	}
+}
+
+func TestListRejectsInvalidQueries(t *testing.T) {
+	env := newTestEnv(t)
+	for range 3 {
+		env.createAccount(t, "0")
+	}
+	page, err := env.accounts.ListAccounts(asSystem(), models.ListQuery{Limit: 1})
+	if err != nil || page.NextCursor == "" {
+		t.Fatalf("first page: got %v, %v, want a next cursor", page, err)
+	}
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+
+	tests := []struct {
+		name string
+		q    models.ListQuery
+	}{
+		{"cursor not base64", models.ListQuery{Cursor: "not a cursor!"}},
+		{"cursor not json", models.ListQuery{Cursor: encode("id=1")}},
+		{"cursor of another sort", models.ListQuery{Cursor: page.NextCursor, Sort: "balance"}},
+		{"tampered cursor value", models.ListQuery{Cursor: encode(`{"s":"id","v":"1 OR 1=1","id":1}`)}},
+		{"tampered time value", models.ListQuery{Cursor: encode(`{"s":"created_at","v":"yesterday","id":1}`), Sort: "created_at"}},
+		{"unknown sort", models.ListQuery{Sort: "owner"}},
+		{"negative limit", models.ListQuery{Limit: -1}},
+		{"bad from", models.ListQuery{From: "last week"}},
+		{"bad amount", models.ListQuery{MinAmount: "ten"}},
+		{"min over max", models.ListQuery{MinAmount: "10.00", MaxAmount: "5.00"}},
+		{"unknown currency", models.ListQuery{Currency: "usd dollars"}},
+	}
+	for _, tt := range tests {
+		if _, err := env.accounts.ListAccounts(asSystem(), tt.q); !errors.Is(err, models.ErrInvalidListQuery) {
+			t.Errorf("%s: got %v, want ErrInvalidListQuery", tt.name, err)
+		}
+	}
+}
+
+func TestListAccountsFilters(t *testing.T) {
+	env := newTestEnv(t)
+	rich := env.createAccount(t, "500.00")
+	poor := env.createAccount(t, "5.00")
+	euro := env.createAccountIn(t, "EUR", "50.00")
+
+	yesterday := time.Now().Add(-24 * time.Hour).Format(time.DateOnly)
+	tomorrow := time.Now().Add(24 * time.Hour).Format(time.DateOnly)
+	tests := []struct {
+		name string
+		q    models.ListQuery
+		want []uint
+	}{
+		{"currency", models.ListQuery{Currency: "EUR"}, []uint{euro.ID}},
+		{"min balance", models.ListQuery{Currency: "USD", MinAmount: "5.01"}, []uint{rich.ID}},
+		{"max balance", models.ListQuery{Currency: "USD", MaxAmount: "5.00"}, []uint{poor.ID}},
+		{"created since", models.ListQuery{From: yesterday}, []uint{rich.ID, poor.ID, euro.ID}},
+		{"created from tomorrow", models.ListQuery{From: tomorrow}, nil},
+		{"created before yesterday", models.ListQuery{To: yesterday}, nil},
+	}
+	for _, tt := range tests {
+		if ids, _ := env.listAccountIDs(t, tt.q); !slices.Equal(ids, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, ids, tt.want)
+		}
+	}
+}
+
+func TestListTransfersFilters(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+	rates, err := fx.NewStaticProvider("USD", map[money.Currency]string{"EUR": "0.915"})
+	if err != nil {
+		t.Fatalf("rates: %v", err)
+	}
+	env.transfers = NewTransferService(env.repo, env.accounts, rates, env.saga, VelocityLimits{}, tier.DefaultCatalog, DefaultHoldTTL)
+
+	a := env.createAccount(t, "100.00")
+	b := env.createAccount(t, "0")
+	c := env.createAccount(t, "0")
+	euro := env.createAccountIn(t, "EUR", "100.00")
+
+	small := env.completedTransfer(t, a, b, "10.00")
+	large := env.completedTransfer(t, a, c, "25.00")
+	back := env.completedTransfer(t, b, a, "5.00")
+	foreign := env.completedTransfer(t, euro, c, "20.00")
+	failed := &models.Transfer{
+		FromAccountID:     a.ID,
+		FromAccountNumber: a.AccountNumber,
+		ToAccountID:       b.ID,
+		ToAccountNumber:   b.AccountNumber,
+		Amount:            money.New(9900, "USD"),
+		CreditAmount:      money.New(9900, "USD"),
+		Status:            models.TransferStatusFailed,
+	}
+	if err := env.repo.CreateTransfer(ctx, failed); err != nil {
+		t.Fatalf("create failed transfer: %v", err)
+	}
+
+	tomorrow := time.Now().Add(24 * time.Hour).Format(time.DateOnly)
+	tests := []struct {
+		name string
+		q    models.ListQuery
+		want []uint
+	}{
+		{"newest first by default", models.ListQuery{}, []uint{failed.ID, foreign.ID, back.ID, large.ID, small.ID}},
+		{"status", models.ListQuery{Type: string(models.TransferStatusFailed)}, []uint{failed.ID}},
+		{"currency", models.ListQuery{Currency: "EUR"}, []uint{foreign.ID}},
+		{"either side of an account", models.ListQuery{AccountNumber: b.AccountNumber, Sort: "id"}, []uint{small.ID, back.ID, failed.ID}},
+		{"amount range", models.ListQuery{Currency: "USD", MinAmount: "5.01", MaxAmount: "25.00", Sort: "id"}, []uint{small.ID, large.ID}},
+		{"by amount", models.ListQuery{Currency: "USD", Sort: "-amount", Limit: 2}, []uint{failed.ID, large.ID, small.ID, back.ID}},
+		{"created from tomorrow", models.ListQuery{From: tomorrow}, nil},
+		{"created before tomorrow", models.ListQuery{To: tomorrow, Type: string(models.TransferStatusCompleted), Sort: "id"}, []uint{small.ID, large.ID, back.ID, foreign.ID}},
+	}
+	for _, tt := range tests {
+		if ids := env.listTransferIDs(t, tt.q); !slices.Equal(ids, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, ids, tt.want)
+		}
+	}
+
+	if _, err := env.transfers.ListTransfers(ctx, models.ListQuery{Sort: "balance"}); !errors.Is(err, models.ErrInvalidListQuery) {
+		t.Errorf("sort by a field of accounts: got %v, want ErrInvalidListQuery", err)
+	}
+}
+
+func TestListTransactionsFilters(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+	account := env.createAccount(t, "100.00")
+	other := env.createAccount(t, "0")
+
+	if _, err := env.accounts.Deposit(ctx, account.ID, models.CashTransactionRequest{Amount: "50.00", Reference: "DEP-1"}); err != nil {
+		t.Fatalf("deposit: %v", err)
+	}
+	if _, err := env.accounts.Withdraw(ctx, account.ID, models.CashTransactionRequest{Amount: "20.00", Reference: "WDR-1"}); err != nil {
+		t.Fatalf("withdraw: %v", err)
+	}
+	transfer := env.completedTransfer(t, account, other, "10.00")
+	opening := fmt.Sprintf("INIT-%d", account.ID)
+	sent := fmt.Sprintf("TRF-%d", transfer.ID)
+
+	tests := []struct {
+		name string
+		q    models.ListQuery
+		want []string
+	}{
+		{"newest first by default", models.ListQuery{Limit: 3}, []string{sent, "WDR-1", "DEP-1", opening}},
+		{"type", models.ListQuery{Type: string(models.TransactionTypeDeposit), Sort: "id"}, []string{opening, "DEP-1"}},
+		{"reference", models.ListQuery{Reference: "WDR-1"}, []string{"WDR-1"}},
+		// Amounts compare by size, so a withdrawal of 20.00 is at least 20.00
+		{"min amount", models.ListQuery{MinAmount: "20.00", Sort: "id"}, []string{opening, "DEP-1", "WDR-1"}},
+		{"max amount", models.ListQuery{MaxAmount: "20.00", Sort: "id"}, []string{"WDR-1", sent}},
+		{"by amount", models.ListQuery{Sort: "amount", Limit: 1}, []string{"WDR-1", sent, "DEP-1", opening}},
+		{"created from tomorrow", models.ListQuery{From: time.Now().Add(24 * time.Hour).Format(time.RFC3339)}, nil},
+	}
+	for _, tt := range tests {
+		if refs := env.listTransactionRefs(t, account.ID, tt.q); !slices.Equal(refs, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, refs, tt.want)
+		}
+	}
+
+	if _, err := env.accounts.GetAccountTransactions(ctx, account.ID, models.ListQuery{MinAmount: "1.001"}); !errors.Is(err, models.ErrInvalidListQuery) {
+		t.Errorf("amount finer than the currency: got %v, want ErrInvalidListQuery", err)
+	}
+}
@@ -0,0 +1,546 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tribal/bank-api/internal/audit"
+	"github.com/tribal/bank-api/internal/auth"
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/internal/repository"
+	"github.com/tribal/bank-api/internal/tier"
+	"github.com/tribal/bank-api/pkg/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// batchHoldTTL bounds the holds of compensating batches. They are captured as soon
+// as all of them are placed and voided as soon as their batch gives up on
+// them, so this only matters for holds a crash left behind.
+const batchHoldTTL = 10 * time.Minute
+
+// CreateBatch records a batch of transfers and runs them. Best-effort batches
+// run each transfer on its own, like CreateTransfer. Compensating batches
+// record every transfer in one database transaction, or none if any of them is
+// invalid or over its limits, then hold the amount of every transfer and
+// capture them only once all the holds are in place and every destination is
+// still active; otherwise the holds are voided. Moving the money is
+// compensating, not transactional: captures already made when a later one
+// fails are reversed, and a batch that cannot confirm a capture or a reversal
+// ends in needs_attention. The returned batch carries the outcome of each
+// transfer.
+func (s *TransferService) CreateBatch(ctx context.Context, req models.CreateTransferBatchRequest) (*models.TransferBatch, error) {
+	ctx, span := transferTracer.Start(ctx, "TransferService.CreateBatch")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("batch.mode", string(req.Mode)),
+		attribute.Int("batch.items", len(req.Transfers)),
+	)
+
+	if err := auth.Authorize(ctx, auth.PermTransfersCreate); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	if err := validateBatch(req); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	batch := &models.TransferBatch{
+		Mode:      req.Mode,
+		CreatedBy: audit.FromContext(ctx).Actor,
+	}
+	for i, transfer := range req.Transfers {
+		batch.Items = append(batch.Items, models.TransferBatchItem{
+			Position:          i,
+			FromAccountNumber: transfer.FromAccountNumber,
+			ToAccountNumber:   transfer.ToAccountNumber,
+			Amount:            transfer.Amount,
+			Description:       transfer.Description,
+			Status:            models.BatchItemPending,
+		})
+	}
+	batch.Tally()
+
+	err := s.repo.WithTransaction(ctx, func(tx repository.Store) error {
+		if err := tx.CreateBatch(ctx, batch); err != nil {
+			return fmt.Errorf("failed to create batch: %w", err)
+		}
+		return recordAudit(ctx, tx, models.AuditBatchCreated, models.AuditEntityBatch, batch.ID, nil, batch)
+	})
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("batch.id", int(batch.ID)))
+
+	before := batchHeader(batch)
+	if req.Mode == models.BatchModeCompensating {
+		s.runCompensatingBatch(ctx, batch, req.Transfers)
+	} else {
+		s.runBestEffortBatch(ctx, batch, req.Transfers)
+	}
+
+	if err := s.saveBatch(ctx, batch, before); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	span.SetAttributes(
+		attribute.String("batch.status", string(batch.Status)),
+		attribute.Int("batch.succeeded", batch.Summary.Succeeded),
+		attribute.Int("batch.failed", batch.Summary.Failed),
+	)
+	telemetry.RecordTransferBatch(string(batch.Mode), string(batch.Status), batch.Summary.Total)
+
+	return batch, nil
+}
+
+// validateBatch checks the mode and size of a batch. Its transfers are
+// checked as they run.
+func validateBatch(req models.CreateTransferBatchRequest) error {
+	if req.Mode != models.BatchModeCompensating && req.Mode != models.BatchModeBestEffort {
+		return fmt.Errorf("%w: unknown mode %q, want compensating or best_effort", models.ErrInvalidBatch, req.Mode)
+	}
+	if len(req.Transfers) == 0 {
+		return fmt.Errorf("%w: a batch needs at least one transfer", models.ErrInvalidBatch)
+	}
+	if len(req.Transfers) > models.MaxBatchTransfers {
+		return fmt.Errorf("%w: %d transfers, at most %d are allowed", models.ErrInvalidBatch, len(req.Transfers), models.MaxBatchTransfers)
+	}
+	for i, transfer := range req.Transfers {
+		if transfer.Hold {
+			return fmt.Errorf("%w: transfer %d asks for a hold, which batches do not support", models.ErrInvalidBatch, i)
+		}
+	}
+	return nil
+}
+
+// runBestEffortBatch creates the transfers of a batch one after the other;
+// a transfer that fails does not stop the ones after it
+func (s *TransferService) runBestEffortBatch(ctx context.Context, batch *models.TransferBatch, transfers []models.CreateTransferRequest) {
+	for i := range batch.Items {
+		item := &batch.Items[i]
+		itemCtx, span := startBatchItem(ctx, batch, item)
+
+		req := transfers[i]
+		req.BatchID = batch.ID
+		transfer, err := s.createTransfer(itemCtx, req)
+		setItemOutcome(item, transfer, err)
+
+		endBatchItem(span, item)
+	}
+}
+
+// batchRun is an item of a compensating batch on its way through the phases
+type batchRun struct {
+	ctx      context.Context
+	span     trace.Span
+	transfer *models.Transfer
+	limits   tier.Limits
+}
+
+// runCompensatingBatch moves the money of every transfer of a batch or, as
+// far as compensating allows, of none.
+// accounts-api owns the balances, so one database transaction cannot cover
+// the money: it covers recording the transfers, and the holds placed before
+// any capture make sure every source account can pay.
+func (s *TransferService) runCompensatingBatch(ctx context.Context, batch *models.TransferBatch, transfers []models.CreateTransferRequest) {
+	runs := make([]batchRun, len(batch.Items))
+	for i := range batch.Items {
+		runs[i].ctx, runs[i].span = startBatchItem(ctx, batch, &batch.Items[i])
+	}
+	defer func() {
+		for i := range runs {
+			endBatchItem(runs[i].span, &batch.Items[i])
+		}
+	}()
+
+	// Resolve and check every transfer before recording any
+	expiresAt := time.Now().Add(batchHoldTTL)
+	for i := range runs {
+		runs[i].transfer = &models.Transfer{
+			Description:   transfers[i].Description,
+			Status:        models.TransferStatusPending,
+			BatchID:       &batch.ID,
+			HoldExpiresAt: &expiresAt,
+		}
+		limits, err := s.prepareTransfer(runs[i].ctx, transfers[i], runs[i].transfer)
+		if err != nil {
+			runs[i].span.RecordError(err)
+			recordTransferError(runs[i].transfer, err)
+			abortBatch(batch, i, err)
+			return
+		}
+		runs[i].limits = limits
+	}
+
+	// Each transfer counts towards the limits of the ones after it
+	failed := -1
+	err := s.repo.WithTransaction(ctx, func(tx repository.Store) error {
+		for i := range runs {
+			if err := s.recordTransfer(runs[i].ctx, tx, runs[i].transfer, runs[i].limits, sagaStepHold); err != nil {
+				failed = i
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if failed >= 0 {
+			runs[failed].span.RecordError(err)
+			recordTransferError(runs[failed].transfer, err)
+		}
+		abortBatch(batch, failed, err)
+		return
+	}
+
+	// Phase one: hold the amount of every transfer
+	held := true
+	for i := range runs {
+		runs[i].transfer = s.runBatchStep(runs[i].ctx, runs[i].transfer.ID, nil)
+		held = held && runs[i].transfer.Status == models.TransferStatusAuthorized
+	}
+
+	if !held {
+		s.voidCompensatingBatch(batch, runs, 0)
+		return
+	}
+
+	// The destinations were checked before the holds were placed; one that
+	// was frozen or closed since would reject its credit after the capture
+	for i := range runs {
+		if err := s.checkBatchDestination(runs[i].ctx, runs[i].transfer); err != nil {
+			runs[i].span.RecordError(err)
+			s.voidCompensatingBatch(batch, runs, 0)
+			setItemOutcome(&batch.Items[i], nil, err)
+			return
+		}
+	}
+
+	// Phase two: every source account can pay and every destination can be
+	// credited, capture all the transfers. A capture that fails anyway, or
+	// that accounts-api does not confirm, undoes the ones before it.
+	for i := range runs {
+		item := &batch.Items[i]
+		runs[i].transfer = s.runBatchStep(runs[i].ctx, runs[i].transfer.ID, captureAuthorization)
+		setItemOutcome(item, runs[i].transfer, nil)
+
+		reason := fmt.Sprintf("transfer %d of the batch failed", i)
+		switch runs[i].transfer.Status {
+		case models.TransferStatusCompleted:
+			continue
+		case models.TransferStatusAuthorized:
+			// The capture was refused before it started, as when the hold
+			// expired; void the hold
+			runs[i].transfer = s.runBatchStep(runs[i].ctx, runs[i].transfer.ID, voidAuthorization)
+			setItemOutcome(item, runs[i].transfer, nil)
+			item.Status = models.BatchItemFailed
+			item.FailureReason = "the capture was refused"
+		case models.TransferStatusPending:
+			// The relay retries the capture, so the money may still move
+			item.Status = models.BatchItemNeedsAttention
+			item.FailureReason = "the capture was not confirmed and may still complete"
+			reason = fmt.Sprintf("the capture of transfer %d of the batch was not confirmed", i)
+		}
+		s.reverseCompensatingBatch(batch, runs[:i], reason)
+		s.voidCompensatingBatch(batch, runs, i+1)
+		return
+	}
+}
+
+// voidCompensatingBatch voids the holds of the transfers of a compensating batch from
+// index start on and records the outcome of their items
+func (s *TransferService) voidCompensatingBatch(batch *models.TransferBatch, runs []batchRun, start int) {
+	for i := start; i < len(runs); i++ {
+		item := &batch.Items[i]
+		transfer := runs[i].transfer
+		switch transfer.Status {
+		case models.TransferStatusAuthorized:
+			transfer = s.runBatchStep(runs[i].ctx, transfer.ID, voidAuthorization)
+			if transfer.Status == models.TransferStatusVoided {
+				telemetry.RecordTransferHold(holdVoided, transfer.Amount)
+			}
+			setItemOutcome(item, transfer, nil)
+			item.FailureReason = "another transfer of the batch failed"
+		case models.TransferStatusPending:
+			// The relay has yet to place the hold; void the transfer so the
+			// hold is released rather than left until it expires
+			transfer = s.voidPendingHold(runs[i].ctx, transfer.ID)
+			setItemOutcome(item, transfer, nil)
+			if item.Status == models.BatchItemSkipped {
+				item.Status = models.BatchItemFailed
+				item.FailureReason = "the hold could not be placed in time"
+			}
+		default:
+			setItemOutcome(item, transfer, nil)
+		}
+	}
+}
+
+// reverseCompensatingBatch reverses the captured transfers of a compensating batch.
+// Their items are skipped, with the reversal in their failure reason; an
+// item whose reversal is rejected or not confirmed may keep its money moved
+// and needs attention.
+func (s *TransferService) reverseCompensatingBatch(batch *models.TransferBatch, runs []batchRun, reason string) {
+	for i := range runs {
+		item := &batch.Items[i]
+		transfer := runs[i].transfer
+		if transfer.Status != models.TransferStatusCompleted {
+			continue
+		}
+		reversal, err := s.reverseTransfer(runs[i].ctx, transfer.ID, models.CreateReversalRequest{Reason: reason})
+		if err != nil {
+			item.Status = models.BatchItemNeedsAttention
+			item.FailureReason = fmt.Sprintf("%s, and reversing this transfer failed: %v", reason, err)
+			continue
+		}
+		item.Status = models.BatchItemSkipped
+		if reversal.Status != models.ReversalStatusCompleted {
+			item.Status = models.BatchItemNeedsAttention
+		}
+		item.FailureReason = fmt.Sprintf("%s; reversal %d %s", reason, reversal.ID, reversal.Status)
+	}
+}
+
+// voidPendingHold voids a transfer of a compensating batch whose hold the relay
+// has yet to place. The saga then releases the hold instead of authorizing
+// the transfer, in case it was placed after all. A transfer authorized in
+// the meantime is voided like any other.
+func (s *TransferService) voidPendingHold(ctx context.Context, id uint) *models.Transfer {
+	err := s.repo.WithTransaction(ctx, func(tx repository.Store) error {
+		locked, err := tx.LockTransfer(ctx, id)
+		if err != nil {
+			return err
+		}
+		if locked.Status != models.TransferStatusPending {
+			return nil
+		}
+
+		before := *locked
+		locked.Status = models.TransferStatusVoided
+		if err := tx.UpdateTransferStatus(ctx, locked); err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, models.AuditTransferStatusChanged, models.AuditEntityTransfer, locked.ID, before, locked)
+	})
+	if err != nil {
+		trace.SpanFromContext(ctx).RecordError(err)
+	}
+
+	transfer := s.runBatchStep(ctx, id, nil)
+	if transfer.Status == models.TransferStatusAuthorized {
+		transfer = s.runBatchStep(ctx, id, voidAuthorization)
+	}
+	return transfer
+}
+
+// checkBatchDestination checks that the destination of a held transfer can
+// still be credited
+func (s *TransferService) checkBatchDestination(ctx context.Context, transfer *models.Transfer) error {
+	account, err := s.accounts.GetAccount(ctx, transfer.ToAccountID)
+	if err != nil {
+		return fmt.Errorf("destination account not found: %w", err)
+	}
+	if err := account.CheckActive(); err != nil {
+		return fmt.Errorf("destination account: %w", err)
+	}
+	return nil
+}
+
+// runBatchStep settles an authorized transfer of a batch with settle, or
+// runs its saga when settle is nil, and returns the transfer as it stands
+// afterwards. Errors are recorded on the span of the item; the transfer
+// status tells how far it got.
+func (s *TransferService) runBatchStep(ctx context.Context, id uint, settle func(*models.Transfer, time.Time) (string, error)) *models.Transfer {
+	span := trace.SpanFromContext(ctx)
+	if settle != nil {
+		if _, err := s.settleAuthorization(ctx, id, settle); err != nil {
+			span.RecordError(err)
+		}
+	} else if err := s.saga.Run(ctx, id); err != nil {
+		span.RecordError(err)
+	}
+
+	transfer, err := s.repo.GetTransferByID(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		// Leave the transfer pending; the batch is refreshed when read
+		return &models.Transfer{ID: id, Status: models.TransferStatusPending}
+	}
+	return transfer
+}
+
+// abortBatch marks the items of a compensating batch that was not recorded: the
+// item at index failed with err, and the others were skipped. A negative
+// index fails every item with err.
+func abortBatch(batch *models.TransferBatch, index int, err error) {
+	for i := range batch.Items {
+		item := &batch.Items[i]
+		switch {
+		case index < 0 || i == index:
+			setItemOutcome(item, nil, err)
+		default:
+			item.Status = models.BatchItemSkipped
+			item.FailureReason = fmt.Sprintf("transfer %d of the batch failed", index)
+		}
+	}
+}
+
+// setItemOutcome records on item the transfer it created, if any, and how it
+// went
+func setItemOutcome(item *models.TransferBatchItem, transfer *models.Transfer, err error) {
+	if transfer != nil {
+		item.TransferID = &transfer.ID
+		item.Status = models.BatchItemStatusOf(transfer)
+		item.FailureReason = transfer.FailureReason
+		item.FailureCode = transfer.FailureCode
+		return
+	}
+	if err != nil {
+		item.Status = models.BatchItemFailed
+		item.FailureReason = err.Error()
+		item.FailureCode = models.ErrorCode(err)
+		if item.FailureCode == "" {
+			item.FailureCode = auth.ErrorCode(err)
+		}
+	}
+}
+
+// startBatchItem starts the span of a batch item. Each item gets a trace of
+// its own, linked to the span of the batch, so large batches do not end up
+// in a single trace.
+func startBatchItem(ctx context.Context, batch *models.TransferBatch, item *models.TransferBatchItem) (context.Context, trace.Span) {
+	return transferTracer.Start(ctx, "TransferService.batchItem",
+		trace.WithNewRoot(),
+		trace.WithLinks(trace.LinkFromContext(ctx)),
+		trace.WithAttributes(
+			attribute.Int("batch.id", int(batch.ID)),
+			attribute.Int("batch.position", item.Position),
+			attribute.String("batch.mode", string(batch.Mode)),
+		),
+	)
+}
+
+func endBatchItem(span trace.Span, item *models.TransferBatchItem) {
+	span.SetAttributes(attribute.String("batch.item_status", string(item.Status)))
+	if item.TransferID != nil {
+		span.SetAttributes(attribute.Int("transfer.id", int(*item.TransferID)))
+	}
+	span.End()
+}
+
+// saveBatch derives the status of a batch from its items and stores both,
+// auditing the change of status
+func (s *TransferService) saveBatch(ctx context.Context, batch *models.TransferBatch, before *models.TransferBatch) error {
+	batch.Tally()
+	return s.repo.WithTransaction(ctx, func(tx repository.Store) error {
+		if err := tx.UpdateBatch(ctx, batch); err != nil {
+			return fmt.Errorf("failed to update batch: %w", err)
+		}
+		if batch.Status == before.Status && batch.Summary == before.Summary {
+			return nil
+		}
+		return recordAudit(ctx, tx, models.AuditBatchStatusChanged, models.AuditEntityBatch, batch.ID, before, batchHeader(batch))
+	})
+}
+
+// batchHeader copies a batch without its items, which the audit log already
+// holds from when the batch was created
+func batchHeader(batch *models.TransferBatch) *models.TransferBatch {
+	header := *batch
+	header.Items = nil
+	return &header
+}
+
+// GetBatch returns a batch with the outcome of each of its transfers.
+// Transfers the relay finished since the batch was last read are brought up
+// to date first.
+func (s *TransferService) GetBatch(ctx context.Context, id uint) (*models.TransferBatch, error) {
+	ctx, span := transferTracer.Start(ctx, "TransferService.GetBatch")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int("batch.id", int(id)))
+
+	if err := auth.Authorize(ctx, auth.PermTransfersRead); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	batch, err := s.repo.GetBatchByID(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		span.RecordError(models.ErrBatchNotFound)
+		return nil, models.ErrBatchNotFound
+	}
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to get batch: %w", err)
+	}
+
+	if err := s.authorizeBatch(ctx, batch); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	if batch.Status != models.TransferBatchStatusProcessing {
+		return batch, nil
+	}
+
+	before := batchHeader(batch)
+	for i := range batch.Items {
+		item := &batch.Items[i]
+		if item.Status != models.BatchItemPending || item.TransferID == nil {
+			continue
+		}
+		transfer, err := s.repo.GetTransferByID(ctx, *item.TransferID)
+		if err != nil {
+			span.RecordError(err)
+			continue
+		}
+		setItemOutcome(item, transfer, nil)
+	}
+	batch.Tally()
+	if batch.Summary == before.Summary {
+		return batch, nil
+	}
+
+	// The transfers changed the batch, not the caller reading it
+	md := audit.FromContext(ctx)
+	md.Actor = audit.SystemActor
+	ctx = audit.WithMetadata(ctx, md)
+	if err := s.saveBatch(ctx, batch, before); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	return batch, nil
+}
+
+// authorizeBatch checks that the caller may read a batch. Callers limited to
+// their own accounts must own the source account of every item, as they
+// must to submit it; the accounts are only looked up for them.
+func (s *TransferService) authorizeBatch(ctx context.Context, batch *models.TransferBatch) error {
+	if auth.Allowed(ctx, auth.PermTransfersRead) == auth.ScopeAll {
+		return nil
+	}
+	checked := make(map[string]bool)
+	for _, item := range batch.Items {
+		if checked[item.FromAccountNumber] {
+			continue
+		}
+		checked[item.FromAccountNumber] = true
+
+		account, err := s.accounts.GetAccountByNumber(ctx, item.FromAccountNumber)
+		if err != nil {
+			return fmt.Errorf("failed to get account: %w", err)
+		}
+		if err := auth.AuthorizeAccount(ctx, auth.PermTransfersRead, account); err != nil {
+			return err
+		}
+	}
+	return nil
+}
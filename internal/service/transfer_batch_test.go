@@ -0,0 +1,380 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/pkg/money"
+)
+
+// compensatingBatch submits a compensating batch that pays amount from one account to
+// each of the others
+func (e *testEnv) compensatingBatch(t *testing.T, from *models.Account, to []*models.Account, amount string) *models.TransferBatch {
+	t.Helper()
+	req := models.CreateTransferBatchRequest{Mode: models.BatchModeCompensating}
+	for _, account := range to {
+		req.Transfers = append(req.Transfers, models.CreateTransferRequest{
+			FromAccountNumber: from.AccountNumber,
+			ToAccountNumber:   account.AccountNumber,
+			Amount:            money.Decimal(amount),
+		})
+	}
+	batch, err := e.transfers.CreateBatch(asSystem(), req)
+	if err != nil {
+		t.Fatalf("create batch: %v", err)
+	}
+	return batch
+}
+
+func TestCompensatingBatchCompletes(t *testing.T) {
+	env := newTestEnv(t)
+
+	from := env.createAccount(t, "100.00")
+	to := []*models.Account{env.createAccount(t, "0"), env.createAccount(t, "0")}
+	batch := env.compensatingBatch(t, from, to, "10.00")
+
+	if batch.Status != models.TransferBatchStatusCompleted || batch.Summary.Succeeded != 2 {
+		t.Fatalf("batch: got %s with %+v, want completed with 2 succeeded", batch.Status, batch.Summary)
+	}
+	if balance := env.balance(t, from.ID); balance != 8000 {
+		t.Fatalf("source balance: got %d, want 8000", balance)
+	}
+}
+
+func TestCompensatingBatchReversesCapturesWhenOneFails(t *testing.T) {
+	env := newTestEnv(t)
+
+	from := env.createAccount(t, "100.00")
+	to := []*models.Account{env.createAccount(t, "0"), env.createAccount(t, "0"), env.createAccount(t, "0")}
+
+	// accounts-api rejects the second capture
+	captures := 0
+	env.accounts.setFail(func(op string, accountID uint, key string) error {
+		if op != opPostEntry || !strings.HasSuffix(key, ":"+sagaStepCapture) {
+			return nil
+		}
+		captures++
+		if captures == 2 {
+			return fmt.Errorf("%w: account %d", models.ErrAccountFrozen, accountID)
+		}
+		return nil
+	})
+
+	batch := env.compensatingBatch(t, from, to, "10.00")
+
+	if batch.Status != models.TransferBatchStatusFailed {
+		t.Fatalf("batch status: got %s with %+v, want failed", batch.Status, batch.Summary)
+	}
+	tests := []struct {
+		status   models.TransferBatchItemStatus
+		code     string
+		transfer models.TransferStatus
+		reason   string
+	}{
+		{models.BatchItemSkipped, "", models.TransferStatusCompleted, "reversal"},
+		{models.BatchItemFailed, models.ErrorCode(models.ErrAccountFrozen), models.TransferStatusFailed, "frozen"},
+		{models.BatchItemSkipped, "", models.TransferStatusVoided, "another transfer of the batch failed"},
+	}
+	for i, tt := range tests {
+		item := batch.Items[i]
+		if item.Status != tt.status || item.FailureCode != tt.code || !strings.Contains(item.FailureReason, tt.reason) {
+			t.Errorf("item %d: got %s %q %q, want %s %q and a reason with %q", i, item.Status, item.FailureCode, item.FailureReason, tt.status, tt.code, tt.reason)
+		}
+		if item.TransferID == nil {
+			t.Fatalf("item %d: no transfer", i)
+		}
+		if got := env.transfer(t, *item.TransferID); got.Status != tt.transfer {
+			t.Errorf("transfer of item %d: got %s, want %s", i, got.Status, tt.transfer)
+		}
+	}
+
+	// The captured transfer was reversed in full and every hold released
+	if got := env.transfer(t, *batch.Items[0].TransferID); got.ReversedAmount.Minor != 1000 {
+		t.Fatalf("reversed amount: got %d, want 1000", got.ReversedAmount.Minor)
+	}
+	if balance, available := env.balance(t, from.ID), env.available(t, from.ID); balance != 10000 || available != 10000 {
+		t.Fatalf("source: got balance %d and available %d, want 10000 and 10000", balance, available)
+	}
+	for i, account := range to {
+		if balance := env.balance(t, account.ID); balance != 0 {
+			t.Errorf("destination %d balance: got %d, want 0", i, balance)
+		}
+	}
+}
+
+func TestCompensatingBatchChecksDestinationsBeforeCapture(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+
+	from := env.createAccount(t, "100.00")
+	to := []*models.Account{env.createAccount(t, "0"), env.createAccount(t, "0")}
+
+	// The first destination is frozen while the holds are placed
+	frozen := false
+	env.accounts.setFail(func(op string, accountID uint, key string) error {
+		if op == opPlaceHold && !frozen {
+			frozen = true
+			if _, err := env.accounts.ChangeStatus(ctx, to[0].ID, models.AccountActionFreeze, models.AccountStatusRequest{Reason: models.AccountReasonSuspectedFraud}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	batch := env.compensatingBatch(t, from, to, "10.00")
+
+	if batch.Status != models.TransferBatchStatusFailed {
+		t.Fatalf("batch status: got %s with %+v, want failed", batch.Status, batch.Summary)
+	}
+	if item := batch.Items[0]; item.Status != models.BatchItemFailed || item.FailureCode != models.ErrorCode(models.ErrAccountFrozen) {
+		t.Fatalf("item 0: got %s %q, want failed with %q", item.Status, item.FailureCode, models.ErrorCode(models.ErrAccountFrozen))
+	}
+	if item := batch.Items[1]; item.Status != models.BatchItemSkipped {
+		t.Fatalf("item 1: got %s, want skipped", item.Status)
+	}
+	for i, item := range batch.Items {
+		if got := env.transfer(t, *item.TransferID); got.Status != models.TransferStatusVoided {
+			t.Errorf("transfer of item %d: got %s, want voided", i, got.Status)
+		}
+	}
+	if calls := env.accounts.callCount(opPostEntry); calls != 0 {
+		t.Fatalf("entries posted: got %d, want none", calls)
+	}
+	if balance, available := env.balance(t, from.ID), env.available(t, from.ID); balance != 10000 || available != 10000 {
+		t.Fatalf("source: got balance %d and available %d, want 10000 and 10000", balance, available)
+	}
+}
+
+func TestCompensatingBatchRejectedReversalNeedsAttention(t *testing.T) {
+	env := newTestEnv(t)
+
+	from := env.createAccount(t, "100.00")
+	to := []*models.Account{env.createAccount(t, "0"), env.createAccount(t, "0"), env.createAccount(t, "0")}
+
+	// The second capture is rejected, and so is taking back the first
+	// transfer from its destination
+	captures := 0
+	env.accounts.setFail(func(op string, accountID uint, key string) error {
+		switch {
+		case op == opPostEntry && strings.HasSuffix(key, ":"+sagaStepCapture):
+			captures++
+			if captures == 2 {
+				return fmt.Errorf("%w: account %d", models.ErrAccountFrozen, accountID)
+			}
+		case op == opPostEntry && strings.Contains(key, ":"+reversalStepDebit+":"):
+			return fmt.Errorf("%w: account %d", models.ErrAccountFrozen, accountID)
+		}
+		return nil
+	})
+
+	batch := env.compensatingBatch(t, from, to, "10.00")
+
+	if batch.Status != models.TransferBatchStatusNeedsAttention || batch.Summary.NeedsAttention != 1 {
+		t.Fatalf("batch: got %s with %+v, want needs_attention with 1 item to check", batch.Status, batch.Summary)
+	}
+	want := []models.TransferBatchItemStatus{models.BatchItemNeedsAttention, models.BatchItemFailed, models.BatchItemSkipped}
+	for i, status := range want {
+		if item := batch.Items[i]; item.Status != status {
+			t.Errorf("item %d: got %s %q, want %s", i, item.Status, item.FailureReason, status)
+		}
+	}
+	if reason := batch.Items[0].FailureReason; !strings.Contains(reason, "reversing this transfer failed") {
+		t.Errorf("item 0 reason: got %q, want the failed reversal", reason)
+	}
+
+	// The first transfer's money stays moved until an operator sorts it out
+	if balance := env.balance(t, to[0].ID); balance != 1000 {
+		t.Errorf("first destination balance: got %d, want 1000", balance)
+	}
+	if balance, available := env.balance(t, from.ID), env.available(t, from.ID); balance != 9000 || available != 9000 {
+		t.Errorf("source: got balance %d and available %d, want 9000 and 9000", balance, available)
+	}
+
+	// needs_attention is final
+	got, err := env.transfers.GetBatch(asSystem(), batch.ID)
+	if err != nil {
+		t.Fatalf("get batch: %v", err)
+	}
+	if got.Status != models.TransferBatchStatusNeedsAttention {
+		t.Errorf("stored batch: got %s, want needs_attention", got.Status)
+	}
+}
+
+func TestCompensatingBatchUnconfirmedReversalNeedsAttention(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+	clock := newTestClock()
+	env.saga.now = clock.Now
+
+	from := env.createAccount(t, "100.00")
+	to := []*models.Account{env.createAccount(t, "0"), env.createAccount(t, "0"), env.createAccount(t, "0")}
+
+	// The second capture is rejected and accounts-api does not answer while
+	// the first transfer is taken back from its destination
+	captures := 0
+	env.accounts.setFail(func(op string, accountID uint, key string) error {
+		switch {
+		case op == opPostEntry && strings.HasSuffix(key, ":"+sagaStepCapture):
+			captures++
+			if captures == 2 {
+				return fmt.Errorf("%w: account %d", models.ErrAccountFrozen, accountID)
+			}
+		case op == opPostEntry && strings.Contains(key, ":"+reversalStepDebit+":"):
+			return errUnreachable
+		}
+		return nil
+	})
+
+	batch := env.compensatingBatch(t, from, to, "10.00")
+
+	if batch.Status != models.TransferBatchStatusNeedsAttention || batch.Summary.NeedsAttention != 1 {
+		t.Fatalf("batch: got %s with %+v, want needs_attention with 1 item to check", batch.Status, batch.Summary)
+	}
+	if reason := batch.Items[0].FailureReason; !strings.Contains(reason, string(models.ReversalStatusPending)) {
+		t.Errorf("item 0 reason: got %q, want the reversal still pending", reason)
+	}
+	if balance := env.balance(t, to[0].ID); balance != 1000 {
+		t.Errorf("first destination balance: got %d, want 1000 until the reversal is confirmed", balance)
+	}
+
+	// The relay finishes the reversal later; the batch stays flagged for an
+	// operator to confirm
+	env.accounts.setFail(nil)
+	for range 2 {
+		clock.Advance(sagaMaxBackoff)
+		if err := env.saga.ProcessDue(ctx); err != nil {
+			t.Fatalf("process due: %v", err)
+		}
+	}
+	if balance := env.balance(t, to[0].ID); balance != 0 {
+		t.Errorf("first destination balance after the relay: got %d, want 0", balance)
+	}
+	if balance := env.balance(t, from.ID); balance != 10000 {
+		t.Errorf("source balance after the relay: got %d, want 10000", balance)
+	}
+	got, err := env.transfers.GetBatch(ctx, batch.ID)
+	if err != nil {
+		t.Fatalf("get batch: %v", err)
+	}
+	if got.Status != models.TransferBatchStatusNeedsAttention {
+		t.Errorf("stored batch: got %s, want needs_attention", got.Status)
+	}
+}
+
+func TestCompensatingBatchPendingCaptureNeedsAttention(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+
+	from := env.createAccount(t, "100.00")
+	to := []*models.Account{env.createAccount(t, "0"), env.createAccount(t, "0"), env.createAccount(t, "0")}
+
+	// accounts-api does not answer the second capture, so the relay is left
+	// to retry it
+	captures := 0
+	env.accounts.setFail(func(op string, accountID uint, key string) error {
+		if op != opPostEntry || !strings.HasSuffix(key, ":"+sagaStepCapture) {
+			return nil
+		}
+		captures++
+		if captures == 2 {
+			return fmt.Errorf("accounts-api timed out")
+		}
+		return nil
+	})
+
+	batch := env.compensatingBatch(t, from, to, "10.00")
+
+	if batch.Status != models.TransferBatchStatusNeedsAttention {
+		t.Fatalf("batch status: got %s with %+v, want needs_attention", batch.Status, batch.Summary)
+	}
+	tests := []struct {
+		status   models.TransferBatchItemStatus
+		transfer models.TransferStatus
+	}{
+		{models.BatchItemSkipped, models.TransferStatusCompleted},
+		{models.BatchItemNeedsAttention, models.TransferStatusPending},
+		{models.BatchItemSkipped, models.TransferStatusVoided},
+	}
+	for i, tt := range tests {
+		item := batch.Items[i]
+		if item.Status != tt.status {
+			t.Errorf("item %d: got %s %q, want %s", i, item.Status, item.FailureReason, tt.status)
+		}
+		if got := env.transfer(t, *item.TransferID); got.Status != tt.transfer {
+			t.Errorf("transfer of item %d: got %s, want %s", i, got.Status, tt.transfer)
+		}
+	}
+	if got := env.transfer(t, *batch.Items[0].TransferID); got.ReversedAmount.Minor != 1000 {
+		t.Errorf("first transfer: got %d reversed, want 1000", got.ReversedAmount.Minor)
+	}
+
+	// Only the unconfirmed capture is still outstanding
+	if balance, available := env.balance(t, from.ID), env.available(t, from.ID); balance != 10000 || available != 9000 {
+		t.Fatalf("source: got balance %d and available %d, want 10000 and 9000", balance, available)
+	}
+
+	// The relay completes the capture later; the batch stays flagged
+	env.accounts.setFail(nil)
+	if err := env.saga.Run(ctx, *batch.Items[1].TransferID); err != nil {
+		t.Fatalf("run saga: %v", err)
+	}
+	got, err := env.transfers.GetBatch(ctx, batch.ID)
+	if err != nil {
+		t.Fatalf("get batch: %v", err)
+	}
+	if got.Status != models.TransferBatchStatusNeedsAttention || got.Items[1].Status != models.BatchItemNeedsAttention {
+		t.Errorf("stored batch: got %s with item 1 %s, want both needs_attention", got.Status, got.Items[1].Status)
+	}
+	if balance := env.balance(t, to[1].ID); balance != 1000 {
+		t.Errorf("second destination balance: got %d, want 1000", balance)
+	}
+}
+
+func TestCompensatingBatchReleasesHoldsPlacedLate(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+
+	from := env.createAccount(t, "100.00")
+	to := []*models.Account{env.createAccount(t, "0"), env.createAccount(t, "0")}
+
+	// accounts-api places the second hold but the answer is lost, so the
+	// transfer stays pending
+	holds := 0
+	env.accounts.setFail(func(op string, accountID uint, key string) error {
+		if op != opPlaceHold {
+			return nil
+		}
+		holds++
+		if holds != 2 {
+			return nil
+		}
+		if _, err := env.accounts.AccountService.PlaceHold(ctx, accountID, models.AccountHoldRequest{Key: key, Amount: money.New(1000, "USD")}); err != nil {
+			return err
+		}
+		return fmt.Errorf("accounts-api timed out")
+	})
+
+	batch := env.compensatingBatch(t, from, to, "10.00")
+
+	if batch.Status != models.TransferBatchStatusFailed {
+		t.Fatalf("batch status: got %s with %+v, want failed", batch.Status, batch.Summary)
+	}
+	if item := batch.Items[1]; item.Status != models.BatchItemFailed || item.FailureReason != "the hold could not be placed in time" {
+		t.Fatalf("item 1: got %s %q, want failed as the hold was not placed in time", item.Status, item.FailureReason)
+	}
+	for i, item := range batch.Items {
+		if got := env.transfer(t, *item.TransferID); got.Status != models.TransferStatusVoided {
+			t.Errorf("transfer of item %d: got %s, want voided", i, got.Status)
+		}
+	}
+
+	// Both holds are released right away, without waiting for them to expire
+	if balance, available := env.balance(t, from.ID), env.available(t, from.ID); balance != 10000 || available != 10000 {
+		t.Fatalf("source: got balance %d and available %d, want 10000 and 10000", balance, available)
+	}
+	if calls := env.accounts.callCount(opReleaseHold); calls != 2 {
+		t.Errorf("holds released: got %d, want 2", calls)
+	}
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tribal/bank-api/internal/auth"
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/internal/repository"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// RecordHistoricalTransfer records a transfer that took place at
+// req.OccurredAt, before the accounts were managed here, e.g. when they are
+// imported from another system. The saga books its entries on both accounts
+// dated then, but the balances loaded already include it, so it moves no
+// money, counts towards no velocity or tier limit and cannot be reversed.
+// Accounts take part whatever their status. The returned transfer is
+// completed, or still pending if accounts-api could not be reached.
+func (s *TransferService) RecordHistoricalTransfer(ctx context.Context, req models.HistoricalTransferRequest) (*models.Transfer, error) {
+	ctx, span := transferTracer.Start(ctx, "TransferService.RecordHistoricalTransfer")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("transfer.from", req.FromAccountNumber),
+		attribute.String("transfer.to", req.ToAccountNumber),
+		attribute.String("transfer.amount", string(req.Amount)),
+		attribute.String("transfer.occurred_at", req.OccurredAt.Format(time.RFC3339)),
+	)
+
+	if err := auth.Authorize(ctx, auth.PermTransfersCreate); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	transfer := &models.Transfer{
+		Description: req.Description,
+		Status:      models.TransferStatusPending,
+	}
+	if err := s.prepareHistoricalTransfer(ctx, req, transfer); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	err := s.repo.WithTransaction(ctx, func(tx repository.Store) error {
+		if err := tx.CreateTransfer(ctx, transfer); err != nil {
+			return fmt.Errorf("failed to create transfer record: %w", err)
+		}
+		if err := recordAudit(ctx, tx, models.AuditTransferImported, models.AuditEntityTransfer, transfer.ID, nil, transfer); err != nil {
+			return err
+		}
+		if err := tx.CreateOutboxMessage(ctx, newSagaMessage(ctx, transfer.ID, sagaStepDebit, "", time.Now())); err != nil {
+			return fmt.Errorf("failed to enqueue transfer: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("transfer.id", int(transfer.ID)))
+
+	if err := s.saga.Run(ctx, transfer.ID); err != nil {
+		span.RecordError(err)
+	}
+
+	transfer, err = s.repo.GetTransferByID(ctx, transfer.ID)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to get transfer: %w", err)
+	}
+
+	span.SetAttributes(attribute.String("transfer.status", string(transfer.Status)))
+
+	switch transfer.Status {
+	case models.TransferStatusFailed, models.TransferStatusCompensated, models.TransferStatusNeedsAttention:
+		return nil, fmt.Errorf("transfer %d %s: %s", transfer.ID, transfer.Status, transfer.FailureReason)
+	}
+
+	return transfer, nil
+}
+
+// ValidateHistoricalTransfer runs the checks of RecordHistoricalTransfer
+// without recording the transfer
+func (s *TransferService) ValidateHistoricalTransfer(ctx context.Context, req models.HistoricalTransferRequest) error {
+	ctx, span := transferTracer.Start(ctx, "TransferService.ValidateHistoricalTransfer")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("transfer.from", req.FromAccountNumber),
+		attribute.String("transfer.to", req.ToAccountNumber),
+		attribute.String("transfer.amount", string(req.Amount)),
+		attribute.String("transfer.occurred_at", req.OccurredAt.Format(time.RFC3339)),
+	)
+
+	if err := auth.Authorize(ctx, auth.PermTransfersCreate); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	if err := s.prepareHistoricalTransfer(ctx, req, &models.Transfer{}); err != nil {
+		span.RecordError(err)
+		return err
+	}
+	return nil
+}
+
+// prepareHistoricalTransfer checks when a historical transfer took place
+// and fills in transfer through prepareTransfer
+func (s *TransferService) prepareHistoricalTransfer(ctx context.Context, req models.HistoricalTransferRequest, transfer *models.Transfer) error {
+	if req.OccurredAt.IsZero() || !req.OccurredAt.Before(time.Now()) {
+		return fmt.Errorf("%w: occurred at %s", models.ErrOccurredInFuture, req.OccurredAt.Format(time.RFC3339))
+	}
+	occurredAt := req.OccurredAt.UTC()
+	transfer.OccurredAt = &occurredAt
+
+	_, err := s.prepareTransfer(ctx, models.CreateTransferRequest{
+		FromAccountNumber: req.FromAccountNumber,
+		ToAccountNumber:   req.ToAccountNumber,
+		Amount:            req.Amount,
+		Description:       req.Description,
+	}, transfer)
+	return err
+}
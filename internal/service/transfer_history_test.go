@@ -0,0 +1,240 @@
+package service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/internal/repository"
+	"github.com/tribal/bank-api/internal/statement"
+	"github.com/tribal/bank-api/pkg/money"
+	"github.com/tribal/bank-api/pkg/telemetry"
+)
+
+// recordHistory records a historical transfer of amount that took place at
+// occurredAt
+func (e *testEnv) recordHistory(t *testing.T, from, to *models.Account, amount string, occurredAt time.Time) *models.Transfer {
+	t.Helper()
+	transfer, err := e.transfers.RecordHistoricalTransfer(asSystem(), models.HistoricalTransferRequest{
+		FromAccountNumber: from.AccountNumber,
+		ToAccountNumber:   to.AccountNumber,
+		Amount:            money.Decimal(amount),
+		OccurredAt:        occurredAt,
+	})
+	if err != nil {
+		t.Fatalf("record historical transfer: %v", err)
+	}
+	return transfer
+}
+
+func TestHistoricalTransferMovesNoMoney(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+
+	from := env.createAccount(t, "100.00")
+	to := env.createAccount(t, "0")
+	occurredAt := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	imported := testutil.ToFloat64(telemetry.BankImportedTransfersTotal.WithLabelValues("success", "USD"))
+	transfers := testutil.ToFloat64(telemetry.BankTransfersTotal.WithLabelValues("success", "USD", "USD"))
+	transfer := env.recordHistory(t, from, to, "30.00", occurredAt)
+
+	if transfer.Status != models.TransferStatusCompleted || transfer.OccurredAt == nil || !transfer.OccurredAt.Equal(occurredAt) {
+		t.Fatalf("transfer: got %s occurred at %v, want completed at %v", transfer.Status, transfer.OccurredAt, occurredAt)
+	}
+	if from, to := env.balance(t, from.ID), env.balance(t, to.ID); from != 10000 || to != 0 {
+		t.Fatalf("balances: got %d and %d, want 10000 and 0", from, to)
+	}
+
+	// It is counted and audited as imported, apart from live transfers
+	if got := testutil.ToFloat64(telemetry.BankImportedTransfersTotal.WithLabelValues("success", "USD")); got != imported+1 {
+		t.Errorf("imported transfers metric: got %v, want %v", got, imported+1)
+	}
+	if got := testutil.ToFloat64(telemetry.BankTransfersTotal.WithLabelValues("success", "USD", "USD")); got != transfers {
+		t.Errorf("transfers metric: got %v, want it unchanged at %v", got, transfers)
+	}
+	if actions := env.auditActions(t, models.AuditEntityTransfer, transfer.ID); len(actions) == 0 || actions[0] != models.AuditTransferImported {
+		t.Errorf("audit: got %v, want it to start with %s", actions, models.AuditTransferImported)
+	}
+
+	// Both legs are booked dated when the transfer took place
+	for _, leg := range []struct {
+		account *models.Account
+		amount  int64
+	}{{from, -3000}, {to, 3000}} {
+		transactions, _, err := env.repo.ListTransactionsByAccount(ctx, leg.account.ID, repository.ListOptions{Type: string(models.TransactionTypeTransfer), Limit: 10})
+		if err != nil {
+			t.Fatalf("list transactions: %v", err)
+		}
+		if len(transactions) != 1 {
+			t.Fatalf("account %d: got %d transfer transactions, want 1", leg.account.ID, len(transactions))
+		}
+		got := transactions[0]
+		if got.Amount.Minor != leg.amount || got.OccurredAt == nil || !got.CreatedAt.Equal(occurredAt) || got.JournalEntryID != nil {
+			t.Errorf("account %d: got %d dated %v without journal entry %v, want %d dated %v",
+				leg.account.ID, got.Amount.Minor, got.CreatedAt, got.JournalEntryID == nil, leg.amount, occurredAt)
+		}
+	}
+
+	// Statements still add up to the balance
+	statement, err := env.accounts.GetStatement(ctx, from.ID, models.StatementQuery{From: "2024-01-01"})
+	if err != nil {
+		t.Fatalf("statement: %v", err)
+	}
+	if err := env.accounts.ReadStatement(ctx, statement, func(func(func(*models.Transaction) error) error) error { return nil }); err != nil {
+		t.Fatalf("read statement: %v", err)
+	}
+	if statement.OpeningBalance.Minor != 0 || statement.ClosingBalance.Minor != 10000 {
+		t.Fatalf("statement: got opening %d and closing %d, want 0 and 10000", statement.OpeningBalance.Minor, statement.ClosingBalance.Minor)
+	}
+
+	report, err := NewLedgerService(env.repo).Verify(ctx)
+	if err != nil {
+		t.Fatalf("verify ledger: %v", err)
+	}
+	if !report.Balanced {
+		t.Fatalf("ledger unbalanced: %+v", report.BalanceMismatches)
+	}
+
+	if _, err := env.transfers.ReverseTransfer(ctx, transfer.ID, models.CreateReversalRequest{}); !errors.Is(err, models.ErrTransferNotReversible) {
+		t.Fatalf("reverse: got %v, want %v", err, models.ErrTransferNotReversible)
+	}
+}
+
+func TestStatementListsImportedHistory(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+
+	from := env.createAccount(t, "100.00")
+	to := env.createAccount(t, "0")
+	env.recordHistory(t, from, to, "30.00", time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC))
+	env.recordHistory(t, from, to, "12.50", time.Date(2024, 2, 10, 16, 0, 0, 0, time.UTC))
+
+	tests := []struct {
+		name    string
+		query   models.StatementQuery
+		closing string
+		// amount and balance cells of the transaction rows, in order
+		lines [][2]string
+	}{
+		{
+			name:    "since the history",
+			query:   models.StatementQuery{From: "2024-01-01"},
+			closing: "100.00",
+			lines:   [][2]string{{"-12.50", "memo"}, {"-30.00", "memo"}, {"100.00", "100.00"}},
+		},
+		{
+			name:    "history only",
+			query:   models.StatementQuery{From: "2024-03-01", To: "2024-04-01"},
+			closing: "0.00",
+			lines:   [][2]string{{"-30.00", "memo"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt, err := env.accounts.GetStatement(ctx, from.ID, tt.query)
+			if err != nil {
+				t.Fatalf("statement: %v", err)
+			}
+
+			// The balance loaded with the account includes the history, so
+			// the imported lines are memos that the balances leave out
+			var buf bytes.Buffer
+			err = env.accounts.ReadStatement(ctx, stmt, func(each func(fn func(*models.Transaction) error) error) error {
+				return statement.Write(ctx, &buf, stmt, each)
+			})
+			if err != nil {
+				t.Fatalf("write statement: %v", err)
+			}
+			rows, err := csv.NewReader(&buf).ReadAll()
+			if err != nil {
+				t.Fatalf("read statement: %v", err)
+			}
+
+			var lines [][2]string
+			for _, row := range rows[2 : len(rows)-1] {
+				lines = append(lines, [2]string{row[5], row[7]})
+			}
+			if !slices.Equal(lines, tt.lines) {
+				t.Fatalf("lines: got %v, want %v", lines, tt.lines)
+			}
+			if closing := rows[len(rows)-1][7]; closing != tt.closing {
+				t.Fatalf("closing balance: got %s, want %s", closing, tt.closing)
+			}
+		})
+	}
+}
+
+func TestHistoricalTransfersSkipLimits(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+	env.transfers.limits = VelocityLimits{MaxPerHour: 1}
+
+	from := env.createAccount(t, "100.00")
+	to := env.createAccount(t, "0")
+	yesterday := time.Now().Add(-24 * time.Hour)
+	for range 3 {
+		env.recordHistory(t, from, to, "500.00", yesterday)
+	}
+
+	// History is recorded even when the account can no longer take part
+	if _, err := env.accounts.ChangeStatus(ctx, to.ID, models.AccountActionFreeze, models.AccountStatusRequest{Reason: models.AccountReasonSuspectedFraud}); err != nil {
+		t.Fatalf("freeze: %v", err)
+	}
+	env.recordHistory(t, from, to, "1.00", yesterday)
+	if _, err := env.accounts.ChangeStatus(ctx, to.ID, models.AccountActionUnfreeze, models.AccountStatusRequest{Reason: models.AccountReasonSuspectedFraud}); err != nil {
+		t.Fatalf("unfreeze: %v", err)
+	}
+
+	// None of it counts towards the hourly limit
+	req := models.CreateTransferRequest{FromAccountNumber: from.AccountNumber, ToAccountNumber: to.AccountNumber, Amount: "10.00"}
+	if _, err := env.transfers.CreateTransfer(ctx, req); err != nil {
+		t.Fatalf("first live transfer: %v", err)
+	}
+	if _, err := env.transfers.CreateTransfer(ctx, req); !errors.Is(err, models.ErrTransferRateExceeded) {
+		t.Fatalf("second live transfer: got %v, want %v", err, models.ErrTransferRateExceeded)
+	}
+	if balance := env.balance(t, from.ID); balance != 9000 {
+		t.Fatalf("source balance: got %d, want 9000", balance)
+	}
+}
+
+func TestHistoricalTransferValidation(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+
+	from := env.createAccount(t, "100.00")
+	to := env.createAccount(t, "0")
+
+	tests := []struct {
+		name       string
+		occurredAt time.Time
+		to         string
+		err        error
+	}{
+		{"in the future", time.Now().Add(time.Hour), to.AccountNumber, models.ErrOccurredInFuture},
+		{"missing date", time.Time{}, to.AccountNumber, models.ErrOccurredInFuture},
+		{"same account", time.Now().Add(-time.Hour), from.AccountNumber, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := models.HistoricalTransferRequest{
+				FromAccountNumber: from.AccountNumber,
+				ToAccountNumber:   tt.to,
+				Amount:            "10.00",
+				OccurredAt:        tt.occurredAt,
+			}
+			err := env.transfers.ValidateHistoricalTransfer(ctx, req)
+			if err == nil || (tt.err != nil && !errors.Is(err, tt.err)) {
+				t.Fatalf("validate: got %v, want %v", err, tt.err)
+			}
+			if _, err := env.transfers.RecordHistoricalTransfer(ctx, req); err == nil {
+				t.Fatal("record: got no error")
+			}
+		})
+	}
+}
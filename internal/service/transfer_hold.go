@@ -0,0 +1,249 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tribal/bank-api/internal/auth"
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/internal/repository"
+	"github.com/tribal/bank-api/pkg/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// DefaultHoldTTL is how long an authorized transfer waits to be captured
+	// before its hold is released
+	DefaultHoldTTL = 7 * 24 * time.Hour
+
+	holdExpiryBatch = 50
+
+	// Outcomes of a hold, for the bank_transfer_holds_total metric
+	holdAuthorized = "authorized"
+	holdCaptured   = "captured"
+	holdVoided     = "voided"
+	holdExpired    = "expired"
+)
+
+// CaptureTransfer completes an authorized transfer: the hold on the source
+// account is turned into the debit and the destination is credited. The
+// returned transfer is completed, or still pending if accounts-api could not
+// be reached. Captures that fail release the hold and are returned as an
+// error.
+func (s *TransferService) CaptureTransfer(ctx context.Context, id uint) (*models.Transfer, error) {
+	ctx, span := transferTracer.Start(ctx, "TransferService.CaptureTransfer")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int("transfer.id", int(id)))
+
+	transfer, err := s.settleAuthorization(ctx, id, captureAuthorization)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.String("transfer.status", string(transfer.Status)))
+
+	if transfer.Status == models.TransferStatusFailed {
+		err := fmt.Errorf("transfer %d %s: %s", transfer.ID, transfer.Status, transfer.FailureReason)
+		// Keep the domain error accounts-api rejected the capture with
+		if cause := models.ErrorFromCode(transfer.FailureCode); cause != nil {
+			err = fmt.Errorf("%w: %w", cause, err)
+		}
+		return nil, err
+	}
+
+	s.attachAccounts(ctx, transfer)
+
+	return transfer, nil
+}
+
+// VoidTransfer cancels an authorized transfer and releases its hold, giving
+// the amount back to the available balance of the source account
+func (s *TransferService) VoidTransfer(ctx context.Context, id uint) (*models.Transfer, error) {
+	ctx, span := transferTracer.Start(ctx, "TransferService.VoidTransfer")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int("transfer.id", int(id)))
+
+	transfer, err := s.settleAuthorization(ctx, id, voidAuthorization)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	telemetry.RecordTransferHold(holdVoided, transfer.Amount)
+	s.attachAccounts(ctx, transfer)
+
+	return transfer, nil
+}
+
+// captureAuthorization settles an authorized transfer whose hold has not
+// expired for capture
+func captureAuthorization(transfer *models.Transfer, now time.Time) (string, error) {
+	if transfer.HoldExpiresAt != nil && now.After(*transfer.HoldExpiresAt) {
+		return "", fmt.Errorf("%w: transfer %d expired at %s", models.ErrHoldExpired, transfer.ID, transfer.HoldExpiresAt.Format(time.RFC3339))
+	}
+	transfer.Status = models.TransferStatusPending
+	return sagaStepCapture, nil
+}
+
+// voidAuthorization settles an authorized transfer as voided
+func voidAuthorization(transfer *models.Transfer, now time.Time) (string, error) {
+	transfer.Status = models.TransferStatusVoided
+	return sagaStepRelease, nil
+}
+
+// settleAuthorization moves an authorized transfer out of that status with
+// settle, which sets the new status and returns the saga step that follows,
+// and runs the saga
+func (s *TransferService) settleAuthorization(ctx context.Context, id uint, settle func(transfer *models.Transfer, now time.Time) (string, error)) (*models.Transfer, error) {
+	if err := auth.Authorize(ctx, auth.PermTransfersCreate); err != nil {
+		return nil, err
+	}
+
+	// Ownership is checked before locking, as it may need accounts-api
+	transfer, err := s.repo.GetTransferByID(ctx, id)
+	if err != nil {
+		return nil, transferNotFound(err)
+	}
+	if err := s.authorizeTransferSource(ctx, transfer); err != nil {
+		return nil, err
+	}
+
+	err = s.repo.WithTransaction(ctx, func(tx repository.Store) error {
+		locked, err := tx.LockTransfer(ctx, id)
+		if err != nil {
+			return transferNotFound(err)
+		}
+		if locked.Status != models.TransferStatusAuthorized {
+			return fmt.Errorf("%w: transfer %d is %s", models.ErrTransferNotAuthorized, id, locked.Status)
+		}
+
+		before := *locked
+		now := time.Now()
+		step, err := settle(locked, now)
+		if err != nil {
+			return err
+		}
+		if err := tx.UpdateTransferStatus(ctx, locked); err != nil {
+			return err
+		}
+		if err := tx.CreateOutboxMessage(ctx, newSagaMessage(ctx, locked.ID, step, "", now)); err != nil {
+			return fmt.Errorf("failed to enqueue transfer: %w", err)
+		}
+		return recordAudit(ctx, tx, models.AuditTransferStatusChanged, models.AuditEntityTransfer, locked.ID, before, locked)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Steps that could not run now are left to the relay
+	if err := s.saga.Run(ctx, id); err != nil {
+		trace.SpanFromContext(ctx).RecordError(err)
+	}
+
+	transfer, err = s.repo.GetTransferByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transfer: %w", err)
+	}
+	return transfer, nil
+}
+
+// StartHoldExpiry expires stale authorizations until ctx is cancelled
+func (s *TransferService) StartHoldExpiry(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_ = s.ExpireHolds(ctx)
+		}
+	}
+}
+
+// ExpireHolds moves authorized transfers whose hold expired to expired and
+// releases their holds. Each transfer is locked and checked again before it
+// changes, so replicas expiring at the same time do not clash with each
+// other or with a capture.
+func (s *TransferService) ExpireHolds(ctx context.Context) error {
+	ctx, span := transferTracer.Start(ctx, "TransferService.ExpireHolds")
+	defer span.End()
+
+	now := time.Now()
+	transfers, err := s.repo.ListExpiredAuthorizations(ctx, now, holdExpiryBatch)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	expired := 0
+	for _, transfer := range transfers {
+		changed := false
+		err := s.repo.WithTransaction(ctx, func(tx repository.Store) error {
+			locked, err := tx.LockTransfer(ctx, transfer.ID)
+			if err != nil {
+				return err
+			}
+			if locked.Status != models.TransferStatusAuthorized || locked.HoldExpiresAt == nil || !now.After(*locked.HoldExpiresAt) {
+				return nil
+			}
+
+			before := *locked
+			locked.Status = models.TransferStatusExpired
+			if err := tx.UpdateTransferStatus(ctx, locked); err != nil {
+				return err
+			}
+			if err := tx.CreateOutboxMessage(ctx, newSagaMessage(ctx, locked.ID, sagaStepRelease, "", now)); err != nil {
+				return fmt.Errorf("failed to enqueue transfer: %w", err)
+			}
+			changed = true
+			return recordAudit(ctx, tx, models.AuditTransferStatusChanged, models.AuditEntityTransfer, locked.ID, before, locked)
+		})
+		if err != nil {
+			span.RecordError(err)
+			return fmt.Errorf("failed to expire transfer %d: %w", transfer.ID, err)
+		}
+		if !changed {
+			continue
+		}
+
+		expired++
+		telemetry.RecordTransferHold(holdExpired, transfer.Amount)
+		if err := s.saga.Run(ctx, transfer.ID); err != nil {
+			span.RecordError(err)
+		}
+	}
+
+	span.SetAttributes(attribute.Int("transfers.expired", expired))
+
+	return nil
+}
+
+// authorizeTransferSource checks that the caller may send from the source
+// account of a transfer. The account is only looked up for callers limited
+// to their own accounts.
+func (s *TransferService) authorizeTransferSource(ctx context.Context, transfer *models.Transfer) error {
+	if auth.Allowed(ctx, auth.PermTransfersCreate) == auth.ScopeAll {
+		return nil
+	}
+	account, err := s.accounts.GetAccount(ctx, transfer.FromAccountID)
+	if err != nil {
+		return fmt.Errorf("failed to get account: %w", err)
+	}
+	return auth.AuthorizeAccount(ctx, auth.PermTransfersCreate, account)
+}
+
+// transferNotFound maps a missing row to models.ErrTransferNotFound
+func transferNotFound(err error) error {
+	if errors.Is(err, repository.ErrNotFound) {
+		return models.ErrTransferNotFound
+	}
+	return err
+}
@@ -0,0 +1,207 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/pkg/money"
+)
+
+// authorize creates a transfer of amount that only holds it on the source
+// account
+func (e *testEnv) authorize(t *testing.T, from, to *models.Account, amount string) *models.Transfer {
+	t.Helper()
+	transfer, err := e.transfers.CreateTransfer(asSystem(), models.CreateTransferRequest{
+		FromAccountNumber: from.AccountNumber,
+		ToAccountNumber:   to.AccountNumber,
+		Amount:            money.Decimal(amount),
+		Hold:              true,
+	})
+	if err != nil {
+		t.Fatalf("authorize transfer: %v", err)
+	}
+	if transfer.Status != models.TransferStatusAuthorized {
+		t.Fatalf("status: got %s, want authorized", transfer.Status)
+	}
+	return transfer
+}
+
+// available returns the available balance of an account in minor units
+func (e *testEnv) available(t *testing.T, id uint) int64 {
+	t.Helper()
+	account, err := e.repo.GetAccountByID(asSystem(), id)
+	if err != nil {
+		t.Fatalf("get account %d: %v", id, err)
+	}
+	return account.AvailableBalance().Minor
+}
+
+// expireHolds makes the holds authorized from now on expire right away
+func (e *testEnv) expireHolds(t *testing.T) {
+	t.Helper()
+	ttl := e.transfers.holdTTL
+	e.transfers.holdTTL = time.Millisecond
+	t.Cleanup(func() { e.transfers.holdTTL = ttl })
+}
+
+func TestHoldReducesAvailableBalance(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+
+	from := env.createAccount(t, "100.00")
+	to := env.createAccount(t, "0")
+	transfer := env.authorize(t, from, to, "30.00")
+
+	if balance, available := env.balance(t, from.ID), env.available(t, from.ID); balance != 10000 || available != 7000 {
+		t.Fatalf("after authorizing: got balance %d and available %d, want 10000 and 7000", balance, available)
+	}
+	if balance := env.balance(t, to.ID); balance != 0 {
+		t.Fatalf("destination balance after authorizing: got %d, want 0", balance)
+	}
+
+	// The hold counts against later transfers
+	rejected, err := env.transfers.createTransfer(ctx, models.CreateTransferRequest{
+		FromAccountNumber: from.AccountNumber,
+		ToAccountNumber:   to.AccountNumber,
+		Amount:            money.Decimal("80.00"),
+	})
+	if err == nil || rejected.FailureCode != models.ErrorCode(models.ErrInsufficientBalance) {
+		t.Fatalf("transfer over the available balance: got %v, want it to fail for lack of funds", err)
+	}
+
+	captured, err := env.transfers.CaptureTransfer(ctx, transfer.ID)
+	if err != nil {
+		t.Fatalf("capture: %v", err)
+	}
+	if captured.Status != models.TransferStatusCompleted {
+		t.Fatalf("status after capture: got %s, want completed", captured.Status)
+	}
+	if balance, available := env.balance(t, from.ID), env.available(t, from.ID); balance != 7000 || available != 7000 {
+		t.Fatalf("after capture: got balance %d and available %d, want 7000 and 7000", balance, available)
+	}
+	if balance := env.balance(t, to.ID); balance != 3000 {
+		t.Fatalf("destination balance after capture: got %d, want 3000", balance)
+	}
+}
+
+func TestCaptureAfterHoldExpired(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+	env.expireHolds(t)
+
+	from := env.createAccount(t, "100.00")
+	to := env.createAccount(t, "0")
+	transfer := env.authorize(t, from, to, "30.00")
+	time.Sleep(5 * time.Millisecond)
+
+	_, err := env.transfers.CaptureTransfer(ctx, transfer.ID)
+	if !errors.Is(err, models.ErrHoldExpired) {
+		t.Fatalf("capture: got %v, want %v", err, models.ErrHoldExpired)
+	}
+
+	// Nothing moved; the hold is left for the expiry to release
+	if got := env.transfer(t, transfer.ID); got.Status != models.TransferStatusAuthorized {
+		t.Fatalf("status: got %s, want authorized", got.Status)
+	}
+	if balance, available := env.balance(t, from.ID), env.available(t, from.ID); balance != 10000 || available != 7000 {
+		t.Fatalf("source: got balance %d and available %d, want 10000 and 7000", balance, available)
+	}
+	if balance := env.balance(t, to.ID); balance != 0 {
+		t.Fatalf("destination balance: got %d, want 0", balance)
+	}
+}
+
+func TestVoidTwice(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+
+	from := env.createAccount(t, "100.00")
+	to := env.createAccount(t, "0")
+	transfer := env.authorize(t, from, to, "30.00")
+
+	voided, err := env.transfers.VoidTransfer(ctx, transfer.ID)
+	if err != nil {
+		t.Fatalf("void: %v", err)
+	}
+	if voided.Status != models.TransferStatusVoided {
+		t.Fatalf("status: got %s, want voided", voided.Status)
+	}
+	if available := env.available(t, from.ID); available != 10000 {
+		t.Fatalf("available after void: got %d, want 10000", available)
+	}
+
+	if _, err := env.transfers.VoidTransfer(ctx, transfer.ID); !errors.Is(err, models.ErrTransferNotAuthorized) {
+		t.Fatalf("second void: got %v, want %v", err, models.ErrTransferNotAuthorized)
+	}
+	if _, err := env.transfers.CaptureTransfer(ctx, transfer.ID); !errors.Is(err, models.ErrTransferNotAuthorized) {
+		t.Fatalf("capture after void: got %v, want %v", err, models.ErrTransferNotAuthorized)
+	}
+
+	if got := env.transfer(t, transfer.ID); got.Status != models.TransferStatusVoided {
+		t.Fatalf("status after the second void: got %s, want voided", got.Status)
+	}
+	if calls := env.accounts.callCount(opReleaseHold); calls != 1 {
+		t.Fatalf("hold releases: got %d, want 1", calls)
+	}
+	if balance, available := env.balance(t, from.ID), env.available(t, from.ID); balance != 10000 || available != 10000 {
+		t.Fatalf("source: got balance %d and available %d, want 10000 and 10000", balance, available)
+	}
+}
+
+func TestExpireHoldsMovesOnlyAuthorizedTransfers(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+
+	from := env.createAccount(t, "100.00")
+	to := env.createAccount(t, "0")
+
+	// Current is authorized with the default TTL; the others are past theirs
+	current := env.authorize(t, from, to, "10.00")
+	env.expireHolds(t)
+	stale := env.authorize(t, from, to, "20.00")
+	voided := env.authorize(t, from, to, "30.00")
+	if _, err := env.transfers.VoidTransfer(ctx, voided.ID); err != nil {
+		t.Fatalf("void: %v", err)
+	}
+	completed, err := env.transfers.CreateTransfer(ctx, models.CreateTransferRequest{
+		FromAccountNumber: from.AccountNumber,
+		ToAccountNumber:   to.AccountNumber,
+		Amount:            money.Decimal("5.00"),
+	})
+	if err != nil {
+		t.Fatalf("create transfer: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	for range 2 {
+		if err := env.transfers.ExpireHolds(ctx); err != nil {
+			t.Fatalf("expire holds: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		transfer *models.Transfer
+		status   models.TransferStatus
+	}{
+		{"current", current, models.TransferStatusAuthorized},
+		{"stale", stale, models.TransferStatusExpired},
+		{"voided", voided, models.TransferStatusVoided},
+		{"completed", completed, models.TransferStatusCompleted},
+	}
+	for _, tt := range tests {
+		if got := env.transfer(t, tt.transfer.ID); got.Status != tt.status {
+			t.Errorf("%s: got %s, want %s", tt.name, got.Status, tt.status)
+		}
+	}
+
+	// Only the hold of the current authorization is left
+	if balance, available := env.balance(t, from.ID), env.available(t, from.ID); balance != 9500 || available != 8500 {
+		t.Fatalf("source: got balance %d and available %d, want 9500 and 8500", balance, available)
+	}
+	if calls := env.accounts.callCount(opReleaseHold); calls != 2 {
+		t.Fatalf("hold releases: got %d, want one for the void and one for the expiry", calls)
+	}
+}
@@ -0,0 +1,240 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tribal/bank-api/internal/auth"
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/internal/repository"
+	"github.com/tribal/bank-api/internal/tier"
+	"github.com/tribal/bank-api/pkg/money"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// VelocityLimits caps the transfers each account can send. MaxPerHour counts
+// the transfers of the last hour and MaxDailyAmount sums, per currency of the
+// source account, the amounts debited in the last 24 hours. Zero values and
+// currencies without an entry are unlimited. Failed and compensated
+// transfers do not count.
+type VelocityLimits struct {
+	MaxPerHour     int
+	MaxDailyAmount map[money.Currency]money.Money
+}
+
+// ParseVelocityLimits reads the limits from their environment form: a count
+// of transfers per hour and a comma-separated list of daily amounts such as
+// "USD:10000.00,EUR:9000.00". Empty values leave the limit unset.
+func ParseVelocityLimits(maxPerHour, maxDailyAmount string) (VelocityLimits, error) {
+	var limits VelocityLimits
+	if maxPerHour != "" {
+		n, err := strconv.Atoi(maxPerHour)
+		if err != nil || n < 0 {
+			return limits, fmt.Errorf("invalid transfers per hour %q", maxPerHour)
+		}
+		limits.MaxPerHour = n
+	}
+
+	for _, item := range strings.Split(maxDailyAmount, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		code, amount, ok := strings.Cut(item, ":")
+		if !ok {
+			return limits, fmt.Errorf("invalid daily amount %q, want CURRENCY:AMOUNT", item)
+		}
+		currency, err := money.ParseCurrency(code)
+		if err != nil {
+			return limits, err
+		}
+		limit, err := money.Parse(amount, currency)
+		if err != nil {
+			return limits, fmt.Errorf("invalid daily amount for %s: %w", currency, err)
+		}
+		if limit.IsNegative() {
+			return limits, fmt.Errorf("invalid daily amount for %s: must not be negative", currency)
+		}
+		if limits.MaxDailyAmount == nil {
+			limits.MaxDailyAmount = make(map[money.Currency]money.Money)
+		}
+		limits.MaxDailyAmount[currency] = limit
+	}
+	return limits, nil
+}
+
+// checkVelocity rejects the transfer when it would exceed the limits of its
+// source account. It runs in the transaction that records the transfer and
+// locks the account's velocity first, so concurrent transfers are counted.
+func (s *TransferService) checkVelocity(ctx context.Context, tx repository.Store, transfer *models.Transfer) error {
+	maxDaily, limitDaily := s.limits.MaxDailyAmount[transfer.Amount.Currency]
+	limitDaily = limitDaily && maxDaily.IsPositive()
+	if s.limits.MaxPerHour <= 0 && !limitDaily {
+		return nil
+	}
+
+	if err := tx.LockTransferVelocity(ctx, transfer.FromAccountID); err != nil {
+		return fmt.Errorf("failed to lock transfer velocity: %w", err)
+	}
+
+	now := time.Now()
+	if s.limits.MaxPerHour > 0 {
+		velocity, err := tx.GetTransferVelocity(ctx, transfer.FromAccountID, now.Add(-time.Hour))
+		if err != nil {
+			return fmt.Errorf("failed to get transfer velocity: %w", err)
+		}
+		if velocity.Count >= int64(s.limits.MaxPerHour) {
+			return fmt.Errorf("%w: limit is %d", models.ErrTransferRateExceeded, s.limits.MaxPerHour)
+		}
+	}
+
+	if limitDaily {
+		velocity, err := tx.GetTransferVelocity(ctx, transfer.FromAccountID, now.Add(-24*time.Hour))
+		if err != nil {
+			return fmt.Errorf("failed to get transfer velocity: %w", err)
+		}
+		sent := money.New(velocity.AmountMinor, transfer.Amount.Currency)
+		total, err := sent.Add(transfer.Amount)
+		if err != nil {
+			return err
+		}
+		if total.Minor > maxDaily.Minor {
+			return fmt.Errorf("%w: %s %s sent in the last 24 hours, limit is %s %s",
+				models.ErrDailyAmountExceeded, sent, sent.Currency, maxDaily, maxDaily.Currency)
+		}
+	}
+	return nil
+}
+
+// tierLimits returns the limits of the account's tier for its currency.
+// Accounts read from an accounts-api without tiers are in the default tier.
+func (s *TransferService) tierLimits(account *models.Account) (tier.Limits, error) {
+	name, err := s.tiers.Resolve(account.Tier)
+	if err != nil {
+		return tier.Limits{}, err
+	}
+	return s.tiers.Limits(name, account.Currency())
+}
+
+// checkTransactionLimits rejects amounts outside the per-transaction range
+// of the tier
+func checkTransactionLimits(amount money.Money, limits tier.Limits) error {
+	if amount.Minor < limits.MinPerTransaction.Minor {
+		return fmt.Errorf("%w: minimum is %s %s", models.ErrTransferAmountRange, limits.MinPerTransaction, amount.Currency)
+	}
+	if !limits.MaxPerTransaction.IsZero() && amount.Minor > limits.MaxPerTransaction.Minor {
+		return fmt.Errorf("%w: maximum is %s %s", models.ErrTransferAmountRange, limits.MaxPerTransaction, amount.Currency)
+	}
+	return nil
+}
+
+// checkTierLimits rejects the transfer when, added to what the source account
+// sent in the last day or month, it would exceed the rolling limits of its
+// tier. Like checkVelocity it runs under the account's velocity lock.
+func checkTierLimits(ctx context.Context, tx repository.Store, transfer *models.Transfer, limits tier.Limits) error {
+	if limits.Daily.IsZero() && limits.Monthly.IsZero() {
+		return nil
+	}
+	if err := tx.LockTransferVelocity(ctx, transfer.FromAccountID); err != nil {
+		return fmt.Errorf("failed to lock transfer velocity: %w", err)
+	}
+
+	now := time.Now()
+	for _, window := range []struct {
+		name   string
+		limit  money.Money
+		length time.Duration
+	}{
+		{"daily", limits.Daily, tier.DailyWindow},
+		{"monthly", limits.Monthly, tier.MonthlyWindow},
+	} {
+		if window.limit.IsZero() {
+			continue
+		}
+		velocity, err := tx.GetTransferVelocity(ctx, transfer.FromAccountID, now.Add(-window.length))
+		if err != nil {
+			return fmt.Errorf("failed to get transfer velocity: %w", err)
+		}
+		if velocity.AmountMinor+transfer.Amount.Minor > window.limit.Minor {
+			remaining := money.New(max(window.limit.Minor-velocity.AmountMinor, 0), window.limit.Currency)
+			return fmt.Errorf("%w: %s limit is %s %s, %s %s left",
+				models.ErrTierLimitExceeded, window.name, window.limit, window.limit.Currency, remaining, remaining.Currency)
+		}
+	}
+	return nil
+}
+
+// GetAccountLimits returns the tier limits of an account and how much of the
+// daily and monthly ones it has used
+func (s *TransferService) GetAccountLimits(ctx context.Context, accountID uint) (*models.AccountLimits, error) {
+	ctx, span := transferTracer.Start(ctx, "TransferService.GetAccountLimits")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int("account.id", int(accountID)))
+
+	if err := auth.Authorize(ctx, auth.PermAccountsRead); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	account, err := s.accounts.GetAccount(ctx, accountID)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to get account: %w", err)
+	}
+	if err := auth.AuthorizeAccount(ctx, auth.PermAccountsRead, account); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	name, err := s.tiers.Resolve(account.Tier)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	limits, err := s.tiers.Limits(name, account.Currency())
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	span.SetAttributes(attribute.String("account.tier", name))
+
+	result := &models.AccountLimits{AccountID: account.ID, AccountNumber: account.AccountNumber, Tier: name}
+	if !limits.MinPerTransaction.IsZero() {
+		result.MinPerTransaction = &limits.MinPerTransaction
+	}
+	if !limits.MaxPerTransaction.IsZero() {
+		result.MaxPerTransaction = &limits.MaxPerTransaction
+	}
+
+	now := time.Now()
+	usage := func(limit money.Money, window time.Duration, label string) (*models.LimitUsage, error) {
+		if limit.IsZero() {
+			return nil, nil
+		}
+		velocity, err := s.repo.GetTransferVelocity(ctx, account.ID, now.Add(-window))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get transfer velocity: %w", err)
+		}
+		used := money.New(velocity.AmountMinor, limit.Currency)
+		return &models.LimitUsage{
+			Window:    label,
+			Limit:     limit,
+			Used:      used,
+			Remaining: money.New(max(limit.Minor-used.Minor, 0), limit.Currency),
+		}, nil
+	}
+	if result.Daily, err = usage(limits.Daily, tier.DailyWindow, "24h"); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	if result.Monthly, err = usage(limits.Monthly, tier.MonthlyWindow, "30d"); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	return result, nil
+}
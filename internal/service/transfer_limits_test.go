@@ -0,0 +1,130 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/pkg/money"
+)
+
+// createBasicAccount opens a USD account in the basic tier of the default
+// catalog: 1.00 to 1000.00 per transfer, 2000.00 a day and 10000.00 a month
+func (e *testEnv) createBasicAccount(t *testing.T, balance string) *models.Account {
+	t.Helper()
+	account, err := e.accounts.CreateAccount(asSystem(), models.CreateAccountRequest{
+		AccountNumber:  fmt.Sprintf("ACC-%d-%d", time.Now().UnixNano(), accountSeq.Add(1)),
+		Currency:       "USD",
+		InitialBalance: money.Decimal(balance),
+		Tier:           "basic",
+	})
+	if err != nil {
+		t.Fatalf("create basic account: %v", err)
+	}
+	return account
+}
+
+// send creates a transfer and returns it with the error CreateTransfer
+// returned
+func (e *testEnv) send(from, to *models.Account, amount string, hold bool) (*models.Transfer, error) {
+	return e.transfers.CreateTransfer(asSystem(), models.CreateTransferRequest{
+		FromAccountNumber: from.AccountNumber,
+		ToAccountNumber:   to.AccountNumber,
+		Amount:            money.Decimal(amount),
+		Hold:              hold,
+	})
+}
+
+func TestTierPerTransactionLimits(t *testing.T) {
+	env := newTestEnv(t)
+	from := env.createBasicAccount(t, "5000.00")
+	to := env.createAccount(t, "0")
+
+	for _, amount := range []string{"0.99", "1000.01"} {
+		if _, err := env.send(from, to, amount, false); !errors.Is(err, models.ErrTransferAmountRange) {
+			t.Errorf("sending %s: got %v, want ErrTransferAmountRange", amount, err)
+		}
+	}
+	for _, amount := range []string{"1.00", "1000.00"} {
+		if _, err := env.send(from, to, amount, false); err != nil {
+			t.Errorf("sending %s: %v", amount, err)
+		}
+	}
+	if balance := env.balance(t, to.ID); balance != 100100 {
+		t.Errorf("destination balance: got %d, want 100100", balance)
+	}
+}
+
+func TestTierDailyLimitCountsLiveTransfers(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+	from := env.createBasicAccount(t, "5000.00")
+	to := env.createAccount(t, "0")
+
+	// A voided authorization and a compensated transfer sent nothing
+	authorized := env.authorize(t, from, to, "1000.00")
+	if _, err := env.transfers.VoidTransfer(ctx, authorized.ID); err != nil {
+		t.Fatalf("void: %v", err)
+	}
+	env.accounts.setFail(func(op string, accountID uint, key string) error {
+		if strings.HasSuffix(key, ":"+sagaStepCredit) {
+			return fmt.Errorf("%w: account %d", models.ErrAccountFrozen, accountID)
+		}
+		return nil
+	})
+	compensated, _ := env.transfers.createTransfer(ctx, models.CreateTransferRequest{
+		FromAccountNumber: from.AccountNumber,
+		ToAccountNumber:   to.AccountNumber,
+		Amount:            money.Decimal("1000.00"),
+	})
+	env.accounts.setFail(nil)
+	if compensated == nil || env.transfer(t, compensated.ID).Status != models.TransferStatusCompensated {
+		t.Fatalf("transfer: got %v, want it compensated", compensated)
+	}
+
+	for _, amount := range []string{"1000.00", "900.00"} {
+		if _, err := env.send(from, to, amount, false); err != nil {
+			t.Fatalf("sending %s: %v", amount, err)
+		}
+	}
+	// 1900.00 sent, so 200.00 would exceed the 2000.00 of a day
+	if _, err := env.send(from, to, "200.00", false); !errors.Is(err, models.ErrTierLimitExceeded) {
+		t.Fatalf("sending past the daily limit: got %v, want ErrTierLimitExceeded", err)
+	}
+	// An authorized transfer holds its amount against the limit
+	env.authorize(t, from, to, "100.00")
+	if _, err := env.send(from, to, "1.00", false); !errors.Is(err, models.ErrTierLimitExceeded) {
+		t.Fatalf("sending with the daily limit used up: got %v, want ErrTierLimitExceeded", err)
+	}
+
+	limits, err := env.transfers.GetAccountLimits(ctx, from.ID)
+	if err != nil {
+		t.Fatalf("get limits: %v", err)
+	}
+	if limits.Tier != "basic" || limits.MinPerTransaction == nil || *limits.MinPerTransaction != money.New(100, "USD") ||
+		limits.MaxPerTransaction == nil || *limits.MaxPerTransaction != money.New(100000, "USD") {
+		t.Errorf("limits: got tier %q from %v to %v, want basic from 1.00 to 1000.00", limits.Tier, limits.MinPerTransaction, limits.MaxPerTransaction)
+	}
+	usage := []struct {
+		name  string
+		got   *models.LimitUsage
+		limit int64
+		used  int64
+	}{
+		{"daily", limits.Daily, 200000, 200000},
+		{"monthly", limits.Monthly, 1000000, 200000},
+	}
+	for _, u := range usage {
+		if u.got == nil {
+			t.Errorf("%s usage: got none, want %d used of %d", u.name, u.used, u.limit)
+			continue
+		}
+		if u.got.Limit.Minor != u.limit || u.got.Used.Minor != u.used || u.got.Remaining.Minor != u.limit-u.used {
+			t.Errorf("%s usage: got %s used of %s with %s left, want %d of %d",
+				u.name, u.got.Used, u.got.Limit, u.got.Remaining, u.used, u.limit)
+		}
+	}
+}
@@ -0,0 +1,347 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/tribal/bank-api/internal/auth"
+	"github.com/tribal/bank-api/internal/fx"
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/internal/repository"
+	"github.com/tribal/bank-api/pkg/money"
+	"github.com/tribal/bank-api/pkg/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	reversalAggregate = "transfer_reversal"
+
+	// Reversal steps: take the money back from the destination, refund the
+	// source and, if the refund is rejected, return it to the destination
+	reversalStepDebit      = "reversal.debit"
+	reversalStepCredit     = "reversal.credit"
+	reversalStepCompensate = "reversal.compensate"
+)
+
+// ReverseTransfer undoes all or part of a completed transfer. The amount is
+// expressed in the source currency and defaults to what is left to reverse;
+// the total reversed can never exceed the original amount. Cross-currency
+// transfers are reversed at their original rate. The returned reversal is
+// completed, or still pending if accounts-api could not be reached.
+func (s *TransferService) ReverseTransfer(ctx context.Context, transferID uint, req models.CreateReversalRequest) (*models.TransferReversal, error) {
+	ctx, span := transferTracer.Start(ctx, "TransferService.ReverseTransfer")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("transfer.id", int(transferID)),
+		attribute.String("reversal.amount", string(req.Amount)),
+	)
+
+	if err := auth.Authorize(ctx, auth.PermTransfersReverse); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	return s.reverseTransfer(ctx, transferID, req)
+}
+
+// reverseTransfer is ReverseTransfer without the permission check, for
+// compensating batches undoing their own transfers. It records errors on the
+// span of ctx.
+func (s *TransferService) reverseTransfer(ctx context.Context, transferID uint, req models.CreateReversalRequest) (*models.TransferReversal, error) {
+	span := trace.SpanFromContext(ctx)
+
+	transfer, err := s.repo.GetTransferByID(ctx, transferID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			err = models.ErrTransferNotFound
+		}
+		span.RecordError(err)
+		return nil, err
+	}
+	if transfer.Status != models.TransferStatusCompleted {
+		err := fmt.Errorf("%w: transfer %d is %s", models.ErrTransferNotReversible, transfer.ID, transfer.Status)
+		span.RecordError(err)
+		return nil, err
+	}
+	if transfer.OccurredAt != nil {
+		err := fmt.Errorf("%w: transfer %d is historical and moved no money", models.ErrTransferNotReversible, transfer.ID)
+		span.RecordError(err)
+		return nil, err
+	}
+
+	reversal, err := s.prepareReversal(transfer, req)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	// Reserve the amount, record the reversal and its first step atomically
+	err = s.repo.WithTransaction(ctx, func(tx repository.Store) error {
+		before, err := tx.LockTransfer(ctx, transfer.ID)
+		if err != nil {
+			return err
+		}
+		if err := tx.ReserveTransferReversal(ctx, transfer, reversal.Amount, reversal.CreditAmount); err != nil {
+			return err
+		}
+		if err := tx.CreateReversal(ctx, reversal); err != nil {
+			return fmt.Errorf("failed to create reversal record: %w", err)
+		}
+		if err := tx.CreateOutboxMessage(ctx, newOutboxMessage(ctx, reversalAggregate, reversal.ID, reversalStepDebit, "", time.Now())); err != nil {
+			return fmt.Errorf("failed to enqueue reversal: %w", err)
+		}
+		if err := recordAudit(ctx, tx, models.AuditReversalCreated, models.AuditEntityReversal, reversal.ID, nil, reversal); err != nil {
+			return err
+		}
+		return auditTransferReversals(ctx, tx, before)
+	})
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("reversal.id", int(reversal.ID)))
+
+	if err := s.saga.RunReversal(ctx, reversal.ID); err != nil {
+		span.RecordError(err)
+	}
+
+	reversal, err = s.repo.GetReversalByID(ctx, reversal.ID)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to get reversal: %w", err)
+	}
+
+	span.SetAttributes(attribute.String("reversal.status", string(reversal.Status)))
+
+	if reversal.Status == models.ReversalStatusFailed {
+		return nil, fmt.Errorf("%w: reversal %d of transfer %d: %s", models.ErrReversalFailed, reversal.ID, transfer.ID, reversal.FailureReason)
+	}
+
+	return reversal, nil
+}
+
+// prepareReversal validates the requested amount against what is left to
+// reverse and computes the amount to take back from the destination
+func (s *TransferService) prepareReversal(transfer *models.Transfer, req models.CreateReversalRequest) (*models.TransferReversal, error) {
+	remaining, err := transfer.Amount.Sub(transfer.ReversedAmount)
+	if err != nil {
+		return nil, err
+	}
+	remainingCredit, err := transfer.CreditAmount.Sub(transfer.ReversedCreditAmount)
+	if err != nil {
+		return nil, err
+	}
+
+	amount := remaining
+	if req.Amount != "" {
+		if amount, err = req.Amount.Money(transfer.Amount.Currency); err != nil {
+			return nil, fmt.Errorf("invalid amount: %w", err)
+		}
+	}
+	if !amount.IsPositive() {
+		return nil, fmt.Errorf("%w: amount must be greater than zero", money.ErrInvalidAmount)
+	}
+	if cmp, _ := amount.Cmp(remaining); cmp > 0 {
+		return nil, fmt.Errorf("%w: %s %s requested, %s %s left", models.ErrReversalExceedsAmount,
+			amount, amount.Currency, remaining, remaining.Currency)
+	}
+
+	// The last reversal takes back exactly what is left so rounding never
+	// strands a minor unit on the destination
+	credit := remainingCredit
+	if amount != remaining {
+		if credit, err = reversalCredit(transfer, amount); err != nil {
+			return nil, err
+		}
+	}
+
+	return &models.TransferReversal{
+		TransferID:   transfer.ID,
+		Amount:       amount,
+		CreditAmount: credit,
+		Status:       models.ReversalStatusPending,
+		Reason:       req.Reason,
+	}, nil
+}
+
+// reversalCredit converts part of a transfer's amount into the destination
+// currency at the rate the transfer was executed with
+func reversalCredit(transfer *models.Transfer, amount money.Money) (money.Money, error) {
+	if transfer.FXRate == "" {
+		return amount, nil
+	}
+	value, ok := new(big.Rat).SetString(transfer.FXRate)
+	if !ok {
+		return money.Money{}, fmt.Errorf("%w: %q", fx.ErrInvalidRate, transfer.FXRate)
+	}
+	return fx.Convert(amount, fx.Rate{From: transfer.Amount.Currency, To: transfer.CreditAmount.Currency, Value: value})
+}
+
+// RunReversal drives the saga of one reversal as far as it can go right now
+func (s *TransferSaga) RunReversal(ctx context.Context, reversalID uint) error {
+	return s.run(ctx, reversalAggregate, reversalID)
+}
+
+// handleReversal executes a step of a reversal
+func (s *TransferSaga) handleReversal(ctx context.Context, msg *models.OutboxMessage) (bool, error) {
+	ctx, span := transferTracer.Start(ctx, "TransferSaga."+msg.Type)
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("reversal.id", int(msg.AggregateID)),
+		attribute.Int("outbox.id", int(msg.ID)),
+		attribute.Int("outbox.attempt", msg.Attempts+1),
+	)
+
+	reversal, err := s.repo.GetReversalByID(ctx, msg.AggregateID)
+	if err != nil {
+		span.RecordError(err)
+		return false, fmt.Errorf("failed to load reversal %d: %w", msg.AggregateID, err)
+	}
+	transfer, err := s.repo.GetTransferByID(ctx, reversal.TransferID)
+	if err != nil {
+		span.RecordError(err)
+		return false, fmt.Errorf("failed to load transfer %d: %w", reversal.TransferID, err)
+	}
+
+	span.SetAttributes(attribute.Int("transfer.id", int(transfer.ID)))
+
+	// Reversal transactions keep the reference of the original transfer
+	reference := fmt.Sprintf("TRF-%d", transfer.ID)
+	entry := models.AccountEntry{
+		Key:       fmt.Sprintf("%s:%s:%d", reference, msg.Type, reversal.ID),
+		Type:      models.TransactionTypeReversal,
+		Reference: reference,
+	}
+
+	var accountID uint
+	switch msg.Type {
+	case reversalStepDebit:
+		accountID = transfer.ToAccountID
+		entry.Amount = reversal.CreditAmount.Neg()
+		entry.Description = fmt.Sprintf("Reversal of transfer from %s", transfer.FromAccountNumber)
+	case reversalStepCredit:
+		accountID = transfer.FromAccountID
+		entry.Amount = reversal.Amount
+		entry.Description = fmt.Sprintf("Reversal of transfer to %s", transfer.ToAccountNumber)
+	case reversalStepCompensate:
+		accountID = transfer.ToAccountID
+		entry.Amount = reversal.CreditAmount
+		entry.Description = "Refund of failed reversal"
+		entry.Refund = true
+	default:
+		err := fmt.Errorf("unknown reversal step %q", msg.Type)
+		span.RecordError(err)
+		return s.dropStep(ctx, msg, err)
+	}
+
+	_, stepErr := s.accounts.PostEntry(ctx, accountID, entry)
+	if stepErr != nil {
+		span.RecordError(stepErr)
+	}
+
+	// Same retry policy as transfers: only domain errors are final
+	if stepErr != nil && models.ErrorCode(stepErr) == "" {
+		return false, s.retry(ctx, msg, stepErr)
+	}
+
+	now := s.now()
+	reversalBefore := *reversal
+	dead := false
+	err = s.repo.WithTransaction(ctx, func(tx repository.Store) error {
+		// Serialize with other reversals of the transfer, so the status derived
+		// from the completed ones counts every reversal that committed before
+		transferBefore, err := tx.LockTransfer(ctx, transfer.ID)
+		if err != nil {
+			return err
+		}
+		if err := tx.MarkOutboxMessageProcessed(ctx, msg, now); err != nil {
+			return err
+		}
+
+		switch {
+		case msg.Type == reversalStepDebit && stepErr == nil:
+			return tx.CreateOutboxMessage(ctx, newOutboxMessage(ctx, reversalAggregate, reversal.ID, reversalStepCredit, "", now))
+
+		case msg.Type == reversalStepDebit:
+			reversal.Status = models.ReversalStatusFailed
+			reversal.FailureReason = stepErr.Error()
+			if err := tx.ReleaseTransferReversal(ctx, reversal); err != nil {
+				return err
+			}
+
+		case msg.Type == reversalStepCredit && stepErr == nil:
+			reversal.Status = models.ReversalStatusCompleted
+
+		case msg.Type == reversalStepCredit:
+			// The destination was already debited and must be refunded
+			reversal.FailureReason = stepErr.Error()
+			if err := tx.CreateOutboxMessage(ctx, newOutboxMessage(ctx, reversalAggregate, reversal.ID, reversalStepCompensate, stepErr.Error(), now)); err != nil {
+				return err
+			}
+
+		case msg.Type == reversalStepCompensate && stepErr == nil:
+			reversal.Status = models.ReversalStatusFailed
+			if err := tx.ReleaseTransferReversal(ctx, reversal); err != nil {
+				return err
+			}
+
+		default:
+			// A refund that is rejected needs manual intervention
+			dead = true
+			if err := tx.MarkOutboxMessageDead(ctx, msg, stepErr.Error()); err != nil {
+				return err
+			}
+			return flagSagaForAttention(ctx, tx, msg, fmt.Sprintf("%s rejected: %s", msg.Type, stepErr), "")
+		}
+
+		if err := tx.UpdateReversalStatus(ctx, reversal); err != nil {
+			return err
+		}
+		if err := recordAudit(ctx, tx, models.AuditReversalStatusChanged, models.AuditEntityReversal, reversal.ID, &reversalBefore, reversal); err != nil {
+			return err
+		}
+		if err := tx.UpdateTransferReversalStatus(ctx, transfer.ID); err != nil {
+			return err
+		}
+		return auditTransferReversals(ctx, tx, transferBefore)
+	})
+	if err != nil {
+		span.RecordError(err)
+		return false, fmt.Errorf("failed to record reversal step: %w", err)
+	}
+
+	if dead {
+		telemetry.RecordSagaStepDead(msg.Type)
+		span.SetAttributes(attribute.String("reversal.status", string(models.ReversalStatusNeedsAttention)))
+		return true, nil
+	}
+
+	span.SetAttributes(attribute.String("reversal.status", string(reversal.Status)))
+
+	full := reversal.Amount == transfer.Amount
+	switch reversal.Status {
+	case models.ReversalStatusCompleted:
+		telemetry.RecordTransferReversal(reversal.Amount, full, true)
+	case models.ReversalStatusFailed:
+		telemetry.RecordTransferReversal(reversal.Amount, full, false)
+	}
+
+	return true, nil
+}
+
+// auditTransferReversals records how the reversed amounts and reversal
+// status of a transfer changed within tx, given its state before
+func auditTransferReversals(ctx context.Context, tx repository.Store, before *models.Transfer) error {
+	after, err := tx.LockTransfer(ctx, before.ID)
+	if err != nil {
+		return err
+	}
+	return recordAudit(ctx, tx, models.AuditTransferReversalsChanged, models.AuditEntityTransfer, before.ID, before, after)
+}
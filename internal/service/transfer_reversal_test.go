@@ -0,0 +1,212 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tribal/bank-api/internal/fx"
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/internal/tier"
+	"github.com/tribal/bank-api/pkg/money"
+)
+
+// createAccountIn opens an account in currency with the given initial
+// balance
+func (e *testEnv) createAccountIn(t *testing.T, currency, balance string) *models.Account {
+	t.Helper()
+	account, err := e.accounts.CreateAccount(asSystem(), models.CreateAccountRequest{
+		AccountNumber:  fmt.Sprintf("ACC-%d-%d", time.Now().UnixNano(), accountSeq.Add(1)),
+		Currency:       currency,
+		InitialBalance: money.Decimal(balance),
+	})
+	if err != nil {
+		t.Fatalf("create %s account: %v", currency, err)
+	}
+	return account
+}
+
+// completedTransfer moves amount between two accounts and fails the test
+// unless the transfer completes
+func (e *testEnv) completedTransfer(t *testing.T, from, to *models.Account, amount string) *models.Transfer {
+	t.Helper()
+	transfer, err := e.transfers.CreateTransfer(asSystem(), models.CreateTransferRequest{
+		FromAccountNumber: from.AccountNumber,
+		ToAccountNumber:   to.AccountNumber,
+		Amount:            money.Decimal(amount),
+	})
+	if err != nil || transfer.Status != models.TransferStatusCompleted {
+		t.Fatalf("transfer: got %v, want it completed", err)
+	}
+	return transfer
+}
+
+func TestPartialReversal(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+
+	from := env.createAccount(t, "100.00")
+	to := env.createAccount(t, "0")
+	transfer := env.completedTransfer(t, from, to, "40.00")
+
+	reversal, err := env.transfers.ReverseTransfer(ctx, transfer.ID, models.CreateReversalRequest{Amount: "15.00", Reason: "partial refund"})
+	if err != nil {
+		t.Fatalf("reverse: %v", err)
+	}
+	if reversal.Status != models.ReversalStatusCompleted || reversal.Amount != money.New(1500, "USD") || reversal.CreditAmount != money.New(1500, "USD") {
+		t.Fatalf("reversal: got %s of %s/%s, want completed of 15.00/15.00", reversal.Status, reversal.Amount, reversal.CreditAmount)
+	}
+	if balance := env.balance(t, from.ID); balance != 7500 {
+		t.Errorf("source balance: got %d, want 7500", balance)
+	}
+	if balance := env.balance(t, to.ID); balance != 2500 {
+		t.Errorf("destination balance: got %d, want 2500", balance)
+	}
+	got := env.transfer(t, transfer.ID)
+	if got.ReversalStatus != models.TransferPartiallyReversed || got.ReversedAmount != money.New(1500, "USD") {
+		t.Fatalf("transfer: got %q with %s reversed, want partially_reversed with 15.00", got.ReversalStatus, got.ReversedAmount)
+	}
+
+	// Without an amount the rest is reversed
+	reversal, err = env.transfers.ReverseTransfer(ctx, transfer.ID, models.CreateReversalRequest{})
+	if err != nil {
+		t.Fatalf("reverse the rest: %v", err)
+	}
+	if reversal.Amount != money.New(2500, "USD") {
+		t.Fatalf("second reversal: got %s, want the 25.00 left", reversal.Amount)
+	}
+	if balance := env.balance(t, from.ID); balance != 10000 {
+		t.Errorf("source balance after reversing everything: got %d, want 10000", balance)
+	}
+	if got := env.transfer(t, transfer.ID); got.ReversalStatus != models.TransferReversed {
+		t.Errorf("reversal status: got %q, want reversed", got.ReversalStatus)
+	}
+}
+
+func TestReversalExceedingRemainingAmount(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+
+	from := env.createAccount(t, "100.00")
+	to := env.createAccount(t, "0")
+	transfer := env.completedTransfer(t, from, to, "40.00")
+
+	if _, err := env.transfers.ReverseTransfer(ctx, transfer.ID, models.CreateReversalRequest{Amount: "40.01"}); !errors.Is(err, models.ErrReversalExceedsAmount) {
+		t.Fatalf("reversing more than the transfer: got %v, want ErrReversalExceedsAmount", err)
+	}
+	if _, err := env.transfers.ReverseTransfer(ctx, transfer.ID, models.CreateReversalRequest{Amount: "30.00"}); err != nil {
+		t.Fatalf("reverse: %v", err)
+	}
+	if _, err := env.transfers.ReverseTransfer(ctx, transfer.ID, models.CreateReversalRequest{Amount: "10.01"}); !errors.Is(err, models.ErrReversalExceedsAmount) {
+		t.Fatalf("reversing more than is left: got %v, want ErrReversalExceedsAmount", err)
+	}
+	for _, amount := range []money.Decimal{"0", "-1.00"} {
+		if _, err := env.transfers.ReverseTransfer(ctx, transfer.ID, models.CreateReversalRequest{Amount: amount}); !errors.Is(err, money.ErrInvalidAmount) {
+			t.Errorf("reversing %s: got %v, want ErrInvalidAmount", amount, err)
+		}
+	}
+
+	if balance := env.balance(t, from.ID); balance != 9000 {
+		t.Errorf("source balance: got %d, want 9000", balance)
+	}
+	if got := env.transfer(t, transfer.ID); got.ReversedAmount != money.New(3000, "USD") {
+		t.Errorf("reversed amount: got %s, want 30.00", got.ReversedAmount)
+	}
+}
+
+func TestConcurrentPartialReversals(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+
+	from := env.createAccount(t, "100.00")
+	to := env.createAccount(t, "0")
+	transfer := env.completedTransfer(t, from, to, "10.00")
+
+	// Each fits on its own, together they exceed the transfer
+	const workers = 2
+	errs := make([]error, workers)
+	var wg sync.WaitGroup
+	for i := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = env.transfers.ReverseTransfer(ctx, transfer.ID, models.CreateReversalRequest{Amount: "6.00"})
+		}()
+	}
+	wg.Wait()
+
+	var succeeded int
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, models.ErrReversalExceedsAmount):
+			t.Errorf("reversal: got %v, want success or ErrReversalExceedsAmount", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Fatalf("succeeded reversals: got %d, want 1", succeeded)
+	}
+	if got := env.transfer(t, transfer.ID); got.ReversedAmount != money.New(600, "USD") || got.ReversedCreditAmount != money.New(600, "USD") {
+		t.Fatalf("reversed amounts: got %s/%s, want 6.00/6.00", got.ReversedAmount, got.ReversedCreditAmount)
+	}
+	if balance := env.balance(t, from.ID); balance != 9600 {
+		t.Errorf("source balance: got %d, want 9600", balance)
+	}
+	if balance := env.balance(t, to.ID); balance != 400 {
+		t.Errorf("destination balance: got %d, want 400", balance)
+	}
+}
+
+func TestCrossCurrencyReversalRounding(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+	rates, err := fx.NewStaticProvider("USD", map[money.Currency]string{"EUR": "0.915"})
+	if err != nil {
+		t.Fatalf("rates: %v", err)
+	}
+	env.transfers = NewTransferService(env.repo, env.accounts, rates, env.saga, VelocityLimits{}, tier.DefaultCatalog, DefaultHoldTTL)
+
+	from := env.createAccount(t, "100.00")
+	to := env.createAccountIn(t, "EUR", "0")
+	transfer := env.completedTransfer(t, from, to, "10.00")
+	if transfer.CreditAmount != money.New(915, "EUR") {
+		t.Fatalf("credit amount: got %s %s, want 9.15 EUR", transfer.CreditAmount, transfer.CreditAmount.Currency)
+	}
+
+	// 3.33 USD is 3.04695 EUR at the transfer's rate, rounded to 3.05. The
+	// last reversal takes back what is left, 3.05, not 3.34 USD converted
+	// to 3.06.
+	steps := []struct {
+		amount money.Decimal
+		credit money.Money
+	}{
+		{"3.33", money.New(305, "EUR")},
+		{"3.33", money.New(305, "EUR")},
+		{"3.34", money.New(305, "EUR")},
+	}
+	for i, step := range steps {
+		reversal, err := env.transfers.ReverseTransfer(ctx, transfer.ID, models.CreateReversalRequest{Amount: step.amount})
+		if err != nil {
+			t.Fatalf("reversal %d: %v", i+1, err)
+		}
+		if reversal.CreditAmount != step.credit {
+			t.Errorf("reversal %d of %s USD: got %s %s back from the destination, want %s EUR",
+				i+1, step.amount, reversal.CreditAmount, reversal.CreditAmount.Currency, step.credit)
+		}
+	}
+
+	got := env.transfer(t, transfer.ID)
+	if got.ReversedAmount != got.Amount || got.ReversedCreditAmount != got.CreditAmount {
+		t.Errorf("reversed: got %s USD and %s EUR, want all of %s USD and %s EUR",
+			got.ReversedAmount, got.ReversedCreditAmount, got.Amount, got.CreditAmount)
+	}
+	if balance := env.balance(t, to.ID); balance != 0 {
+		t.Errorf("destination balance: got %d, want nothing stranded", balance)
+	}
+	if balance := env.balance(t, from.ID); balance != 10000 {
+		t.Errorf("source balance: got %d, want 10000", balance)
+	}
+}
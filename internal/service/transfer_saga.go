@@ -0,0 +1,475 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tribal/bank-api/internal/audit"
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/internal/repository"
+	"github.com/tribal/bank-api/pkg/telemetry"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+const (
+	transferAggregate = "transfer"
+
+	// Saga steps, each delivered as an outbox message
+	sagaStepDebit      = "transfer.debit"
+	sagaStepCredit     = "transfer.credit"
+	sagaStepCompensate = "transfer.compensate"
+
+	// Steps of two-phase transfers: hold the amount on the source account,
+	// then either capture the hold, which debits the source and continues
+	// with the credit, or release it
+	sagaStepHold    = "transfer.hold"
+	sagaStepCapture = "transfer.capture"
+	sagaStepRelease = "transfer.release"
+
+	sagaLease       = 30 * time.Second
+	sagaMaxAttempts = 20
+	sagaMaxBackoff  = 5 * time.Minute
+	sagaRelayBatch  = 50
+)
+
+// TransferSaga orchestrates a transfer across services: it reserves the funds
+// by debiting the source account, credits the destination and, if the credit
+// is rejected, compensates by refunding the source. Two-phase transfers hold
+// the funds first and debit them when captured. Reversals run the same
+// steps in the opposite direction. Each step is an outbox
+// message written in the same local transaction as the previous outcome, so
+// progress survives crashes; every entry posted to accounts-api carries a
+// deterministic key so redelivered steps are applied at most once.
+type TransferSaga struct {
+	repo     repository.Repository
+	accounts AccountGateway
+	now      func() time.Time
+}
+
+func NewTransferSaga(repo repository.Repository, accounts AccountGateway) *TransferSaga {
+	return &TransferSaga{repo: repo, accounts: accounts, now: time.Now}
+}
+
+// newSagaMessage builds the outbox message for a step of the transfer saga,
+// capturing the caller's trace context
+func newSagaMessage(ctx context.Context, transferID uint, step, payload string, now time.Time) *models.OutboxMessage {
+	return newOutboxMessage(ctx, transferAggregate, transferID, step, payload, now)
+}
+
+func newOutboxMessage(ctx context.Context, aggregateType string, aggregateID uint, step, payload string, now time.Time) *models.OutboxMessage {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	audit.Inject(ctx, carrier)
+	traceContext, _ := json.Marshal(carrier)
+
+	return &models.OutboxMessage{
+		AggregateType: aggregateType,
+		AggregateID:   aggregateID,
+		Type:          step,
+		Payload:       payload,
+		TraceContext:  string(traceContext),
+		Status:        models.OutboxStatusPending,
+		NextAttemptAt: now,
+	}
+}
+
+// Run drives the saga of one transfer as far as it can go right now. Steps
+// that fail transiently are left for the relay to retry.
+func (s *TransferSaga) Run(ctx context.Context, transferID uint) error {
+	return s.run(ctx, transferAggregate, transferID)
+}
+
+func (s *TransferSaga) run(ctx context.Context, aggregateType string, aggregateID uint) error {
+	for {
+		messages, err := s.repo.ListPendingOutboxMessages(ctx, aggregateType, aggregateID)
+		if err != nil {
+			return fmt.Errorf("failed to load saga steps: %w", err)
+		}
+
+		progressed := false
+		for i := range messages {
+			done, err := s.handle(ctx, &messages[i])
+			if err != nil {
+				return err
+			}
+			progressed = progressed || done
+		}
+		if !progressed {
+			return nil
+		}
+	}
+}
+
+// Start runs the relay until ctx is cancelled, resuming steps that are due
+// for a retry or were interrupted by a crash
+func (s *TransferSaga) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_ = s.ProcessDue(ctx)
+		}
+	}
+}
+
+// ProcessDue delivers every pending message whose retry time has come. A
+// message that fails to be delivered does not hold up the rest; the errors
+// of all of them are returned together.
+func (s *TransferSaga) ProcessDue(ctx context.Context) error {
+	messages, err := s.repo.ListDueOutboxMessages(ctx, s.now(), sagaRelayBatch)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for i := range messages {
+		msg := &messages[i]
+		if msg.AggregateType != transferAggregate && msg.AggregateType != reversalAggregate {
+			continue
+		}
+
+		// Continue the trace of the request that started the transfer and
+		// attribute the step to its actor
+		var carrier propagation.MapCarrier
+		msgCtx := ctx
+		if json.Unmarshal([]byte(msg.TraceContext), &carrier) == nil {
+			msgCtx = otel.GetTextMapPropagator().Extract(ctx, carrier)
+			msgCtx = audit.Extract(msgCtx, carrier)
+		}
+
+		if _, err := s.handle(msgCtx, msg); err != nil {
+			errs = append(errs, fmt.Errorf("outbox message %d: %w", msg.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// handle claims and executes one step. It reports whether the saga moved on,
+// i.e. the step succeeded or failed permanently.
+func (s *TransferSaga) handle(ctx context.Context, msg *models.OutboxMessage) (bool, error) {
+	claimed, err := s.repo.ClaimOutboxMessage(ctx, msg.ID, s.now(), sagaLease)
+	if err != nil || !claimed {
+		return false, err
+	}
+
+	if msg.AggregateType == reversalAggregate {
+		return s.handleReversal(ctx, msg)
+	}
+	return s.handleTransfer(ctx, msg)
+}
+
+// handleTransfer executes a step of a transfer
+func (s *TransferSaga) handleTransfer(ctx context.Context, msg *models.OutboxMessage) (bool, error) {
+	ctx, span := transferTracer.Start(ctx, "TransferSaga."+msg.Type)
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("transfer.id", int(msg.AggregateID)),
+		attribute.Int("outbox.id", int(msg.ID)),
+		attribute.Int("outbox.attempt", msg.Attempts+1),
+	)
+
+	transfer, err := s.repo.GetTransferByID(ctx, msg.AggregateID)
+	if err != nil {
+		span.RecordError(err)
+		return false, fmt.Errorf("failed to load transfer %d: %w", msg.AggregateID, err)
+	}
+
+	// A compensating batch voids the transfers whose hold it gave up on, so
+	// there is nothing left to hold for them
+	cancelled := msg.Type == sagaStepHold && transfer.Status != models.TransferStatusPending
+
+	var stepErr error
+	switch {
+	case cancelled:
+	case msg.Type == sagaStepHold:
+		_, stepErr = s.accounts.PlaceHold(ctx, transfer.FromAccountID, models.AccountHoldRequest{
+			Key:         transferHoldKey(transfer),
+			Amount:      transfer.Amount,
+			Reference:   fmt.Sprintf("TRF-%d", transfer.ID),
+			Description: fmt.Sprintf("Hold for transfer to %s", transfer.ToAccountNumber),
+		})
+	case msg.Type == sagaStepRelease:
+		_, stepErr = s.accounts.ReleaseHold(ctx, transfer.FromAccountID, transferHoldKey(transfer))
+		// The hold of a transfer voided before it was placed may not exist
+		if errors.Is(stepErr, models.ErrHoldNotFound) && transfer.Status == models.TransferStatusVoided {
+			stepErr = nil
+		}
+	default:
+		accountID, entry, err := transferEntry(transfer, msg.Type)
+		if err != nil {
+			span.RecordError(err)
+			return s.dropStep(ctx, msg, err)
+		}
+		_, stepErr = s.accounts.PostEntry(ctx, accountID, entry)
+	}
+	if stepErr != nil {
+		span.RecordError(stepErr)
+	}
+
+	// Errors that accounts-api reports with a domain code are final; anything
+	// else (network, 5xx) is retried with backoff
+	if stepErr != nil && models.ErrorCode(stepErr) == "" {
+		return false, s.retry(ctx, msg, stepErr)
+	}
+
+	now := s.now()
+	dead := false
+	err = s.repo.WithTransaction(ctx, func(tx repository.Store) error {
+		// The step's outcome applies to the transfer as it is now, which a
+		// capture, void or reversal may have changed since it was loaded
+		locked, err := tx.LockTransfer(ctx, transfer.ID)
+		if err != nil {
+			return err
+		}
+		before := *locked
+		transfer = locked
+		if err := tx.MarkOutboxMessageProcessed(ctx, msg, now); err != nil {
+			return err
+		}
+
+		// The transfer was voided before or while its hold was placed. A hold
+		// this attempt, or an earlier one that crashed, may have placed is
+		// released.
+		if msg.Type == sagaStepHold && before.Status != models.TransferStatusPending {
+			cancelled = true
+			if stepErr != nil {
+				return nil
+			}
+			return tx.CreateOutboxMessage(ctx, newSagaMessage(ctx, transfer.ID, sagaStepRelease, "", now))
+		}
+
+		switch {
+		case (msg.Type == sagaStepDebit || msg.Type == sagaStepCapture) && stepErr == nil:
+			return tx.CreateOutboxMessage(ctx, newSagaMessage(ctx, transfer.ID, sagaStepCredit, "", now))
+
+		case msg.Type == sagaStepHold && stepErr == nil:
+			transfer.Status = models.TransferStatusAuthorized
+
+		case msg.Type == sagaStepDebit || msg.Type == sagaStepHold:
+			transfer.Status = models.TransferStatusFailed
+			transfer.FailureReason = stepErr.Error()
+			transfer.FailureCode = models.ErrorCode(stepErr)
+
+		case msg.Type == sagaStepCapture:
+			// Nothing was debited, but the hold still reserves the amount
+			transfer.Status = models.TransferStatusFailed
+			transfer.FailureReason = stepErr.Error()
+			transfer.FailureCode = models.ErrorCode(stepErr)
+			if err := tx.CreateOutboxMessage(ctx, newSagaMessage(ctx, transfer.ID, sagaStepRelease, "", now)); err != nil {
+				return err
+			}
+
+		case msg.Type == sagaStepRelease && stepErr == nil:
+			// The transfer was already voided, expired or failed
+			return nil
+
+		case msg.Type == sagaStepCredit && stepErr == nil:
+			transfer.Status = models.TransferStatusCompleted
+
+		case msg.Type == sagaStepCredit:
+			// The source was already debited and must be refunded
+			transfer.FailureReason = stepErr.Error()
+			transfer.FailureCode = models.ErrorCode(stepErr)
+			if err := tx.CreateOutboxMessage(ctx, newSagaMessage(ctx, transfer.ID, sagaStepCompensate, stepErr.Error(), now)); err != nil {
+				return err
+			}
+
+		case msg.Type == sagaStepCompensate && stepErr == nil:
+			transfer.Status = models.TransferStatusCompensated
+
+		default:
+			// A refund or release that is rejected needs manual intervention
+			dead = true
+			if err := tx.MarkOutboxMessageDead(ctx, msg, stepErr.Error()); err != nil {
+				return err
+			}
+			return flagSagaForAttention(ctx, tx, msg, fmt.Sprintf("%s rejected: %s", msg.Type, stepErr), models.ErrorCode(stepErr))
+		}
+
+		if err := tx.UpdateTransferStatus(ctx, transfer); err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, models.AuditTransferStatusChanged, models.AuditEntityTransfer, transfer.ID, &before, transfer)
+	})
+	if err != nil {
+		span.RecordError(err)
+		return false, fmt.Errorf("failed to record saga step: %w", err)
+	}
+
+	if cancelled {
+		span.SetAttributes(attribute.String("transfer.status", string(models.TransferStatusVoided)))
+		return true, nil
+	}
+	if dead {
+		telemetry.RecordSagaStepDead(msg.Type)
+		span.SetAttributes(attribute.String("transfer.status", string(models.TransferStatusNeedsAttention)))
+		return true, nil
+	}
+
+	span.SetAttributes(attribute.String("transfer.status", string(transfer.Status)))
+
+	switch {
+	case msg.Type == sagaStepHold && stepErr == nil:
+		telemetry.RecordTransferHold(holdAuthorized, transfer.Amount)
+	case msg.Type == sagaStepCapture && stepErr == nil:
+		telemetry.RecordTransferHold(holdCaptured, transfer.Amount)
+	}
+
+	// Historical transfers only record the past, so they are counted apart
+	if transfer.OccurredAt != nil {
+		switch transfer.Status {
+		case models.TransferStatusCompleted:
+			telemetry.RecordImportedTransfer(transfer.Amount, true)
+		case models.TransferStatusFailed, models.TransferStatusCompensated:
+			telemetry.RecordImportedTransfer(transfer.Amount, false)
+		}
+		return true, nil
+	}
+
+	switch transfer.Status {
+	case models.TransferStatusCompleted:
+		telemetry.RecordTransfer(transfer.Amount, transfer.CreditAmount, true)
+	case models.TransferStatusFailed, models.TransferStatusCompensated:
+		telemetry.RecordTransfer(transfer.Amount, transfer.CreditAmount, false)
+	}
+
+	return true, nil
+}
+
+// transferEntry builds the entry a balance-moving step posts and returns the
+// account it is posted to
+func transferEntry(transfer *models.Transfer, step string) (uint, models.AccountEntry, error) {
+	reference := fmt.Sprintf("TRF-%d", transfer.ID)
+	entry := models.AccountEntry{
+		Key:        fmt.Sprintf("%s:%s", reference, step),
+		Type:       models.TransactionTypeTransfer,
+		Reference:  reference,
+		OccurredAt: transfer.OccurredAt,
+	}
+
+	switch step {
+	case sagaStepDebit:
+		entry.Amount = transfer.Amount.Neg()
+		entry.Description = fmt.Sprintf("Transfer to %s", transfer.ToAccountNumber)
+		return transfer.FromAccountID, entry, nil
+	case sagaStepCapture:
+		entry.Amount = transfer.Amount.Neg()
+		entry.Description = fmt.Sprintf("Transfer to %s", transfer.ToAccountNumber)
+		entry.HoldKey = transferHoldKey(transfer)
+		return transfer.FromAccountID, entry, nil
+	case sagaStepCredit:
+		entry.Amount = transfer.CreditAmount
+		entry.Description = fmt.Sprintf("Transfer from %s", transfer.FromAccountNumber)
+		return transfer.ToAccountID, entry, nil
+	case sagaStepCompensate:
+		entry.Amount = transfer.Amount
+		entry.Description = "Refund of failed transfer"
+		entry.Refund = true
+		return transfer.FromAccountID, entry, nil
+	}
+	return 0, entry, fmt.Errorf("unknown saga step %q", step)
+}
+
+// transferHoldKey identifies the hold of a two-phase transfer in accounts-api
+func transferHoldKey(transfer *models.Transfer) string {
+	return fmt.Sprintf("TRF-%d:hold", transfer.ID)
+}
+
+// retry schedules another attempt with exponential backoff, giving up after
+// sagaMaxAttempts. A step given up on leaves its transfer or reversal
+// needing attention.
+func (s *TransferSaga) retry(ctx context.Context, msg *models.OutboxMessage, cause error) error {
+	msg.Attempts++
+	msg.LastError = cause.Error()
+
+	backoff := time.Second << min(msg.Attempts, 16)
+	if backoff > sagaMaxBackoff {
+		backoff = sagaMaxBackoff
+	}
+	msg.NextAttemptAt = s.now().Add(backoff)
+
+	if msg.Attempts < sagaMaxAttempts {
+		return s.repo.RescheduleOutboxMessage(ctx, msg)
+	}
+
+	msg.Status = models.OutboxStatusDead
+	err := s.repo.WithTransaction(ctx, func(tx repository.Store) error {
+		if err := tx.RescheduleOutboxMessage(ctx, msg); err != nil {
+			return err
+		}
+		reason := fmt.Sprintf("%s gave up after %d attempts: %s", msg.Type, msg.Attempts, cause)
+		return flagSagaForAttention(ctx, tx, msg, reason, "")
+	})
+	if err != nil {
+		return fmt.Errorf("failed to give up on saga step: %w", err)
+	}
+
+	telemetry.RecordSagaStepDead(msg.Type)
+	return nil
+}
+
+// dropStep marks a message the saga cannot execute, such as one of an
+// unknown step, dead and flags its transfer or reversal for attention, as
+// delivering it again would fail the same way
+func (s *TransferSaga) dropStep(ctx context.Context, msg *models.OutboxMessage, cause error) (bool, error) {
+	err := s.repo.WithTransaction(ctx, func(tx repository.Store) error {
+		if err := tx.MarkOutboxMessageDead(ctx, msg, cause.Error()); err != nil {
+			return err
+		}
+		return flagSagaForAttention(ctx, tx, msg, fmt.Sprintf("%s dropped: %s", msg.Type, cause), "")
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to drop saga step: %w", err)
+	}
+
+	telemetry.RecordSagaStepDead(msg.Type)
+	return true, nil
+}
+
+// flagSagaForAttention moves the transfer or reversal of a dead saga message
+// to needs_attention within tx, recording why in its failure reason and in
+// the audit log
+func flagSagaForAttention(ctx context.Context, tx repository.Store, msg *models.OutboxMessage, reason, code string) error {
+	if msg.AggregateType == reversalAggregate {
+		reversal, err := tx.GetReversalByID(ctx, msg.AggregateID)
+		if err != nil {
+			return err
+		}
+		// Serialize with the other reversals of the transfer
+		if _, err := tx.LockTransfer(ctx, reversal.TransferID); err != nil {
+			return err
+		}
+		before := *reversal
+		reversal.Status = models.ReversalStatusNeedsAttention
+		reversal.FailureReason = reason
+		if err := tx.UpdateReversalStatus(ctx, reversal); err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, models.AuditReversalStatusChanged, models.AuditEntityReversal, reversal.ID, &before, reversal)
+	}
+
+	before, err := tx.LockTransfer(ctx, msg.AggregateID)
+	if err != nil {
+		return err
+	}
+	transfer := *before
+	transfer.Status = models.TransferStatusNeedsAttention
+	transfer.FailureReason = reason
+	if code != "" {
+		transfer.FailureCode = code
+	}
+	if err := tx.UpdateTransferStatus(ctx, &transfer); err != nil {
+		return err
+	}
+	return recordAudit(ctx, tx, models.AuditTransferStatusChanged, models.AuditEntityTransfer, transfer.ID, before, &transfer)
+}
@@ -0,0 +1,250 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/pkg/money"
+)
+
+var errUnreachable = errors.New("accounts-api unreachable")
+
+func TestSagaGivesUpAfterMaxAttempts(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+	clock := newTestClock()
+	env.saga.now = clock.Now
+
+	from := env.createAccount(t, "100.00")
+	to := env.createAccount(t, "0")
+
+	env.accounts.setFail(func(op string, accountID uint, key string) error {
+		return errUnreachable
+	})
+
+	transfer, err := env.transfers.CreateTransfer(ctx, models.CreateTransferRequest{
+		FromAccountNumber: from.AccountNumber,
+		ToAccountNumber:   to.AccountNumber,
+		Amount:            money.Decimal("10.00"),
+	})
+	if err != nil {
+		t.Fatalf("create transfer: %v", err)
+	}
+	if transfer.Status != models.TransferStatusPending {
+		t.Fatalf("status after the first attempt: got %s, want pending", transfer.Status)
+	}
+
+	for range sagaMaxAttempts {
+		clock.Advance(sagaMaxBackoff)
+		if err := env.saga.ProcessDue(ctx); err != nil {
+			t.Fatalf("process due: %v", err)
+		}
+	}
+
+	got := env.transfer(t, transfer.ID)
+	if got.Status != models.TransferStatusNeedsAttention {
+		t.Fatalf("status: got %s, want %s", got.Status, models.TransferStatusNeedsAttention)
+	}
+	want := fmt.Sprintf("%s gave up after %d attempts", sagaStepDebit, sagaMaxAttempts)
+	if !strings.Contains(got.FailureReason, want) {
+		t.Fatalf("failure reason: got %q, want it to contain %q", got.FailureReason, want)
+	}
+	if calls := env.accounts.callCount(opPostEntry); calls != sagaMaxAttempts {
+		t.Fatalf("debit attempts: got %d, want %d", calls, sagaMaxAttempts)
+	}
+
+	actions := env.auditActions(t, models.AuditEntityTransfer, transfer.ID)
+	if !slices.Contains(actions, models.AuditTransferStatusChanged) {
+		t.Fatalf("audit actions: got %v, want a status change", actions)
+	}
+
+	pending, err := env.repo.ListPendingOutboxMessages(ctx, transferAggregate, transfer.ID)
+	if err != nil {
+		t.Fatalf("list pending messages: %v", err)
+	}
+	if len(pending) != 0 {
+		t.Fatalf("pending messages: got %d, want none", len(pending))
+	}
+
+	// Nothing is left for the relay to deliver
+	clock.Advance(sagaMaxBackoff)
+	if err := env.saga.ProcessDue(ctx); err != nil {
+		t.Fatalf("process due: %v", err)
+	}
+	if calls := env.accounts.callCount(opPostEntry); calls != sagaMaxAttempts {
+		t.Fatalf("debit attempts after giving up: got %d, want %d", calls, sagaMaxAttempts)
+	}
+}
+
+func TestSagaRejectedRefundNeedsAttention(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+
+	from := env.createAccount(t, "100.00")
+	to := env.createAccount(t, "0")
+
+	// The destination rejects the credit and the source the refund, as if
+	// both were frozen while the transfer was in flight
+	env.accounts.setFail(func(op string, accountID uint, key string) error {
+		if strings.HasSuffix(key, ":"+sagaStepCredit) || strings.HasSuffix(key, ":"+sagaStepCompensate) {
+			return fmt.Errorf("%w: account %d", models.ErrAccountFrozen, accountID)
+		}
+		return nil
+	})
+
+	_, err := env.transfers.CreateTransfer(ctx, models.CreateTransferRequest{
+		FromAccountNumber: from.AccountNumber,
+		ToAccountNumber:   to.AccountNumber,
+		Amount:            money.Decimal("10.00"),
+	})
+	if err == nil {
+		t.Fatalf("create transfer: got no error, want the transfer to need attention")
+	}
+	ids := env.listTransferIDs(t, models.ListQuery{})
+	if len(ids) != 1 {
+		t.Fatalf("transfers: got %d, want 1", len(ids))
+	}
+	got := env.transfer(t, ids[0])
+	if got.Status != models.TransferStatusNeedsAttention {
+		t.Fatalf("status: got %s, want %s", got.Status, models.TransferStatusNeedsAttention)
+	}
+	if got.FailureCode != models.ErrorCode(models.ErrAccountFrozen) {
+		t.Fatalf("failure code: got %q, want %q", got.FailureCode, models.ErrorCode(models.ErrAccountFrozen))
+	}
+	if !strings.HasPrefix(got.FailureReason, sagaStepCompensate+" rejected") {
+		t.Fatalf("failure reason: got %q, want the rejected refund", got.FailureReason)
+	}
+
+	// The source stays debited until an operator refunds it
+	if balance := env.balance(t, from.ID); balance != 9000 {
+		t.Fatalf("source balance: got %d, want 9000", balance)
+	}
+	actions := env.auditActions(t, models.AuditEntityTransfer, got.ID)
+	if !slices.Contains(actions, models.AuditTransferStatusChanged) {
+		t.Fatalf("audit actions: got %v, want a status change", actions)
+	}
+}
+
+func TestSagaRelayContinuesPastFailingMessage(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+	clock := newTestClock()
+	env.saga.now = clock.Now
+
+	from := env.createAccount(t, "100.00")
+	to := env.createAccount(t, "0")
+
+	// A message whose transfer cannot be loaded fails on every delivery
+	poisoned := newSagaMessage(ctx, 1_000_000, sagaStepDebit, "", clock.Now())
+	if err := env.repo.CreateOutboxMessage(ctx, poisoned); err != nil {
+		t.Fatalf("create message: %v", err)
+	}
+
+	env.accounts.setFail(func(op string, accountID uint, key string) error {
+		return errUnreachable
+	})
+	transfer, err := env.transfers.CreateTransfer(ctx, models.CreateTransferRequest{
+		FromAccountNumber: from.AccountNumber,
+		ToAccountNumber:   to.AccountNumber,
+		Amount:            money.Decimal("10.00"),
+	})
+	if err != nil {
+		t.Fatalf("create transfer: %v", err)
+	}
+	env.accounts.setFail(nil)
+
+	// One pass for the debit, one for the credit it enqueues
+	for range 2 {
+		clock.Advance(sagaMaxBackoff)
+		err := env.saga.ProcessDue(ctx)
+		if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("outbox message %d", poisoned.ID)) {
+			t.Fatalf("process due: got %v, want the error of message %d", err, poisoned.ID)
+		}
+	}
+	if got := env.transfer(t, transfer.ID); got.Status != models.TransferStatusCompleted {
+		t.Fatalf("status: got %s, want the transfer behind the failing message completed", got.Status)
+	}
+}
+
+func TestSagaDropsUnknownSteps(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+
+	from := env.createAccount(t, "100.00")
+	to := env.createAccount(t, "0")
+	transfer := env.completedTransfer(t, from, to, "10.00")
+
+	msg := newSagaMessage(ctx, transfer.ID, "transfer.refund", "", time.Now())
+	if err := env.repo.CreateOutboxMessage(ctx, msg); err != nil {
+		t.Fatalf("create message: %v", err)
+	}
+	if err := env.saga.ProcessDue(ctx); err != nil {
+		t.Fatalf("process due: %v", err)
+	}
+
+	got := env.transfer(t, transfer.ID)
+	if got.Status != models.TransferStatusNeedsAttention {
+		t.Fatalf("status: got %s, want %s", got.Status, models.TransferStatusNeedsAttention)
+	}
+	if !strings.Contains(got.FailureReason, `unknown saga step "transfer.refund"`) {
+		t.Fatalf("failure reason: got %q, want the unknown step", got.FailureReason)
+	}
+	pending, err := env.repo.ListPendingOutboxMessages(ctx, transferAggregate, transfer.ID)
+	if err != nil {
+		t.Fatalf("list pending messages: %v", err)
+	}
+	if len(pending) != 0 {
+		t.Fatalf("pending messages: got %d, want the unknown step dead", len(pending))
+	}
+	if calls := env.accounts.callCount(opPostEntry); calls != 2 {
+		t.Errorf("entries posted: got %d, want only the debit and credit", calls)
+	}
+}
+
+func TestSagaStepKeepsConcurrentStatusChange(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+
+	from := env.createAccount(t, "100.00")
+	to := env.createAccount(t, "0")
+
+	// While the credit is in flight another writer moves the transfer to
+	// needs_attention; the rejected credit must not put it back to pending.
+	// The refund that follows is left for the relay.
+	env.accounts.setFail(func(op string, accountID uint, key string) error {
+		switch {
+		case strings.HasSuffix(key, ":"+sagaStepCredit):
+			var id uint
+			fmt.Sscanf(key, "TRF-%d:", &id)
+			flagged := &models.Transfer{ID: id, Status: models.TransferStatusNeedsAttention, FailureReason: "flagged by an operator"}
+			if err := env.repo.UpdateTransferStatus(ctx, flagged); err != nil {
+				t.Errorf("flag transfer: %v", err)
+			}
+			return fmt.Errorf("%w: account %d", models.ErrAccountFrozen, accountID)
+		case strings.HasSuffix(key, ":"+sagaStepCompensate):
+			return errUnreachable
+		}
+		return nil
+	})
+
+	transfer, _ := env.transfers.createTransfer(ctx, models.CreateTransferRequest{
+		FromAccountNumber: from.AccountNumber,
+		ToAccountNumber:   to.AccountNumber,
+		Amount:            money.Decimal("10.00"),
+	})
+	if transfer == nil {
+		t.Fatal("create transfer: got no transfer")
+	}
+	got := env.transfer(t, transfer.ID)
+	if got.Status != models.TransferStatusNeedsAttention {
+		t.Fatalf("status: got %s, want the concurrent %s kept", got.Status, models.TransferStatusNeedsAttention)
+	}
+	if got.FailureCode != models.ErrorCode(models.ErrAccountFrozen) {
+		t.Errorf("failure code: got %q, want the rejected credit's", got.FailureCode)
+	}
+}
@@ -0,0 +1,326 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tribal/bank-api/internal/audit"
+	"github.com/tribal/bank-api/internal/auth"
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/internal/repository"
+	"github.com/tribal/bank-api/pkg/money"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// scheduleClockSkew is how far in the past a schedule can start, so a client
+// asking for "now" with a clock slightly behind is not rejected
+const scheduleClockSkew = time.Minute
+
+// CreateSchedule validates a scheduled or recurring transfer against the
+// accounts it moves money between and stores it. The accounts and limits are
+// checked again on every run; the runs are attributed to the caller.
+func (s *TransferService) CreateSchedule(ctx context.Context, req models.CreateScheduleRequest) (*models.TransferSchedule, error) {
+	ctx, span := transferTracer.Start(ctx, "TransferService.CreateSchedule")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("schedule.from", req.FromAccountNumber),
+		attribute.String("schedule.to", req.ToAccountNumber),
+		attribute.String("schedule.amount", string(req.Amount)),
+		attribute.String("schedule.frequency", string(req.Frequency)),
+	)
+
+	if err := auth.Authorize(ctx, auth.PermTransfersSchedule); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	schedule, err := s.prepareSchedule(ctx, req)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	err = s.repo.WithTransaction(ctx, func(tx repository.Store) error {
+		if err := tx.CreateSchedule(ctx, schedule); err != nil {
+			return fmt.Errorf("failed to create schedule: %w", err)
+		}
+		return recordAudit(ctx, tx, models.AuditScheduleCreated, models.AuditEntitySchedule, schedule.ID, nil, schedule)
+	})
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("schedule.id", int(schedule.ID)))
+
+	return schedule, nil
+}
+
+// prepareSchedule checks the recurrence of the request and resolves its
+// accounts through accounts-api
+func (s *TransferService) prepareSchedule(ctx context.Context, req models.CreateScheduleRequest) (*models.TransferSchedule, error) {
+	frequency := req.Frequency
+	if frequency == "" {
+		frequency = models.ScheduleOnce
+	}
+	every := req.Every
+	if every == 0 {
+		every = 1
+	}
+
+	switch frequency {
+	case models.ScheduleOnce:
+		if every != 1 || req.EndAt != nil {
+			return nil, fmt.Errorf("%w: schedules that run once take no every or end_at", models.ErrInvalidSchedule)
+		}
+	case models.ScheduleDaily, models.ScheduleWeekly, models.ScheduleMonthly:
+		if every < 1 {
+			return nil, fmt.Errorf("%w: every must be at least 1", models.ErrInvalidSchedule)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown frequency %q, want once, daily, weekly or monthly", models.ErrInvalidSchedule, frequency)
+	}
+	if req.StartAt.Before(time.Now().Add(-scheduleClockSkew)) {
+		return nil, fmt.Errorf("%w: start_at is in the past", models.ErrInvalidSchedule)
+	}
+	if req.EndAt != nil && req.EndAt.Before(req.StartAt) {
+		return nil, fmt.Errorf("%w: end_at is before start_at", models.ErrInvalidSchedule)
+	}
+
+	fromAccount, err := s.accounts.GetAccountByNumber(ctx, req.FromAccountNumber)
+	if err != nil {
+		return nil, fmt.Errorf("source account not found: %w", err)
+	}
+	toAccount, err := s.accounts.GetAccountByNumber(ctx, req.ToAccountNumber)
+	if err != nil {
+		return nil, fmt.Errorf("destination account not found: %w", err)
+	}
+	if fromAccount.ID == toAccount.ID {
+		return nil, fmt.Errorf("%w: cannot transfer to the same account", models.ErrInvalidSchedule)
+	}
+	if err := auth.AuthorizeAccount(ctx, auth.PermTransfersSchedule, fromAccount); err != nil {
+		return nil, fmt.Errorf("%w: %s", err, fromAccount.AccountNumber)
+	}
+	var customerID *uint
+	if id, _ := auth.CustomerScope(ctx, auth.PermTransfersSchedule); id != 0 {
+		customerID = &id
+	}
+	if err := fromAccount.CheckActive(); err != nil {
+		return nil, fmt.Errorf("source account: %w", err)
+	}
+	if err := toAccount.CheckActive(); err != nil {
+		return nil, fmt.Errorf("destination account: %w", err)
+	}
+
+	amount, err := req.Amount.Money(fromAccount.Currency())
+	if err != nil {
+		return nil, fmt.Errorf("invalid amount: %w", err)
+	}
+	if !amount.IsPositive() {
+		return nil, fmt.Errorf("%w: amount must be greater than zero", money.ErrInvalidAmount)
+	}
+	limits, err := s.tierLimits(fromAccount)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkTransactionLimits(amount, limits); err != nil {
+		return nil, err
+	}
+
+	startAt := req.StartAt.UTC()
+	var endAt *time.Time
+	if req.EndAt != nil {
+		t := req.EndAt.UTC()
+		endAt = &t
+	}
+	return &models.TransferSchedule{
+		FromAccountID:     fromAccount.ID,
+		FromAccountNumber: fromAccount.AccountNumber,
+		ToAccountNumber:   toAccount.AccountNumber,
+		Amount:            amount,
+		Description:       req.Description,
+		Frequency:         frequency,
+		Every:             every,
+		StartAt:           startAt,
+		EndAt:             endAt,
+		Status:            models.ScheduleStatusActive,
+		NextRunAt:         startAt,
+		CreatedBy:         audit.FromContext(ctx).Actor,
+		CustomerID:        customerID,
+	}, nil
+}
+
+// ListSchedules returns a page of schedules, newest first by default. Callers
+// limited to their own accounts must filter by one of them.
+func (s *TransferService) ListSchedules(ctx context.Context, q models.ListQuery) (*models.Page[models.TransferSchedule], error) {
+	ctx, span := transferTracer.Start(ctx, "TransferService.ListSchedules")
+	defer span.End()
+
+	if err := auth.Authorize(ctx, auth.PermTransfersSchedule); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	opts, err := listOptions(q, money.DefaultCurrency)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	if auth.Allowed(ctx, auth.PermTransfersSchedule) == auth.ScopeOwn {
+		if q.AccountNumber == "" {
+			err := fmt.Errorf("%w: account_number is required to list the schedules of your accounts", models.ErrInvalidListQuery)
+			span.RecordError(err)
+			return nil, err
+		}
+		account, err := s.accounts.GetAccountByNumber(ctx, q.AccountNumber)
+		if err != nil {
+			span.RecordError(err)
+			return nil, fmt.Errorf("failed to get account: %w", err)
+		}
+		if err := auth.AuthorizeAccount(ctx, auth.PermTransfersSchedule, account); err != nil {
+			span.RecordError(err)
+			return nil, err
+		}
+	}
+
+	schedules, next, err := s.repo.ListSchedules(ctx, opts)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to list schedules: %w", err)
+	}
+
+	span.SetAttributes(attribute.Int("schedules.count", len(schedules)))
+
+	return &models.Page[models.TransferSchedule]{Data: schedules, NextCursor: next}, nil
+}
+
+func (s *TransferService) GetSchedule(ctx context.Context, id uint) (*models.TransferSchedule, error) {
+	ctx, span := transferTracer.Start(ctx, "TransferService.GetSchedule")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int("schedule.id", int(id)))
+
+	if err := auth.Authorize(ctx, auth.PermTransfersSchedule); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	schedule, err := s.repo.GetScheduleByID(ctx, id)
+	if err != nil {
+		err = scheduleNotFound(err)
+		span.RecordError(err)
+		return nil, err
+	}
+	if err := s.authorizeSchedule(ctx, schedule); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	return schedule, nil
+}
+
+// PauseSchedule stops an active schedule from running until it is resumed
+func (s *TransferService) PauseSchedule(ctx context.Context, id uint) (*models.TransferSchedule, error) {
+	return s.setScheduleStatus(ctx, id, models.ScheduleStatusPaused)
+}
+
+// ResumeSchedule reactivates a paused schedule. If occurrences came due
+// while it was paused, the first one runs right away and the rest are
+// skipped.
+func (s *TransferService) ResumeSchedule(ctx context.Context, id uint) (*models.TransferSchedule, error) {
+	return s.setScheduleStatus(ctx, id, models.ScheduleStatusActive)
+}
+
+// CancelSchedule ends an active or paused schedule for good
+func (s *TransferService) CancelSchedule(ctx context.Context, id uint) (*models.TransferSchedule, error) {
+	return s.setScheduleStatus(ctx, id, models.ScheduleStatusCancelled)
+}
+
+// scheduleTransitions lists the statuses each status can move to through the
+// API. Schedules complete on their own.
+var scheduleTransitions = map[models.ScheduleStatus][]models.ScheduleStatus{
+	models.ScheduleStatusActive: {models.ScheduleStatusPaused, models.ScheduleStatusCancelled},
+	models.ScheduleStatusPaused: {models.ScheduleStatusActive, models.ScheduleStatusCancelled},
+}
+
+func (s *TransferService) setScheduleStatus(ctx context.Context, id uint, status models.ScheduleStatus) (*models.TransferSchedule, error) {
+	ctx, span := transferTracer.Start(ctx, "TransferService.setScheduleStatus")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("schedule.id", int(id)),
+		attribute.String("schedule.status", string(status)),
+	)
+
+	if err := auth.Authorize(ctx, auth.PermTransfersSchedule); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	// Ownership is checked before locking, as it may need accounts-api
+	schedule, err := s.repo.GetScheduleByID(ctx, id)
+	if err != nil {
+		err = scheduleNotFound(err)
+		span.RecordError(err)
+		return nil, err
+	}
+	if err := s.authorizeSchedule(ctx, schedule); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	err = s.repo.WithTransaction(ctx, func(tx repository.Store) error {
+		var err error
+		schedule, err = tx.LockSchedule(ctx, id)
+		if err != nil {
+			return scheduleNotFound(err)
+		}
+		before := *schedule
+
+		allowed := false
+		for _, next := range scheduleTransitions[schedule.Status] {
+			allowed = allowed || next == status
+		}
+		if !allowed {
+			return fmt.Errorf("%w: %s to %s", models.ErrInvalidScheduleTransition, schedule.Status, status)
+		}
+
+		schedule.Status = status
+		if err := tx.UpdateScheduleStatus(ctx, schedule); err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, models.AuditScheduleStatusChanged, models.AuditEntitySchedule, schedule.ID, before, schedule)
+	})
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	return schedule, nil
+}
+
+// authorizeSchedule checks that the caller may manage the schedules of the
+// source account. The account is only looked up for callers limited to
+// their own accounts.
+func (s *TransferService) authorizeSchedule(ctx context.Context, schedule *models.TransferSchedule) error {
+	if auth.Allowed(ctx, auth.PermTransfersSchedule) == auth.ScopeAll {
+		return nil
+	}
+	account, err := s.accounts.GetAccount(ctx, schedule.FromAccountID)
+	if err != nil {
+		return fmt.Errorf("failed to get account: %w", err)
+	}
+	return auth.AuthorizeAccount(ctx, auth.PermTransfersSchedule, account)
+}
+
+// scheduleNotFound maps a missing row to models.ErrScheduleNotFound
+func scheduleNotFound(err error) error {
+	if errors.Is(err, repository.ErrNotFound) {
+		return models.ErrScheduleNotFound
+	}
+	return err
+}
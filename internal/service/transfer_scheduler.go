@@ -0,0 +1,269 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tribal/bank-api/internal/audit"
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/internal/repository"
+	"github.com/tribal/bank-api/pkg/money"
+	"github.com/tribal/bank-api/pkg/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	scheduleLease = 2 * time.Minute
+	scheduleBatch = 50
+
+	// A run that fails for lack of funds or a transient error is retried
+	// with exponential backoff, up to scheduleMaxAttempts times and never
+	// past the next occurrence, before its occurrence is skipped
+	scheduleMaxAttempts  = 6
+	scheduleRetryBackoff = time.Minute
+	scheduleMaxBackoff   = time.Hour
+
+	// Outcomes of a run, for the bank_scheduled_transfers_total metric
+	scheduleExecuted  = "executed"
+	scheduleRetried   = "retried"
+	scheduleSkipped   = "skipped"
+	scheduleCancelled = "cancelled"
+)
+
+// Logger receives the errors of work that runs in the background, such as a
+// *telemetry.LokiLogger
+type Logger interface {
+	Error(format string, v ...interface{})
+}
+
+// TransferScheduler creates the transfers of schedules as they come due.
+// Every replica of transfers-api runs one: a replica leases each due
+// schedule before running it, so a run happens on one replica only, and the
+// transfer a run creates carries a unique key, so a run resumed after its
+// lease expired does not transfer twice.
+type TransferScheduler struct {
+	repo      repository.Repository
+	transfers *TransferService
+	now       func() time.Time
+}
+
+func NewTransferScheduler(repo repository.Repository, transfers *TransferService) *TransferScheduler {
+	return &TransferScheduler{repo: repo, transfers: transfers, now: time.Now}
+}
+
+// Start runs due schedules until ctx is cancelled, logging the schedules
+// that fail to run
+func (s *TransferScheduler) Start(ctx context.Context, interval time.Duration, logger Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.ProcessDue(ctx); err != nil {
+				logger.Error("Failed to run due schedules: %v", err)
+			}
+		}
+	}
+}
+
+// ProcessDue runs every active schedule whose next run has come and that no
+// other replica holds. A schedule that fails to run does not hold up the
+// rest; the errors of all of them are returned together.
+func (s *TransferScheduler) ProcessDue(ctx context.Context) error {
+	schedules, err := s.repo.ListDueSchedules(ctx, s.now(), scheduleBatch)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for i := range schedules {
+		schedule := &schedules[i]
+		claimed, err := s.repo.ClaimSchedule(ctx, schedule.ID, s.now(), scheduleLease)
+		if err == nil && claimed {
+			err = s.run(ctx, schedule)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("schedule %d: %w", schedule.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// scheduleRunKey identifies an attempt at an occurrence of a schedule
+func scheduleRunKey(schedule *models.TransferSchedule) string {
+	return fmt.Sprintf("schedule:%d:%d:%d", schedule.ID, schedule.Occurrence, schedule.Attempts)
+}
+
+// run executes the current occurrence of a claimed schedule and records the
+// outcome, which releases the lease
+func (s *TransferScheduler) run(ctx context.Context, schedule *models.TransferSchedule) error {
+	key := scheduleRunKey(schedule)
+
+	// Runs are attributed to whoever created the schedule
+	ctx = audit.WithMetadata(ctx, audit.Metadata{Actor: schedule.CreatedBy, RequestID: key})
+	ctx, span := transferTracer.Start(ctx, "TransferScheduler.run")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("schedule.id", int(schedule.ID)),
+		attribute.Int("schedule.occurrence", schedule.Occurrence),
+		attribute.Int("schedule.attempt", schedule.Attempts),
+	)
+
+	before := *schedule
+	transfer, runErr := s.execute(ctx, schedule, key)
+
+	now := s.now()
+	schedule.LastRunAt = &now
+	if transfer != nil {
+		schedule.LastTransferID = &transfer.ID
+	}
+
+	outcome := scheduleExecuted
+	if runErr != nil {
+		span.RecordError(runErr)
+		schedule.LastError = runErr.Error()
+		switch {
+		case errors.Is(runErr, models.ErrNotAccountOwner):
+			schedule.Status = models.ScheduleStatusCancelled
+			outcome = scheduleCancelled
+		case retryableRun(transfer, runErr) && s.retry(schedule, now):
+			outcome = scheduleRetried
+		default:
+			outcome = scheduleSkipped
+		}
+	} else {
+		schedule.LastError = ""
+	}
+	if outcome == scheduleExecuted || outcome == scheduleSkipped {
+		advanceSchedule(schedule, now)
+	}
+
+	span.SetAttributes(
+		attribute.String("schedule.outcome", outcome),
+		attribute.String("schedule.status", string(schedule.Status)),
+	)
+
+	err := s.repo.WithTransaction(ctx, func(tx repository.Store) error {
+		if err := tx.RecordScheduleRun(ctx, schedule); err != nil {
+			return err
+		}
+		if schedule.Status != before.Status {
+			return recordAudit(ctx, tx, models.AuditScheduleStatusChanged, models.AuditEntitySchedule, schedule.ID, before, schedule)
+		}
+		return nil
+	})
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("failed to record schedule run: %w", err)
+	}
+
+	telemetry.RecordScheduledTransfer(outcome)
+	return nil
+}
+
+// execute creates the transfer of the current occurrence, or returns the one
+// an interrupted run already created. A transfer that failed is returned
+// along with the error.
+func (s *TransferScheduler) execute(ctx context.Context, schedule *models.TransferSchedule, key string) (*models.Transfer, error) {
+	transfer, err := s.repo.GetTransferByScheduleKey(ctx, key)
+	if errors.Is(err, repository.ErrNotFound) {
+		if err := s.authorizeRun(ctx, schedule); err != nil {
+			return nil, err
+		}
+		transfer, err = s.transfers.CreateTransfer(ctx, models.CreateTransferRequest{
+			FromAccountNumber: schedule.FromAccountNumber,
+			ToAccountNumber:   schedule.ToAccountNumber,
+			Amount:            money.Decimal(schedule.Amount.String()),
+			Description:       schedule.Description,
+			ScheduleID:        schedule.ID,
+			ScheduleKey:       key,
+		})
+		if err != nil {
+			// The transfer may be recorded all the same: failed by the saga,
+			// with the code of the error, or created by a replica whose
+			// lease on the schedule expired
+			recorded, lookupErr := s.repo.GetTransferByScheduleKey(ctx, key)
+			if lookupErr != nil {
+				return nil, err
+			}
+			transfer = recorded
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get transfer: %w", err)
+	}
+
+	switch transfer.Status {
+	case models.TransferStatusFailed, models.TransferStatusCompensated, models.TransferStatusNeedsAttention:
+		return transfer, fmt.Errorf("transfer %d %s: %s", transfer.ID, transfer.Status, transfer.FailureReason)
+	}
+	return transfer, nil
+}
+
+// authorizeRun checks that the customer that created a schedule still owns
+// its source account. Runs create their transfers with access to every
+// account, so a customer removed as owner would otherwise keep debiting it.
+func (s *TransferScheduler) authorizeRun(ctx context.Context, schedule *models.TransferSchedule) error {
+	if schedule.CustomerID == nil {
+		return nil
+	}
+	account, err := s.transfers.accounts.GetAccountByNumber(ctx, schedule.FromAccountNumber)
+	if err != nil {
+		return fmt.Errorf("source account not found: %w", err)
+	}
+	if !account.OwnedBy(*schedule.CustomerID) {
+		return fmt.Errorf("%w: customer %d no longer owns %s", models.ErrNotAccountOwner, *schedule.CustomerID, account.AccountNumber)
+	}
+	return nil
+}
+
+// retryableRun tells whether a failed run may succeed later: the source
+// account lacked funds, or the transfer was not recorded for a reason that
+// is not a domain error, such as accounts-api being unreachable
+func retryableRun(transfer *models.Transfer, err error) bool {
+	if transfer != nil {
+		return transfer.FailureCode == models.ErrorCode(models.ErrInsufficientBalance)
+	}
+	return models.ErrorCode(err) == ""
+}
+
+// retry schedules another attempt at the current occurrence with exponential
+// backoff. It reports false when the attempts are exhausted or the retry
+// would run into the next occurrence.
+func (s *TransferScheduler) retry(schedule *models.TransferSchedule, now time.Time) bool {
+	if schedule.Attempts+1 >= scheduleMaxAttempts {
+		return false
+	}
+	backoff := scheduleRetryBackoff << schedule.Attempts
+	if backoff > scheduleMaxBackoff {
+		backoff = scheduleMaxBackoff
+	}
+	retryAt := now.Add(backoff)
+	if _, next, ok := schedule.NextOccurrenceAfter(now); ok && !retryAt.Before(next) {
+		return false
+	}
+
+	schedule.Attempts++
+	schedule.NextRunAt = retryAt
+	return true
+}
+
+// advanceSchedule moves a schedule past its current occurrence to the next
+// one due after now, skipping any it missed, or completes it when none is
+// left
+func advanceSchedule(schedule *models.TransferSchedule, now time.Time) {
+	schedule.Attempts = 0
+	n, at, ok := schedule.NextOccurrenceAfter(now)
+	if !ok {
+		schedule.Occurrence++
+		schedule.Status = models.ScheduleStatusCompleted
+		return
+	}
+	schedule.Occurrence = n
+	schedule.NextRunAt = at
+}
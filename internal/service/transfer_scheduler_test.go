@@ -0,0 +1,323 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/internal/repository"
+	"github.com/tribal/bank-api/pkg/money"
+)
+
+// newTestScheduler returns a scheduler for env whose clock tests control
+func newTestScheduler(env *testEnv) (*TransferScheduler, *testClock) {
+	clock := newTestClock()
+	scheduler := NewTransferScheduler(env.repo, env.transfers)
+	scheduler.now = clock.Now
+	return scheduler, clock
+}
+
+// createSchedule schedules a daily transfer of amount that is due now
+func (e *testEnv) createSchedule(t *testing.T, ctx context.Context, from, to *models.Account, amount string) *models.TransferSchedule {
+	t.Helper()
+	schedule, err := e.transfers.CreateSchedule(ctx, models.CreateScheduleRequest{
+		FromAccountNumber: from.AccountNumber,
+		ToAccountNumber:   to.AccountNumber,
+		Amount:            money.Decimal(amount),
+		Frequency:         models.ScheduleDaily,
+		StartAt:           time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("create schedule: %v", err)
+	}
+	return schedule
+}
+
+func (e *testEnv) schedule(t *testing.T, id uint) *models.TransferSchedule {
+	t.Helper()
+	schedule, err := e.repo.GetScheduleByID(asSystem(), id)
+	if err != nil {
+		t.Fatalf("get schedule %d: %v", id, err)
+	}
+	return schedule
+}
+
+func TestSchedulerRetriesWithBackoff(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+
+	from := env.createAccount(t, "0")
+	to := env.createAccount(t, "0")
+	created := env.createSchedule(t, ctx, from, to, "10.00")
+	scheduler, clock := newTestScheduler(env)
+
+	// Each retry of an occurrence waits twice as long as the one before
+	for attempt := 1; attempt < scheduleMaxAttempts; attempt++ {
+		if err := scheduler.ProcessDue(ctx); err != nil {
+			t.Fatalf("process due: %v", err)
+		}
+		got := env.schedule(t, created.ID)
+		backoff := scheduleRetryBackoff << (attempt - 1)
+		if got.Attempts != attempt || got.Occurrence != 0 {
+			t.Fatalf("attempt %d: got attempts %d of occurrence %d, want %d of 0", attempt, got.Attempts, got.Occurrence, attempt)
+		}
+		if want := clock.Now().Add(backoff); !got.NextRunAt.Equal(want) {
+			t.Fatalf("attempt %d: got next run %v, want %v", attempt, got.NextRunAt, want)
+		}
+		if !strings.Contains(got.LastError, "insufficient") {
+			t.Fatalf("attempt %d: got last error %q, want the lack of funds", attempt, got.LastError)
+		}
+
+		// Not due before the backoff has passed
+		clock.Advance(backoff - time.Second)
+		if err := scheduler.ProcessDue(ctx); err != nil {
+			t.Fatalf("process due: %v", err)
+		}
+		if got := env.schedule(t, created.ID); got.Attempts != attempt {
+			t.Fatalf("attempt %d ran again before its backoff", attempt)
+		}
+		clock.Advance(time.Second)
+	}
+
+	// The last attempt skips the occurrence and waits for the next one
+	if err := scheduler.ProcessDue(ctx); err != nil {
+		t.Fatalf("process due: %v", err)
+	}
+	got := env.schedule(t, created.ID)
+	if got.Attempts != 0 || got.Occurrence != 1 || !got.NextRunAt.Equal(got.OccurrenceAt(1)) {
+		t.Fatalf("after the last attempt: got attempts %d of occurrence %d due %v, want 0 of 1 due %v",
+			got.Attempts, got.Occurrence, got.NextRunAt, got.OccurrenceAt(1))
+	}
+	if got.Status != models.ScheduleStatusActive {
+		t.Fatalf("status: got %s, want active", got.Status)
+	}
+}
+
+func TestSchedulerRetryStopsBeforeNextOccurrence(t *testing.T) {
+	start := time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC)
+	schedule := &models.TransferSchedule{Frequency: models.ScheduleDaily, Every: 1, StartAt: start, NextRunAt: start}
+	scheduler := &TransferScheduler{}
+
+	schedule.Attempts = scheduleMaxAttempts - 1
+	if scheduler.retry(schedule, start) {
+		t.Fatalf("retry after %d attempts: got true, want the attempts exhausted", schedule.Attempts)
+	}
+	schedule.Attempts = scheduleMaxAttempts - 2
+	want := start.Add(scheduleRetryBackoff << schedule.Attempts)
+	if !scheduler.retry(schedule, start) || !schedule.NextRunAt.Equal(want) || schedule.Attempts != scheduleMaxAttempts-1 {
+		t.Fatalf("last retry: got attempt %d at %v, want %d at %v", schedule.Attempts, schedule.NextRunAt, scheduleMaxAttempts-1, want)
+	}
+
+	// A retry that would run into tomorrow's occurrence gives way to it
+	schedule.Attempts = 1
+	schedule.NextRunAt = start
+	late := start.Add(24*time.Hour - time.Minute)
+	if scheduler.retry(schedule, late) || !schedule.NextRunAt.Equal(start) {
+		t.Fatal("retry into the next occurrence: got true, want false")
+	}
+}
+
+func TestAdvanceSchedule(t *testing.T) {
+	start := time.Date(2025, 1, 31, 9, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 10)
+
+	tests := []struct {
+		name       string
+		schedule   models.TransferSchedule
+		now        time.Time
+		occurrence int
+		nextRunAt  time.Time
+		status     models.ScheduleStatus
+	}{
+		{
+			name:       "next occurrence",
+			schedule:   models.TransferSchedule{Frequency: models.ScheduleDaily, Every: 1},
+			now:        start,
+			occurrence: 1,
+			nextRunAt:  start.AddDate(0, 0, 1),
+			status:     models.ScheduleStatusActive,
+		},
+		{
+			name:       "missed occurrences are skipped",
+			schedule:   models.TransferSchedule{Frequency: models.ScheduleWeekly, Every: 2},
+			now:        start.AddDate(0, 0, 30),
+			occurrence: 3,
+			nextRunAt:  start.AddDate(0, 0, 42),
+			status:     models.ScheduleStatusActive,
+		},
+		{
+			name:       "monthly stays in the month",
+			schedule:   models.TransferSchedule{Frequency: models.ScheduleMonthly, Every: 1},
+			now:        start,
+			occurrence: 1,
+			nextRunAt:  time.Date(2025, 2, 28, 9, 0, 0, 0, time.UTC),
+			status:     models.ScheduleStatusActive,
+		},
+		{
+			name:       "once completes",
+			schedule:   models.TransferSchedule{Frequency: models.ScheduleOnce, Every: 1},
+			now:        start,
+			occurrence: 1,
+			nextRunAt:  start,
+			status:     models.ScheduleStatusCompleted,
+		},
+		{
+			name:       "past end completes",
+			schedule:   models.TransferSchedule{Frequency: models.ScheduleDaily, Every: 1, EndAt: &end},
+			now:        end,
+			occurrence: 1,
+			nextRunAt:  start,
+			status:     models.ScheduleStatusCompleted,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule := tt.schedule
+			schedule.StartAt = start
+			schedule.NextRunAt = start
+			schedule.Status = models.ScheduleStatusActive
+			schedule.Attempts = 3
+
+			advanceSchedule(&schedule, tt.now)
+
+			if schedule.Occurrence != tt.occurrence || !schedule.NextRunAt.Equal(tt.nextRunAt) || schedule.Status != tt.status {
+				t.Fatalf("got occurrence %d due %v %s, want %d due %v %s",
+					schedule.Occurrence, schedule.NextRunAt, schedule.Status, tt.occurrence, tt.nextRunAt, tt.status)
+			}
+			if schedule.Attempts != 0 {
+				t.Fatalf("attempts: got %d, want 0", schedule.Attempts)
+			}
+		})
+	}
+}
+
+func TestSchedulerSkipsLeasedSchedules(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+
+	from := env.createAccount(t, "100.00")
+	to := env.createAccount(t, "0")
+	created := env.createSchedule(t, ctx, from, to, "10.00")
+	scheduler, clock := newTestScheduler(env)
+
+	// Another replica holds the schedule
+	claimed, err := env.repo.ClaimSchedule(ctx, created.ID, clock.Now(), scheduleLease)
+	if err != nil || !claimed {
+		t.Fatalf("claim: got %v, %v, want true", claimed, err)
+	}
+	if claimed, _ := env.repo.ClaimSchedule(ctx, created.ID, clock.Now(), scheduleLease); claimed {
+		t.Fatal("second claim: got true, want the lease to hold")
+	}
+	if err := scheduler.ProcessDue(ctx); err != nil {
+		t.Fatalf("process due: %v", err)
+	}
+	if got := env.schedule(t, created.ID); got.LastRunAt != nil {
+		t.Fatal("a leased schedule ran")
+	}
+
+	// The replica died; once its lease expires the schedule runs here
+	clock.Advance(scheduleLease + time.Second)
+	if err := scheduler.ProcessDue(ctx); err != nil {
+		t.Fatalf("process due: %v", err)
+	}
+	got := env.schedule(t, created.ID)
+	if got.LastRunAt == nil || got.LastTransferID == nil || got.Occurrence != 1 {
+		t.Fatalf("after the lease expired: got last run %v, transfer %v, occurrence %d, want a run of occurrence 0",
+			got.LastRunAt, got.LastTransferID, got.Occurrence)
+	}
+	if got.LockedUntil != nil {
+		t.Fatalf("lease: got %v, want it released", got.LockedUntil)
+	}
+	if balance := env.balance(t, to.ID); balance != 1000 {
+		t.Fatalf("destination balance: got %d, want 1000", balance)
+	}
+}
+
+// failingClaims fails to claim one schedule, as a database error would
+type failingClaims struct {
+	repository.Repository
+	id uint
+}
+
+var errClaim = errors.New("claim failed")
+
+func (r *failingClaims) ClaimSchedule(ctx context.Context, id uint, now time.Time, lease time.Duration) (bool, error) {
+	if id == r.id {
+		return false, errClaim
+	}
+	return r.Repository.ClaimSchedule(ctx, id, now, lease)
+}
+
+func TestSchedulerContinuesAfterFailure(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+
+	from := env.createAccount(t, "100.00")
+	to := env.createAccount(t, "0")
+	broken := env.createSchedule(t, ctx, from, to, "10.00")
+	healthy := env.createSchedule(t, ctx, from, to, "5.00")
+
+	scheduler := NewTransferScheduler(&failingClaims{Repository: env.repo, id: broken.ID}, env.transfers)
+	scheduler.now = newTestClock().Now
+
+	err := scheduler.ProcessDue(ctx)
+	if !errors.Is(err, errClaim) || !strings.Contains(err.Error(), fmt.Sprintf("schedule %d", broken.ID)) {
+		t.Fatalf("process due: got %v, want the claim error of schedule %d", err, broken.ID)
+	}
+	if got := env.schedule(t, healthy.ID); got.LastTransferID == nil {
+		t.Fatal("the schedule after the failing one did not run")
+	}
+}
+
+func TestScheduleCancelledWhenCreatorRemovedAsOwner(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+
+	alice := env.createCustomer(t, "alice")
+	bob := env.createCustomer(t, "bob")
+	from := env.createAccount(t, "100.00", alice.ID, bob.ID)
+	to := env.createAccount(t, "0", alice.ID)
+	created := env.createSchedule(t, asCustomer(alice.ID), from, to, "10.00")
+	if created.CustomerID == nil || *created.CustomerID != alice.ID {
+		t.Fatalf("customer: got %v, want %d", created.CustomerID, alice.ID)
+	}
+
+	if _, err := env.accounts.RemoveOwner(ctx, from.ID, alice.ID); err != nil {
+		t.Fatalf("remove owner: %v", err)
+	}
+	scheduler, clock := newTestScheduler(env)
+	if err := scheduler.ProcessDue(ctx); err != nil {
+		t.Fatalf("process due: %v", err)
+	}
+
+	got := env.schedule(t, created.ID)
+	if got.Status != models.ScheduleStatusCancelled {
+		t.Fatalf("status: got %s, want cancelled", got.Status)
+	}
+	if got.LastTransferID != nil || !strings.Contains(got.LastError, "no longer owns") {
+		t.Fatalf("got transfer %v and last error %q, want no transfer and the lost ownership", got.LastTransferID, got.LastError)
+	}
+	if balance := env.balance(t, from.ID); balance != 10000 {
+		t.Fatalf("source balance: got %d, want 10000", balance)
+	}
+	actions := env.auditActions(t, models.AuditEntitySchedule, created.ID)
+	if !slices.Contains(actions, models.AuditScheduleStatusChanged) {
+		t.Fatalf("audit actions: got %v, want a status change", actions)
+	}
+
+	// Schedules created with access to every account are not tied to an
+	// owner
+	other := env.createSchedule(t, ctx, from, to, "10.00")
+	clock.Advance(time.Second)
+	if err := scheduler.ProcessDue(ctx); err != nil {
+		t.Fatalf("process due: %v", err)
+	}
+	if got := env.schedule(t, other.ID); got.Status != models.ScheduleStatusActive || got.LastTransferID == nil {
+		t.Fatalf("operator schedule: got %s with transfer %v, want an active schedule that ran", got.Status, got.LastTransferID)
+	}
+}
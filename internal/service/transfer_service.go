@@ -2,135 +2,429 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/tribal/bank-api/internal/auth"
+	"github.com/tribal/bank-api/internal/fx"
 	"github.com/tribal/bank-api/internal/models"
 	"github.com/tribal/bank-api/internal/repository"
+	"github.com/tribal/bank-api/internal/tier"
+	"github.com/tribal/bank-api/pkg/money"
 	"github.com/tribal/bank-api/pkg/telemetry"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
-	"gorm.io/gorm"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var transferTracer = otel.Tracer("transfers-api")
 
+// AccountGateway gives access to accounts, which are owned by accounts-api.
+// transfers-api uses the HTTP client in internal/accountsclient; the
+// AccountService satisfies it in-process.
+type AccountGateway interface {
+	GetAccount(ctx context.Context, id uint) (*models.Account, error)
+	GetAccountByNumber(ctx context.Context, accountNumber string) (*models.Account, error)
+	PostEntry(ctx context.Context, accountID uint, entry models.AccountEntry) (*models.Account, error)
+	PlaceHold(ctx context.Context, accountID uint, hold models.AccountHoldRequest) (*models.Account, error)
+	ReleaseHold(ctx context.Context, accountID uint, key string) (*models.Account, error)
+}
+
 type TransferService struct {
-	repo *repository.Repository
+	repo     repository.Repository
+	accounts AccountGateway
+	rates    fx.RateProvider
+	saga     *TransferSaga
+	limits   VelocityLimits
+	tiers    *tier.Catalog
+	holdTTL  time.Duration
 }
 
-func NewTransferService(repo *repository.Repository) *TransferService {
-	return &TransferService{repo: repo}
+// NewTransferService creates the service. rates may be nil, in which case
+// transfers between accounts of different currencies are rejected. Outgoing
+// transfers are bounded by limits and by the tier of the source account.
+// Authorized transfers expire holdTTL after they are created.
+func NewTransferService(repo repository.Repository, accounts AccountGateway, rates fx.RateProvider, saga *TransferSaga, limits VelocityLimits, tiers *tier.Catalog, holdTTL time.Duration) *TransferService {
+	return &TransferService{repo: repo, accounts: accounts, rates: rates, saga: saga, limits: limits, tiers: tiers, holdTTL: holdTTL}
 }
 
+// CreateTransfer validates the request, records the transfer as pending
+// together with the first saga step and runs the saga. The returned transfer
+// is completed, or authorized when the request only asks for a hold, or
+// still pending if accounts-api could not be reached and the relay will
+// finish it later. Transfers that fail are returned as an error.
 func (s *TransferService) CreateTransfer(ctx context.Context, req models.CreateTransferRequest) (*models.Transfer, error) {
+	transfer, err := s.createTransfer(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	s.attachAccounts(ctx, transfer)
+
+	return transfer, nil
+}
+
+// createTransfer is CreateTransfer without the accounts attached. A transfer
+// that was recorded but failed is returned along with the error.
+func (s *TransferService) createTransfer(ctx context.Context, req models.CreateTransferRequest) (*models.Transfer, error) {
 	ctx, span := transferTracer.Start(ctx, "TransferService.CreateTransfer")
 	defer span.End()
 
 	span.SetAttributes(
 		attribute.String("transfer.from", req.FromAccountNumber),
 		attribute.String("transfer.to", req.ToAccountNumber),
-		attribute.Float64("transfer.amount", req.Amount),
+		attribute.String("transfer.amount", string(req.Amount)),
+		attribute.Bool("transfer.hold", req.Hold),
 	)
 
-	var transfer *models.Transfer
-	var fromAccount, toAccount *models.Account
+	if err := auth.Authorize(ctx, auth.PermTransfersCreate); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
 
-	// Execute transfer in a transaction
-	err := s.repo.WithTransaction(ctx, func(tx *gorm.DB) error {
-		// Get source account
-		var err error
-		fromAccount, err = s.repo.GetAccountByNumber(ctx, req.FromAccountNumber)
-		if err != nil {
-			return fmt.Errorf("source account not found: %w", err)
-		}
+	transfer := &models.Transfer{
+		Description: req.Description,
+		Status:      models.TransferStatusPending,
+	}
+	if req.ScheduleKey != "" {
+		transfer.ScheduleID = &req.ScheduleID
+		transfer.ScheduleKey = &req.ScheduleKey
+	}
+	if req.BatchID != 0 {
+		transfer.BatchID = &req.BatchID
+	}
+	firstStep := sagaStepDebit
+	if req.Hold {
+		expiresAt := time.Now().Add(s.holdTTL)
+		transfer.HoldExpiresAt = &expiresAt
+		firstStep = sagaStepHold
+	}
 
-		// Get destination account
-		toAccount, err = s.repo.GetAccountByNumber(ctx, req.ToAccountNumber)
-		if err != nil {
-			return fmt.Errorf("destination account not found: %w", err)
-		}
+	limits, err := s.prepareTransfer(ctx, req, transfer)
+	if err != nil {
+		span.RecordError(err)
+		recordTransferError(transfer, err)
+		return nil, err
+	}
 
-		// Check if accounts are different
-		if fromAccount.ID == toAccount.ID {
-			return fmt.Errorf("cannot transfer to the same account")
-		}
+	err = s.repo.WithTransaction(ctx, func(tx repository.Store) error {
+		return s.recordTransfer(ctx, tx, transfer, limits, firstStep)
+	})
+	if err != nil {
+		span.RecordError(err)
+		recordTransferError(transfer, err)
+		return nil, err
+	}
 
-		// Check sufficient balance (minimal validation as requested)
-		if fromAccount.Balance < req.Amount {
-			return fmt.Errorf("insufficient balance")
-		}
+	span.SetAttributes(attribute.Int("transfer.id", int(transfer.ID)))
 
-		// Update balances
-		fromAccount.Balance -= req.Amount
-		toAccount.Balance += req.Amount
+	if err := s.saga.Run(ctx, transfer.ID); err != nil {
+		span.RecordError(err)
+	}
 
-		if err := tx.Save(fromAccount).Error; err != nil {
-			return fmt.Errorf("failed to update source account: %w", err)
-		}
+	transfer, err = s.repo.GetTransferByID(ctx, transfer.ID)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to get transfer: %w", err)
+	}
 
-		if err := tx.Save(toAccount).Error; err != nil {
-			return fmt.Errorf("failed to update destination account: %w", err)
-		}
+	span.SetAttributes(attribute.String("transfer.status", string(transfer.Status)))
 
-		// Create transfer record
-		transfer = &models.Transfer{
-			FromAccountID: fromAccount.ID,
-			ToAccountID:   toAccount.ID,
-			Amount:        req.Amount,
-			Description:   req.Description,
-		}
+	switch transfer.Status {
+	case models.TransferStatusFailed, models.TransferStatusCompensated, models.TransferStatusNeedsAttention:
+		return transfer, &transferFailure{transfer: transfer}
+	}
 
-		if err := tx.Create(transfer).Error; err != nil {
-			return fmt.Errorf("failed to create transfer record: %w", err)
-		}
+	return transfer, nil
+}
 
-		// Create transactions for both accounts
-		reference := fmt.Sprintf("TRF-%d", transfer.ID)
+// transferFailure is the error of a transfer the saga finished without
+// moving its money as requested. It unwraps to the domain error recorded in
+// the failure code, or to models.ErrTransferFailed when there is none, so
+// callers can tell a rejected transfer from one that could not be attempted.
+type transferFailure struct {
+	transfer *models.Transfer
+}
 
-		withdrawalTx := &models.Transaction{
-			AccountID:   fromAccount.ID,
-			Type:        models.TransactionTypeTransfer,
-			Amount:      -req.Amount,
-			Reference:   reference,
-			Description: fmt.Sprintf("Transfer to %s", toAccount.AccountNumber),
-		}
+func (e *transferFailure) Error() string {
+	return fmt.Sprintf("transfer %d %s: %s", e.transfer.ID, e.transfer.Status, e.transfer.FailureReason)
+}
 
-		if err := tx.Create(withdrawalTx).Error; err != nil {
-			return fmt.Errorf("failed to create withdrawal transaction: %w", err)
+func (e *transferFailure) Unwrap() error {
+	if err := models.ErrorFromCode(e.transfer.FailureCode); err != nil {
+		return err
+	}
+	return models.ErrTransferFailed
+}
+
+// ValidateTransfer runs the checks of CreateTransfer without recording the
+// transfer: both accounts must be able to take part and the amount must be
+// within the limits of the source account as they stand. Whether the source
+// account can pay is only known when the saga debits it.
+func (s *TransferService) ValidateTransfer(ctx context.Context, req models.CreateTransferRequest) error {
+	ctx, span := transferTracer.Start(ctx, "TransferService.ValidateTransfer")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("transfer.from", req.FromAccountNumber),
+		attribute.String("transfer.to", req.ToAccountNumber),
+		attribute.String("transfer.amount", string(req.Amount)),
+	)
+
+	if err := auth.Authorize(ctx, auth.PermTransfersCreate); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	transfer := &models.Transfer{Description: req.Description}
+	limits, err := s.prepareTransfer(ctx, req, transfer)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	err = s.repo.WithTransaction(ctx, func(tx repository.Store) error {
+		if err := s.checkVelocity(ctx, tx, transfer); err != nil {
+			return err
 		}
+		return checkTierLimits(ctx, tx, transfer, limits)
+	})
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+// recordTransfer persists a prepared transfer and its first saga step in
+// tx, once the source account is known to be within its velocity and tier
+// limits. Transfers recorded earlier in tx count towards those limits.
+func (s *TransferService) recordTransfer(ctx context.Context, tx repository.Store, transfer *models.Transfer, limits tier.Limits, firstStep string) error {
+	if err := s.checkVelocity(ctx, tx, transfer); err != nil {
+		return err
+	}
+	if err := checkTierLimits(ctx, tx, transfer, limits); err != nil {
+		return err
+	}
+	if err := tx.CreateTransfer(ctx, transfer); err != nil {
+		return fmt.Errorf("failed to create transfer record: %w", err)
+	}
+	if err := recordAudit(ctx, tx, models.AuditTransferCreated, models.AuditEntityTransfer, transfer.ID, nil, transfer); err != nil {
+		return err
+	}
+	if err := tx.CreateOutboxMessage(ctx, newSagaMessage(ctx, transfer.ID, firstStep, "", time.Now())); err != nil {
+		return fmt.Errorf("failed to enqueue transfer: %w", err)
+	}
+	return nil
+}
 
-		depositTx := &models.Transaction{
-			AccountID:   toAccount.ID,
-			Type:        models.TransactionTypeTransfer,
-			Amount:      req.Amount,
-			Reference:   reference,
-			Description: fmt.Sprintf("Transfer from %s", fromAccount.AccountNumber),
+// recordTransferError counts a transfer that could not be recorded: as
+// rejected when it broke a limit and as failed otherwise. Transfers that
+// failed before their amounts were known, such as for a missing account or a
+// denied permission, have no currencies to label and are left to the HTTP
+// metrics.
+func recordTransferError(transfer *models.Transfer, err error) {
+	if transfer.Amount.Currency == "" || transfer.CreditAmount.Currency == "" {
+		return
+	}
+	if errors.Is(err, models.ErrTransferAmountRange) || errors.Is(err, models.ErrTransferRateExceeded) ||
+		errors.Is(err, models.ErrDailyAmountExceeded) || errors.Is(err, models.ErrTierLimitExceeded) {
+		telemetry.RecordTransferRejected(transfer.Amount, transfer.CreditAmount)
+		return
+	}
+	telemetry.RecordTransfer(transfer.Amount, transfer.CreditAmount, false)
+}
+
+// prepareTransfer resolves both accounts through accounts-api and computes
+// the amounts of each leg, filling in transfer. It returns the tier limits of
+// the source account once the amount is known to be within the
+// per-transaction ones. A historical transfer, whose OccurredAt is set, only
+// records the past: neither the status nor the limits of the accounts are
+// checked, and both legs must be in the same currency.
+func (s *TransferService) prepareTransfer(ctx context.Context, req models.CreateTransferRequest, transfer *models.Transfer) (tier.Limits, error) {
+	// Get source account
+	fromAccount, err := s.accounts.GetAccountByNumber(ctx, req.FromAccountNumber)
+	if err != nil {
+		return tier.Limits{}, fmt.Errorf("source account not found: %w", err)
+	}
+
+	// Get destination account
+	toAccount, err := s.accounts.GetAccountByNumber(ctx, req.ToAccountNumber)
+	if err != nil {
+		return tier.Limits{}, fmt.Errorf("destination account not found: %w", err)
+	}
+
+	// Check if accounts are different
+	if fromAccount.ID == toAccount.ID {
+		return tier.Limits{}, models.ErrSameAccount
+	}
+
+	// A caller allowed to send from its own accounts only must be acting
+	// for a customer who owns the source account
+	if err := auth.AuthorizeAccount(ctx, auth.PermTransfersCreate, fromAccount); err != nil {
+		return tier.Limits{}, fmt.Errorf("%w: %s", err, fromAccount.AccountNumber)
+	}
+
+	// Frozen and closed accounts can neither send nor receive. accounts-api
+	// enforces this again when the saga posts each leg.
+	historical := transfer.OccurredAt != nil
+	if !historical {
+		if err := fromAccount.CheckActive(); err != nil {
+			return tier.Limits{}, fmt.Errorf("source account: %w", err)
 		}
+		if err := toAccount.CheckActive(); err != nil {
+			return tier.Limits{}, fmt.Errorf("destination account: %w", err)
+		}
+	}
 
-		if err := tx.Create(depositTx).Error; err != nil {
-			return fmt.Errorf("failed to create deposit transaction: %w", err)
+	transfer.FromAccountID = fromAccount.ID
+	transfer.ToAccountID = toAccount.ID
+	transfer.FromAccountNumber = fromAccount.AccountNumber
+	transfer.ToAccountNumber = toAccount.AccountNumber
+
+	// The amount is expressed in the currency of the source account
+	transfer.Amount, err = req.Amount.Money(fromAccount.Currency())
+	if err != nil {
+		return tier.Limits{}, fmt.Errorf("invalid amount: %w", err)
+	}
+	if !transfer.Amount.IsPositive() {
+		return tier.Limits{}, fmt.Errorf("%w: amount must be greater than zero", money.ErrInvalidAmount)
+	}
+
+	if historical {
+		// The rate of the time is not known, so there is nothing to
+		// convert with
+		if fromAccount.Currency() != toAccount.Currency() {
+			return tier.Limits{}, fmt.Errorf("%w: source in %s, destination in %s", models.ErrCurrencyMismatch, fromAccount.Currency(), toAccount.Currency())
 		}
+		transfer.CreditAmount = transfer.Amount
+		transfer.ReversedAmount = money.Zero(transfer.Amount.Currency)
+		transfer.ReversedCreditAmount = money.Zero(transfer.CreditAmount.Currency)
+		return tier.Limits{}, nil
+	}
 
-		return nil
-	})
+	limits, err := s.tierLimits(fromAccount)
+	if err != nil {
+		return tier.Limits{}, err
+	}
+	if err := checkTransactionLimits(transfer.Amount, limits); err != nil {
+		return tier.Limits{}, err
+	}
 
+	// Convert into the destination currency when the accounts differ
+	transfer.CreditAmount, transfer.FXRate, err = s.convert(ctx, transfer.Amount, toAccount.Currency())
+	if err != nil {
+		return tier.Limits{}, err
+	}
+
+	transfer.ReversedAmount = money.Zero(transfer.Amount.Currency)
+	transfer.ReversedCreditAmount = money.Zero(transfer.CreditAmount.Currency)
+
+	return limits, nil
+}
+
+// attachAccounts resolves the current state of both accounts from
+// accounts-api; a lookup failure is not fatal
+func (s *TransferService) attachAccounts(ctx context.Context, transfer *models.Transfer) {
+	span := trace.SpanFromContext(ctx)
+	if account, err := s.accounts.GetAccount(ctx, transfer.FromAccountID); err == nil {
+		transfer.FromAccount = account
+	} else {
+		span.RecordError(err)
+	}
+	if account, err := s.accounts.GetAccount(ctx, transfer.ToAccountID); err == nil {
+		transfer.ToAccount = account
+	} else {
+		span.RecordError(err)
+	}
+}
+
+// convert returns the amount credited to an account in the target currency
+// and the applied rate, or an empty rate when no conversion is needed
+func (s *TransferService) convert(ctx context.Context, amount money.Money, target money.Currency) (money.Money, string, error) {
+	if amount.Currency == target {
+		return amount, "", nil
+	}
+	if s.rates == nil {
+		return money.Money{}, "", fmt.Errorf("%w: cross-currency transfers are not supported (%s to %s)", models.ErrCurrencyMismatch, amount.Currency, target)
+	}
+
+	ctx, span := transferTracer.Start(ctx, "TransferService.convert")
+	defer span.End()
+
+	rate, err := s.rates.Rate(ctx, amount.Currency, target)
+	if err != nil {
+		span.RecordError(err)
+		return money.Money{}, "", fmt.Errorf("failed to get exchange rate: %w", err)
+	}
+
+	converted, err := fx.Convert(amount, rate)
+	if err != nil {
+		span.RecordError(err)
+		return money.Money{}, "", fmt.Errorf("failed to convert amount: %w", err)
+	}
+
+	span.SetAttributes(
+		attribute.String("fx.pair", fmt.Sprintf("%s/%s", rate.From, rate.To)),
+		attribute.String("fx.rate", rate.String()),
+	)
+
+	return converted, rate.String(), nil
+}
+
+// ListTransfers returns a page of transfers, newest first by default. Amount
+// filters apply to the debited amount and are read in the currency filter,
+// or the default currency. Callers limited to their own accounts must filter
+// by one of them, which lists the transfers to and from it.
+func (s *TransferService) ListTransfers(ctx context.Context, q models.ListQuery) (*models.Page[models.Transfer], error) {
+	ctx, span := transferTracer.Start(ctx, "TransferService.ListTransfers")
+	defer span.End()
+
+	if err := auth.Authorize(ctx, auth.PermTransfersRead); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	currency, err := money.ParseCurrency(q.Currency)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("%w: %w", models.ErrInvalidListQuery, err)
+	}
+	opts, err := listOptions(q, currency)
 	if err != nil {
 		span.RecordError(err)
-		// Record failed transfer
-		telemetry.RecordTransfer(req.Amount, false)
 		return nil, err
 	}
+	if q.Currency != "" {
+		opts.Currency = string(currency)
+	}
 
-	// Record successful transfer
-	telemetry.RecordTransfer(req.Amount, true)
-	telemetry.UpdateAccountBalance(fromAccount.AccountNumber, fromAccount.Balance)
-	telemetry.UpdateAccountBalance(toAccount.AccountNumber, toAccount.Balance)
+	if auth.Allowed(ctx, auth.PermTransfersRead) == auth.ScopeOwn {
+		if q.AccountNumber == "" {
+			err := fmt.Errorf("%w: account_number is required to list the transfers of your accounts", models.ErrInvalidListQuery)
+			span.RecordError(err)
+			return nil, err
+		}
+		account, err := s.accounts.GetAccountByNumber(ctx, q.AccountNumber)
+		if err != nil {
+			span.RecordError(err)
+			return nil, fmt.Errorf("failed to get account: %w", err)
+		}
+		if err := auth.AuthorizeAccount(ctx, auth.PermTransfersRead, account); err != nil {
+			span.RecordError(err)
+			return nil, err
+		}
+	}
 
-	// Load the full transfer with related accounts
-	transfer.FromAccount = *fromAccount
-	transfer.ToAccount = *toAccount
+	transfers, next, err := s.repo.ListTransfers(ctx, opts)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("failed to list transfers: %w", err)
+	}
 
-	return transfer, nil
+	span.SetAttributes(attribute.Int("transfers.count", len(transfers)))
+
+	return &models.Page[models.Transfer]{Data: transfers, NextCursor: next}, nil
 }
 
 func (s *TransferService) GetTransfer(ctx context.Context, id uint) (*models.Transfer, error) {
@@ -139,10 +433,24 @@ func (s *TransferService) GetTransfer(ctx context.Context, id uint) (*models.Tra
 
 	span.SetAttributes(attribute.Int("transfer.id", int(id)))
 
+	if err := auth.Authorize(ctx, auth.PermTransfersRead); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
 	transfer, err := s.repo.GetTransferByID(ctx, id)
 	if err != nil {
 		span.RecordError(err)
-		return nil, fmt.Errorf("failed to get transfer: %w", err)
+		return nil, fmt.Errorf("failed to get transfer: %w", transferNotFound(err))
+	}
+
+	s.attachAccounts(ctx, transfer)
+
+	// Callers limited to their own accounts can read transfers from or to
+	// one of them
+	if err := auth.AuthorizeAnyAccount(ctx, auth.PermTransfersRead, transfer.FromAccount, transfer.ToAccount); err != nil {
+		span.RecordError(err)
+		return nil, err
 	}
 
 	return transfer, nil
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/pkg/money"
+)
+
+// transferCounts returns the value of bank_transfers_total by series, keyed
+// by status and currencies
+func transferCounts(t *testing.T) map[string]float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("gather metrics: %v", err)
+	}
+	counts := map[string]float64{}
+	for _, family := range families {
+		if family.GetName() != "bank_transfers_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			key := labels["status"] + " " + labels["from_currency"] + ">" + labels["to_currency"]
+			counts[key] = metric.GetCounter().GetValue()
+		}
+	}
+	return counts
+}
+
+func TestCustomerReadsOwnTransfers(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+
+	alice := env.createCustomer(t, "alice")
+	bob := env.createCustomer(t, "bob")
+	aliceAccount := env.createAccount(t, "100.00", alice.ID)
+	bobAccount := env.createAccount(t, "100.00", bob.ID)
+	other := env.createAccount(t, "0")
+
+	send := func(from, to *models.Account) *models.Transfer {
+		t.Helper()
+		transfer, err := env.transfers.CreateTransfer(ctx, models.CreateTransferRequest{
+			FromAccountNumber: from.AccountNumber,
+			ToAccountNumber:   to.AccountNumber,
+			Amount:            money.Decimal("1.00"),
+		})
+		if err != nil {
+			t.Fatalf("create transfer: %v", err)
+		}
+		return transfer
+	}
+	toBob := send(aliceAccount, bobAccount)
+	toOther := send(bobAccount, other)
+
+	asAlice := asCustomer(alice.ID)
+
+	if _, err := env.transfers.GetTransfer(asAlice, toBob.ID); err != nil {
+		t.Fatalf("alice reading her transfer: %v", err)
+	}
+	if _, err := env.transfers.GetTransfer(asCustomer(bob.ID), toBob.ID); err != nil {
+		t.Fatalf("bob reading a transfer he received: %v", err)
+	}
+	if _, err := env.transfers.GetTransfer(asAlice, toOther.ID); !errors.Is(err, models.ErrNotAccountOwner) {
+		t.Fatalf("alice reading another transfer: got %v, want ErrNotAccountOwner", err)
+	}
+
+	if _, err := env.transfers.ListTransfers(asAlice, models.ListQuery{}); !errors.Is(err, models.ErrInvalidListQuery) {
+		t.Fatalf("alice listing every transfer: got %v, want ErrInvalidListQuery", err)
+	}
+	if _, err := env.transfers.ListTransfers(asAlice, models.ListQuery{AccountNumber: bobAccount.AccountNumber}); !errors.Is(err, models.ErrNotAccountOwner) {
+		t.Fatalf("alice listing bob's transfers: got %v, want ErrNotAccountOwner", err)
+	}
+	page, err := env.transfers.ListTransfers(asAlice, models.ListQuery{AccountNumber: aliceAccount.AccountNumber})
+	if err != nil {
+		t.Fatalf("alice listing her transfers: %v", err)
+	}
+	if len(page.Data) != 1 || page.Data[0].ID != toBob.ID {
+		t.Fatalf("alice's transfers: got %d, want transfer %d only", len(page.Data), toBob.ID)
+	}
+
+	batch, err := env.transfers.CreateBatch(asCustomer(bob.ID), models.CreateTransferBatchRequest{
+		Mode: models.BatchModeBestEffort,
+		Transfers: []models.CreateTransferRequest{
+			{FromAccountNumber: bobAccount.AccountNumber, ToAccountNumber: aliceAccount.AccountNumber, Amount: "2.00"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("create batch: %v", err)
+	}
+	if _, err := env.transfers.GetBatch(asCustomer(bob.ID), batch.ID); err != nil {
+		t.Fatalf("bob reading his batch: %v", err)
+	}
+	if _, err := env.transfers.GetBatch(asAlice, batch.ID); !errors.Is(err, models.ErrNotAccountOwner) {
+		t.Fatalf("alice reading bob's batch: got %v, want ErrNotAccountOwner", err)
+	}
+}
+
+func TestTransferMetricsNeedCurrencies(t *testing.T) {
+	ctx := asSystem()
+	env := newTestEnv(t)
+
+	customer := env.createCustomer(t, "carol")
+	from := env.createAccount(t, "100.00")
+	to := env.createAccount(t, "0")
+	before := transferCounts(t)
+
+	// Neither failure gets far enough to know the currencies
+	missing := models.CreateTransferRequest{FromAccountNumber: "ACC-MISSING", ToAccountNumber: to.AccountNumber, Amount: "10.00"}
+	if _, err := env.transfers.CreateTransfer(ctx, missing); err == nil {
+		t.Fatal("transfer from a missing account: got no error")
+	}
+	denied := models.CreateTransferRequest{FromAccountNumber: from.AccountNumber, ToAccountNumber: to.AccountNumber, Amount: "10.00"}
+	if _, err := env.transfers.CreateTransfer(asCustomer(customer.ID), denied); !errors.Is(err, models.ErrNotAccountOwner) {
+		t.Fatalf("transfer from another customer's account: got %v, want %v", err, models.ErrNotAccountOwner)
+	}
+
+	// A transfer that is refused once its amounts are known still counts
+	tooMuch := models.CreateTransferRequest{FromAccountNumber: from.AccountNumber, ToAccountNumber: to.AccountNumber, Amount: "500.00"}
+	if _, err := env.transfers.CreateTransfer(ctx, tooMuch); err == nil {
+		t.Fatal("transfer over the balance: got no error")
+	}
+
+	after := transferCounts(t)
+	for key, value := range after {
+		if value != before[key] && key != "failed USD>USD" {
+			t.Errorf("%s: counted %v more, want only failed USD>USD to change", key, value-before[key])
+		}
+	}
+	if got := after["failed USD>USD"] - before["failed USD>USD"]; got != 1 {
+		t.Errorf("failed USD>USD: counted %v more, want 1", got)
+	}
+}
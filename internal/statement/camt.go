@@ -0,0 +1,114 @@
+package statement
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/pkg/money"
+)
+
+// camtNamespace is the version of the ISO 20022 bank-to-customer statement
+// written by camtWriter
+const camtNamespace = "urn:iso:std:iso:20022:tech:xsd:camt.053.001.08"
+
+// camtWriter writes an ISO 20022 camt.053 statement. The schema puts both
+// balances before the entries, so the closing balance must be known upfront.
+// Memo lines are entries with status INFO, given for information only.
+type camtWriter struct {
+	w io.Writer
+}
+
+func (c *camtWriter) begin(s *models.Statement) error {
+	id := statementID(s)
+	_, err := fmt.Fprintf(c.w, `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="%s">
+  <BkToCstmrStmt>
+    <GrpHdr>
+      <MsgId>%s</MsgId>
+      <CreDtTm>%s</CreDtTm>
+    </GrpHdr>
+    <Stmt>
+      <Id>%s</Id>
+      <CreDtTm>%s</CreDtTm>
+      <FrToDt>
+        <FrDtTm>%s</FrDtTm>
+        <ToDtTm>%s</ToDtTm>
+      </FrToDt>
+      <Acct>
+        <Id><Othr><Id>%s</Id></Othr></Id>
+        <Ccy>%s</Ccy>
+      </Acct>
+%s%s`,
+		camtNamespace, id, camtTime(s.CreatedAt), id, camtTime(s.CreatedAt),
+		camtTime(s.From), camtTime(s.To),
+		escape(s.Account.AccountNumber), s.Account.Currency(),
+		camtBalance("OPBD", s.OpeningBalance, s.From), camtBalance("CLBD", s.ClosingBalance, s.To))
+	return err
+}
+
+// camtBalance writes a balance of the given type: OPBD (opening booked) or
+// CLBD (closing booked)
+func camtBalance(kind string, balance money.Money, at time.Time) string {
+	return fmt.Sprintf(`      <Bal>
+        <Tp><CdOrPrtry><Cd>%s</Cd></CdOrPrtry></Tp>
+        <Amt Ccy="%s">%s</Amt>
+        <CdtDbtInd>%s</CdtDbtInd>
+        <Dt><DtTm>%s</DtTm></Dt>
+      </Bal>
+`, kind, balance.Currency, abs(balance), creditDebit(balance), camtTime(at))
+}
+
+func (c *camtWriter) line(t *models.Transaction, _ money.Money) error {
+	reversal := ""
+	if t.Type == models.TransactionTypeReversal {
+		reversal = "\n        <RvslInd>true</RvslInd>"
+	}
+	reference := ""
+	if t.Reference != "" {
+		reference = fmt.Sprintf("\n        <AcctSvcrRef>%s</AcctSvcrRef>", escape(clip(t.Reference, 35)))
+	}
+	status := "BOOK"
+	if memo(t) {
+		status = "INFO"
+	}
+	info := ""
+	if t.Description != "" {
+		info = fmt.Sprintf("\n        <AddtlNtryInf>%s</AddtlNtryInf>", escape(clip(t.Description, 500)))
+	}
+
+	_, err := fmt.Fprintf(c.w, `      <Ntry>
+        <NtryRef>%d</NtryRef>
+        <Amt Ccy="%s">%s</Amt>
+        <CdtDbtInd>%s</CdtDbtInd>%s
+        <Sts><Cd>%s</Cd></Sts>
+        <BookgDt><DtTm>%s</DtTm></BookgDt>%s
+        <BkTxCd><Prtry><Cd>%s</Cd></Prtry></BkTxCd>%s
+      </Ntry>
+`,
+		t.ID, t.Amount.Currency, abs(t.Amount), creditDebit(t.Amount), reversal,
+		status, camtTime(t.CreatedAt), reference, t.Type, info)
+	return err
+}
+
+func (c *camtWriter) end(*models.Statement) error {
+	_, err := io.WriteString(c.w, `    </Stmt>
+  </BkToCstmrStmt>
+</Document>
+`)
+	return err
+}
+
+// creditDebit returns the ISO 20022 indicator of the sign of an amount. Zero
+// balances are reported as credits.
+func creditDebit(m money.Money) string {
+	if m.IsNegative() {
+		return "DBIT"
+	}
+	return "CRDT"
+}
+
+func camtTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,68 @@
+package statement
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/pkg/money"
+)
+
+// Types of the rows of a CSV statement that are not transactions
+const (
+	csvOpeningBalance = "opening_balance"
+	csvClosingBalance = "closing_balance"
+)
+
+// csvMemo fills the balance of memo lines
+const csvMemo = "memo"
+
+// csvWriter writes a single table: a row for the opening balance, a row per
+// transaction with the balance after it and a row for the closing balance,
+// so the file can be loaded into a spreadsheet as is. Memo lines read "memo"
+// instead of a balance.
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (c *csvWriter) begin(s *models.Statement) error {
+	if err := c.w.Write([]string{"date", "transaction_id", "type", "reference", "description", "amount", "currency", "balance"}); err != nil {
+		return err
+	}
+	return c.balance(s.From, csvOpeningBalance, s.OpeningBalance)
+}
+
+func (c *csvWriter) line(t *models.Transaction, balance money.Money) error {
+	after := balance.String()
+	if memo(t) {
+		after = csvMemo
+	}
+	return c.w.Write([]string{
+		t.CreatedAt.UTC().Format(time.RFC3339),
+		strconv.FormatUint(uint64(t.ID), 10),
+		string(t.Type),
+		t.Reference,
+		t.Description,
+		t.Amount.String(),
+		string(t.Amount.Currency),
+		after,
+	})
+}
+
+func (c *csvWriter) end(s *models.Statement) error {
+	if err := c.balance(s.To, csvClosingBalance, s.ClosingBalance); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvWriter) balance(at time.Time, kind string, balance money.Money) error {
+	return c.w.Write([]string{at.UTC().Format(time.RFC3339), "", kind, "", "", "", string(balance.Currency), balance.String()})
+}
@@ -0,0 +1,133 @@
+package statement
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/pkg/money"
+)
+
+// ofxBankID fills the routing number OFX requires for bank accounts. Accounts
+// of this API are identified by their number alone.
+const ofxBankID = "BANKAPI"
+
+// ofxWriter writes an OFX 2.2 bank statement response, the format personal
+// finance software imports. OFX has no opening balance element, so it goes
+// in the balance list next to the closing (ledger) balance. It has no memo
+// lines either, and the software adds up every transaction it imports, so
+// memo lines are left out.
+type ofxWriter struct {
+	w io.Writer
+}
+
+func (o *ofxWriter) begin(s *models.Statement) error {
+	_, err := fmt.Fprintf(o.w, `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>
+<OFX>
+  <SIGNONMSGSRSV1>
+    <SONRS>
+      <STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>
+      <DTSERVER>%s</DTSERVER>
+      <LANGUAGE>ENG</LANGUAGE>
+    </SONRS>
+  </SIGNONMSGSRSV1>
+  <BANKMSGSRSV1>
+    <STMTTRNRS>
+      <TRNUID>%s</TRNUID>
+      <STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>
+      <STMTRS>
+        <CURDEF>%s</CURDEF>
+        <BANKACCTFROM>
+          <BANKID>%s</BANKID>
+          <ACCTID>%s</ACCTID>
+          <ACCTTYPE>CHECKING</ACCTTYPE>
+        </BANKACCTFROM>
+        <BANKTRANLIST>
+          <DTSTART>%s</DTSTART>
+          <DTEND>%s</DTEND>
+`,
+		ofxTime(s.CreatedAt), statementID(s), s.Account.Currency(), ofxBankID, escape(s.Account.AccountNumber),
+		ofxTime(s.From), ofxTime(s.To))
+	return err
+}
+
+func (o *ofxWriter) line(t *models.Transaction, _ money.Money) error {
+	if memo(t) {
+		return nil
+	}
+	name := t.Reference
+	if name == "" {
+		name = string(t.Type)
+	}
+	memo := ""
+	if t.Description != "" {
+		memo = fmt.Sprintf("\n            <MEMO>%s</MEMO>", escape(clip(t.Description, 255)))
+	}
+	_, err := fmt.Fprintf(o.w, `          <STMTTRN>
+            <TRNTYPE>%s</TRNTYPE>
+            <DTPOSTED>%s</DTPOSTED>
+            <TRNAMT>%s</TRNAMT>
+            <FITID>%d</FITID>
+            <NAME>%s</NAME>%s
+          </STMTTRN>
+`,
+		ofxTransactionType(t), ofxTime(t.CreatedAt), t.Amount, t.ID,
+		escape(clip(name, 32)), memo)
+	return err
+}
+
+func (o *ofxWriter) end(s *models.Statement) error {
+	_, err := fmt.Fprintf(o.w, `        </BANKTRANLIST>
+        <LEDGERBAL>
+          <BALAMT>%s</BALAMT>
+          <DTASOF>%s</DTASOF>
+        </LEDGERBAL>
+        <BALLIST>
+          <BAL>
+            <NAME>Opening balance</NAME>
+            <DESC>Balance at the start of the statement</DESC>
+            <BALTYPE>DOLLAR</BALTYPE>
+            <VALUE>%s</VALUE>
+            <DTASOF>%s</DTASOF>
+          </BAL>
+        </BALLIST>
+      </STMTRS>
+    </STMTTRNRS>
+  </BANKMSGSRSV1>
+</OFX>
+`,
+		s.ClosingBalance, ofxTime(s.To), s.OpeningBalance, ofxTime(s.From))
+	return err
+}
+
+// ofxTransactionType maps a transaction to an OFX TRNTYPE. Reversals are
+// plain credits or debits.
+func ofxTransactionType(t *models.Transaction) string {
+	switch t.Type {
+	case models.TransactionTypeDeposit:
+		return "DEP"
+	case models.TransactionTypeTransfer:
+		return "XFER"
+	case models.TransactionTypeFee:
+		return "FEE"
+	}
+	if t.Amount.IsNegative() {
+		return "DEBIT"
+	}
+	return "CREDIT"
+}
+
+func ofxTime(t time.Time) string {
+	return t.UTC().Format("20060102150405.000") + "[0:GMT]"
+}
+
+// escape escapes text for XML character data
+func escape(text string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(text))
+	return b.String()
+}
@@ -0,0 +1,150 @@
+// Package statement writes account statements in the file formats banks
+// exchange them in. Lines are written as they are read, so statements of any
+// length are exported in constant memory.
+package statement
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/pkg/money"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var tracer = otel.Tracer("statement")
+
+// formatWriter writes one format. begin is called with the header, line with
+// each transaction and the balance after it, and end once all lines are
+// written. Memo lines are passed to line with the balance unchanged.
+type formatWriter interface {
+	begin(s *models.Statement) error
+	line(t *models.Transaction, balance money.Money) error
+	end(s *models.Statement) error
+}
+
+// Formats lists the formats statements can be exported in
+var Formats = []models.StatementFormat{models.StatementCSV, models.StatementText, models.StatementOFX, models.StatementCAMT053}
+
+// ContentType returns the media type of a format
+func ContentType(format models.StatementFormat) string {
+	switch format {
+	case models.StatementCSV:
+		return "text/csv; charset=utf-8"
+	case models.StatementOFX:
+		return "application/x-ofx"
+	case models.StatementCAMT053:
+		return "application/xml"
+	default:
+		return "text/plain; charset=utf-8"
+	}
+}
+
+// Filename returns the name a statement is downloaded as
+func Filename(s *models.Statement) string {
+	ext := string(s.Format)
+	if s.Format == models.StatementCAMT053 {
+		ext = "xml"
+	}
+	return fmt.Sprintf("statement-%s-%s.%s", s.Account.AccountNumber, s.From.UTC().Format("20060102"), ext)
+}
+
+// Write writes the statement s to w in its format. each calls its argument with
+// the transactions of the statement in order, stopping at the first error.
+// Historical transactions are written as memo lines, see memo. The other
+// lines must add up to the closing balance of s; otherwise the statement is
+// written anyway and an error is returned.
+func Write(ctx context.Context, w io.Writer, s *models.Statement, each func(fn func(*models.Transaction) error) error) error {
+	_, span := tracer.Start(ctx, "statement.Write")
+	defer span.End()
+
+	format := s.Format
+	span.SetAttributes(
+		attribute.Int("account.id", int(s.Account.ID)),
+		attribute.String("statement.format", string(format)),
+	)
+
+	buf := bufio.NewWriter(w)
+	var fw formatWriter
+	switch format {
+	case models.StatementCSV:
+		fw = newCSVWriter(buf)
+	case models.StatementText:
+		fw = &textWriter{w: buf}
+	case models.StatementOFX:
+		fw = &ofxWriter{w: buf}
+	case models.StatementCAMT053:
+		fw = &camtWriter{w: buf}
+	default:
+		err := fmt.Errorf("%w: unknown format %q", models.ErrInvalidStatement, format)
+		span.RecordError(err)
+		return err
+	}
+
+	lines := 0
+	balance := s.OpeningBalance
+	err := fw.begin(s)
+	if err == nil {
+		err = each(func(t *models.Transaction) error {
+			if !memo(t) {
+				var err error
+				if balance, err = balance.Add(t.Amount); err != nil {
+					return err
+				}
+			}
+			lines++
+			return fw.line(t, balance)
+		})
+	}
+	if err == nil {
+		err = fw.end(s)
+	}
+	if err == nil {
+		err = buf.Flush()
+	}
+	if err == nil && balance != s.ClosingBalance {
+		err = fmt.Errorf("statement lines add up to %s, closing balance is %s", balance, s.ClosingBalance)
+	}
+
+	span.SetAttributes(attribute.Int("statement.lines", lines))
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+// memo reports whether a transaction is listed as a memo line: a historical
+// transaction, imported with an account whose loaded balance already includes
+// it. Memo lines show the history of the account but leave the balance of the
+// statement alone.
+func memo(t *models.Transaction) bool {
+	return t.OccurredAt != nil
+}
+
+// statementID identifies a statement in the formats that carry one. It fits
+// the 35 characters ISO 20022 allows.
+func statementID(s *models.Statement) string {
+	return fmt.Sprintf("STMT-%d-%s-%s", s.Account.ID, s.From.UTC().Format("20060102"), s.To.UTC().Format("20060102"))
+}
+
+// clip shortens text to at most n characters
+func clip(text string, n int) string {
+	if utf8.RuneCountInString(text) <= n {
+		return text
+	}
+	runes := []rune(text)
+	return string(runes[:n-1]) + "~"
+}
+
+// abs returns the magnitude of an amount; the formats that need it give the
+// sign as a credit or debit indicator
+func abs(m money.Money) money.Money {
+	if m.IsNegative() {
+		return m.Neg()
+	}
+	return m
+}
@@ -0,0 +1,143 @@
+package statement
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/pkg/money"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func usd(minor int64) money.Money {
+	return money.New(minor, "USD")
+}
+
+// fixture is a statement whose lines cover every transaction type, a memo
+// line of imported history, a debit balance and text that has to be escaped
+// or clipped
+func fixture() (*models.Statement, []models.Transaction) {
+	from := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	day := func(d int, hour int) time.Time { return from.AddDate(0, 0, d-1).Add(time.Duration(hour) * time.Hour) }
+	imported := day(3, 10)
+
+	s := &models.Statement{
+		Account:        &models.Account{ID: 7, AccountNumber: "ACC-001", Balance: usd(0)},
+		From:           from,
+		To:             from.AddDate(0, 1, 0),
+		OpeningBalance: usd(10000),
+		ClosingBalance: usd(-5950),
+		Format:         models.StatementCSV,
+		CreatedAt:      time.Date(2026, 11, 1, 8, 30, 0, 0, time.UTC),
+	}
+	transactions := []models.Transaction{
+		{ID: 101, Type: models.TransactionTypeDeposit, Amount: usd(25000), Reference: "ATM-0001", Description: "Depósito en cajero", CreatedAt: day(2, 9)},
+		{ID: 240, Type: models.TransactionTypeTransfer, Amount: usd(-3000), Reference: "TRF-88", Description: "Imported from the previous core", OccurredAt: &imported, CreatedAt: imported},
+		{ID: 102, Type: models.TransactionTypeTransfer, Amount: usd(-42050), Reference: "TRF-12", Description: "Rent & <utilities> for October, paid early", CreatedAt: day(5, 14)},
+		{ID: 103, Type: models.TransactionTypeFee, Amount: usd(-200), Reference: "FEE-3", Description: "Overdraft fee", CreatedAt: day(5, 15)},
+		{ID: 104, Type: models.TransactionTypeReversal, Amount: usd(4000), Reference: "TRF-9", CreatedAt: day(20, 11)},
+		{ID: 105, Type: models.TransactionTypeWithdrawal, Amount: usd(-2700), CreatedAt: day(31, 23)},
+	}
+	return s, transactions
+}
+
+func write(t *testing.T, format models.StatementFormat, s *models.Statement, transactions []models.Transaction) []byte {
+	t.Helper()
+	s.Format = format
+	var buf bytes.Buffer
+	err := Write(context.Background(), &buf, s, func(fn func(*models.Transaction) error) error {
+		for i := range transactions {
+			if err := fn(&transactions[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("write %s: %v", format, err)
+	}
+	return buf.Bytes()
+}
+
+func TestGolden(t *testing.T) {
+	golden := map[models.StatementFormat]string{
+		models.StatementCSV:     "statement.csv",
+		models.StatementText:    "statement.txt",
+		models.StatementOFX:     "statement.ofx",
+		models.StatementCAMT053: "statement.camt053.xml",
+	}
+	for _, format := range Formats {
+		t.Run(string(format), func(t *testing.T) {
+			s, transactions := fixture()
+			got := write(t, format, s, transactions)
+
+			path := filepath.Join("testdata", golden[format])
+			if *update {
+				if err := os.WriteFile(path, got, 0o644); err != nil {
+					t.Fatalf("update golden file: %v", err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("read golden file: %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("%s differs from the golden file; got:\n%s", format, got)
+			}
+
+			if format == models.StatementOFX || format == models.StatementCAMT053 {
+				if err := xml.Unmarshal(got, new(struct{})); err != nil {
+					t.Fatalf("%s is not well-formed XML: %v", format, err)
+				}
+			}
+		})
+	}
+}
+
+func TestEmptyStatement(t *testing.T) {
+	s, _ := fixture()
+	s.ClosingBalance = s.OpeningBalance
+
+	got := write(t, models.StatementCSV, s, nil)
+	want := "date,transaction_id,type,reference,description,amount,currency,balance\n" +
+		"2026-10-01T00:00:00Z,,opening_balance,,,,USD,100.00\n" +
+		"2026-11-01T00:00:00Z,,closing_balance,,,,USD,100.00\n"
+	if string(got) != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestLinesMustAddUp(t *testing.T) {
+	s, transactions := fixture()
+	s.ClosingBalance = usd(0)
+
+	var buf bytes.Buffer
+	err := Write(context.Background(), &buf, s, func(fn func(*models.Transaction) error) error {
+		for i := range transactions {
+			if err := fn(&transactions[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		t.Fatal("statement whose lines do not add up to the closing balance was accepted")
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	s, _ := fixture()
+	s.Format = "pdf"
+	err := Write(context.Background(), &bytes.Buffer{}, s, func(func(*models.Transaction) error) error { return nil })
+	if !errors.Is(err, models.ErrInvalidStatement) {
+		t.Fatalf("got %v, want ErrInvalidStatement", err)
+	}
+}
@@ -0,0 +1,91 @@
+package statement
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/pkg/money"
+)
+
+const textTime = "2006-01-02 15:04:05 UTC"
+
+// textLine lays out the columns of a plain text statement. Long references
+// and descriptions are clipped so the columns stay aligned.
+const textLine = "%-19s  %-10s  %-16s  %-30s  %14s  %14s\n"
+
+// textWriter writes a statement to be read or printed as is. Memo lines
+// read "memo" in the balance column and are counted apart from the totals.
+type textWriter struct {
+	w       io.Writer
+	credits money.Money
+	debits  money.Money
+	count   int
+	memos   int
+}
+
+func (t *textWriter) begin(s *models.Statement) error {
+	currency := s.Account.Currency()
+	t.credits, t.debits = money.Zero(currency), money.Zero(currency)
+
+	_, err := fmt.Fprintf(t.w, "ACCOUNT STATEMENT\n\n"+
+		"Account:   %s\n"+
+		"Currency:  %s\n"+
+		"Period:    %s to %s\n"+
+		"Created:   %s\n\n",
+		s.Account.AccountNumber, currency,
+		s.From.UTC().Format(textTime), s.To.UTC().Format(textTime),
+		s.CreatedAt.UTC().Format(textTime))
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(t.w, textLine, "Date", "Type", "Reference", "Description", "Amount", "Balance"); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(t.w, textLine, s.From.UTC().Format(time.DateTime), "", "", "Opening balance", "", s.OpeningBalance)
+	return err
+}
+
+func (t *textWriter) line(tx *models.Transaction, balance money.Money) error {
+	if memo(tx) {
+		t.memos++
+		_, err := fmt.Fprintf(t.w, textLine,
+			tx.CreatedAt.UTC().Format(time.DateTime), tx.Type,
+			clip(tx.Reference, 16), clip(tx.Description, 30),
+			tx.Amount, "memo")
+		return err
+	}
+
+	var err error
+	if tx.Amount.IsNegative() {
+		t.debits, err = t.debits.Add(tx.Amount.Neg())
+	} else {
+		t.credits, err = t.credits.Add(tx.Amount)
+	}
+	if err != nil {
+		return err
+	}
+	t.count++
+
+	_, err = fmt.Fprintf(t.w, textLine,
+		tx.CreatedAt.UTC().Format(time.DateTime), tx.Type,
+		clip(tx.Reference, 16), clip(tx.Description, 30),
+		tx.Amount, balance)
+	return err
+}
+
+func (t *textWriter) end(s *models.Statement) error {
+	if _, err := fmt.Fprintf(t.w, textLine, s.To.UTC().Format(time.DateTime), "", "", "Closing balance", "", s.ClosingBalance); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(t.w, "\n%d transactions, %s %s in, %s %s out\n",
+		t.count, t.credits, t.credits.Currency, t.debits, t.debits.Currency); err != nil {
+		return err
+	}
+	if t.memos == 0 {
+		return nil
+	}
+	_, err := fmt.Fprintf(t.w, "Memo lines of imported history, not included in the balance: %d\n", t.memos)
+	return err
+}
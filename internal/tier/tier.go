@@ -0,0 +1,203 @@
+// Package tier defines account tiers and the transfer limits of each one
+package tier
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/pkg/money"
+)
+
+// Windows of the rolling outgoing limits
+const (
+	DailyWindow   = 24 * time.Hour
+	MonthlyWindow = 30 * 24 * time.Hour
+)
+
+// Limits bound the transfers an account sends, in the account's currency.
+// Zero amounts set no limit.
+type Limits struct {
+	MinPerTransaction money.Money
+	MaxPerTransaction money.Money
+	Daily             money.Money
+	Monthly           money.Money
+}
+
+// Spec is how limits are written in a tier file: decimal amounts in the
+// currency they are listed under, left out for no limit
+type Spec struct {
+	MinPerTransaction string `json:"min_per_transaction,omitempty"`
+	MaxPerTransaction string `json:"max_per_transaction,omitempty"`
+	Daily             string `json:"daily,omitempty"`
+	Monthly           string `json:"monthly,omitempty"`
+}
+
+// Catalog holds the tiers accounts can be opened in. Each tier lists limits
+// per currency; accounts in a currency their tier does not list are not
+// limited. A tier file looks like:
+//
+//	{"default": "standard",
+//	 "tiers": {"standard": {"USD": {"max_per_transaction": "10000.00", "daily": "25000.00"}}}}
+type Catalog struct {
+	defaultTier string
+	tiers       map[string]map[money.Currency]Limits
+}
+
+// DefaultCatalog is used when no tier file is configured. It matches
+// config/account-tiers.json.
+var DefaultCatalog = mustCatalog("standard", map[string]map[money.Currency]Spec{
+	"basic": {
+		"USD": {MinPerTransaction: "1.00", MaxPerTransaction: "1000.00", Daily: "2000.00", Monthly: "10000.00"},
+		"EUR": {MinPerTransaction: "1.00", MaxPerTransaction: "1000.00", Daily: "2000.00", Monthly: "10000.00"},
+		"GBP": {MinPerTransaction: "1.00", MaxPerTransaction: "800.00", Daily: "1600.00", Monthly: "8000.00"},
+		"JPY": {MinPerTransaction: "100", MaxPerTransaction: "150000", Daily: "300000", Monthly: "1500000"},
+		"MXN": {MinPerTransaction: "20.00", MaxPerTransaction: "17000.00", Daily: "34000.00", Monthly: "170000.00"},
+		"CLP": {MinPerTransaction: "1000", MaxPerTransaction: "900000", Daily: "1800000", Monthly: "9000000"},
+	},
+	"standard": {
+		"USD": {MinPerTransaction: "0.01", MaxPerTransaction: "10000.00", Daily: "25000.00", Monthly: "100000.00"},
+		"EUR": {MinPerTransaction: "0.01", MaxPerTransaction: "10000.00", Daily: "25000.00", Monthly: "100000.00"},
+		"GBP": {MinPerTransaction: "0.01", MaxPerTransaction: "8000.00", Daily: "20000.00", Monthly: "80000.00"},
+		"JPY": {MinPerTransaction: "1", MaxPerTransaction: "1500000", Daily: "3750000", Monthly: "15000000"},
+		"MXN": {MinPerTransaction: "0.01", MaxPerTransaction: "170000.00", Daily: "425000.00", Monthly: "1700000.00"},
+		"CLP": {MinPerTransaction: "1", MaxPerTransaction: "9000000", Daily: "22500000", Monthly: "90000000"},
+	},
+	"premium": {
+		"USD": {MinPerTransaction: "0.01", MaxPerTransaction: "100000.00", Daily: "250000.00", Monthly: "1000000.00"},
+		"EUR": {MinPerTransaction: "0.01", MaxPerTransaction: "100000.00", Daily: "250000.00", Monthly: "1000000.00"},
+		"GBP": {MinPerTransaction: "0.01", MaxPerTransaction: "80000.00", Daily: "200000.00", Monthly: "800000.00"},
+		"JPY": {MinPerTransaction: "1", MaxPerTransaction: "15000000", Daily: "37500000", Monthly: "150000000"},
+		"MXN": {MinPerTransaction: "0.01", MaxPerTransaction: "1700000.00", Daily: "4250000.00", Monthly: "17000000.00"},
+		"CLP": {MinPerTransaction: "1", MaxPerTransaction: "90000000", Daily: "225000000", Monthly: "900000000"},
+	},
+})
+
+// NewCatalog builds a catalog from the limits of each tier. defaultTier is
+// the tier of accounts opened without one and must be defined.
+func NewCatalog(defaultTier string, tiers map[string]map[money.Currency]Spec) (*Catalog, error) {
+	c := &Catalog{defaultTier: defaultTier, tiers: make(map[string]map[money.Currency]Limits, len(tiers))}
+	for name, currencies := range tiers {
+		if name == "" {
+			return nil, fmt.Errorf("tier names cannot be empty")
+		}
+		limits := make(map[money.Currency]Limits, len(currencies))
+		for code, spec := range currencies {
+			currency, err := money.ParseCurrency(string(code))
+			if err != nil {
+				return nil, fmt.Errorf("tier %q: %w", name, err)
+			}
+			l, err := parseLimits(spec, currency)
+			if err != nil {
+				return nil, fmt.Errorf("tier %q, %s: %w", name, currency, err)
+			}
+			limits[currency] = l
+		}
+		c.tiers[name] = limits
+	}
+	if _, ok := c.tiers[defaultTier]; !ok {
+		return nil, fmt.Errorf("default tier %q is not defined", defaultTier)
+	}
+	return c, nil
+}
+
+func parseLimits(spec Spec, currency money.Currency) (Limits, error) {
+	var l Limits
+	for _, field := range []struct {
+		name  string
+		value string
+		dst   *money.Money
+	}{
+		{"min_per_transaction", spec.MinPerTransaction, &l.MinPerTransaction},
+		{"max_per_transaction", spec.MaxPerTransaction, &l.MaxPerTransaction},
+		{"daily", spec.Daily, &l.Daily},
+		{"monthly", spec.Monthly, &l.Monthly},
+	} {
+		amount, err := money.Decimal(field.value).Money(currency)
+		if err != nil {
+			return l, fmt.Errorf("%s: %w", field.name, err)
+		}
+		if amount.IsNegative() {
+			return l, fmt.Errorf("%s cannot be negative", field.name)
+		}
+		*field.dst = amount
+	}
+	if !l.MaxPerTransaction.IsZero() && l.MinPerTransaction.Minor > l.MaxPerTransaction.Minor {
+		return l, fmt.Errorf("min_per_transaction exceeds max_per_transaction")
+	}
+	return l, nil
+}
+
+func mustCatalog(defaultTier string, tiers map[string]map[money.Currency]Spec) *Catalog {
+	c, err := NewCatalog(defaultTier, tiers)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// LoadFile reads a tier file
+func LoadFile(path string) (*Catalog, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tiers file: %w", err)
+	}
+	var file struct {
+		Default string                             `json:"default"`
+		Tiers   map[string]map[money.Currency]Spec `json:"tiers"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse tiers file: %w", err)
+	}
+	if len(file.Tiers) == 0 {
+		return nil, fmt.Errorf("tiers file %s defines no tiers", path)
+	}
+	return NewCatalog(file.Default, file.Tiers)
+}
+
+// Default returns the tier of accounts opened without one
+func (c *Catalog) Default() string {
+	return c.defaultTier
+}
+
+// Names returns the tiers the catalog defines, sorted
+func (c *Catalog) Names() []string {
+	names := make([]string, 0, len(c.tiers))
+	for name := range c.tiers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Resolve returns the tier an account asking for name is opened in: the
+// default when name is empty, or ErrUnknownTier when it is not defined
+func (c *Catalog) Resolve(name string) (string, error) {
+	if name == "" {
+		return c.defaultTier, nil
+	}
+	if _, ok := c.tiers[name]; !ok {
+		return "", fmt.Errorf("%w: %q", models.ErrUnknownTier, name)
+	}
+	return name, nil
+}
+
+// Limits returns the limits of a tier for accounts in currency
+func (c *Catalog) Limits(name string, currency money.Currency) (Limits, error) {
+	currencies, ok := c.tiers[name]
+	if !ok {
+		return Limits{}, fmt.Errorf("%w: %q", models.ErrUnknownTier, name)
+	}
+	if l, ok := currencies[currency]; ok {
+		return l, nil
+	}
+	return Limits{
+		MinPerTransaction: money.Zero(currency),
+		MaxPerTransaction: money.Zero(currency),
+		Daily:             money.Zero(currency),
+		Monthly:           money.Zero(currency),
+	}, nil
+}
@@ -0,0 +1,74 @@
+package tier
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/tribal/bank-api/internal/models"
+	"github.com/tribal/bank-api/pkg/money"
+)
+
+func TestDefaultCatalogMatchesTiersFile(t *testing.T) {
+	file, err := LoadFile("../../config/account-tiers.json")
+	if err != nil {
+		t.Fatalf("load tiers: %v", err)
+	}
+	if !reflect.DeepEqual(file, DefaultCatalog) {
+		t.Fatalf("config/account-tiers.json and DefaultCatalog differ:\nfile:    %v\ndefault: %v", file, DefaultCatalog)
+	}
+}
+
+func TestCatalog(t *testing.T) {
+	c, err := NewCatalog("standard", map[string]map[money.Currency]Spec{
+		"standard": {"USD": {MinPerTransaction: "1.00", MaxPerTransaction: "500.00", Daily: "1000.00"}},
+		"vip":      {},
+	})
+	if err != nil {
+		t.Fatalf("new catalog: %v", err)
+	}
+
+	if name, err := c.Resolve(""); err != nil || name != "standard" {
+		t.Fatalf("resolve empty tier: got %q, %v", name, err)
+	}
+	if _, err := c.Resolve("gold"); !errors.Is(err, models.ErrUnknownTier) {
+		t.Fatalf("resolve unknown tier: got %v, want ErrUnknownTier", err)
+	}
+
+	limits, err := c.Limits("standard", "USD")
+	if err != nil {
+		t.Fatalf("limits: %v", err)
+	}
+	want := Limits{
+		MinPerTransaction: money.New(100, "USD"),
+		MaxPerTransaction: money.New(50000, "USD"),
+		Daily:             money.New(100000, "USD"),
+		Monthly:           money.Zero("USD"),
+	}
+	if limits != want {
+		t.Fatalf("limits: got %+v, want %+v", limits, want)
+	}
+
+	// Currencies the tier does not list are not limited
+	limits, err = c.Limits("vip", "EUR")
+	if err != nil {
+		t.Fatalf("limits: %v", err)
+	}
+	if !limits.MaxPerTransaction.IsZero() || !limits.Daily.IsZero() || !limits.Monthly.IsZero() {
+		t.Fatalf("unlisted currency: got %+v, want no limits", limits)
+	}
+}
+
+func TestNewCatalogRejectsInvalidLimits(t *testing.T) {
+	for name, tiers := range map[string]map[string]map[money.Currency]Spec{
+		"missing default": {"basic": {}},
+		"negative amount": {"standard": {"USD": {Daily: "-1.00"}}},
+		"min above max":   {"standard": {"USD": {MinPerTransaction: "10.00", MaxPerTransaction: "5.00"}}},
+		"bad currency":    {"standard": {"US": {Daily: "1.00"}}},
+		"bad amount":      {"standard": {"USD": {Daily: "1.001"}}},
+	} {
+		if _, err := NewCatalog("standard", tiers); err == nil {
+			t.Errorf("%s: got no error", name)
+		}
+	}
+}
@@ -1,41 +0,0 @@
--- Initial database schema for bank API
-
-CREATE TABLE IF NOT EXISTS accounts (
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
-    account_number TEXT UNIQUE NOT NULL,
-    balance REAL NOT NULL DEFAULT 0,
-    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    deleted_at DATETIME
-);
-
-CREATE TABLE IF NOT EXISTS transfers (
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
-    from_account_id INTEGER NOT NULL,
-    to_account_id INTEGER NOT NULL,
-    amount REAL NOT NULL,
-    description TEXT,
-    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    deleted_at DATETIME,
-    FOREIGN KEY (from_account_id) REFERENCES accounts(id),
-    FOREIGN KEY (to_account_id) REFERENCES accounts(id)
-);
-
-CREATE TABLE IF NOT EXISTS transactions (
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
-    account_id INTEGER NOT NULL,
-    type TEXT NOT NULL CHECK(type IN ('deposit', 'withdrawal', 'transfer')),
-    amount REAL NOT NULL,
-    reference TEXT,
-    description TEXT,
-    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    deleted_at DATETIME,
-    FOREIGN KEY (account_id) REFERENCES accounts(id)
-);
-
-CREATE INDEX IF NOT EXISTS idx_transactions_account_id ON transactions(account_id);
-CREATE INDEX IF NOT EXISTS idx_accounts_deleted_at ON accounts(deleted_at);
-CREATE INDEX IF NOT EXISTS idx_transfers_deleted_at ON transfers(deleted_at);
-CREATE INDEX IF NOT EXISTS idx_transactions_deleted_at ON transactions(deleted_at);
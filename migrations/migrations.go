@@ -0,0 +1,10 @@
+// Package migrations holds the versioned database schema, one directory per
+// dialect. Each version has a <version>_<name>.up.sql file and may have a
+// matching .down.sql that undoes it. The files are embedded in the service
+// binaries and applied with `<service> migrate up`.
+package migrations
+
+import "embed"
+
+//go:embed sqlite/*.sql postgres/*.sql
+var FS embed.FS
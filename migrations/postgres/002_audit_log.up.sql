@@ -0,0 +1,25 @@
+-- Append-only, hash-chained audit log. The triggers reject any change to
+-- stored entries; tampering that bypasses them is caught by `audit verify`.
+
+CREATE TABLE audit_entries (
+    id BIGSERIAL PRIMARY KEY,
+    sequence BIGINT NOT NULL,
+    action TEXT NOT NULL,
+    entity_type TEXT NOT NULL,
+    entity_id BIGINT NOT NULL,
+    actor TEXT NOT NULL,
+    request_id TEXT,
+    trace_id TEXT,
+    state_before TEXT,
+    state_after TEXT,
+    prev_hash VARCHAR(64),
+    hash VARCHAR(64) NOT NULL,
+    created_at TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX idx_audit_entries_sequence ON audit_entries(sequence);
+CREATE INDEX idx_audit_entries_action ON audit_entries(action);
+CREATE INDEX idx_audit_entity ON audit_entries(entity_type, entity_id);
+
+CREATE FUNCTION audit_entries_append_only() RETURNS trigger LANGUAGE plpgsql AS $$ BEGIN RAISE EXCEPTION 'audit entries are append-only'; END; $$;
+CREATE TRIGGER audit_entries_no_change BEFORE UPDATE OR DELETE ON audit_entries FOR EACH ROW EXECUTE FUNCTION audit_entries_append_only();
+CREATE TRIGGER audit_entries_no_truncate BEFORE TRUNCATE ON audit_entries FOR EACH STATEMENT EXECUTE FUNCTION audit_entries_append_only();
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_accounts_status;
+ALTER TABLE accounts DROP COLUMN status_changed_at;
+ALTER TABLE accounts DROP COLUMN status_reason;
+ALTER TABLE accounts DROP COLUMN status;
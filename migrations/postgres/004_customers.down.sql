@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS account_owners;
+DROP TABLE IF EXISTS customers;
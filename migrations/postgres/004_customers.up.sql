@@ -0,0 +1,23 @@
+-- Customers and the accounts they own. An account with several owners is a
+-- joint account.
+
+CREATE TABLE customers (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    email TEXT NOT NULL,
+    external_id TEXT,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX idx_customers_email ON customers(email);
+CREATE UNIQUE INDEX idx_customers_external_id ON customers(external_id);
+CREATE INDEX idx_customers_deleted_at ON customers(deleted_at);
+
+CREATE TABLE account_owners (
+    account_id BIGINT NOT NULL REFERENCES accounts(id),
+    customer_id BIGINT NOT NULL REFERENCES customers(id),
+    created_at TIMESTAMPTZ,
+    PRIMARY KEY (account_id, customer_id)
+);
+CREATE INDEX idx_account_owners_customer_id ON account_owners(customer_id);
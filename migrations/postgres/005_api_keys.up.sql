@@ -0,0 +1,16 @@
+-- API keys of machine clients. Only the SHA-256 of each key is stored; the
+-- prefix identifies the key without revealing it.
+
+CREATE TABLE api_keys (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    prefix TEXT NOT NULL,
+    hash TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    customer_id BIGINT REFERENCES customers(id),
+    roles TEXT,
+    expires_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX idx_api_keys_prefix ON api_keys(prefix);
@@ -0,0 +1,3 @@
+-- Velocity limits count and sum the recent transfers sent from each account
+
+CREATE INDEX idx_transfers_from_account_created ON transfers(from_account_id, created_at);
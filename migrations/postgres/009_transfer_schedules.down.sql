@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_transfers_schedule_key;
+DROP INDEX IF EXISTS idx_transfers_schedule_id;
+ALTER TABLE transfers DROP COLUMN schedule_key;
+ALTER TABLE transfers DROP COLUMN schedule_id;
+ALTER TABLE transfers DROP COLUMN failure_code;
+DROP TABLE IF EXISTS transfer_schedules;
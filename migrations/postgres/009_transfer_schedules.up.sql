@@ -0,0 +1,39 @@
+-- Scheduled and recurring transfers. Each run of a schedule creates a
+-- transfer tagged with a unique key, so a run is never executed twice.
+-- Schedules created by a customer record who it was, so each run can check
+-- that the customer still owns the source account. Schedules created with
+-- access to every account leave it empty.
+
+CREATE TABLE transfer_schedules (
+    id BIGSERIAL PRIMARY KEY,
+    from_account_id BIGINT NOT NULL,
+    from_account_number TEXT NOT NULL,
+    to_account_number TEXT NOT NULL,
+    amount_minor BIGINT NOT NULL DEFAULT 0,
+    amount_currency VARCHAR(3) NOT NULL DEFAULT 'USD',
+    description TEXT,
+    frequency VARCHAR(20) NOT NULL,
+    every INTEGER NOT NULL DEFAULT 1,
+    start_at TIMESTAMPTZ NOT NULL,
+    end_at TIMESTAMPTZ,
+    status VARCHAR(20) NOT NULL DEFAULT 'active',
+    occurrence INTEGER NOT NULL DEFAULT 0,
+    next_run_at TIMESTAMPTZ NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_run_at TIMESTAMPTZ,
+    last_transfer_id BIGINT,
+    last_error TEXT,
+    locked_until TIMESTAMPTZ,
+    created_by TEXT NOT NULL,
+    customer_id BIGINT,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+CREATE INDEX idx_transfer_schedules_from_account_number ON transfer_schedules(from_account_number);
+CREATE INDEX idx_transfer_schedules_due ON transfer_schedules(status, next_run_at);
+
+ALTER TABLE transfers ADD COLUMN failure_code TEXT;
+ALTER TABLE transfers ADD COLUMN schedule_id BIGINT;
+ALTER TABLE transfers ADD COLUMN schedule_key TEXT;
+CREATE INDEX idx_transfers_schedule_id ON transfers(schedule_id);
+CREATE UNIQUE INDEX idx_transfers_schedule_key ON transfers(schedule_key);
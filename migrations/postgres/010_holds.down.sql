@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_transfers_hold_expires_at;
+ALTER TABLE transfers DROP COLUMN hold_expires_at;
+DROP TABLE IF EXISTS account_holds;
+ALTER TABLE accounts DROP COLUMN held_amount_currency;
+ALTER TABLE accounts DROP COLUMN held_amount_minor;
@@ -0,0 +1,26 @@
+-- Holds reserve part of an account's available balance for debits that are
+-- authorized but not captured yet. held_amount is the sum of the account's
+-- active holds; transfers authorized against a hold expire at
+-- hold_expires_at unless captured or voided first.
+
+ALTER TABLE accounts ADD COLUMN held_amount_minor BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE accounts ADD COLUMN held_amount_currency VARCHAR(3) NOT NULL DEFAULT 'USD';
+UPDATE accounts SET held_amount_currency = balance_currency;
+
+CREATE TABLE account_holds (
+    id BIGSERIAL PRIMARY KEY,
+    account_id BIGINT NOT NULL,
+    key TEXT NOT NULL,
+    amount_minor BIGINT NOT NULL DEFAULT 0,
+    amount_currency VARCHAR(3) NOT NULL DEFAULT 'USD',
+    reference TEXT,
+    description TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'active',
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+CREATE INDEX idx_account_holds_account_id ON account_holds(account_id);
+CREATE UNIQUE INDEX idx_account_holds_key ON account_holds(key);
+
+ALTER TABLE transfers ADD COLUMN hold_expires_at TIMESTAMPTZ;
+CREATE INDEX idx_transfers_hold_expires_at ON transfers(hold_expires_at);
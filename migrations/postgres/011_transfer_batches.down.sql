@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_transfers_batch_id;
+ALTER TABLE transfers DROP COLUMN batch_id;
+DROP TABLE IF EXISTS transfer_batch_items;
+DROP TABLE IF EXISTS transfer_batches;
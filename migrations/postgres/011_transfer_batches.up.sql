@@ -0,0 +1,40 @@
+-- Transfer batches submit many transfers in one request. Each item records
+-- the transfer it created, or why none was created; the summary counts the
+-- items by status, including those whose outcome could not be confirmed and
+-- need attention.
+
+CREATE TABLE transfer_batches (
+    id BIGSERIAL PRIMARY KEY,
+    mode VARCHAR(20) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    summary_total INTEGER NOT NULL DEFAULT 0,
+    summary_succeeded INTEGER NOT NULL DEFAULT 0,
+    summary_pending INTEGER NOT NULL DEFAULT 0,
+    summary_failed INTEGER NOT NULL DEFAULT 0,
+    summary_skipped INTEGER NOT NULL DEFAULT 0,
+    summary_needs_attention INTEGER NOT NULL DEFAULT 0,
+    created_by TEXT NOT NULL,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+CREATE INDEX idx_transfer_batches_status ON transfer_batches(status);
+
+CREATE TABLE transfer_batch_items (
+    id BIGSERIAL PRIMARY KEY,
+    batch_id BIGINT NOT NULL,
+    position INTEGER NOT NULL,
+    from_account_number TEXT NOT NULL,
+    to_account_number TEXT NOT NULL,
+    amount TEXT NOT NULL,
+    description TEXT,
+    status VARCHAR(20) NOT NULL,
+    transfer_id BIGINT,
+    failure_reason TEXT,
+    failure_code TEXT,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+CREATE INDEX idx_transfer_batch_items_batch_id ON transfer_batch_items(batch_id);
+
+ALTER TABLE transfers ADD COLUMN batch_id BIGINT;
+CREATE INDEX idx_transfers_batch_id ON transfers(batch_id);
@@ -0,0 +1,2 @@
+ALTER TABLE transactions DROP COLUMN occurred_at;
+ALTER TABLE transfers DROP COLUMN occurred_at;
@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS outbox_messages;
+DROP TABLE IF EXISTS idempotency_keys;
+DROP TABLE IF EXISTS transactions;
+DROP TABLE IF EXISTS postings;
+DROP TABLE IF EXISTS journal_entries;
+DROP TABLE IF EXISTS transfer_reversals;
+DROP TABLE IF EXISTS transfers;
+DROP TABLE IF EXISTS accounts;
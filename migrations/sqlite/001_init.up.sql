@@ -0,0 +1,134 @@
+-- Baseline schema. Tables and indexes use IF NOT EXISTS so databases created
+-- before versioned migrations (by GORM AutoMigrate) can adopt it.
+
+CREATE TABLE IF NOT EXISTS accounts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    account_number TEXT NOT NULL,
+    balance_minor INTEGER NOT NULL DEFAULT 0,
+    balance_currency TEXT NOT NULL DEFAULT 'USD',
+    version INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME,
+    updated_at DATETIME,
+    deleted_at DATETIME
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_accounts_account_number ON accounts(account_number);
+CREATE INDEX IF NOT EXISTS idx_accounts_deleted_at ON accounts(deleted_at);
+
+CREATE TABLE IF NOT EXISTS transfers (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    from_account_id INTEGER NOT NULL,
+    to_account_id INTEGER NOT NULL,
+    from_account_number TEXT,
+    to_account_number TEXT,
+    amount_minor INTEGER NOT NULL DEFAULT 0,
+    amount_currency TEXT NOT NULL DEFAULT 'USD',
+    credit_amount_minor INTEGER NOT NULL DEFAULT 0,
+    credit_amount_currency TEXT NOT NULL DEFAULT 'USD',
+    fx_rate TEXT,
+    status TEXT,
+    failure_reason TEXT,
+    description TEXT,
+    reversed_amount_minor INTEGER NOT NULL DEFAULT 0,
+    reversed_amount_currency TEXT NOT NULL DEFAULT 'USD',
+    reversed_credit_amount_minor INTEGER NOT NULL DEFAULT 0,
+    reversed_credit_amount_currency TEXT NOT NULL DEFAULT 'USD',
+    reversal_status TEXT,
+    created_at DATETIME,
+    updated_at DATETIME,
+    deleted_at DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_transfers_from_account_number ON transfers(from_account_number);
+CREATE INDEX IF NOT EXISTS idx_transfers_to_account_number ON transfers(to_account_number);
+CREATE INDEX IF NOT EXISTS idx_transfers_status ON transfers(status);
+CREATE INDEX IF NOT EXISTS idx_transfers_deleted_at ON transfers(deleted_at);
+
+CREATE TABLE IF NOT EXISTS transfer_reversals (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    transfer_id INTEGER NOT NULL REFERENCES transfers(id),
+    amount_minor INTEGER NOT NULL DEFAULT 0,
+    amount_currency TEXT NOT NULL DEFAULT 'USD',
+    credit_amount_minor INTEGER NOT NULL DEFAULT 0,
+    credit_amount_currency TEXT NOT NULL DEFAULT 'USD',
+    status TEXT,
+    reason TEXT,
+    failure_reason TEXT,
+    created_at DATETIME,
+    updated_at DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_transfer_reversals_transfer_id ON transfer_reversals(transfer_id);
+CREATE INDEX IF NOT EXISTS idx_transfer_reversals_status ON transfer_reversals(status);
+
+CREATE TABLE IF NOT EXISTS journal_entries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    reference TEXT,
+    description TEXT,
+    created_at DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_journal_entries_reference ON journal_entries(reference);
+
+CREATE TABLE IF NOT EXISTS postings (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    journal_entry_id INTEGER NOT NULL REFERENCES journal_entries(id),
+    account_id INTEGER,
+    system_account TEXT,
+    amount_minor INTEGER NOT NULL DEFAULT 0,
+    amount_currency TEXT NOT NULL DEFAULT 'USD',
+    created_at DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_postings_journal_entry_id ON postings(journal_entry_id);
+CREATE INDEX IF NOT EXISTS idx_postings_account_id ON postings(account_id);
+CREATE INDEX IF NOT EXISTS idx_postings_system_account ON postings(system_account);
+
+CREATE TABLE IF NOT EXISTS transactions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    account_id INTEGER NOT NULL REFERENCES accounts(id),
+    type TEXT NOT NULL,
+    amount_minor INTEGER NOT NULL DEFAULT 0,
+    amount_currency TEXT NOT NULL DEFAULT 'USD',
+    reference TEXT,
+    description TEXT,
+    entry_key TEXT,
+    journal_entry_id INTEGER,
+    created_at DATETIME,
+    updated_at DATETIME,
+    deleted_at DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_transactions_account_id ON transactions(account_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_transactions_entry_key ON transactions(entry_key);
+CREATE INDEX IF NOT EXISTS idx_transactions_journal_entry_id ON transactions(journal_entry_id);
+CREATE INDEX IF NOT EXISTS idx_transactions_deleted_at ON transactions(deleted_at);
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    idempotency_key TEXT NOT NULL,
+    scope TEXT NOT NULL,
+    request_hash TEXT NOT NULL,
+    status_code INTEGER NOT NULL DEFAULT 0,
+    content_type TEXT,
+    response_body BLOB,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME,
+    updated_at DATETIME
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_idempotency_scope_key ON idempotency_keys(idempotency_key, scope);
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
+
+CREATE TABLE IF NOT EXISTS outbox_messages (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    aggregate_type TEXT NOT NULL,
+    aggregate_id INTEGER NOT NULL,
+    type TEXT NOT NULL,
+    payload TEXT,
+    trace_context TEXT,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at DATETIME,
+    locked_until DATETIME,
+    last_error TEXT,
+    processed_at DATETIME,
+    created_at DATETIME,
+    updated_at DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_outbox_aggregate ON outbox_messages(aggregate_type, aggregate_id);
+CREATE INDEX IF NOT EXISTS idx_outbox_messages_status ON outbox_messages(status);
+CREATE INDEX IF NOT EXISTS idx_outbox_messages_next_attempt_at ON outbox_messages(next_attempt_at);
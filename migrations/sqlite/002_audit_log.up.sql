@@ -0,0 +1,24 @@
+-- Append-only, hash-chained audit log. The triggers reject any change to
+-- stored entries; tampering that bypasses them is caught by `audit verify`.
+
+CREATE TABLE audit_entries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    sequence INTEGER NOT NULL,
+    action TEXT NOT NULL,
+    entity_type TEXT NOT NULL,
+    entity_id INTEGER NOT NULL,
+    actor TEXT NOT NULL,
+    request_id TEXT,
+    trace_id TEXT,
+    state_before TEXT,
+    state_after TEXT,
+    prev_hash TEXT,
+    hash TEXT NOT NULL,
+    created_at DATETIME
+);
+CREATE UNIQUE INDEX idx_audit_entries_sequence ON audit_entries(sequence);
+CREATE INDEX idx_audit_entries_action ON audit_entries(action);
+CREATE INDEX idx_audit_entity ON audit_entries(entity_type, entity_id);
+
+CREATE TRIGGER audit_entries_no_update BEFORE UPDATE ON audit_entries BEGIN SELECT RAISE(ABORT, 'audit entries are append-only'); END;
+CREATE TRIGGER audit_entries_no_delete BEFORE DELETE ON audit_entries BEGIN SELECT RAISE(ABORT, 'audit entries are append-only'); END;
@@ -0,0 +1,7 @@
+-- Account lifecycle: active, frozen or closed, with the reason code of the
+-- last transition
+
+ALTER TABLE accounts ADD COLUMN status TEXT NOT NULL DEFAULT 'active';
+ALTER TABLE accounts ADD COLUMN status_reason TEXT;
+ALTER TABLE accounts ADD COLUMN status_changed_at DATETIME;
+CREATE INDEX idx_accounts_status ON accounts(status);
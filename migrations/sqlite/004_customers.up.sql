@@ -0,0 +1,23 @@
+-- Customers and the accounts they own. An account with several owners is a
+-- joint account.
+
+CREATE TABLE customers (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    email TEXT NOT NULL,
+    external_id TEXT,
+    created_at DATETIME,
+    updated_at DATETIME,
+    deleted_at DATETIME
+);
+CREATE UNIQUE INDEX idx_customers_email ON customers(email);
+CREATE UNIQUE INDEX idx_customers_external_id ON customers(external_id);
+CREATE INDEX idx_customers_deleted_at ON customers(deleted_at);
+
+CREATE TABLE account_owners (
+    account_id INTEGER NOT NULL REFERENCES accounts(id),
+    customer_id INTEGER NOT NULL REFERENCES customers(id),
+    created_at DATETIME,
+    PRIMARY KEY (account_id, customer_id)
+);
+CREATE INDEX idx_account_owners_customer_id ON account_owners(customer_id);
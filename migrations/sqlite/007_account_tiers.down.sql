@@ -0,0 +1 @@
+ALTER TABLE accounts DROP COLUMN tier;
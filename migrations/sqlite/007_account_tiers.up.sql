@@ -0,0 +1,3 @@
+-- Account tiers, which set the transfer limits of each account
+
+ALTER TABLE accounts ADD COLUMN tier TEXT NOT NULL DEFAULT 'standard';
@@ -0,0 +1,2 @@
+ALTER TABLE accounts DROP COLUMN overdraft_limit_currency;
+ALTER TABLE accounts DROP COLUMN overdraft_limit_minor;
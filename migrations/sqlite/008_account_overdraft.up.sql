@@ -0,0 +1,6 @@
+-- Overdraft facility: an account can be debited down to minus its overdraft
+-- limit, which is kept in the account's currency
+
+ALTER TABLE accounts ADD COLUMN overdraft_limit_minor INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE accounts ADD COLUMN overdraft_limit_currency TEXT NOT NULL DEFAULT 'USD';
+UPDATE accounts SET overdraft_limit_currency = balance_currency;
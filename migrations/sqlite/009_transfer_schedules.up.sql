@@ -0,0 +1,39 @@
+-- Scheduled and recurring transfers. Each run of a schedule creates a
+-- transfer tagged with a unique key, so a run is never executed twice.
+-- Schedules created by a customer record who it was, so each run can check
+-- that the customer still owns the source account. Schedules created with
+-- access to every account leave it empty.
+
+CREATE TABLE transfer_schedules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    from_account_id INTEGER NOT NULL,
+    from_account_number TEXT NOT NULL,
+    to_account_number TEXT NOT NULL,
+    amount_minor INTEGER NOT NULL DEFAULT 0,
+    amount_currency TEXT NOT NULL DEFAULT 'USD',
+    description TEXT,
+    frequency TEXT NOT NULL,
+    every INTEGER NOT NULL DEFAULT 1,
+    start_at DATETIME NOT NULL,
+    end_at DATETIME,
+    status TEXT NOT NULL DEFAULT 'active',
+    occurrence INTEGER NOT NULL DEFAULT 0,
+    next_run_at DATETIME NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_run_at DATETIME,
+    last_transfer_id INTEGER,
+    last_error TEXT,
+    locked_until DATETIME,
+    created_by TEXT NOT NULL,
+    customer_id INTEGER,
+    created_at DATETIME,
+    updated_at DATETIME
+);
+CREATE INDEX idx_transfer_schedules_from_account_number ON transfer_schedules(from_account_number);
+CREATE INDEX idx_transfer_schedules_due ON transfer_schedules(status, next_run_at);
+
+ALTER TABLE transfers ADD COLUMN failure_code TEXT;
+ALTER TABLE transfers ADD COLUMN schedule_id INTEGER;
+ALTER TABLE transfers ADD COLUMN schedule_key TEXT;
+CREATE INDEX idx_transfers_schedule_id ON transfers(schedule_id);
+CREATE UNIQUE INDEX idx_transfers_schedule_key ON transfers(schedule_key);
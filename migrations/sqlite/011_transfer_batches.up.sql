@@ -0,0 +1,40 @@
+-- Transfer batches submit many transfers in one request. Each item records
+-- the transfer it created, or why none was created; the summary counts the
+-- items by status, including those whose outcome could not be confirmed and
+-- need attention.
+
+CREATE TABLE transfer_batches (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    mode TEXT NOT NULL,
+    status TEXT NOT NULL,
+    summary_total INTEGER NOT NULL DEFAULT 0,
+    summary_succeeded INTEGER NOT NULL DEFAULT 0,
+    summary_pending INTEGER NOT NULL DEFAULT 0,
+    summary_failed INTEGER NOT NULL DEFAULT 0,
+    summary_skipped INTEGER NOT NULL DEFAULT 0,
+    summary_needs_attention INTEGER NOT NULL DEFAULT 0,
+    created_by TEXT NOT NULL,
+    created_at DATETIME,
+    updated_at DATETIME
+);
+CREATE INDEX idx_transfer_batches_status ON transfer_batches(status);
+
+CREATE TABLE transfer_batch_items (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    batch_id INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    from_account_number TEXT NOT NULL,
+    to_account_number TEXT NOT NULL,
+    amount TEXT NOT NULL,
+    description TEXT,
+    status TEXT NOT NULL,
+    transfer_id INTEGER,
+    failure_reason TEXT,
+    failure_code TEXT,
+    created_at DATETIME,
+    updated_at DATETIME
+);
+CREATE INDEX idx_transfer_batch_items_batch_id ON transfer_batch_items(batch_id);
+
+ALTER TABLE transfers ADD COLUMN batch_id INTEGER;
+CREATE INDEX idx_transfers_batch_id ON transfers(batch_id);
@@ -0,0 +1,7 @@
+-- Historical transfers are imported after the fact: occurred_at is when they
+-- took place. Their transactions carry it too and, since the balances loaded
+-- already include them, have no journal entry and are left out of
+-- statements. Live transfers and transactions leave it empty.
+
+ALTER TABLE transfers ADD COLUMN occurred_at DATETIME;
+ALTER TABLE transactions ADD COLUMN occurred_at DATETIME;
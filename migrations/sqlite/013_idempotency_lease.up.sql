@@ -0,0 +1,5 @@
+-- A request holds its idempotency key until locked_until. If it dies before
+-- storing a response, a retry may reclaim the key once the lease has passed
+-- instead of getting 409 until the key expires.
+
+ALTER TABLE idempotency_keys ADD COLUMN locked_until DATETIME;
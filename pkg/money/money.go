@@ -0,0 +1,282 @@
+package money
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Currency is an ISO 4217 currency code
+type Currency string
+
+// DefaultCurrency is used when no currency is specified
+const DefaultCurrency Currency = "USD"
+
+// exponents maps known currencies to their number of minor unit digits.
+// Currencies not listed here use two decimal places.
+var exponents = map[Currency]int{
+	"JPY": 0,
+	"KRW": 0,
+	"CLP": 0,
+	"BHD": 3,
+	"KWD": 3,
+	"JOD": 3,
+}
+
+var (
+	ErrInvalidAmount    = errors.New("invalid amount")
+	ErrTooManyDecimals  = errors.New("amount has too many decimal places for currency")
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+	ErrOverflow         = errors.New("amount overflow")
+	ErrInvalidCurrency  = errors.New("invalid currency code")
+)
+
+// ParseCurrency validates and normalizes a three-letter ISO 4217 code.
+// An empty string yields DefaultCurrency.
+func ParseCurrency(s string) (Currency, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if s == "" {
+		return DefaultCurrency, nil
+	}
+	if len(s) != 3 {
+		return "", fmt.Errorf("%w: %q", ErrInvalidCurrency, s)
+	}
+	for _, r := range s {
+		if r < 'A' || r > 'Z' {
+			return "", fmt.Errorf("%w: %q", ErrInvalidCurrency, s)
+		}
+	}
+	return Currency(s), nil
+}
+
+// Exponent returns the number of minor unit digits of the currency
+func (c Currency) Exponent() int {
+	if exp, ok := exponents[c]; ok {
+		return exp
+	}
+	return 2
+}
+
+// Money is an amount expressed in integer minor units (e.g. cents) of a currency
+type Money struct {
+	Minor    int64    `gorm:"column:minor;not null;default:0"`
+	Currency Currency `gorm:"column:currency;size:3;not null;default:USD"`
+}
+
+// New creates a Money value from minor units
+func New(minor int64, currency Currency) Money {
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	return Money{Minor: minor, Currency: currency}
+}
+
+// Zero returns a zero amount in the given currency
+func Zero(currency Currency) Money {
+	return New(0, currency)
+}
+
+// Parse parses a decimal string such as "12.34" into minor units of the currency.
+// It fails rather than rounds when the string has more decimals than the currency allows.
+func Parse(s string, currency Currency) (Money, error) {
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	exp := currency.Exponent()
+
+	s = strings.TrimSpace(s)
+	negative := false
+	switch {
+	case strings.HasPrefix(s, "-"):
+		negative = true
+		s = s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	if intPart == "" && fracPart == "" {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	if intPart == "" {
+		intPart = "0"
+	}
+	if !isDigits(intPart) || !isDigits(fracPart) {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+
+	fracPart = strings.TrimRight(fracPart, "0")
+	if len(fracPart) > exp {
+		return Money{}, fmt.Errorf("%w: %q (%s allows %d)", ErrTooManyDecimals, s, currency, exp)
+	}
+	fracPart += strings.Repeat("0", exp-len(fracPart))
+
+	minor, err := strconv.ParseInt(intPart+fracPart, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("%w: %q", ErrOverflow, s)
+	}
+	if negative {
+		minor = -minor
+	}
+
+	return Money{Minor: minor, Currency: currency}, nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// String formats the amount as a decimal string without the currency code
+func (m Money) String() string {
+	exp := m.Currency.Exponent()
+	minor := m.Minor
+	sign := ""
+	if minor < 0 {
+		sign = "-"
+	}
+
+	// Work on the unsigned magnitude so math.MinInt64 formats correctly
+	digits := strconv.FormatUint(absUint(minor), 10)
+	if exp == 0 {
+		return sign + digits
+	}
+	if len(digits) <= exp {
+		digits = strings.Repeat("0", exp-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-exp] + "." + digits[len(digits)-exp:]
+}
+
+func absUint(v int64) uint64 {
+	if v < 0 {
+		return uint64(-(v + 1)) + 1
+	}
+	return uint64(v)
+}
+
+// Float64 returns the amount in major units. It is lossy and only meant for
+// reporting (e.g. Prometheus samples), never for arithmetic.
+func (m Money) Float64() float64 {
+	return float64(m.Minor) / math.Pow10(m.Currency.Exponent())
+}
+
+func (m Money) IsZero() bool     { return m.Minor == 0 }
+func (m Money) IsPositive() bool { return m.Minor > 0 }
+func (m Money) IsNegative() bool { return m.Minor < 0 }
+
+// Neg returns the amount with the opposite sign
+func (m Money) Neg() Money {
+	return Money{Minor: -m.Minor, Currency: m.Currency}
+}
+
+// Add returns m + o. Both amounts must share the same currency.
+func (m Money) Add(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+	}
+	sum := m.Minor + o.Minor
+	if (o.Minor > 0 && sum < m.Minor) || (o.Minor < 0 && sum > m.Minor) {
+		return Money{}, ErrOverflow
+	}
+	return Money{Minor: sum, Currency: m.Currency}, nil
+}
+
+// Sub returns m - o. Both amounts must share the same currency.
+func (m Money) Sub(o Money) (Money, error) {
+	if o.Minor == math.MinInt64 {
+		return Money{}, ErrOverflow
+	}
+	return m.Add(o.Neg())
+}
+
+// Cmp compares two amounts of the same currency, returning -1, 0 or 1
+func (m Money) Cmp(o Money) (int, error) {
+	if m.Currency != o.Currency {
+		return 0, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+	}
+	switch {
+	case m.Minor < o.Minor:
+		return -1, nil
+	case m.Minor > o.Minor:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+type moneyJSON struct {
+	Value    string   `json:"value"`
+	Currency Currency `json:"currency"`
+}
+
+// MarshalJSON encodes the amount as {"value": "12.34", "currency": "USD"}
+func (m Money) MarshalJSON() ([]byte, error) {
+	currency := m.Currency
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	return json.Marshal(moneyJSON{Value: New(m.Minor, currency).String(), Currency: currency})
+}
+
+// UnmarshalJSON decodes the object form produced by MarshalJSON
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var v moneyJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	parsed, err := Parse(v.Value, v.Currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Decimal is a decimal amount as received from clients, before it is bound to
+// a currency. It accepts both JSON strings ("12.34") and JSON numbers (12.34);
+// numbers are read from their literal text so no float rounding takes place.
+type Decimal string
+
+// UnmarshalJSON keeps the literal decimal text of a JSON string or number
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		*d = ""
+		return nil
+	}
+
+	var s string
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+	} else {
+		var n json.Number
+		if err := json.Unmarshal(data, &n); err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidAmount, data)
+		}
+		s = n.String()
+	}
+
+	if strings.ContainsAny(s, "eE") {
+		return fmt.Errorf("%w: exponent notation is not supported: %s", ErrInvalidAmount, s)
+	}
+	*d = Decimal(s)
+	return nil
+}
+
+// Money binds the decimal to a currency, converting it to minor units.
+// An empty decimal is treated as zero.
+func (d Decimal) Money(currency Currency) (Money, error) {
+	if d == "" {
+		return Zero(currency), nil
+	}
+	return Parse(string(d), currency)
+}
@@ -0,0 +1,187 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in       string
+		currency Currency
+		want     int64
+		err      error
+	}{
+		{"12.34", "USD", 1234, nil},
+		{"  12.3 ", "USD", 1230, nil},
+		{"12", "USD", 1200, nil},
+		{".5", "USD", 50, nil},
+		{"5.", "USD", 500, nil},
+		{"+7.01", "USD", 701, nil},
+		{"-7.01", "USD", -701, nil},
+		{"1.2300", "USD", 123, nil},
+		{"0", "USD", 0, nil},
+		{"1234", "JPY", 1234, nil},
+		{"1.234", "KWD", 1234, nil},
+		{"12.345", "USD", 0, ErrTooManyDecimals},
+		{"1.5", "JPY", 0, ErrTooManyDecimals},
+		{"1.2345", "KWD", 0, ErrTooManyDecimals},
+		{"", "USD", 0, ErrInvalidAmount},
+		{"-", "USD", 0, ErrInvalidAmount},
+		{".", "USD", 0, ErrInvalidAmount},
+		{"1e3", "USD", 0, ErrInvalidAmount},
+		{"1,000.00", "USD", 0, ErrInvalidAmount},
+		{"--1", "USD", 0, ErrInvalidAmount},
+		{"1.2.3", "USD", 0, ErrInvalidAmount},
+		{"abc", "USD", 0, ErrInvalidAmount},
+		{"92233720368547758.08", "USD", 0, ErrOverflow},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in, tt.currency)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Parse(%q, %s): got %v, want %v", tt.in, tt.currency, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != New(tt.want, tt.currency) {
+			t.Errorf("Parse(%q, %s): got %v, %v, want %d minor units", tt.in, tt.currency, got, err, tt.want)
+		}
+	}
+
+	if got, err := Parse("1.00", ""); err != nil || got.Currency != DefaultCurrency {
+		t.Errorf("Parse without currency: got %v, %v, want %s", got, err, DefaultCurrency)
+	}
+}
+
+func TestDecimalUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Decimal
+		err  error
+	}{
+		{`"12.34"`, "12.34", nil},
+		{`12.34`, "12.34", nil},
+		{`-0.10`, "-0.10", nil},
+		{`0.1000000000000000055511151231257827`, "0.1000000000000000055511151231257827", nil},
+		{`null`, "", nil},
+		{`""`, "", nil},
+		{`1e3`, "", ErrInvalidAmount},
+		{`"1E3"`, "", ErrInvalidAmount},
+		{`true`, "", ErrInvalidAmount},
+	}
+	for _, tt := range tests {
+		var d Decimal
+		err := json.Unmarshal([]byte(tt.in), &d)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("unmarshal %s: got %v, want %v", tt.in, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || d != tt.want {
+			t.Errorf("unmarshal %s: got %q, %v, want %q", tt.in, d, err, tt.want)
+		}
+	}
+
+	// Decimals keep their text, so the currency decides whether they fit
+	if _, err := Decimal("0.125").Money("USD"); !errors.Is(err, ErrTooManyDecimals) {
+		t.Errorf("0.125 USD: got %v, want ErrTooManyDecimals", err)
+	}
+	if m, err := Decimal("").Money("EUR"); err != nil || m != Zero("EUR") {
+		t.Errorf("empty decimal: got %v, %v, want zero", m, err)
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		m    Money
+		want string
+	}{
+		{New(1234, "USD"), "12.34"},
+		{New(-5, "USD"), "-0.05"},
+		{New(0, "USD"), "0.00"},
+		{New(7, "KWD"), "0.007"},
+		{New(-1500, "JPY"), "-1500"},
+		{New(math.MaxInt64, "USD"), "92233720368547758.07"},
+		{New(math.MinInt64, "USD"), "-92233720368547758.08"},
+		{New(math.MinInt64, "JPY"), "-9223372036854775808"},
+	}
+	for _, tt := range tests {
+		if got := tt.m.String(); got != tt.want {
+			t.Errorf("String(%d %s): got %q, want %q", tt.m.Minor, tt.m.Currency, got, tt.want)
+		}
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	usd := func(minor int64) Money { return New(minor, "USD") }
+
+	if sum, err := usd(150).Add(usd(-200)); err != nil || sum != usd(-50) {
+		t.Errorf("add: got %v, %v, want -0.50", sum, err)
+	}
+	if diff, err := usd(150).Sub(usd(200)); err != nil || diff != usd(-50) {
+		t.Errorf("sub: got %v, %v, want -0.50", diff, err)
+	}
+
+	overflows := []struct {
+		name string
+		fn   func() (Money, error)
+	}{
+		{"add past max", func() (Money, error) { return usd(math.MaxInt64).Add(usd(1)) }},
+		{"add past min", func() (Money, error) { return usd(math.MinInt64).Add(usd(-1)) }},
+		{"sub past max", func() (Money, error) { return usd(math.MaxInt64).Sub(usd(-1)) }},
+		{"sub past min", func() (Money, error) { return usd(math.MinInt64 + 1).Sub(usd(2)) }},
+		{"sub min", func() (Money, error) { return usd(0).Sub(usd(math.MinInt64)) }},
+	}
+	for _, tt := range overflows {
+		if _, err := tt.fn(); !errors.Is(err, ErrOverflow) {
+			t.Errorf("%s: got %v, want ErrOverflow", tt.name, err)
+		}
+	}
+
+	eur := New(100, "EUR")
+	if _, err := usd(100).Add(eur); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("add across currencies: got %v, want ErrCurrencyMismatch", err)
+	}
+	if _, err := usd(100).Sub(eur); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("sub across currencies: got %v, want ErrCurrencyMismatch", err)
+	}
+	if _, err := usd(100).Cmp(eur); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("cmp across currencies: got %v, want ErrCurrencyMismatch", err)
+	}
+	if c, err := usd(100).Cmp(usd(99)); err != nil || c != 1 {
+		t.Errorf("cmp: got %d, %v, want 1", c, err)
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	data, err := json.Marshal(New(-1050, "EUR"))
+	if err != nil || string(data) != `{"value":"-10.50","currency":"EUR"}` {
+		t.Fatalf("marshal: got %s, %v", data, err)
+	}
+
+	var m Money
+	if err := json.Unmarshal(data, &m); err != nil || m != New(-1050, "EUR") {
+		t.Fatalf("unmarshal: got %v, %v", m, err)
+	}
+	if err := json.Unmarshal([]byte(`{"value":"1.001","currency":"USD"}`), &m); !errors.Is(err, ErrTooManyDecimals) {
+		t.Fatalf("unmarshal with too many decimals: got %v, want ErrTooManyDecimals", err)
+	}
+}
+
+func TestParseCurrency(t *testing.T) {
+	if c, err := ParseCurrency(" eur "); err != nil || c != "EUR" {
+		t.Errorf("eur: got %q, %v", c, err)
+	}
+	if c, err := ParseCurrency(""); err != nil || c != DefaultCurrency {
+		t.Errorf("empty: got %q, %v", c, err)
+	}
+	for _, in := range []string{"EU", "EURO", "E1R"} {
+		if _, err := ParseCurrency(in); !errors.Is(err, ErrInvalidCurrency) {
+			t.Errorf("%q: got %v, want ErrInvalidCurrency", in, err)
+		}
+	}
+}
@@ -125,6 +125,19 @@ func (l *LokiLogger) sendToLoki(level, msg string) error {
 	return nil
 }
 
+// logFieldsKey holds the extra fields of the request log in the gin context
+const logFieldsKey = "telemetry.log_fields"
+
+// LogField adds a field to the log entry GinMiddleware writes for the request
+func LogField(c *gin.Context, key string, value interface{}) {
+	fields := c.GetStringMap(logFieldsKey)
+	if fields == nil {
+		fields = make(map[string]interface{})
+		c.Set(logFieldsKey, fields)
+	}
+	fields[key] = value
+}
+
 // GinMiddleware returns a gin middleware that logs requests to Loki
 func (l *LokiLogger) GinMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -159,6 +172,9 @@ func (l *LokiLogger) GinMiddleware() gin.HandlerFunc {
 			"error":      errorMessage,
 			"msg":        "http_request",
 		}
+		for key, value := range c.GetStringMap(logFieldsKey) {
+			logEntry[key] = value
+		}
 
 		// Log to stdout for debugging
 		if statusCode >= 500 {
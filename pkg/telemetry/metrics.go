@@ -8,6 +8,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/tribal/bank-api/pkg/money"
 )
 
 var (
@@ -60,22 +61,142 @@ var (
 			Name: "bank_transfers_total",
 			Help: "Total number of transfers processed",
 		},
-		[]string{"status"}, // success, failed
+		[]string{"status", "from_currency", "to_currency"}, // status: success, failed, rejected_limit
 	)
 
-	BankTransferAmountTotal = promauto.NewCounter(
+	BankTransferAmountTotal = promauto.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "bank_transfer_amount_total",
-			Help: "Total amount transferred",
+			Help: "Total amount transferred in major units of the currency",
 		},
+		[]string{"currency"},
+	)
+
+	BankTransferReversalsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bank_transfer_reversals_total",
+			Help: "Total number of transfer reversals processed",
+		},
+		[]string{"status", "type", "currency"}, // status: success, failed; type: full, partial
 	)
 
 	BankAccountBalance = promauto.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "bank_account_balance",
-			Help: "Current balance of bank accounts",
+			Help: "Current balance of bank accounts in major units of the currency",
+		},
+		[]string{"account_number", "currency"},
+	)
+
+	BankOverdraftDrawn = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "bank_overdraft_drawn",
+			Help: "Overdraft in use by bank accounts in major units of the currency",
+		},
+		[]string{"account_number", "currency"},
+	)
+
+	BankOverdraftLimit = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "bank_overdraft_limit",
+			Help: "Overdraft limit of bank accounts in major units of the currency",
+		},
+		[]string{"account_number", "currency"},
+	)
+
+	BankAccountTransactionsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bank_account_transactions_total",
+			Help: "Total number of deposits and withdrawals processed",
+		},
+		[]string{"type", "status", "currency"}, // status: success, failed
+	)
+
+	BankAccountTransactionAmountTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bank_account_transaction_amount_total",
+			Help: "Total amount deposited or withdrawn in major units of the currency",
+		},
+		[]string{"type", "currency"},
+	)
+
+	BankLedgerImbalances = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "bank_ledger_imbalances",
+			Help: "Number of ledger imbalances found by the last verification",
+		},
+	)
+
+	// Authorization metrics
+	AuthzDeniedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "authz_denied_total",
+			Help: "Total number of requests denied by the RBAC policy",
+		},
+		[]string{"permission", "check"}, // check: route, service
+	)
+
+	// Rate limiting metrics
+	RateLimitedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_rate_limited_total",
+			Help: "Total number of requests rejected by the rate limiter",
+		},
+		[]string{"method", "endpoint"},
+	)
+
+	// Scheduled transfer metrics
+	BankScheduledTransfersTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bank_scheduled_transfers_total",
+			Help: "Total number of scheduled transfer runs",
+		},
+		[]string{"outcome"}, // outcome: executed, retried, skipped
+	)
+
+	// Two-phase transfer metrics
+	BankTransferHoldsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bank_transfer_holds_total",
+			Help: "Total number of holds of two-phase transfers by outcome",
+		},
+		[]string{"outcome", "currency"}, // outcome: authorized, captured, voided, expired
+	)
+
+	// Saga metrics
+	BankSagaDeadStepsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bank_saga_dead_steps_total",
+			Help: "Total number of saga steps given up on, whose transfer or reversal needs attention",
+		},
+		[]string{"step"},
+	)
+
+	// Imported transfer metrics
+	BankImportedTransfersTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bank_imported_transfers_total",
+			Help: "Total number of historical transfers imported, which move no money",
 		},
-		[]string{"account_number"},
+		[]string{"status", "currency"},
+	)
+
+	// Transfer batch metrics
+	BankTransferBatchesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bank_transfer_batches_total",
+			Help: "Total number of transfer batches by mode and status",
+		},
+		[]string{"mode", "status"},
+	)
+
+	BankTransferBatchItems = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "bank_transfer_batch_items",
+			Help:    "Number of transfers per batch",
+			Buckets: []float64{1, 5, 10, 25, 50, 100, 250, 500},
+		},
+		[]string{"mode"},
 	)
 )
 
@@ -140,16 +261,59 @@ func computeApproximateRequestSize(r *http.Request) int {
 	return s
 }
 
-// RecordTransfer records a transfer metric
-func RecordTransfer(amount float64, success bool) {
+// RecordTransfer records a transfer metric. debit and credit are the amounts
+// leaving the source and reaching the destination account.
+func RecordTransfer(debit, credit money.Money, success bool) {
 	status := "success"
 	if !success {
 		status = "failed"
 	}
-	BankTransfersTotal.WithLabelValues(status).Inc()
+	BankTransfersTotal.WithLabelValues(status, string(debit.Currency), string(credit.Currency)).Inc()
 	
 	if success {
-		BankTransferAmountTotal.Add(amount)
+		BankTransferAmountTotal.WithLabelValues(string(debit.Currency)).Add(debit.Float64())
+	}
+}
+
+// RecordTransferRejected records a transfer refused by a velocity limit
+func RecordTransferRejected(debit, credit money.Money) {
+	BankTransfersTotal.WithLabelValues("rejected_limit", string(debit.Currency), string(credit.Currency)).Inc()
+}
+
+// RecordImportedTransfer records a historical transfer once its saga has
+// booked it or given up
+func RecordImportedTransfer(amount money.Money, success bool) {
+	status := "success"
+	if !success {
+		status = "failed"
+	}
+	BankImportedTransfersTotal.WithLabelValues(status, string(amount.Currency)).Inc()
+}
+
+// RecordTransferReversal records a transfer reversal metric. full tells
+// whether the reversal undid the whole transfer at once.
+func RecordTransferReversal(amount money.Money, full, success bool) {
+	status := "success"
+	if !success {
+		status = "failed"
+	}
+	reversalType := "partial"
+	if full {
+		reversalType = "full"
+	}
+	BankTransferReversalsTotal.WithLabelValues(status, reversalType, string(amount.Currency)).Inc()
+}
+
+// RecordAccountTransaction records a deposit or withdrawal metric
+func RecordAccountTransaction(txType string, amount money.Money, success bool) {
+	status := "success"
+	if !success {
+		status = "failed"
+	}
+	BankAccountTransactionsTotal.WithLabelValues(txType, status, string(amount.Currency)).Inc()
+
+	if success {
+		BankAccountTransactionAmountTotal.WithLabelValues(txType, string(amount.Currency)).Add(amount.Float64())
 	}
 }
 
@@ -159,6 +323,53 @@ func RecordAccountCreation() {
 }
 
 // UpdateAccountBalance updates the balance gauge for an account
-func UpdateAccountBalance(accountNumber string, balance float64) {
-	BankAccountBalance.WithLabelValues(accountNumber).Set(balance)
+func UpdateAccountBalance(accountNumber string, balance money.Money) {
+	BankAccountBalance.WithLabelValues(accountNumber, string(balance.Currency)).Set(balance.Float64())
+}
+
+// UpdateAccountOverdraft updates the overdraft gauges for an account
+func UpdateAccountOverdraft(accountNumber string, limit, drawn money.Money) {
+	BankOverdraftLimit.WithLabelValues(accountNumber, string(limit.Currency)).Set(limit.Float64())
+	BankOverdraftDrawn.WithLabelValues(accountNumber, string(drawn.Currency)).Set(drawn.Float64())
+}
+
+// UpdateLedgerImbalances records the outcome of the last ledger verification
+func UpdateLedgerImbalances(count int) {
+	BankLedgerImbalances.Set(float64(count))
+}
+
+// RecordAuthzDenied records a permission the RBAC policy denied. check tells
+// whether a route or a service method denied it.
+func RecordAuthzDenied(permission, check string) {
+	AuthzDeniedTotal.WithLabelValues(permission, check).Inc()
+}
+
+// RecordRateLimited records a request the rate limiter rejected
+func RecordRateLimited(method, endpoint string) {
+	RateLimitedTotal.WithLabelValues(method, endpoint).Inc()
+}
+
+// RecordScheduledTransfer records the outcome of a run of a transfer
+// schedule: executed, retried or skipped
+func RecordScheduledTransfer(outcome string) {
+	BankScheduledTransfersTotal.WithLabelValues(outcome).Inc()
+}
+
+// RecordTransferHold records a step in the life of the hold of a two-phase
+// transfer: authorized, captured, voided or expired
+func RecordTransferHold(outcome string, amount money.Money) {
+	BankTransferHoldsTotal.WithLabelValues(outcome, string(amount.Currency)).Inc()
+}
+
+// RecordTransferBatch records a processed transfer batch, its status once
+// processed and how many transfers it held
+func RecordTransferBatch(mode, status string, items int) {
+	BankTransferBatchesTotal.WithLabelValues(mode, status).Inc()
+	BankTransferBatchItems.WithLabelValues(mode).Observe(float64(items))
+}
+
+// RecordSagaStepDead records a saga step that was given up on, either after
+// exhausting its retries or because accounts-api rejected a refund or release
+func RecordSagaStepDead(step string) {
+	BankSagaDeadStepsTotal.WithLabelValues(step).Inc()
 }
@@ -31,6 +31,20 @@ echo "☸️  Applying Kubernetes manifests..."
 
 kubectl apply -f k8s/namespace.yaml
 
+# API keys registered by the init containers of both services. They are
+# generated on the first deploy and kept afterwards, so they never live in
+# the repository.
+new_api_key() {
+  echo "bk_$(openssl rand -hex 4)_$(openssl rand -hex 32)"
+}
+if ! kubectl get secret bank-api-keys -n banking-system >/dev/null 2>&1; then
+  echo "🔑 Generating API keys..."
+  kubectl create secret generic bank-api-keys -n banking-system \
+    --from-literal=service-api-key="$(new_api_key)" \
+    --from-literal=admin-api-key="$(new_api_key)" \
+    --dry-run=client -o yaml | kubectl apply -f -
+fi
+
 # Helm repos for LGTM stack (Grafana, Loki, Prometheus, Tempo)
 echo "📦 Adding Helm repos..."
 helm repo add grafana https://grafana.github.io/helm-charts 
@@ -74,6 +88,9 @@ echo "  • Accounts API: http://localhost:30080  (puerto 30080)"
 echo "  • Transfers API: http://localhost:30081  (puerto 30081)"
 echo "  • Grafana:       http://localhost:30300  (puerto 30300, usuario: admin / admin)"
 echo ""
+echo "🔑 API key de administración (scripts/test-api.sh la lee de API_KEY):"
+echo "  export API_KEY=\$(kubectl get secret bank-api-keys -n banking-system -o jsonpath='{.data.admin-api-key}' | base64 -d)"
+echo ""
 echo "🔌 Port-forwards activos. Para detenerlos:"
 echo "  pkill -f 'port-forward.*banking-system'"
 echo ""
@@ -0,0 +1,82 @@
+#!/bin/bash
+
+set -e
+
+# Fires many transfers in parallel from the same account and checks that the
+# account is never overdrawn and the ledger stays balanced.
+# Args: accounts-api URL, transfers-api URL, number of transfers, parallelism
+BASE_URL="${1:-http://localhost:30080}"
+TRANSFERS_URL="${2:-http://localhost:30081}"
+# Every /api route requires credentials: an API key or a JWT bearer token
+API_KEY="${API_KEY:?set API_KEY to an API key registered in both services}"
+TRANSFERS="${3:-100}"
+PARALLEL="${4:-20}"
+
+# The source can only cover a quarter of the transfers
+FUNDS=$((TRANSFERS / 4))
+RUN_ID=$(date +%s%N)
+SRC="STRESS-SRC-$RUN_ID"
+DST="STRESS-DST-$RUN_ID"
+
+echo "🔥 Stress testing concurrent transfers"
+echo "   Accounts:  $BASE_URL"
+echo "   Transfers: $TRANSFERS_URL"
+echo "   $TRANSFERS transfers of 1.00 from an account holding $FUNDS.00 ($PARALLEL in parallel)"
+echo ""
+
+SRC_ID=$(curl -s -H "X-API-Key: $API_KEY" -X POST "$BASE_URL/api/accounts" \
+  -H "Content-Type: application/json" \
+  -d "{\"account_number\": \"$SRC\", \"initial_balance\": \"$FUNDS.00\"}" | jq -r '.id')
+DST_ID=$(curl -s -H "X-API-Key: $API_KEY" -X POST "$BASE_URL/api/accounts" \
+  -H "Content-Type: application/json" \
+  -d "{\"account_number\": \"$DST\", \"initial_balance\": \"0\"}" | jq -r '.id')
+
+seq "$TRANSFERS" | xargs -P "$PARALLEL" -I{} curl -s -H "X-API-Key: $API_KEY" -o /dev/null -w "%{http_code}\n" \
+  -X POST "$TRANSFERS_URL/api/transfers" \
+  -H "Content-Type: application/json" \
+  -d "{\"from_account_number\": \"$SRC\", \"to_account_number\": \"$DST\", \"amount\": \"1.00\", \"description\": \"stress {}\"}" \
+  > /tmp/stress-transfers-$RUN_ID.txt
+
+echo "Responses:"
+sort /tmp/stress-transfers-$RUN_ID.txt | uniq -c
+SUCCEEDED=$(grep -c '^201$' /tmp/stress-transfers-$RUN_ID.txt || true)
+rm -f /tmp/stress-transfers-$RUN_ID.txt
+echo ""
+
+SRC_BALANCE=$(curl -s -H "X-API-Key: $API_KEY" "$BASE_URL/api/accounts/$SRC_ID" | jq -r '.balance.value')
+DST_BALANCE=$(curl -s -H "X-API-Key: $API_KEY" "$BASE_URL/api/accounts/$DST_ID" | jq -r '.balance.value')
+LEDGER=$(curl -s -H "X-API-Key: $API_KEY" "$BASE_URL/api/ledger/verify")
+
+echo "Source balance:      $SRC_BALANCE"
+echo "Destination balance: $DST_BALANCE"
+echo "Completed transfers: $SUCCEEDED"
+echo "Ledger balanced:     $(echo "$LEDGER" | jq -r '.balanced')"
+echo ""
+
+FAILED=0
+if [[ "$SRC_BALANCE" == -* ]]; then
+  echo "❌ Source account was overdrawn"
+  FAILED=1
+fi
+if [ "$SUCCEEDED" -gt "$FUNDS" ]; then
+  echo "❌ More transfers completed than the source could cover"
+  FAILED=1
+fi
+if [ "$DST_BALANCE" != "$SUCCEEDED.00" ]; then
+  echo "❌ Destination balance does not match the completed transfers"
+  FAILED=1
+fi
+if [ "$(jq -n "$SRC_BALANCE + $DST_BALANCE == $FUNDS")" != "true" ]; then
+  echo "❌ Money was created or lost"
+  FAILED=1
+fi
+if [ "$(echo "$LEDGER" | jq -r '.balanced')" != "true" ]; then
+  echo "❌ Ledger is out of balance"
+  echo "$LEDGER" | jq '.'
+  FAILED=1
+fi
+
+if [ "$FAILED" -ne 0 ]; then
+  exit 1
+fi
+echo "✅ No overdraft under parallel load"
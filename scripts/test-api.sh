@@ -6,6 +6,8 @@ set -e
 # Defaults match k8s port-forward (30080 / 30081); use 8080/8081 for local/docker.
 BASE_URL="${1:-http://localhost:30080}"
 TRANSFERS_URL="${2:-http://localhost:30081}"
+# Every /api route requires credentials: an API key or a JWT bearer token
+API_KEY="${API_KEY:?set API_KEY to an API key registered in both services}"
 
 echo "🧪 Testing Bank API"
 echo "   Accounts:  $BASE_URL"
@@ -19,11 +21,11 @@ echo ""
 
 # Create first account
 echo "2️⃣  Creating account ACC001..."
-ACC1=$(curl -s -X POST "$BASE_URL/api/accounts" \
+ACC1=$(curl -s -H "X-API-Key: $API_KEY" -X POST "$BASE_URL/api/accounts" \
   -H "Content-Type: application/json" \
   -d '{
     "account_number": "ACC001",
-    "initial_balance": 1000.0
+    "initial_balance": "1000.00"
   }')
 echo "$ACC1" | jq '.'
 ACC1_ID=$(echo "$ACC1" | jq -r '.id')
@@ -31,11 +33,11 @@ echo ""
 
 # Create second account
 echo "3️⃣  Creating account ACC002..."
-ACC2=$(curl -s -X POST "$BASE_URL/api/accounts" \
+ACC2=$(curl -s -H "X-API-Key: $API_KEY" -X POST "$BASE_URL/api/accounts" \
   -H "Content-Type: application/json" \
   -d '{
     "account_number": "ACC002",
-    "initial_balance": 500.0
+    "initial_balance": "500.00"
   }')
 echo "$ACC2" | jq '.'
 ACC2_ID=$(echo "$ACC2" | jq -r '.id')
@@ -43,29 +45,45 @@ echo ""
 
 # List accounts
 echo "4️⃣  Listing all accounts..."
-curl -s "$BASE_URL/api/accounts" | jq '.'
+curl -s -H "X-API-Key: $API_KEY" "$BASE_URL/api/accounts" | jq '.'
 echo ""
 
 # Make a transfer
 echo "5️⃣  Making transfer from ACC001 to ACC002..."
-TRANSFER=$(curl -s -X POST "$TRANSFERS_URL/api/transfers" \
+TRANSFER=$(curl -s -H "X-API-Key: $API_KEY" -X POST "$TRANSFERS_URL/api/transfers" \
   -H "Content-Type: application/json" \
   -d '{
     "from_account_number": "ACC001",
     "to_account_number": "ACC002",
-    "amount": 250.0,
+    "amount": "250.00",
     "description": "Test transfer"
   }')
 echo "$TRANSFER" | jq '.'
 echo ""
 
+# Deposit and withdraw
+echo "6️⃣  Depositing into and withdrawing from ACC002..."
+curl -s -H "X-API-Key: $API_KEY" -X POST "$BASE_URL/api/accounts/$ACC2_ID/deposits" \
+  -H "Content-Type: application/json" \
+  -d '{
+    "amount": "75.50",
+    "reference": "TEST-DEP"
+  }' | jq '.'
+curl -s -H "X-API-Key: $API_KEY" -X POST "$BASE_URL/api/accounts/$ACC2_ID/withdrawals" \
+  -H "Content-Type: application/json" \
+  -d '{
+    "amount": "25.50",
+    "reference": "TEST-WDR"
+  }' | jq '.'
+echo ""
+
 # Get account transactions
-echo "6️⃣  Getting transactions for ACC001..."
-curl -s "$BASE_URL/api/accounts/$ACC1_ID/transactions" | jq '.'
+echo "7️⃣  Getting transactions for ACC001..."
+curl -s -H "X-API-Key: $API_KEY" "$BASE_URL/api/accounts/$ACC1_ID/transactions" | jq '.'
 echo ""
 
-echo "7️⃣  Getting transactions for ACC002..."
-curl -s "$BASE_URL/api/accounts/$ACC2_ID/transactions" | jq '.'
+echo "8️⃣  Getting transactions for ACC002..."
+curl -s -H "X-API-Key: $API_KEY" "$BASE_URL/api/accounts/$ACC2_ID/transactions" | jq '.'
 echo ""
 
 echo "✅ All tests completed!"